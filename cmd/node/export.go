@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"agent-chain/pkg/blockchain"
+	"agent-chain/pkg/types"
+)
+
+// exportedBlock is a block line of a JSONL chain export
+type exportedBlock struct {
+	Type        string            `json:"type"`
+	BlockHeight int64             `json:"block_height"`
+	BlockHash   string            `json:"block_hash"`
+	Header      types.BlockHeader `json:"header"`
+	TxCount     int               `json:"tx_count"`
+}
+
+// exportedTx is a transaction line of a JSONL chain export
+type exportedTx struct {
+	Type        string            `json:"type"`
+	BlockHeight int64             `json:"block_height"`
+	BlockHash   string            `json:"block_hash"`
+	Index       int               `json:"index"`
+	Transaction types.Transaction `json:"transaction"`
+}
+
+// exportCmd writes the stored chain to a newline-delimited JSON file
+func exportCmd() *cobra.Command {
+	var configFile, format, outFile string
+	var from, to int64
+	var includeTxs bool
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export stored blocks to a JSONL file for offline analysis",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "jsonl" {
+				return fmt.Errorf("unsupported format %q (only jsonl is supported)", format)
+			}
+
+			config, err := loadConfig(configFile)
+			if err != nil {
+				return fmt.Errorf("failed to load config: %v", err)
+			}
+
+			var out io.Writer = os.Stdout
+			if outFile != "" && outFile != "-" {
+				file, err := os.Create(outFile)
+				if err != nil {
+					return fmt.Errorf("failed to create output file: %v", err)
+				}
+				defer file.Close()
+				out = file
+			}
+
+			blocks, txs, err := exportChain(filepath.Join(config.DataDir, "blockchain"), out, from, to, includeTxs)
+			if err != nil {
+				return err
+			}
+
+			if out != os.Stdout {
+				fmt.Printf("Exported %d blocks and %d transactions to %s\n", blocks, txs, outFile)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&configFile, "config", "", "Config file path")
+	cmd.Flags().StringVar(&format, "format", "jsonl", "Output format (jsonl)")
+	cmd.Flags().StringVar(&outFile, "out", "", "Output file (default stdout)")
+	cmd.Flags().Int64Var(&from, "from", 0, "First block height to export")
+	cmd.Flags().Int64Var(&to, "to", -1, "Last block height to export (default chain tip)")
+	cmd.Flags().BoolVar(&includeTxs, "txs", false, "Also write one line per transaction")
+
+	return cmd
+}
+
+// exportChain streams blocks, and optionally their transactions, from the
+// block store as JSONL records and returns how many of each were written
+func exportChain(dataDir string, out io.Writer, from, to int64, includeTxs bool) (int, int, error) {
+	writer := bufio.NewWriter(out)
+	encoder := json.NewEncoder(writer)
+
+	blocks, txs := 0, 0
+	err := blockchain.ReadStoredBlocks(dataDir, from, to, func(block *types.Block) error {
+		blockHash := "0x" + block.Header.Hash.String()
+		if err := encoder.Encode(exportedBlock{
+			Type:        "block",
+			BlockHeight: block.Header.Height,
+			BlockHash:   blockHash,
+			Header:      block.Header,
+			TxCount:     len(block.Txs),
+		}); err != nil {
+			return err
+		}
+		blocks++
+
+		if !includeTxs {
+			return nil
+		}
+		for i := range block.Txs {
+			if err := encoder.Encode(exportedTx{
+				Type:        "transaction",
+				BlockHeight: block.Header.Height,
+				BlockHash:   blockHash,
+				Index:       i,
+				Transaction: block.Txs[i],
+			}); err != nil {
+				return err
+			}
+			txs++
+		}
+		return nil
+	})
+	if err != nil {
+		return blocks, txs, fmt.Errorf("export failed: %v", err)
+	}
+
+	if err := writer.Flush(); err != nil {
+		return blocks, txs, fmt.Errorf("failed to write export: %v", err)
+	}
+	return blocks, txs, nil
+}
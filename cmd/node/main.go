@@ -2,16 +2,22 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	_ "embed"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sort"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -31,36 +37,220 @@ type Node struct {
 	config     *NodeConfig
 	logger     *logrus.Logger
 	httpServer *http.Server
+	rpcSlots   chan struct{}
+
+	pprofServer *http.Server
 }
 
 type NodeConfig struct {
-	DataDir       string   `mapstructure:"data_dir"`
-	P2PPort       int      `mapstructure:"p2p_port"`
-	RPCPort       int      `mapstructure:"rpc_port"`
-	PrivateKey    string   `mapstructure:"private_key"`
-	BootNodes     []string `mapstructure:"boot_nodes"`
-	IsValidator   bool     `mapstructure:"is_validator"`
-	IsBootstrap   bool     `mapstructure:"is_bootstrap"`
-	EnableDiscovery bool   `mapstructure:"enable_discovery"`
+	DataDir             string                 `mapstructure:"data_dir"`
+	P2PPort             int                    `mapstructure:"p2p_port"`
+	RPCPort             int                    `mapstructure:"rpc_port"`
+	PrivateKey          string                 `mapstructure:"private_key"`
+	BootNodes           []string               `mapstructure:"boot_nodes"`
+	IsValidator         bool                   `mapstructure:"is_validator"`
+	IsBootstrap         bool                   `mapstructure:"is_bootstrap"`
+	EnableDiscovery     bool                   `mapstructure:"enable_discovery"`
+	EnableMDNS          bool                   `mapstructure:"enable_mdns"`
+	MaxBlocksInMemory   int                    `mapstructure:"max_blocks_in_memory"`
+	SnapshotInterval    int64                  `mapstructure:"snapshot_interval"`
+	SnapshotRetention   int                    `mapstructure:"snapshot_retention"`
+	DustThreshold       int64                  `mapstructure:"dust_threshold"`
+	AuditLog            bool                   `mapstructure:"audit_log"`
+	RPCTLSCertFile      string                 `mapstructure:"rpc_tls_cert_file"`
+	RPCTLSKeyFile       string                 `mapstructure:"rpc_tls_key_file"`
+	MaxInFlightRPC      int                    `mapstructure:"max_in_flight_rpc"`
+	EvalWorkers         int                    `mapstructure:"eval_workers"`
+	EvalQueueSize       int                    `mapstructure:"eval_queue_size"`
+	FinalityDepth       int64                  `mapstructure:"finality_depth"`
+	MaxReorgDepth       int64                  `mapstructure:"max_reorg_depth"`
+	GenesisAccounts     []GenesisAccountConfig `mapstructure:"genesis_accounts"`
+	DevnetFunding       bool                   `mapstructure:"devnet_funding"`
+	PrioritizeOwnTxs    bool                   `mapstructure:"prioritize_own_txs"`
+	ProduceEmptyBlocks  bool                   `mapstructure:"produce_empty_blocks"`
+	EmptyBlockInterval  time.Duration          `mapstructure:"empty_block_interval"`
+	MinValidatorStake   int64                  `mapstructure:"min_validator_stake"`
+	MinDelegatorStake   int64                  `mapstructure:"min_delegator_stake"`
+	UnbondingPeriod     int64                  `mapstructure:"unbonding_period"`
+	ValidatorCommission int64                  `mapstructure:"validator_commission"`
+	GasPrice            int64                  `mapstructure:"gas_price"`
+	Decimals            int                    `mapstructure:"decimals"`
+	MaxClockDrift       time.Duration          `mapstructure:"max_clock_drift"`
+	MaxMempoolSize      int                    `mapstructure:"max_mempool_size"`
+	MaxMempoolPerSender int                    `mapstructure:"max_mempool_per_sender"`
+	LogLevel            string                 `mapstructure:"log_level"`
+	LogFormat           string                 `mapstructure:"log_format"`
+	Consensus           string                 `mapstructure:"consensus"`
+	PowDifficulty       int64                  `mapstructure:"pow_difficulty"`
+	PowRetargetInterval int64                  `mapstructure:"pow_retarget_interval"`
+	RPCAuthToken        string                 `mapstructure:"rpc_auth_token"`
+	GenesisFile         string                 `mapstructure:"genesis_file"`
+	DNSSeedPort         int                    `mapstructure:"dns_seed_port"`
+	BlockTime           time.Duration          `mapstructure:"block_time"`
+	PprofAddr           string                 `mapstructure:"pprof_addr"`
+}
+
+// GenesisAccountConfig is an account funded in the genesis state
+type GenesisAccountConfig struct {
+	Address string `mapstructure:"address"`
+	Balance int64  `mapstructure:"balance"`
+}
+
+// Error codes reported for rejected transactions in batch submissions
+const (
+	TxErrInvalidFormat = "invalid_format"
+	TxErrRejected      = "rejected"
+)
+
+// mutatingMethods are the RPC methods that require the bearer token when
+// rpc_auth_token is set; all other methods only read and stay public
+var mutatingMethods = map[string]bool{
+	"submit_transaction":  true,
+	"submit_transactions": true,
+}
+
+// maxBatchSize caps the number of transactions accepted by submit_transactions
+const maxBatchSize = types.DefaultMaxTxPerBlock
+
+// defaultMaxInFlightRPC bounds concurrent RPC requests when not configured
+const defaultMaxInFlightRPC = 256
+
+// maxHeadersPerRequest caps the number of headers returned by get_headers
+const maxHeadersPerRequest = 500
+
+// maxBlocksPerRange caps the window of blocks returned by get_blocks
+const maxBlocksPerRange = 100
+
+// BlockSummary is the compact view of a block returned by get_blocks
+type BlockSummary struct {
+	Height    int64  `json:"height"`
+	Hash      string `json:"hash"`
+	Timestamp int64  `json:"timestamp"`
+	Validator string `json:"validator"`
+	TxCount   int    `json:"tx_count"`
+}
+
+// maxMempoolPage caps the number of entries returned by get_mempool
+const maxMempoolPage = 500
+
+// maxTransactionsPage caps the number of entries returned by get_transactions
+const maxTransactionsPage = 500
+
+// maxAccountsPage caps the number of entries returned by list_accounts
+const maxAccountsPage = 500
+
+// AccountEntry is an account returned by list_accounts
+type AccountEntry struct {
+	Address string `json:"address"`
+	Balance int64  `json:"balance"`
+	Nonce   int64  `json:"nonce"`
+}
+
+// MempoolEntry summarizes a pending transaction for get_mempool
+type MempoolEntry struct {
+	Hash   string `json:"hash"`
+	Type   string `json:"type"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Amount int64  `json:"amount"`
+	Fee    int64  `json:"fee"`
+	Nonce  int64  `json:"nonce"`
+}
+
+// TxSubmitResult reports the outcome of a single transaction in a batch submission
+type TxSubmitResult struct {
+	Index        int    `json:"index"`
+	TxHash       string `json:"tx_hash,omitempty"`
+	Accepted     bool   `json:"accepted"`
+	ErrorCode    string `json:"error_code,omitempty"`
+	ErrorMessage string `json:"error_message,omitempty"`
+}
+
+// nodeOptions holds the command line flags. Flags left unset keep the value
+// from the config file.
+type nodeOptions struct {
+	configFile      string
+	isBootstrap     bool
+	enableDiscovery bool
+	enableMDNS      bool
+	devnetFunding   bool
+	logLevel        string
+	logFormat       string
+	consensusMode   string
+	rpcAuthToken    string
+	exportSnapshot  string
+	importSnapshot  string
+	genesisFile     string
+	blockTime       time.Duration
+	pprofAddr       string
+}
+
+// addFlags binds the options to the command's flags
+func (o *nodeOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.configFile, "config", "", "Config file path")
+	cmd.Flags().BoolVar(&o.isBootstrap, "bootstrap", false, "Run as bootstrap node to help other nodes discover the network")
+	cmd.Flags().BoolVar(&o.enableDiscovery, "discovery", true, "Enable automatic peer discovery")
+	cmd.Flags().BoolVar(&o.enableMDNS, "mdns", false, "Discover peers on the local network via mDNS")
+	cmd.Flags().BoolVar(&o.devnetFunding, "devnet-funding", false, "Fund three throwaway devnet accounts at genesis")
+	cmd.Flags().StringVar(&o.logLevel, "log-level", "", "Log level: trace, debug, info, warn or error (overrides config)")
+	cmd.Flags().StringVar(&o.logFormat, "log-format", "", "Log format: text or json (overrides config)")
+	cmd.Flags().StringVar(&o.consensusMode, "consensus", "", "Block production: instant or pow (overrides config)")
+	cmd.Flags().StringVar(&o.rpcAuthToken, "rpc-auth-token", "", "Bearer token required for RPC methods that submit transactions (overrides config)")
+	cmd.Flags().StringVar(&o.exportSnapshot, "export-snapshot", "", "Write the chain state at the current tip to a file and exit")
+	cmd.Flags().StringVar(&o.importSnapshot, "import-snapshot", "", "Initialize a fresh data dir from a snapshot file before starting")
+	cmd.Flags().StringVar(&o.genesisFile, "genesis", "", "Genesis file defining the network (overrides config; defaults to the built-in devnet)")
+	cmd.Flags().DurationVar(&o.blockTime, "block-time", 0, "Interval between blocks, e.g. 200ms, overriding the genesis block time; for testing (overrides config)")
+	cmd.Flags().StringVar(&o.pprofAddr, "pprof-addr", "", "Serve Go profiling endpoints on this address, e.g. 127.0.0.1:6060; debug only (overrides config)")
+}
+
+// apply overrides the config with the flags that were set
+func (o *nodeOptions) apply(config *NodeConfig) {
+	if o.logLevel != "" {
+		config.LogLevel = o.logLevel
+	}
+	if o.logFormat != "" {
+		config.LogFormat = o.logFormat
+	}
+	config.IsBootstrap = o.isBootstrap
+	config.EnableDiscovery = o.enableDiscovery
+	if o.enableMDNS {
+		config.EnableMDNS = true
+	}
+	if o.devnetFunding {
+		config.DevnetFunding = true
+	}
+	if o.consensusMode != "" {
+		config.Consensus = o.consensusMode
+	}
+	if o.rpcAuthToken != "" {
+		config.RPCAuthToken = o.rpcAuthToken
+	}
+	if o.genesisFile != "" {
+		config.GenesisFile = o.genesisFile
+	}
+	if o.blockTime != 0 {
+		config.BlockTime = o.blockTime
+	}
+	if o.pprofAddr != "" {
+		config.PprofAddr = o.pprofAddr
+	}
 }
 
 func main() {
-	var configFile string
-	var isBootstrap bool
-	var enableDiscovery bool
+	opts := &nodeOptions{}
 
 	var rootCmd = &cobra.Command{
 		Use:   "node",
 		Short: "Agent Chain Node",
 		Long:  "Blockchain node for Agent Chain network",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runNode(configFile, isBootstrap, enableDiscovery)
+			return runNode(opts)
 		},
 	}
+	opts.addFlags(rootCmd)
 
-	rootCmd.Flags().StringVar(&configFile, "config", "", "Config file path")
-	rootCmd.Flags().BoolVar(&isBootstrap, "bootstrap", false, "Run as bootstrap node to help other nodes discover the network")
-	rootCmd.Flags().BoolVar(&enableDiscovery, "discovery", true, "Enable automatic peer discovery")
+	rootCmd.AddCommand(stateDiffCmd())
+	rootCmd.AddCommand(exportCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -68,20 +258,28 @@ func main() {
 	}
 }
 
-func runNode(configFile string, isBootstrap bool, enableDiscovery bool) error {
-	// Setup logger
-	logger := logrus.New()
-	logger.SetLevel(logrus.InfoLevel)
-
+func runNode(opts *nodeOptions) error {
 	// Load configuration
-	config, err := loadConfig(configFile)
+	config, err := loadConfig(opts.configFile)
 	if err != nil {
 		return fmt.Errorf("failed to load config: %v", err)
 	}
 
 	// Override config with command line flags
-	config.IsBootstrap = isBootstrap
-	config.EnableDiscovery = enableDiscovery
+	opts.apply(config)
+
+	// Setup logger; every component logs through this instance
+	logger := logrus.New()
+	if err := configureLogger(logger, config.LogLevel, config.LogFormat); err != nil {
+		return err
+	}
+
+	if config.ValidatorCommission < 0 || config.ValidatorCommission > 100 {
+		return fmt.Errorf("invalid validator commission %d: must be between 0 and 100", config.ValidatorCommission)
+	}
+	if config.Consensus != types.ConsensusInstant && config.Consensus != types.ConsensusPoW {
+		return fmt.Errorf("invalid consensus %q: must be %s or %s", config.Consensus, types.ConsensusInstant, types.ConsensusPoW)
+	}
 
 	// Create data directory
 	if err := os.MkdirAll(config.DataDir, 0755); err != nil {
@@ -95,14 +293,52 @@ func runNode(configFile string, isBootstrap bool, enableDiscovery bool) error {
 	}
 
 	// Create blockchain config
+	genesisSpec, err := loadGenesis(config.GenesisFile)
+	if err != nil {
+		return err
+	}
+	extraAccounts, err := genesisAccounts(config)
+	if err != nil {
+		return err
+	}
+
 	chainConfig := &types.ChainConfig{
-		ChainID:         1,
-		BlockTime:       types.DefaultBlockTime,
-		MaxBlockSize:    types.DefaultMaxBlockSize,
-		MaxTxPerBlock:   types.DefaultMaxTxPerBlock,
-		InitialReward:   types.DefaultInitialReward,
-		RewardDecay:     0.99,
-		GenesisAccounts: createGenesisAccounts(),
+		MaxBlockSize:        types.DefaultMaxBlockSize,
+		MaxTxPerBlock:       types.DefaultMaxTxPerBlock,
+		InitialReward:       types.DefaultInitialReward,
+		RewardDecay:         0.99,
+		MaxBlocksInMemory:   config.MaxBlocksInMemory,
+		SnapshotInterval:    config.SnapshotInterval,
+		SnapshotRetention:   config.SnapshotRetention,
+		DustThreshold:       config.DustThreshold,
+		AuditLog:            config.AuditLog,
+		FinalityDepth:       config.FinalityDepth,
+		MaxReorgDepth:       config.MaxReorgDepth,
+		PrioritizeOwnTxs:    config.PrioritizeOwnTxs,
+		ProduceEmptyBlocks:  config.ProduceEmptyBlocks,
+		EmptyBlockInterval:  config.EmptyBlockInterval,
+		MinValidatorStake:   config.MinValidatorStake,
+		MinDelegatorStake:   config.MinDelegatorStake,
+		UnbondingPeriod:     config.UnbondingPeriod,
+		ValidatorCommission: config.ValidatorCommission,
+		GasPrice:            config.GasPrice,
+		Decimals:            config.Decimals,
+		MaxClockDrift:       config.MaxClockDrift,
+		MaxMempoolSize:      config.MaxMempoolSize,
+		MaxMempoolPerSender: config.MaxMempoolPerSender,
+		Consensus:           config.Consensus,
+		PowDifficulty:       config.PowDifficulty,
+		PowRetargetInterval: config.PowRetargetInterval,
+	}
+	if err := genesisSpec.Apply(chainConfig); err != nil {
+		return err
+	}
+	chainConfig.GenesisAccounts = append(chainConfig.GenesisAccounts, extraAccounts...)
+	if config.BlockTime != 0 {
+		if config.BlockTime < types.MinBlockTime {
+			return fmt.Errorf("invalid block time %v: must be at least %v", config.BlockTime, types.MinBlockTime)
+		}
+		chainConfig.BlockTime = config.BlockTime
 	}
 
 	// Initialize blockchain
@@ -111,14 +347,44 @@ func runNode(configFile string, isBootstrap bool, enableDiscovery bool) error {
 		return fmt.Errorf("failed to create blockchain: %v", err)
 	}
 
+	// A data dir reused with another genesis would follow a chain no peer
+	// shares. Devnet funding draws fresh accounts on every start, so it can
+	// never match and is not checked.
+	if !config.DevnetFunding {
+		if expected := blockchain.GenesisBlock(chainConfig).Header.Hash; bc.GenesisHash() != expected {
+			return fmt.Errorf("data dir was initialized with genesis 0x%s but the configured genesis is 0x%s", bc.GenesisHash(), expected)
+		}
+	}
+	logger.Infof("Genesis hash: 0x%s", bc.GenesisHash())
+
+	if opts.importSnapshot != "" {
+		if err := importSnapshotFile(bc, opts.importSnapshot); err != nil {
+			return fmt.Errorf("failed to import snapshot: %v", err)
+		}
+		logger.Infof("Imported snapshot %s at height %d", opts.importSnapshot, bc.GetHeight())
+	}
+
+	if opts.exportSnapshot != "" {
+		defer bc.Close(context.Background())
+		if err := exportSnapshotFile(bc, opts.exportSnapshot); err != nil {
+			return fmt.Errorf("failed to export snapshot: %v", err)
+		}
+		logger.Infof("Exported snapshot at height %d to %s", bc.GetHeight(), opts.exportSnapshot)
+		return nil
+	}
+
 	// Initialize network
-	net, err := network.NewNetwork(config.P2PPort, logger)
+	net, err := network.NewNetwork(config.P2PPort, config.DataDir, logger)
 	if err != nil {
 		return fmt.Errorf("failed to create network: %v", err)
 	}
 
+	// Peers must prove they follow the same chain before they are heard
+	net.SetChainStatus(chainStatus(bc))
+
 	// Initialize consensus
 	cons := consensus.NewEngine(bc, net, keyPair, chainConfig, logger)
+	cons.SetEvaluator(consensus.NewEvaluator(config.EvalWorkers, config.EvalQueueSize, consensus.CheckPatch, logger))
 
 	// Create node
 	node := &Node{
@@ -152,10 +418,18 @@ func (n *Node) start() error {
 	}
 
 	// Start network with P2P discovery
+	n.network.SetDNSSeedPort(n.config.DNSSeedPort)
 	if err := n.network.Start(); err != nil {
 		return fmt.Errorf("failed to start network: %v", err)
 	}
 
+	// Find peers on the local network
+	if n.config.EnableMDNS {
+		if err := n.network.EnableMDNS(network.MDNSServiceTag); err != nil {
+			return err
+		}
+	}
+
 	// Connect to boot nodes (legacy support)
 	for _, bootNode := range n.config.BootNodes {
 		if err := n.network.ConnectToPeer(bootNode); err != nil {
@@ -168,11 +442,19 @@ func (n *Node) start() error {
 		return fmt.Errorf("failed to start consensus: %v", err)
 	}
 
+	if err := n.registerMetrics(); err != nil {
+		return fmt.Errorf("failed to register metrics: %v", err)
+	}
+
 	// Start RPC server
 	if err := n.startRPCServer(); err != nil {
 		return fmt.Errorf("failed to start RPC server: %v", err)
 	}
 
+	if err := n.startPprofServer(); err != nil {
+		return err
+	}
+
 	// Log discovery stats
 	if n.config.EnableDiscovery {
 		stats := n.network.GetDiscoveryStats()
@@ -189,37 +471,89 @@ func (n *Node) start() error {
 }
 
 func (n *Node) stop() error {
+	// The whole shutdown, including the final disk writes, gets one deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
 	// Stop RPC server
 	if n.httpServer != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
 		n.httpServer.Shutdown(ctx)
 	}
+	if n.pprofServer != nil {
+		n.pprofServer.Shutdown(ctx)
+	}
 
-	// Stop consensus
+	// Stop consensus; this waits for a block in production to be written
 	n.consensus.Stop()
 
-	// Stop network
+	// Stop network so peers can no longer deliver blocks or transactions
 	n.network.Stop()
 
+	// Persist pending transactions for the next start and refuse late writes
+	if err := n.blockchain.Close(ctx); err != nil {
+		n.logger.Errorf("Failed to close blockchain: %v", err)
+	}
+
 	n.logger.Info("Node stopped")
 	return nil
 }
 
-func (n *Node) startRPCServer() error {
+// newRouter returns the routes served on the RPC port
+func (n *Node) newRouter() *mux.Router {
 	router := mux.NewRouter()
 
+	// Every route shares the in-flight cap; an event feed holds its slot for
+	// as long as it stays connected
+	if n.config.MaxInFlightRPC > 0 {
+		n.rpcSlots = make(chan struct{}, n.config.MaxInFlightRPC)
+	}
+	router.Use(n.limitInFlight)
+
 	// RPC endpoints
 	router.HandleFunc("/", n.handleRPC).Methods("POST")
 	router.HandleFunc("/health", n.handleHealth).Methods("GET")
+	router.HandleFunc("/ws", n.handleEvents).Methods("GET")
+	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	n.registerREST(router)
+
+	return router
+}
+
+func (n *Node) startRPCServer() error {
+	router := n.newRouter()
 
 	n.httpServer = &http.Server{
 		Addr:    fmt.Sprintf(":%d", n.config.RPCPort),
 		Handler: router,
 	}
 
+	// Serve over HTTPS when a certificate is configured
+	certFile, keyFile := n.config.RPCTLSCertFile, n.config.RPCTLSKeyFile
+	if (certFile == "") != (keyFile == "") {
+		return fmt.Errorf("both rpc_tls_cert_file and rpc_tls_key_file must be set to enable HTTPS")
+	}
+	useTLS := certFile != ""
+
+	if useTLS {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load RPC TLS certificate: %v", err)
+		}
+		n.httpServer.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+		n.logger.Info("RPC server using HTTPS")
+	}
+
 	go func() {
-		if err := n.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if useTLS {
+			err = n.httpServer.ListenAndServeTLS("", "")
+		} else {
+			err = n.httpServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			n.logger.Errorf("RPC server error: %v", err)
 		}
 	}()
@@ -227,6 +561,38 @@ func (n *Node) startRPCServer() error {
 	return nil
 }
 
+// authorized reports whether a request carries the configured bearer token;
+// without a configured token every request is authorized
+func (n *Node) authorized(r *http.Request) bool {
+	if n.config.RPCAuthToken == "" {
+		return true
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(n.config.RPCAuthToken)) == 1
+}
+
+// limitInFlight is router middleware that sheds requests with 503 once
+// MaxInFlightRPC requests are already being served, so overload degrades
+// gracefully instead of piling up
+func (n *Node) limitInFlight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n.rpcSlots == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		select {
+		case n.rpcSlots <- struct{}{}:
+			defer func() { <-n.rpcSlots }()
+			next.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Server busy, retry later", http.StatusServiceUnavailable)
+		}
+	})
+}
+
 func (n *Node) handleRPC(w http.ResponseWriter, r *http.Request) {
 	var req map[string]interface{}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -240,22 +606,75 @@ func (n *Node) handleRPC(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if mutatingMethods[method] && !n.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	var response interface{}
 	var err error
 
+	start := time.Now()
 	switch method {
 	case "get_height":
 		response = map[string]interface{}{
-			"height": n.blockchain.GetHeight(),
+			"height":           n.blockchain.GetHeight(),
+			"finalized_height": n.blockchain.GetFinalizedHeight(),
 		}
 	case "get_balance":
 		response, err = n.handleGetBalance(req["params"])
+	case "get_account_proof":
+		response, err = n.handleGetAccountProof(req["params"])
 	case "submit_transaction":
 		response, err = n.handleSubmitTransaction(req["params"])
+	case "submit_transactions":
+		response, err = n.handleSubmitTransactions(req["params"])
+	case "get_block":
+		response, err = n.handleGetBlock(req["params"])
+	case "get_blocks":
+		response, err = n.handleGetBlocks(req["params"])
+	case "get_headers":
+		response, err = n.handleGetHeaders(req["params"])
+	case "get_problem":
+		response, err = n.handleGetProblem(req["params"])
+	case "get_stake":
+		response, err = n.handleGetStake(req["params"])
+	case "get_validators":
+		response, err = n.handleGetValidators()
+	case "get_delegations":
+		response, err = n.handleGetDelegations(req["params"])
+	case "get_chain_id":
+		response = map[string]interface{}{
+			"chain_id": n.blockchain.ChainID(),
+			"decimals": n.blockchain.Config().Decimals,
+		}
+	case "get_chain_info":
+		response = n.handleGetChainInfo()
+	case "get_staking_stats":
+		response = n.blockchain.StakingStats()
+	case "get_state":
+		response = n.blockchain.CurrentSnapshot()
+	case "get_mempool":
+		response, err = n.handleGetMempool(req["params"])
+	case "get_peers":
+		response = n.handleGetPeers()
+	case "get_sync_status":
+		response = n.handleGetSyncStatus()
+	case "get_next_proposer":
+		response, err = n.handleGetNextProposer()
+	case "get_transaction":
+		response, err = n.handleGetTransaction(req["params"])
+	case "get_transactions", "get_history":
+		// get_history is kept as an alias for older wallets
+		response, err = n.handleGetTransactions(req["params"])
+	case "list_accounts":
+		response = n.handleListAccounts(req["params"])
 	default:
 		http.Error(w, "Unknown method", http.StatusBadRequest)
 		return
 	}
+	rpcDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -272,32 +691,518 @@ func (n *Node) handleGetBalance(params interface{}) (interface{}, error) {
 		return nil, fmt.Errorf("invalid params")
 	}
 
-	addressStr, ok := paramsMap["address"].(string)
+	address, err := addressParam(paramsMap, "address")
+	if err != nil {
+		return nil, err
+	}
+
+	account := n.blockchain.GetAccount(address)
+
+	return map[string]interface{}{
+		"balance":       account.Balance,
+		"nonce":         account.Nonce,
+		"pending_nonce": n.blockchain.PendingNonce(address),
+	}, nil
+}
+
+func (n *Node) handleGetAccountProof(params interface{}) (interface{}, error) {
+	paramsMap, ok := params.(map[string]interface{})
 	if !ok {
-		return nil, fmt.Errorf("missing address")
+		return nil, fmt.Errorf("invalid params")
 	}
 
-	address, err := crypto.AddressFromString(addressStr)
+	address, err := addressParam(paramsMap, "address")
 	if err != nil {
-		return nil, fmt.Errorf("invalid address: %v", err)
+		return nil, err
 	}
 
-	account := n.blockchain.GetAccount(address)
+	return n.blockchain.GetAccountProof(address)
+}
+
+func (n *Node) handleSubmitTransaction(params interface{}) (interface{}, error) {
+	paramsMap, ok := params.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid params")
+	}
+
+	tx, err := decodeTransaction(paramsMap["transaction"])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := n.consensus.SubmitTransaction(tx); err != nil {
+		return nil, err
+	}
 
 	return map[string]interface{}{
-		"balance": account.Balance,
-		"nonce":   account.Nonce,
+		"tx_hash": "0x" + tx.Hash.String(),
 	}, nil
 }
 
-func (n *Node) handleSubmitTransaction(params interface{}) (interface{}, error) {
-	// In a real implementation, you'd properly deserialize the transaction
-	// For now, return a mock response
+func (n *Node) handleSubmitTransactions(params interface{}) (interface{}, error) {
+	paramsMap, ok := params.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid params")
+	}
+
+	rawTxs, ok := paramsMap["transactions"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("missing transactions")
+	}
+
+	if len(rawTxs) > maxBatchSize {
+		return nil, fmt.Errorf("batch too large: %d exceeds limit of %d", len(rawTxs), maxBatchSize)
+	}
+
+	// Submit each transaction independently so one failure doesn't abort the batch
+	results := make([]TxSubmitResult, len(rawTxs))
+	accepted := 0
+	for i, rawTx := range rawTxs {
+		results[i].Index = i
+
+		tx, err := decodeTransaction(rawTx)
+		if err != nil {
+			results[i].ErrorCode = TxErrInvalidFormat
+			results[i].ErrorMessage = err.Error()
+			continue
+		}
+
+		if err := n.consensus.SubmitTransaction(tx); err != nil {
+			results[i].TxHash = "0x" + tx.CalculateHash().String()
+			results[i].ErrorCode = TxErrRejected
+			results[i].ErrorMessage = err.Error()
+			continue
+		}
+
+		results[i].TxHash = "0x" + tx.Hash.String()
+		results[i].Accepted = true
+		accepted++
+	}
+
+	return map[string]interface{}{
+		"accepted": accepted,
+		"rejected": len(rawTxs) - accepted,
+		"results":  results,
+	}, nil
+}
+
+func (n *Node) handleGetBlock(params interface{}) (interface{}, error) {
+	paramsMap, ok := params.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid params")
+	}
+
+	if hashStr, ok := paramsMap["hash"].(string); ok {
+		hash, err := crypto.HashFromString(hashStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hash: %v", err)
+		}
+		return n.blockchain.GetBlockByHash(hash)
+	}
+
+	if height, ok := paramsMap["height"].(float64); ok {
+		return n.blockchain.GetBlockByHeight(int64(height))
+	}
+
+	return nil, fmt.Errorf("missing height or hash")
+}
+
+func (n *Node) handleGetHeaders(params interface{}) (interface{}, error) {
+	paramsMap, ok := params.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid params")
+	}
+
+	from, ok := paramsMap["from"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("missing from")
+	}
+
+	count := maxHeadersPerRequest
+	if c, ok := paramsMap["count"].(float64); ok && int(c) > 0 && int(c) < count {
+		count = int(c)
+	}
+
+	headers, err := n.blockchain.GetHeaders(int64(from), count)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"headers": headers,
+	}, nil
+}
+
+func (n *Node) handleGetBlocks(params interface{}) (interface{}, error) {
+	paramsMap, ok := params.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid params")
+	}
+
+	from, ok := paramsMap["from"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("missing from")
+	}
+	to, ok := paramsMap["to"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("missing to")
+	}
+
+	if window := int64(to) - int64(from) + 1; window > maxBlocksPerRange {
+		return nil, fmt.Errorf("range of %d blocks exceeds limit of %d", window, maxBlocksPerRange)
+	}
+
+	blocks, err := n.blockchain.GetBlocks(int64(from), int64(to))
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]BlockSummary, 0, len(blocks))
+	for _, block := range blocks {
+		summaries = append(summaries, BlockSummary{
+			Height:    block.Header.Height,
+			Hash:      "0x" + block.Header.Hash.String(),
+			Timestamp: block.Header.Timestamp,
+			Validator: block.Header.Validator.String(),
+			TxCount:   len(block.Txs),
+		})
+	}
+
 	return map[string]interface{}{
-		"tx_hash": "0x1234567890abcdef",
+		"blocks": summaries,
 	}, nil
 }
 
+func (n *Node) handleGetTransaction(params interface{}) (interface{}, error) {
+	paramsMap, ok := params.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid params")
+	}
+
+	hashStr, ok := paramsMap["hash"].(string)
+	if !ok {
+		return nil, fmt.Errorf("missing hash")
+	}
+
+	hash, err := crypto.HashFromString(hashStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hash: %v", err)
+	}
+
+	info, err := n.blockchain.GetTransaction(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Pending {
+		return map[string]interface{}{
+			"status":      "pending",
+			"transaction": info.Transaction,
+		}, nil
+	}
+
+	return map[string]interface{}{
+		"status":       "mined",
+		"transaction":  info.Transaction,
+		"block_height": info.BlockHeight,
+		"block_hash":   "0x" + info.BlockHash.String(),
+		"index":        info.Index,
+		"gas_used":     info.Transaction.GasUsed,
+	}, nil
+}
+
+func (n *Node) handleGetTransactions(params interface{}) (interface{}, error) {
+	paramsMap, ok := params.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid params")
+	}
+
+	address, err := addressParam(paramsMap, "address")
+	if err != nil {
+		return nil, err
+	}
+
+	txType, _ := paramsMap["type"].(string)
+
+	offset := 0
+	if o, ok := paramsMap["offset"].(float64); ok && o > 0 {
+		offset = int(o)
+	}
+	limit := maxTransactionsPage
+	if l, ok := paramsMap["limit"].(float64); ok && int(l) > 0 && int(l) < limit {
+		limit = int(l)
+	}
+
+	infos, total, err := n.blockchain.GetAddressTransactions(address, txType, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	txs := make([]map[string]interface{}, 0, len(infos))
+	for _, info := range infos {
+		txs = append(txs, map[string]interface{}{
+			"transaction":  info.Transaction,
+			"block_height": info.BlockHeight,
+			"block_hash":   "0x" + info.BlockHash.String(),
+			"block_time":   info.BlockTime,
+			"index":        info.Index,
+		})
+	}
+
+	return map[string]interface{}{
+		"total":        total,
+		"offset":       offset,
+		"transactions": txs,
+	}, nil
+}
+
+func (n *Node) handleListAccounts(params interface{}) interface{} {
+	paramsMap, _ := params.(map[string]interface{})
+
+	offset := 0
+	if o, ok := paramsMap["offset"].(float64); ok && o > 0 {
+		offset = int(o)
+	}
+	limit := maxAccountsPage
+	if l, ok := paramsMap["limit"].(float64); ok && int(l) > 0 && int(l) < limit {
+		limit = int(l)
+	}
+
+	// Accounts come back sorted by address, so pages are stable between calls
+	accounts := n.blockchain.SnapshotAccounts()
+	entries := make([]AccountEntry, 0, limit)
+	for i := offset; i < len(accounts) && len(entries) < limit; i++ {
+		entries = append(entries, AccountEntry{
+			Address: accounts[i].Address.String(),
+			Balance: accounts[i].Balance,
+			Nonce:   accounts[i].Nonce,
+		})
+	}
+
+	return map[string]interface{}{
+		"total":    len(accounts),
+		"offset":   offset,
+		"accounts": entries,
+	}
+}
+
+func (n *Node) handleGetMempool(params interface{}) (interface{}, error) {
+	paramsMap, _ := params.(map[string]interface{})
+
+	txs := n.blockchain.GetPendingTransactions()
+	if _, filtered := paramsMap["address"]; filtered {
+		address, err := addressParam(paramsMap, "address")
+		if err != nil {
+			return nil, err
+		}
+		matching := txs[:0]
+		for _, tx := range txs {
+			if tx.From == address || tx.To == address {
+				matching = append(matching, tx)
+			}
+		}
+		txs = matching
+	}
+
+	// The pool is unordered; sort so that pages are stable between calls
+	sort.Slice(txs, func(i, j int) bool {
+		if txs[i].From != txs[j].From {
+			return txs[i].From.String() < txs[j].From.String()
+		}
+		if txs[i].Nonce != txs[j].Nonce {
+			return txs[i].Nonce < txs[j].Nonce
+		}
+		return txs[i].Hash.String() < txs[j].Hash.String()
+	})
+
+	offset := 0
+	if o, ok := paramsMap["offset"].(float64); ok && o > 0 {
+		offset = int(o)
+	}
+	limit := maxMempoolPage
+	if l, ok := paramsMap["limit"].(float64); ok && int(l) > 0 && int(l) < limit {
+		limit = int(l)
+	}
+
+	entries := make([]MempoolEntry, 0, limit)
+	for i := offset; i < len(txs) && len(entries) < limit; i++ {
+		tx := txs[i]
+		entries = append(entries, MempoolEntry{
+			Hash:   "0x" + tx.Hash.String(),
+			Type:   tx.Type,
+			From:   tx.From.String(),
+			To:     tx.To.String(),
+			Amount: tx.Amount,
+			Fee:    tx.Fee,
+			Nonce:  tx.Nonce,
+		})
+	}
+
+	return map[string]interface{}{
+		"total":        len(txs),
+		"offset":       offset,
+		"transactions": entries,
+	}, nil
+}
+
+func (n *Node) handleGetProblem(params interface{}) (interface{}, error) {
+	paramsMap, ok := params.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid params")
+	}
+
+	id, ok := paramsMap["id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("missing id")
+	}
+
+	return n.blockchain.GetProblem(id)
+}
+
+func (n *Node) handleGetStake(params interface{}) (interface{}, error) {
+	paramsMap, ok := params.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid params")
+	}
+
+	addr, err := addressParam(paramsMap, "address")
+	if err != nil {
+		return nil, err
+	}
+
+	return n.blockchain.GetStake(addr)
+}
+
+func (n *Node) handleGetValidators() (interface{}, error) {
+	return map[string]interface{}{
+		"validators": n.blockchain.Validators(),
+	}, nil
+}
+
+func (n *Node) handleGetDelegations(params interface{}) (interface{}, error) {
+	paramsMap, ok := params.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid params")
+	}
+
+	validator, err := addressParam(paramsMap, "validator")
+	if err != nil {
+		return nil, err
+	}
+
+	delegations := n.blockchain.Delegations(validator)
+	var delegated int64
+	for _, delegation := range delegations {
+		delegated += delegation.Amount
+	}
+
+	return map[string]interface{}{
+		"validator":   validator.String(),
+		"commission":  n.blockchain.Config().ValidatorCommission,
+		"delegated":   delegated,
+		"delegations": delegations,
+	}, nil
+}
+
+func (n *Node) handleGetChainInfo() interface{} {
+	config := n.blockchain.Config()
+	return map[string]interface{}{
+		"chain_id":             config.ChainID,
+		"genesis_hash":         "0x" + n.blockchain.GenesisHash().String(),
+		"decimals":             config.Decimals,
+		"gas_price":            config.GasPrice,
+		"block_time":           config.BlockTime.String(),
+		"consensus":            config.Consensus,
+		"max_tx_per_block":     config.MaxTxPerBlock,
+		"finality_depth":       config.FinalityDepth,
+		"max_reorg_depth":      config.MaxReorgDepth,
+		"finalized_height":     n.blockchain.GetFinalizedHeight(),
+		"min_validator_stake":  config.MinValidatorStake,
+		"min_delegator_stake":  config.MinDelegatorStake,
+		"unbonding_period":     config.UnbondingPeriod,
+		"validator_commission": config.ValidatorCommission,
+	}
+}
+
+func (n *Node) handleGetPeers() interface{} {
+	peers := n.network.GetPeers()
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].ID < peers[j].ID
+	})
+
+	return map[string]interface{}{
+		"count": len(peers),
+		"peers": peers,
+	}
+}
+
+// syncLag is how many blocks a node may trail its best peer and still count
+// as caught up, so a block still propagating does not flip the status
+const syncLag = 1
+
+// isSyncing reports whether a node at height current is still catching up
+// with the highest height its peers reported
+func isSyncing(current, highestPeer int64) bool {
+	return highestPeer-current > syncLag
+}
+
+func (n *Node) handleGetSyncStatus() interface{} {
+	current := n.blockchain.GetHeight()
+	highest := n.network.HighestPeerHeight()
+
+	return map[string]interface{}{
+		"current_height":      current,
+		"highest_peer_height": highest,
+		"syncing":             isSyncing(current, highest),
+	}
+}
+
+func (n *Node) handleGetNextProposer() (interface{}, error) {
+	proposer := n.consensus.NextProposer()
+	if proposer == (types.Address{}) {
+		return nil, fmt.Errorf("no proposer scheduled for the next block")
+	}
+
+	return map[string]interface{}{
+		"height":   n.blockchain.GetHeight() + 1,
+		"proposer": proposer.String(),
+	}, nil
+}
+
+// addressParam parses a required address parameter with the shared address parser
+func addressParam(params map[string]interface{}, key string) (types.Address, error) {
+	s, ok := params[key].(string)
+	if !ok {
+		return types.Address{}, fmt.Errorf("missing %s", key)
+	}
+
+	address, err := crypto.AddressFromString(s)
+	if err != nil {
+		return types.Address{}, fmt.Errorf("invalid %s: %v", key, err)
+	}
+
+	return address, nil
+}
+
+// decodeTransaction converts a JSON-RPC transaction param into a Transaction
+func decodeTransaction(raw interface{}) (*types.Transaction, error) {
+	if raw == nil {
+		return nil, fmt.Errorf("missing transaction")
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction: %v", err)
+	}
+
+	var tx types.Transaction
+	if err := json.Unmarshal(data, &tx); err != nil {
+		return nil, fmt.Errorf("invalid transaction: %v", err)
+	}
+
+	return &tx, nil
+}
+
 func (n *Node) handleHealth(w http.ResponseWriter, r *http.Request) {
 	response := map[string]interface{}{
 		"status":    "ok",
@@ -311,13 +1216,55 @@ func (n *Node) handleHealth(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// configureLogger applies the configured level and output format
+func configureLogger(logger *logrus.Logger, level, format string) error {
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("invalid log level: %v", err)
+	}
+	logger.SetLevel(parsed)
+
+	switch format {
+	case "text":
+		logger.SetFormatter(&logrus.TextFormatter{})
+	case "json":
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return fmt.Errorf("invalid log format %q: must be text or json", format)
+	}
+	return nil
+}
+
 func loadConfig(configFile string) (*NodeConfig, error) {
 	config := &NodeConfig{
-		DataDir:     "./data",
-		P2PPort:     9000,
-		RPCPort:     8545,
-		IsValidator: true,
-		BootNodes:   []string{},
+		DataDir:             "./data",
+		P2PPort:             9000,
+		RPCPort:             8545,
+		IsValidator:         true,
+		BootNodes:           []string{},
+		MaxBlocksInMemory:   types.DefaultMaxBlocksInMemory,
+		SnapshotRetention:   types.DefaultSnapshotRetention,
+		MaxInFlightRPC:      defaultMaxInFlightRPC,
+		EvalWorkers:         consensus.DefaultEvalWorkers,
+		EvalQueueSize:       consensus.DefaultEvalQueueSize,
+		FinalityDepth:       types.DefaultFinalityDepth,
+		MaxReorgDepth:       types.DefaultMaxReorgDepth,
+		GasPrice:            types.DefaultGasPrice,
+		Decimals:            types.DefaultDecimals,
+		MaxClockDrift:       types.DefaultMaxClockDrift,
+		ProduceEmptyBlocks:  true,
+		EmptyBlockInterval:  types.DefaultEmptyBlockInterval,
+		MinValidatorStake:   types.DefaultMinValidatorStake,
+		MinDelegatorStake:   types.DefaultMinDelegatorStake,
+		ValidatorCommission: types.DefaultValidatorCommission,
+		MaxMempoolSize:      types.DefaultMaxMempoolSize,
+		MaxMempoolPerSender: types.DefaultMaxMempoolPerSender,
+		LogLevel:            "info",
+		LogFormat:           "text",
+		Consensus:           types.ConsensusInstant,
+		PowDifficulty:       types.DefaultPowDifficulty,
+		PowRetargetInterval: types.DefaultPowRetargetInterval,
+		DNSSeedPort:         network.DefaultSeedPort,
 	}
 
 	if configFile != "" {
@@ -333,26 +1280,102 @@ func loadConfig(configFile string) (*NodeConfig, error) {
 	return config, nil
 }
 
+// loadOrGenerateKeyPair returns the configured key, or the one saved in the
+// data directory so the node keeps its identity across restarts. A key is only
+// generated, and saved readable by the owner alone, when none was saved yet.
 func loadOrGenerateKeyPair(config *NodeConfig) (*crypto.KeyPair, error) {
 	if config.PrivateKey != "" {
 		return crypto.PrivateKeyFromHex(config.PrivateKey)
 	}
 
+	keyFile := filepath.Join(config.DataDir, "node.key")
+	data, err := os.ReadFile(keyFile)
+	if err == nil {
+		keyPair, err := crypto.PrivateKeyFromHex(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid key in %s: %v", keyFile, err)
+		}
+		return keyPair, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %v", keyFile, err)
+	}
+
 	// Generate new key pair
 	keyPair, err := crypto.GenerateKeyPair()
 	if err != nil {
 		return nil, err
 	}
 
-	// Save private key to config file for persistence
-	keyFile := filepath.Join(config.DataDir, "node.key")
-	if err := os.WriteFile(keyFile, []byte(keyPair.PrivateKeyToHex()), 0600); err != nil {
-		return nil, err
+	// Never replace a key another process saved in the meantime
+	f, err := os.OpenFile(keyFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save %s: %v", keyFile, err)
+	}
+	if _, err := f.WriteString(keyPair.PrivateKeyToHex()); err != nil {
+		f.Close()
+		os.Remove(keyFile)
+		return nil, fmt.Errorf("failed to save %s: %v", keyFile, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(keyFile)
+		return nil, fmt.Errorf("failed to save %s: %v", keyFile, err)
 	}
 
 	return keyPair, nil
 }
 
+// chainStatus returns the handshake a node on bc introduces itself with
+func chainStatus(bc *blockchain.Blockchain) func() network.Handshake {
+	return func() network.Handshake {
+		return network.Handshake{
+			ChainID:     bc.ChainID(),
+			GenesisHash: bc.GenesisHash(),
+			Height:      bc.GetHeight(),
+		}
+	}
+}
+
+// devnetGenesis is the genesis used when no genesis file is configured. The
+// keys of its prefunded accounts are published in the README.
+//
+//go:embed devnet_genesis.json
+var devnetGenesis []byte
+
+// loadGenesis reads the genesis file, or the built-in devnet genesis when no
+// file is configured
+func loadGenesis(path string) (*blockchain.Genesis, error) {
+	if path == "" {
+		return blockchain.ParseGenesis(devnetGenesis)
+	}
+	return blockchain.LoadGenesis(path)
+}
+
+// genesisAccounts returns the accounts funded at genesis in addition to those
+// in the genesis file: those listed in the config, plus the throwaway devnet
+// accounts when devnet funding is enabled. Either makes the genesis block
+// differ from that of nodes started from the same genesis file alone.
+func genesisAccounts(config *NodeConfig) ([]types.Account, error) {
+	accounts := make([]types.Account, 0, len(config.GenesisAccounts))
+	for _, entry := range config.GenesisAccounts {
+		address, err := crypto.AddressFromString(entry.Address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid genesis account %q: %v", entry.Address, err)
+		}
+		if entry.Balance <= 0 {
+			return nil, fmt.Errorf("genesis account %s must have a positive balance", address)
+		}
+		accounts = append(accounts, types.Account{Address: address, Balance: entry.Balance})
+	}
+
+	if config.DevnetFunding {
+		accounts = append(accounts, createGenesisAccounts()...)
+	}
+
+	return accounts, nil
+}
+
+// createGenesisAccounts creates devnet accounts whose keys are discarded
 func createGenesisAccounts() []types.Account {
 	// Create some genesis accounts with initial balances
 	accounts := []types.Account{}
@@ -0,0 +1,801 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"agent-chain/pkg/blockchain"
+	"agent-chain/pkg/consensus"
+	"agent-chain/pkg/crypto"
+	"agent-chain/pkg/network"
+	"agent-chain/pkg/types"
+	"agent-chain/pkg/wallet"
+)
+
+// newTestNode returns a node over a fresh chain funding accounts and an
+// unconnected network, with nothing started
+func newTestNode(t *testing.T, accounts ...types.Account) *Node {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	chainConfig := &types.ChainConfig{
+		ChainID:         1,
+		BlockTime:       types.DefaultBlockTime,
+		MaxTxPerBlock:   types.DefaultMaxTxPerBlock,
+		InitialReward:   types.DefaultInitialReward,
+		GenesisTime:     time.Now().Add(-time.Hour).Unix(),
+		GenesisAccounts: accounts,
+	}
+	bc, err := blockchain.NewBlockchain(chainConfig, t.TempDir())
+	if err != nil {
+		t.Fatalf("NewBlockchain: %v", err)
+	}
+	t.Cleanup(func() { bc.Close(context.Background()) })
+
+	net, err := network.NewNetwork(0, t.TempDir(), logger)
+	if err != nil {
+		t.Fatalf("NewNetwork: %v", err)
+	}
+	t.Cleanup(func() { net.Stop() })
+
+	kp, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+
+	return &Node{
+		blockchain: bc,
+		network:    net,
+		consensus:  consensus.NewEngine(bc, net, kp, chainConfig, logger),
+		keyPair:    kp,
+		config:     &NodeConfig{},
+		logger:     logger,
+	}
+}
+
+// postRPC posts a JSON-RPC request to router and returns the recorded response
+func postRPC(t *testing.T, router http.Handler, method string, params interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(map[string]interface{}{"method": method, "params": params})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+	return w
+}
+
+// callRouter posts a JSON-RPC request to router and decodes the result into
+// result
+func callRouter(t *testing.T, router http.Handler, method string, params, result interface{}) {
+	t.Helper()
+	w := postRPC(t, router, method, params)
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s: status %d: %s", method, w.Code, strings.TrimSpace(w.Body.String()))
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), result); err != nil {
+		t.Fatalf("%s: decoding response: %v", method, err)
+	}
+}
+
+// addEmptyBlocks extends the node's chain by count empty blocks signed with
+// its key
+func addEmptyBlocks(t *testing.T, n *Node, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		last := n.blockchain.GetLastBlock()
+		block := &types.Block{
+			Header: types.BlockHeader{
+				Height:     last.Header.Height + 1,
+				PrevHash:   last.Header.Hash,
+				StateRoot:  last.Header.StateRoot,
+				Timestamp:  last.Header.Timestamp + 1,
+				Difficulty: 1,
+				Validator:  n.keyPair.GetAddress(),
+			},
+			Txs: []types.Transaction{},
+		}
+		if err := n.keyPair.SignBlock(block); err != nil {
+			t.Fatalf("SignBlock: %v", err)
+		}
+		if err := n.blockchain.AddBlock(context.Background(), block); err != nil {
+			t.Fatalf("AddBlock #%d: %v", block.Header.Height, err)
+		}
+	}
+}
+
+func TestInFlightLimitCoversEveryRoute(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	n := &Node{config: &NodeConfig{MaxInFlightRPC: 1}, logger: logger}
+	router := n.newRouter()
+
+	requests := []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"method":"get_height"}`)),
+		httptest.NewRequest(http.MethodGet, "/health", nil),
+		httptest.NewRequest(http.MethodGet, "/ws", nil),
+		httptest.NewRequest(http.MethodGet, "/metrics", nil),
+		httptest.NewRequest(http.MethodGet, "/height", nil),
+		httptest.NewRequest(http.MethodGet, "/block/1", nil),
+		httptest.NewRequest(http.MethodGet, "/peers", nil),
+	}
+
+	// Take the only slot, as a slow request would
+	n.rpcSlots <- struct{}{}
+	for _, r := range requests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s %s: got status %d with the limit reached, want 503", r.Method, r.URL.Path, w.Code)
+		}
+	}
+	<-n.rpcSlots
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("/metrics: got status %d with a free slot, want 200", w.Code)
+	}
+	if len(n.rpcSlots) != 0 {
+		t.Error("request did not release its slot")
+	}
+}
+
+func TestLoadOrGenerateKeyPairPersists(t *testing.T) {
+	config := &NodeConfig{DataDir: t.TempDir()}
+	keyFile := filepath.Join(config.DataDir, "node.key")
+
+	first, err := loadOrGenerateKeyPair(config)
+	if err != nil {
+		t.Fatalf("first start: %v", err)
+	}
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatalf("node.key not saved: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("node.key mode = %o, want 600", perm)
+	}
+
+	second, err := loadOrGenerateKeyPair(config)
+	if err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	if second.GetAddress() != first.GetAddress() {
+		t.Errorf("restart changed the node address from %s to %s", first.GetAddress(), second.GetAddress())
+	}
+
+	// A configured key takes precedence over the saved one
+	other, err := loadOrGenerateKeyPair(&NodeConfig{DataDir: config.DataDir, PrivateKey: "01" + strings.Repeat("00", 31)})
+	if err != nil {
+		t.Fatalf("configured key: %v", err)
+	}
+	if other.GetAddress() == first.GetAddress() {
+		t.Error("configured key was ignored")
+	}
+}
+
+func TestLoadOrGenerateKeyPairKeepsCorruptKey(t *testing.T) {
+	config := &NodeConfig{DataDir: t.TempDir()}
+	keyFile := filepath.Join(config.DataDir, "node.key")
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadOrGenerateKeyPair(config); err == nil {
+		t.Fatal("loaded a corrupt node.key")
+	}
+	data, err := os.ReadFile(keyFile)
+	if err != nil || string(data) != "not a key" {
+		t.Errorf("corrupt node.key was replaced: %q, %v", data, err)
+	}
+}
+
+func TestNodeOptionsOverrideConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want func(*NodeConfig) bool
+	}{
+		{"pprof address", []string{"--pprof-addr", "127.0.0.1:6060"}, func(c *NodeConfig) bool {
+			return c.PprofAddr == "127.0.0.1:6060"
+		}},
+		{"pprof from config when unset", nil, func(c *NodeConfig) bool {
+			return c.PprofAddr == "127.0.0.1:7070"
+		}},
+		{"block time", []string{"--block-time", "200ms"}, func(c *NodeConfig) bool {
+			return c.BlockTime == 200*time.Millisecond
+		}},
+		{"consensus and log level", []string{"--consensus", "pow", "--log-level", "debug"}, func(c *NodeConfig) bool {
+			return c.Consensus == "pow" && c.LogLevel == "debug"
+		}},
+		{"discovery off", []string{"--discovery=false"}, func(c *NodeConfig) bool {
+			return !c.EnableDiscovery
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &nodeOptions{}
+			cmd := &cobra.Command{}
+			opts.addFlags(cmd)
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatalf("ParseFlags: %v", err)
+			}
+
+			config := &NodeConfig{PprofAddr: "127.0.0.1:7070", LogLevel: "info", Consensus: "instant"}
+			opts.apply(config)
+			if !tt.want(config) {
+				t.Errorf("unexpected config after %v: %+v", tt.args, config)
+			}
+		})
+	}
+}
+
+func TestGetPeersResponse(t *testing.T) {
+	n := newTestNode(t)
+	router := n.newRouter()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	other, err := network.NewNetwork(0, t.TempDir(), logger)
+	if err != nil {
+		t.Fatalf("NewNetwork: %v", err)
+	}
+	defer other.Stop()
+
+	if err := n.network.ConnectToPeer(other.GetAddresses()[0] + "/p2p/" + other.GetID()); err != nil {
+		t.Fatalf("ConnectToPeer: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for n.network.GetPeerCount() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("peer never showed up")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	var resp struct {
+		Count int                          `json:"count"`
+		Peers []map[string]json.RawMessage `json:"peers"`
+	}
+	callRouter(t, router, "get_peers", nil, &resp)
+
+	if resp.Count != 1 || len(resp.Peers) != 1 {
+		t.Fatalf("count = %d with %d peers, want 1", resp.Count, len(resp.Peers))
+	}
+	peer := resp.Peers[0]
+	for _, field := range []string{"id", "address", "last_seen"} {
+		if _, ok := peer[field]; !ok {
+			t.Errorf("peer entry has no %q field: %v", field, peer)
+		}
+	}
+
+	var id string
+	var lastSeen time.Time
+	if err := json.Unmarshal(peer["id"], &id); err != nil || id != other.GetID() {
+		t.Errorf("id = %s, want %s", peer["id"], other.GetID())
+	}
+	if err := json.Unmarshal(peer["last_seen"], &lastSeen); err != nil || time.Since(lastSeen) > time.Minute {
+		t.Errorf("last_seen = %s, want a recent time", peer["last_seen"])
+	}
+}
+
+func TestIsSyncing(t *testing.T) {
+	tests := []struct {
+		current, highestPeer int64
+		want                 bool
+	}{
+		{0, 0, false},
+		{10, 10, false},
+		{10, 11, false},
+		{10, 12, true},
+		{0, 100, true},
+		{12, 10, false},
+	}
+	for _, tt := range tests {
+		if got := isSyncing(tt.current, tt.highestPeer); got != tt.want {
+			t.Errorf("isSyncing(%d, %d) = %v, want %v", tt.current, tt.highestPeer, got, tt.want)
+		}
+	}
+}
+
+func TestGetSyncStatus(t *testing.T) {
+	n := newTestNode(t)
+	router := n.newRouter()
+	bc := n.blockchain
+	n.network.SetChainStatus(func() network.Handshake {
+		return network.Handshake{ChainID: bc.ChainID(), GenesisHash: bc.GenesisHash(), Height: bc.GetHeight()}
+	})
+
+	// A peer on the same chain that is ten blocks ahead
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	other, err := network.NewNetwork(0, t.TempDir(), logger)
+	if err != nil {
+		t.Fatalf("NewNetwork: %v", err)
+	}
+	defer other.Stop()
+	other.SetChainStatus(func() network.Handshake {
+		return network.Handshake{ChainID: bc.ChainID(), GenesisHash: bc.GenesisHash(), Height: 10}
+	})
+
+	type syncStatus struct {
+		CurrentHeight     int64 `json:"current_height"`
+		HighestPeerHeight int64 `json:"highest_peer_height"`
+		Syncing           bool  `json:"syncing"`
+	}
+	var status syncStatus
+	callRouter(t, router, "get_sync_status", nil, &status)
+	if status != (syncStatus{}) {
+		t.Fatalf("status without peers = %+v, want caught up at 0", status)
+	}
+
+	if err := n.network.ConnectToPeer(other.GetAddresses()[0] + "/p2p/" + other.GetID()); err != nil {
+		t.Fatalf("ConnectToPeer: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for n.network.HighestPeerHeight() != 10 {
+		if time.Now().After(deadline) {
+			t.Fatal("peer height never arrived")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	callRouter(t, router, "get_sync_status", nil, &status)
+	if want := (syncStatus{0, 10, true}); status != want {
+		t.Errorf("status behind the peer = %+v, want %+v", status, want)
+	}
+
+	// One block behind still counts as caught up
+	addEmptyBlocks(t, n, 9)
+	callRouter(t, router, "get_sync_status", nil, &status)
+	if want := (syncStatus{9, 10, false}); status != want {
+		t.Errorf("status one block behind = %+v, want %+v", status, want)
+	}
+}
+
+func TestMismatchedGenesisRefusesToPeer(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	genesisTime := time.Now().Add(-time.Hour).Unix()
+
+	// startPeer runs a network announcing a chain that funds balance at genesis
+	startPeer := func(balance int64) *network.Network {
+		bc, err := blockchain.NewBlockchain(&types.ChainConfig{
+			ChainID:         1,
+			BlockTime:       types.DefaultBlockTime,
+			GenesisTime:     genesisTime,
+			GenesisAccounts: []types.Account{{Address: types.Address{0xa}, Balance: balance}},
+		}, t.TempDir())
+		if err != nil {
+			t.Fatalf("NewBlockchain: %v", err)
+		}
+		t.Cleanup(func() { bc.Close(context.Background()) })
+
+		net, err := network.NewNetwork(0, t.TempDir(), logger)
+		if err != nil {
+			t.Fatalf("NewNetwork: %v", err)
+		}
+		t.Cleanup(func() { net.Stop() })
+		net.SetChainStatus(chainStatus(bc))
+		return net
+	}
+
+	tests := []struct {
+		name    string
+		balance int64
+		peers   bool
+	}{
+		{"same genesis", 1000, true},
+		{"other genesis", 1001, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local, remote := startPeer(1000), startPeer(tt.balance)
+			handshake := make(chan struct{}, 1)
+			local.OnPeerConnected(func(peer.ID) { handshake <- struct{}{} })
+
+			if err := local.ConnectToPeer(remote.GetAddresses()[0] + "/p2p/" + remote.GetID()); err != nil {
+				t.Fatalf("ConnectToPeer: %v", err)
+			}
+
+			select {
+			case <-handshake:
+				if !tt.peers {
+					t.Fatal("handshake completed with a node on another genesis")
+				}
+			case <-time.After(2 * time.Second):
+				if tt.peers {
+					t.Fatal("no handshake with a node on the same genesis")
+				}
+				if local.GetPeerCount() != 0 || remote.GetPeerCount() != 0 {
+					t.Errorf("still connected: %d and %d peers", local.GetPeerCount(), remote.GetPeerCount())
+				}
+			}
+		})
+	}
+}
+
+func TestListAccountsPages(t *testing.T) {
+	var accounts []types.Account
+	for i := 1; i <= 5; i++ {
+		accounts = append(accounts, types.Account{Address: types.Address{byte(6 - i)}, Balance: int64(i * 100)})
+	}
+	n := newTestNode(t, accounts...)
+	router := n.newRouter()
+
+	type page struct {
+		Total    int            `json:"total"`
+		Offset   int            `json:"offset"`
+		Accounts []AccountEntry `json:"accounts"`
+	}
+	var seen []string
+	for offset := 0; offset < 5; offset += 2 {
+		var p page
+		callRouter(t, router, "list_accounts", map[string]interface{}{"offset": offset, "limit": 2}, &p)
+		if p.Total != 5 || p.Offset != offset {
+			t.Fatalf("page at %d: total %d offset %d, want 5 and %d", offset, p.Total, p.Offset, offset)
+		}
+		for _, entry := range p.Accounts {
+			seen = append(seen, entry.Address)
+		}
+	}
+
+	// Pages follow address order and together cover every account once
+	if len(seen) != 5 {
+		t.Fatalf("pages listed %d accounts, want 5", len(seen))
+	}
+	for i := range seen {
+		if want := (types.Address{byte(i + 1)}).String(); seen[i] != want {
+			t.Errorf("entry %d = %s, want %s", i, seen[i], want)
+		}
+	}
+}
+
+func TestGetMempoolListsSubmittedTransactions(t *testing.T) {
+	alice, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+	bob, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+	n := newTestNode(t,
+		types.Account{Address: alice.GetAddress(), Balance: 1000},
+		types.Account{Address: bob.GetAddress(), Balance: 1000},
+	)
+	router := n.newRouter()
+
+	submit := func(from *crypto.KeyPair, to types.Address, amount, nonce int64) string {
+		tx := &types.Transaction{
+			Type:      types.TxTypeTransfer,
+			From:      from.GetAddress(),
+			To:        to,
+			Amount:    amount,
+			Fee:       1,
+			Nonce:     nonce,
+			Timestamp: time.Now().Unix(),
+			ChainID:   1,
+		}
+		if err := from.SignTransaction(tx); err != nil {
+			t.Fatalf("SignTransaction: %v", err)
+		}
+		var resp struct {
+			TxHash string `json:"tx_hash"`
+		}
+		callRouter(t, router, "submit_transaction", map[string]interface{}{"transaction": tx}, &resp)
+		return resp.TxHash
+	}
+
+	carol := types.Address{0xc}
+	hashes := []string{
+		submit(alice, carol, 10, 0),
+		submit(alice, carol, 20, 1),
+		submit(alice, bob.GetAddress(), 30, 2),
+	}
+	fromBob := submit(bob, carol, 40, 0)
+
+	type mempool struct {
+		Total        int            `json:"total"`
+		Transactions []MempoolEntry `json:"transactions"`
+	}
+
+	var all mempool
+	callRouter(t, router, "get_mempool", nil, &all)
+	if all.Total != 4 || len(all.Transactions) != 4 {
+		t.Fatalf("listed %d of %d transactions, want 4", len(all.Transactions), all.Total)
+	}
+
+	var page mempool
+	callRouter(t, router, "get_mempool", map[string]interface{}{
+		"address": alice.GetAddress().String(),
+		"offset":  1,
+		"limit":   1,
+	}, &page)
+	if page.Total != 3 || len(page.Transactions) != 1 {
+		t.Fatalf("alice's second page: %d of %d transactions, want 1 of 3", len(page.Transactions), page.Total)
+	}
+	if entry := page.Transactions[0]; entry.Hash != hashes[1] || entry.Nonce != 1 || entry.Amount != 20 {
+		t.Errorf("alice's second page = %+v, want nonce 1 for 20", entry)
+	}
+
+	// Bob sent one transaction and received another
+	var bobs mempool
+	callRouter(t, router, "get_mempool", map[string]interface{}{"address": bob.GetAddress().String()}, &bobs)
+	if bobs.Total != 2 {
+		t.Fatalf("bob's transactions = %d, want 2", bobs.Total)
+	}
+	seen := map[string]bool{}
+	for _, entry := range bobs.Transactions {
+		seen[entry.Hash] = true
+	}
+	if !seen[fromBob] || !seen[hashes[2]] {
+		t.Errorf("bob's listing %+v misses a transaction", bobs.Transactions)
+	}
+}
+
+func TestBinaryPatchRecoveredByteExact(t *testing.T) {
+	alice, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+	n := newTestNode(t, types.Account{Address: alice.GetAddress(), Balance: 1_000_000_000})
+	server := httptest.NewServer(n.newRouter())
+	t.Cleanup(server.Close)
+
+	// Every byte value, so nothing survives by being valid UTF-8
+	blob := make([]byte, 512)
+	for i := range blob {
+		blob[i] = byte(i)
+	}
+	patchFile := filepath.Join(t.TempDir(), "patch.bin")
+	if err := os.WriteFile(patchFile, blob, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	w := wallet.NewWallet(t.TempDir(), server.URL)
+	if _, err := w.ImportAccount("alice", alice.PrivateKeyToHex(), false); err != nil {
+		t.Fatalf("ImportAccount: %v", err)
+	}
+	if err := w.LoadAccount("alice"); err != nil {
+		t.Fatalf("LoadAccount: %v", err)
+	}
+	txHash, err := w.SubmitPatch(patchFile, "", types.DefaultPatchGasLimit)
+	if err != nil {
+		t.Fatalf("SubmitPatch: %v", err)
+	}
+
+	var pooled *types.Transaction
+	for _, tx := range n.blockchain.GetPendingTransactions() {
+		if "0x"+tx.Hash.String() == txHash {
+			pooled = tx
+		}
+	}
+	if pooled == nil || pooled.PatchSet == nil {
+		t.Fatalf("patch %s is not in the node's mempool", txHash)
+	}
+	if pooled.PatchSet.Code != "" {
+		t.Errorf("binary content was carried in Code")
+	}
+	artifact, err := pooled.PatchSet.Artifact()
+	if err != nil {
+		t.Fatalf("Artifact: %v", err)
+	}
+	if !bytes.Equal(artifact, blob) {
+		t.Errorf("node recovered %d bytes that differ from the %d submitted", len(artifact), len(blob))
+	}
+}
+
+func TestSubmitRequiresAuthToken(t *testing.T) {
+	alice, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+	n := newTestNode(t, types.Account{Address: alice.GetAddress(), Balance: 1000})
+	n.config.RPCAuthToken = "s3cret"
+	router := n.newRouter()
+
+	submit := func() map[string]interface{} {
+		tx := &types.Transaction{
+			Type:      types.TxTypeTransfer,
+			From:      alice.GetAddress(),
+			To:        types.Address{0xb},
+			Amount:    10,
+			Fee:       1,
+			Timestamp: time.Now().Unix(),
+			ChainID:   1,
+		}
+		if err := alice.SignTransaction(tx); err != nil {
+			t.Fatalf("SignTransaction: %v", err)
+		}
+		return map[string]interface{}{"method": "submit_transaction", "params": map[string]interface{}{"transaction": tx}}
+	}
+
+	tests := []struct {
+		name   string
+		body   func() map[string]interface{}
+		header string
+		want   int
+	}{
+		{"submit without a token", submit, "", http.StatusUnauthorized},
+		{"submit with the wrong token", submit, "Bearer guess", http.StatusUnauthorized},
+		{"submit with the token in another scheme", submit, "Basic s3cret", http.StatusUnauthorized},
+		{"submit with the token", submit, "Bearer s3cret", http.StatusOK},
+		{"read without a token", func() map[string]interface{} {
+			return map[string]interface{}{"method": "get_height"}
+		}, "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(tt.body())
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, strings.TrimSpace(w.Body.String()))
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("WWW-Authenticate = %q, want Bearer", w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+
+	if pending := n.blockchain.GetPendingTransactions(); len(pending) != 1 {
+		t.Errorf("%d transactions pooled, want only the authorized one", len(pending))
+	}
+}
+
+func TestGetBlocksRange(t *testing.T) {
+	n := newTestNode(t)
+	addEmptyBlocks(t, n, 5)
+	router := n.newRouter()
+
+	tests := []struct {
+		name     string
+		from, to int64
+		want     []int64
+	}{
+		{"single block", 3, 3, []int64{3}},
+		{"from genesis", 0, 2, []int64{0, 1, 2}},
+		{"up to the tip", 4, 5, []int64{4, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp struct {
+				Blocks []BlockSummary `json:"blocks"`
+			}
+			callRouter(t, router, "get_blocks", map[string]interface{}{"from": tt.from, "to": tt.to}, &resp)
+			if len(resp.Blocks) != len(tt.want) {
+				t.Fatalf("got %d blocks, want %d", len(resp.Blocks), len(tt.want))
+			}
+			for i, summary := range resp.Blocks {
+				block, err := n.blockchain.GetBlockByHeight(tt.want[i])
+				if err != nil {
+					t.Fatalf("GetBlockByHeight: %v", err)
+				}
+				if summary.Height != tt.want[i] || summary.Hash != "0x"+block.Header.Hash.String() {
+					t.Errorf("block %d = #%d %s, want #%d", i, summary.Height, summary.Hash, tt.want[i])
+				}
+			}
+		})
+	}
+
+	failures := []struct {
+		name   string
+		params map[string]interface{}
+		want   string
+	}{
+		{"from after to", map[string]interface{}{"from": 3, "to": 2}, "after"},
+		{"past the tip", map[string]interface{}{"from": 4, "to": 6}, "outside the chain"},
+		{"negative from", map[string]interface{}{"from": -1, "to": 2}, "outside the chain"},
+		{"window too large", map[string]interface{}{"from": 0, "to": maxBlocksPerRange}, "exceeds limit"},
+		{"missing to", map[string]interface{}{"from": 0}, "missing to"},
+	}
+	for _, tt := range failures {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postRPC(t, router, "get_blocks", tt.params)
+			if w.Code == http.StatusOK || !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("%v: status %d: %s, want an error about %q", tt.params, w.Code, strings.TrimSpace(w.Body.String()), tt.want)
+			}
+		})
+	}
+}
+
+// syncBuffer collects log output written from several goroutines
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestDebugLoggingReachesComponents(t *testing.T) {
+	for _, level := range []string{"debug", "info"} {
+		t.Run(level, func(t *testing.T) {
+			out := &syncBuffer{}
+			logger := logrus.New()
+			logger.SetOutput(out)
+			if err := configureLogger(logger, level, "json"); err != nil {
+				t.Fatalf("configureLogger: %v", err)
+			}
+
+			quiet := logrus.New()
+			quiet.SetOutput(io.Discard)
+			status := func() network.Handshake { return network.Handshake{ChainID: 1} }
+
+			a, err := network.NewNetwork(0, t.TempDir(), logger)
+			if err != nil {
+				t.Fatalf("NewNetwork: %v", err)
+			}
+			defer a.Stop()
+			a.SetChainStatus(status)
+			b, err := network.NewNetwork(0, t.TempDir(), quiet)
+			if err != nil {
+				t.Fatalf("NewNetwork: %v", err)
+			}
+			defer b.Stop()
+			b.SetChainStatus(status)
+
+			// The handshake with a new peer is logged at debug level
+			if err := a.ConnectToPeer(b.GetAddresses()[0] + "/p2p/" + b.GetID()); err != nil {
+				t.Fatalf("ConnectToPeer: %v", err)
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for level == "debug" && !strings.Contains(out.String(), "Handshake with peer") {
+				if time.Now().After(deadline) {
+					t.Fatalf("no debug line logged:\n%s", out)
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+			if level == "info" {
+				time.Sleep(200 * time.Millisecond)
+			}
+
+			for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+				var entry map[string]interface{}
+				if err := json.Unmarshal([]byte(line), &entry); err != nil {
+					t.Fatalf("log line is not JSON: %q", line)
+				}
+				if entry["level"] == "debug" && level != "debug" {
+					t.Errorf("debug line logged at level %s: %q", level, line)
+				}
+			}
+		})
+	}
+}
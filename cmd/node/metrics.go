@@ -0,0 +1,77 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// rpcDuration tracks JSON-RPC latency by method
+var rpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "agentchain",
+	Name:      "rpc_request_duration_seconds",
+	Help:      "Latency of JSON-RPC requests by method.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"method"})
+
+// registerMetrics exposes node state on the default Prometheus registry.
+// Counters are read from the blockchain and consensus engine at scrape time.
+func (n *Node) registerMetrics() error {
+	collectors := []prometheus.Collector{
+		rpcDuration,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "agentchain",
+			Name:      "chain_height",
+			Help:      "Height of the current chain tip.",
+		}, func() float64 {
+			return float64(n.blockchain.GetHeight())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "agentchain",
+			Name:      "peers",
+			Help:      "Number of connected peers.",
+		}, func() float64 {
+			return float64(n.network.GetPeerCount())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "agentchain",
+			Name:      "mempool_size",
+			Help:      "Number of transactions waiting in the pool.",
+		}, func() float64 {
+			return float64(n.blockchain.Stats().MempoolSize)
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "agentchain",
+			Name:      "blocks_produced_total",
+			Help:      "Blocks produced by this node.",
+		}, func() float64 {
+			return float64(n.consensus.BlocksProduced())
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "agentchain",
+			Name:      "blocks_connected_total",
+			Help:      "Blocks connected to the chain, including those from peers and reorgs.",
+		}, func() float64 {
+			return float64(n.blockchain.Stats().BlocksConnected)
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "agentchain",
+			Name:      "transactions_processed_total",
+			Help:      "Transactions applied in connected blocks.",
+		}, func() float64 {
+			return float64(n.blockchain.Stats().TransactionsProcessed)
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "agentchain",
+			Name:      "transactions_pooled_total",
+			Help:      "Transactions accepted into the pool.",
+		}, func() float64 {
+			return float64(n.blockchain.Stats().TransactionsPooled)
+		}),
+	}
+
+	for _, collector := range collectors {
+		if err := prometheus.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+)
+
+// startPprofServer serves the Go runtime profiles on their own listener. It
+// is for debugging only: the profiles expose internals and cost CPU, so the
+// listener is never started unless pprof_addr is set, and it should be bound
+// to a loopback address.
+func (n *Node) startPprofServer() error {
+	if n.config.PprofAddr == "" {
+		return nil
+	}
+
+	// A private mux keeps the handlers off http.DefaultServeMux
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	listener, err := net.Listen("tcp", n.config.PprofAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on pprof address %s: %v", n.config.PprofAddr, err)
+	}
+
+	// Addr records the bound address, which differs when the port was 0
+	n.pprofServer = &http.Server{Addr: listener.Addr().String(), Handler: mux}
+	go func() {
+		if err := n.pprofServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			n.logger.Errorf("pprof server error: %v", err)
+		}
+	}()
+
+	n.logger.Warnf("pprof debug server listening on %s; do not expose it publicly", listener.Addr())
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestPprofServer(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	off := &Node{config: &NodeConfig{}, logger: logger}
+	if err := off.startPprofServer(); err != nil {
+		t.Fatalf("startPprofServer: %v", err)
+	}
+	if off.pprofServer != nil {
+		t.Fatal("pprof server started without pprof_addr")
+	}
+
+	on := &Node{config: &NodeConfig{PprofAddr: "127.0.0.1:0"}, logger: logger}
+	if err := on.startPprofServer(); err != nil {
+		t.Fatalf("startPprofServer: %v", err)
+	}
+	defer on.pprofServer.Shutdown(context.Background())
+
+	resp, err := http.Get("http://" + on.pprofServer.Addr + "/debug/pprof/")
+	if err != nil {
+		t.Fatalf("GET pprof index: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("pprof index status = %d, want 200", resp.StatusCode)
+	}
+
+	// The profiles stay off the RPC routes
+	w := httptest.NewRecorder()
+	off.newRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("pprof index on the RPC port: status %d, want 404", w.Code)
+	}
+}
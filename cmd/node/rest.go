@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// registerREST adds GET endpoints for quick reads with curl. Each is a thin
+// wrapper over the handler backing the equivalent JSON-RPC method.
+func (n *Node) registerREST(router *mux.Router) {
+	router.HandleFunc("/height", n.handleRESTHeight).Methods("GET")
+	router.HandleFunc("/block/{height}", n.handleRESTBlock).Methods("GET")
+	router.HandleFunc("/account/{address}", n.handleRESTAccount).Methods("GET")
+	router.HandleFunc("/tx/{hash}", n.handleRESTTransaction).Methods("GET")
+	router.HandleFunc("/peers", n.handleRESTPeers).Methods("GET")
+}
+
+func (n *Node) handleRESTHeight(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"height":           n.blockchain.GetHeight(),
+		"finalized_height": n.blockchain.GetFinalizedHeight(),
+	})
+}
+
+func (n *Node) handleRESTBlock(w http.ResponseWriter, r *http.Request) {
+	height, err := strconv.ParseInt(mux.Vars(r)["height"], 10, 64)
+	if err != nil || height < 0 {
+		writeJSONError(w, http.StatusBadRequest, "invalid height")
+		return
+	}
+
+	block, err := n.handleGetBlock(map[string]interface{}{"height": float64(height)})
+	writeRESTResult(w, block, err)
+}
+
+// handleRESTAccount reports an unknown address as an empty account rather
+// than a 404, as get_balance does: every address can receive funds
+func (n *Node) handleRESTAccount(w http.ResponseWriter, r *http.Request) {
+	address := mux.Vars(r)["address"]
+	if _, err := addressParam(map[string]interface{}{"address": address}, "address"); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	account, err := n.handleGetBalance(map[string]interface{}{"address": address})
+	writeRESTResult(w, account, err)
+}
+
+func (n *Node) handleRESTTransaction(w http.ResponseWriter, r *http.Request) {
+	tx, err := n.handleGetTransaction(map[string]interface{}{"hash": mux.Vars(r)["hash"]})
+	if err != nil && strings.HasPrefix(err.Error(), "invalid hash") {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeRESTResult(w, tx, err)
+}
+
+func (n *Node) handleRESTPeers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, n.handleGetPeers())
+}
+
+// writeRESTResult writes a handler's result, mapping lookups of resources
+// that do not exist to 404
+func writeRESTResult(w http.ResponseWriter, result interface{}, err error) {
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, result)
+	case strings.Contains(err.Error(), "not found"):
+		writeJSONError(w, http.StatusNotFound, err.Error())
+	default:
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
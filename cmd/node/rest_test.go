@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"agent-chain/pkg/crypto"
+	"agent-chain/pkg/types"
+)
+
+func TestRESTEndpoints(t *testing.T) {
+	alice, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+	n := newTestNode(t, types.Account{Address: alice.GetAddress(), Balance: 1000})
+	router := n.newRouter()
+	addEmptyBlocks(t, n, 2)
+
+	tx := &types.Transaction{
+		Type:      types.TxTypeTransfer,
+		From:      alice.GetAddress(),
+		To:        types.Address{0xb},
+		Amount:    10,
+		Fee:       1,
+		Timestamp: time.Now().Unix(),
+		ChainID:   1,
+	}
+	if err := alice.SignTransaction(tx); err != nil {
+		t.Fatalf("SignTransaction: %v", err)
+	}
+	var submitted struct {
+		TxHash string `json:"tx_hash"`
+	}
+	callRouter(t, router, "submit_transaction", map[string]interface{}{"transaction": tx}, &submitted)
+
+	tests := []struct {
+		path   string
+		status int
+		want   map[string]interface{}
+	}{
+		{"/height", http.StatusOK, map[string]interface{}{"height": 2.0}},
+		{"/block/2", http.StatusOK, nil},
+		{"/block/3", http.StatusNotFound, nil},
+		{"/block/two", http.StatusBadRequest, nil},
+		{"/account/" + alice.GetAddress().String(), http.StatusOK, map[string]interface{}{"balance": 1000.0, "pending_nonce": 1.0}},
+		{"/account/0x" + strings.Repeat("e", 40), http.StatusOK, map[string]interface{}{"balance": 0.0}},
+		{"/account/nobody", http.StatusBadRequest, nil},
+		{"/tx/" + submitted.TxHash, http.StatusOK, map[string]interface{}{"status": "pending"}},
+		{"/tx/0x" + strings.Repeat("0", 64), http.StatusNotFound, nil},
+		{"/tx/xyz", http.StatusBadRequest, nil},
+		{"/peers", http.StatusOK, map[string]interface{}{"count": 0.0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, strings.TrimSpace(w.Body.String()))
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decoding body: %v", err)
+			}
+			if tt.status != http.StatusOK {
+				if _, ok := body["error"]; !ok {
+					t.Errorf("error response %v has no error field", body)
+				}
+				return
+			}
+			for key, want := range tt.want {
+				if got := body[key]; got != want {
+					t.Errorf("%s = %v, want %v", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRESTBlockMatchesRPC(t *testing.T) {
+	n := newTestNode(t)
+	router := n.newRouter()
+	addEmptyBlocks(t, n, 3)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/block/2", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, strings.TrimSpace(w.Body.String()))
+	}
+	var rest, rpc types.Block
+	if err := json.Unmarshal(w.Body.Bytes(), &rest); err != nil {
+		t.Fatalf("decoding block: %v", err)
+	}
+	callRouter(t, router, "get_block", map[string]interface{}{"height": 2}, &rpc)
+
+	if rest.Header.Height != 2 || rest.Header.Hash != rpc.Header.Hash {
+		t.Errorf("/block/2 returned #%d %s, get_block returned #%d %s",
+			rest.Header.Height, rest.Header.Hash, rpc.Header.Height, rpc.Header.Hash)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bufio"
+	"os"
+
+	"agent-chain/pkg/blockchain"
+)
+
+// exportSnapshotFile writes the chain state at the current tip to path
+func exportSnapshotFile(bc *blockchain.Blockchain, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	if err := bc.ExportSnapshot(writer); err != nil {
+		file.Close()
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// importSnapshotFile initializes a fresh chain from the snapshot at path
+func importSnapshotFile(bc *blockchain.Blockchain, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return bc.ImportSnapshot(bufio.NewReader(file))
+}
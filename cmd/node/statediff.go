@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"agent-chain/pkg/blockchain"
+	"agent-chain/pkg/types"
+)
+
+// stateDiffCmd compares the account state of two nodes over RPC
+func stateDiffCmd() *cobra.Command {
+	var localURL, peerURL string
+
+	cmd := &cobra.Command{
+		Use:   "state-diff",
+		Short: "Compare account state and chain tip with another node",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runStateDiff(localURL, peerURL)
+		},
+	}
+
+	cmd.Flags().StringVar(&localURL, "rpc", "http://127.0.0.1:8545", "RPC endpoint of the local node")
+	cmd.Flags().StringVar(&peerURL, "peer", "", "RPC endpoint of the node to compare against (required)")
+	cmd.MarkFlagRequired("peer")
+
+	return cmd
+}
+
+func runStateDiff(localURL, peerURL string) error {
+	var local, peer blockchain.Snapshot
+	if err := rpcCall(localURL, "get_state", nil, &local); err != nil {
+		return fmt.Errorf("failed to fetch local state: %v", err)
+	}
+	if err := rpcCall(peerURL, "get_state", nil, &peer); err != nil {
+		return fmt.Errorf("failed to fetch peer state: %v", err)
+	}
+
+	fmt.Printf("Local: height %d, tip 0x%s\n", local.Header.Height, local.Header.Hash)
+	fmt.Printf("Peer:  height %d, tip 0x%s\n", peer.Header.Height, peer.Header.Hash)
+
+	// Locate the first height at which the chains disagree
+	common := local.Header.Height
+	if peer.Header.Height < common {
+		common = peer.Header.Height
+	}
+
+	divergence, err := findDivergence(localURL, peerURL, common)
+	if err != nil {
+		return err
+	}
+	switch {
+	case divergence >= 0:
+		fmt.Printf("Chains diverge at height %d\n", divergence)
+	case local.Header.Height != peer.Header.Height:
+		fmt.Printf("Chains agree up to height %d; one node is behind\n", common)
+	default:
+		fmt.Printf("Chains are identical\n")
+	}
+
+	// Compare balances across the union of known accounts
+	localBalances := balancesByAddress(local.Accounts)
+	peerBalances := balancesByAddress(peer.Accounts)
+
+	addrs := make([]types.Address, 0, len(localBalances)+len(peerBalances))
+	for addr := range localBalances {
+		addrs = append(addrs, addr)
+	}
+	for addr := range peerBalances {
+		if _, exists := localBalances[addr]; !exists {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return bytes.Compare(addrs[i][:], addrs[j][:]) < 0
+	})
+
+	differences := 0
+	for _, addr := range addrs {
+		localBalance, peerBalance := localBalances[addr], peerBalances[addr]
+		if localBalance == peerBalance {
+			continue
+		}
+		if differences == 0 {
+			fmt.Printf("\n%-44s %15s %15s %15s\n", "Address", "Local", "Peer", "Difference")
+		}
+		differences++
+		fmt.Printf("%-44s %15d %15d %+15d\n", addr, localBalance, peerBalance, peerBalance-localBalance)
+	}
+
+	if differences == 0 {
+		fmt.Printf("\nAll %d account balances match\n", len(addrs))
+	} else {
+		fmt.Printf("\n%d of %d accounts differ\n", differences, len(addrs))
+	}
+
+	return nil
+}
+
+// findDivergence binary searches for the lowest height up to maxHeight whose
+// block hash differs between the two nodes, or returns -1 if none does
+func findDivergence(localURL, peerURL string, maxHeight int64) (int64, error) {
+	differs := func(height int64) (bool, error) {
+		localHeader, err := fetchHeader(localURL, height)
+		if err != nil {
+			return false, fmt.Errorf("failed to fetch local header %d: %v", height, err)
+		}
+		peerHeader, err := fetchHeader(peerURL, height)
+		if err != nil {
+			return false, fmt.Errorf("failed to fetch peer header %d: %v", height, err)
+		}
+		return localHeader.Hash != peerHeader.Hash, nil
+	}
+
+	tipDiffers, err := differs(maxHeight)
+	if err != nil || !tipDiffers {
+		return -1, err
+	}
+
+	// Blocks link by hash, so once the chains differ they differ at every later height
+	low, high := int64(0), maxHeight
+	for low < high {
+		mid := low + (high-low)/2
+		midDiffers, err := differs(mid)
+		if err != nil {
+			return -1, err
+		}
+		if midDiffers {
+			high = mid
+		} else {
+			low = mid + 1
+		}
+	}
+
+	return low, nil
+}
+
+// fetchHeader fetches a single block header by height
+func fetchHeader(url string, height int64) (*types.BlockHeader, error) {
+	var resp struct {
+		Headers []types.BlockHeader `json:"headers"`
+	}
+	if err := rpcCall(url, "get_headers", map[string]interface{}{"from": height, "count": 1}, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Headers) == 0 {
+		return nil, fmt.Errorf("no header at height %d", height)
+	}
+	return &resp.Headers[0], nil
+}
+
+// balancesByAddress indexes account balances by address
+func balancesByAddress(accounts []*types.Account) map[types.Address]int64 {
+	balances := make(map[types.Address]int64, len(accounts))
+	for _, account := range accounts {
+		balances[account.Address] = account.Balance
+	}
+	return balances
+}
+
+// rpcCall performs a JSON-RPC request against a node and decodes the result
+func rpcCall(url, method string, params interface{}, result interface{}) error {
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"method": method,
+		"params": params,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	resp, err := http.Post(url, "application/json", bytes.NewReader(reqBody))
+	if err != nil {
+		return fmt.Errorf("failed to make RPC call: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("RPC error: %s", string(respBody))
+	}
+
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return fmt.Errorf("failed to parse response: %v", err)
+	}
+
+	return nil
+}
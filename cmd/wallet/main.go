@@ -1,18 +1,36 @@
 package main
 
 import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"os"
 	"path/filepath"
-
+	"strconv"
+	"strings"
+	"time"
+
+	"agent-chain/pkg/blockchain"
+	"agent-chain/pkg/consensus"
+	"agent-chain/pkg/crypto"
+	"agent-chain/pkg/types"
 	"agent-chain/pkg/wallet"
+	"github.com/skip2/go-qrcode"
 	"github.com/spf13/cobra"
 )
 
 var (
-	dataDir string
-	rpcURL  string
-	w       *wallet.Wallet
+	dataDir    string
+	rpcURL     string
+	rpcCAFile  string
+	rpcToken   string
+	rpcRetries int
+	rpcTimeout time.Duration
+	passphrase string
+	w          *wallet.Wallet
 )
 
 func main() {
@@ -20,26 +38,59 @@ func main() {
 		Use:   "wallet",
 		Short: "Agent Chain CLI Wallet",
 		Long:  "Command line wallet for Agent Chain blockchain",
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			w = wallet.NewWallet(dataDir, rpcURL)
+			w.SetRPCRetry(rpcRetries, rpcTimeout)
+			w.SetRPCAuthToken(rpcToken)
+			w.SetPassphrase(passphrase)
+			if rpcCAFile != "" {
+				return w.SetRPCRootCA(rpcCAFile)
+			}
+			return nil
 		},
 	}
 
 	// Global flags
 	rootCmd.PersistentFlags().StringVar(&dataDir, "data-dir", getDefaultDataDir(), "Data directory")
-	rootCmd.PersistentFlags().StringVar(&rpcURL, "rpc", "http://127.0.0.1:8545", "RPC endpoint")
+	rootCmd.PersistentFlags().StringVar(&rpcURL, "rpc", "http://127.0.0.1:8545", "RPC endpoint (http:// or https://); separate several with commas for failover")
+	rootCmd.PersistentFlags().IntVar(&rpcRetries, "rpc-retries", wallet.DefaultRPCRetries, "Extra rounds of attempts across the RPC endpoints when they are unreachable")
+	rootCmd.PersistentFlags().DurationVar(&rpcTimeout, "rpc-timeout", wallet.DefaultRPCTimeout, "Timeout of each RPC request")
+	rootCmd.PersistentFlags().StringVar(&rpcCAFile, "rpc-ca", "", "PEM CA certificate to trust for an https:// RPC endpoint")
+	rootCmd.PersistentFlags().StringVar(&rpcToken, "rpc-token", "", "Bearer token for nodes that require one to submit transactions")
+	rootCmd.PersistentFlags().StringVar(&passphrase, "passphrase", os.Getenv("AGENT_WALLET_PASSPHRASE"), "Passphrase encrypting account keys (defaults to $AGENT_WALLET_PASSPHRASE)")
 
 	// Add commands
 	rootCmd.AddCommand(newCmd())
 	rootCmd.AddCommand(importCmd())
+	rootCmd.AddCommand(watchCmd())
+	rootCmd.AddCommand(addrCmd())
+	rootCmd.AddCommand(exportKeyCmd())
+	rootCmd.AddCommand(encryptCmd())
 	rootCmd.AddCommand(listCmd())
+	rootCmd.AddCommand(renameCmd())
+	rootCmd.AddCommand(deleteCmd())
 	rootCmd.AddCommand(balanceCmd())
 	rootCmd.AddCommand(sendCmd())
+	rootCmd.AddCommand(sendBatchCmd())
+	rootCmd.AddCommand(txCmd())
+	rootCmd.AddCommand(signCmd())
+	rootCmd.AddCommand(verifyCmd())
 	rootCmd.AddCommand(receiveCmd())
 	rootCmd.AddCommand(submitPatchCmd())
 	rootCmd.AddCommand(claimCmd())
 	rootCmd.AddCommand(stakeCmd())
+	rootCmd.AddCommand(delegationsCmd())
+	rootCmd.AddCommand(problemCmd())
 	rootCmd.AddCommand(heightCmd())
+	rootCmd.AddCommand(statusCmd())
+	rootCmd.AddCommand(blockCmd())
+	rootCmd.AddCommand(nextProposerCmd())
+	rootCmd.AddCommand(peersCmd())
+	rootCmd.AddCommand(mempoolCmd())
+	rootCmd.AddCommand(blocksCmd())
+	rootCmd.AddCommand(verifyChainCmd())
+	rootCmd.AddCommand(tailEventsCmd())
+	rootCmd.AddCommand(historyCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -76,16 +127,27 @@ func newCmd() *cobra.Command {
 
 func importCmd() *cobra.Command {
 	var name, privateKey string
+	var allowDuplicate bool
 
 	cmd := &cobra.Command{
 		Use:   "import",
 		Short: "Import an account from private key",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			account, err := w.ImportAccount(name, privateKey)
+			account, err := w.ImportAccount(name, privateKey, allowDuplicate)
 			if err != nil {
+				if dupErr, ok := err.(*wallet.DuplicateAddressError); ok {
+					fmt.Fprintf(os.Stderr, "⚠️  WARNING: %v\n", dupErr)
+					return fmt.Errorf("refusing to store a duplicate address; use --allow-duplicate to import anyway")
+				}
 				return err
 			}
 
+			// Warn when the address was knowingly stored under several names
+			names, err := w.AccountNamesByAddress(account.Address)
+			if err == nil && len(names) > 1 {
+				fmt.Fprintf(os.Stderr, "⚠️  WARNING: address %s is now stored under accounts: %s\n", account.Address, strings.Join(names, ", "))
+			}
+
 			fmt.Printf("Imported account:\n")
 			fmt.Printf("Name: %s\n", account.Name)
 			fmt.Printf("Address: %s\n", account.Address)
@@ -96,12 +158,158 @@ func importCmd() *cobra.Command {
 
 	cmd.Flags().StringVar(&name, "name", "", "Account name (required)")
 	cmd.Flags().StringVar(&privateKey, "private-key", "", "Private key hex (required)")
+	cmd.Flags().BoolVar(&allowDuplicate, "allow-duplicate", false, "Import even if the address already exists under another account name")
 	cmd.MarkFlagRequired("name")
 	cmd.MarkFlagRequired("private-key")
 
 	return cmd
 }
 
+func watchCmd() *cobra.Command {
+	var name, address string
+
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Track an address without its private key",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			account, err := w.WatchAccount(name, address)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Watching account:\n")
+			fmt.Printf("Name: %s\n", account.Name)
+			fmt.Printf("Address: %s\n", account.Address)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "Account name (required)")
+	cmd.Flags().StringVar(&address, "address", "", "Address to watch (required)")
+	cmd.MarkFlagRequired("name")
+	cmd.MarkFlagRequired("address")
+
+	return cmd
+}
+
+func exportKeyCmd() *cobra.Command {
+	var account string
+	var confirmed bool
+
+	cmd := &cobra.Command{
+		Use:   "export-key",
+		Short: "Display the raw private key of an account",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fmt.Fprintf(os.Stderr, "⚠️  WARNING: anyone who sees this private key has full control of the account's funds.\n")
+			fmt.Fprintf(os.Stderr, "⚠️  Never share it, paste it into websites, or store it unencrypted.\n")
+
+			if !confirmed {
+				return fmt.Errorf("refusing to export private key without --yes-i-understand")
+			}
+
+			privateKey, err := w.ExportPrivateKey(account, passphrase)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Account: %s\n", account)
+			fmt.Printf("Private Key: %s\n", privateKey)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&account, "account", "", "Account name (required)")
+	cmd.Flags().BoolVar(&confirmed, "yes-i-understand", false, "Confirm that you understand the risk of exposing the private key")
+	cmd.MarkFlagRequired("account")
+
+	return cmd
+}
+
+func encryptCmd() *cobra.Command {
+	var account string
+
+	cmd := &cobra.Command{
+		Use:   "encrypt",
+		Short: "Encrypt the stored private key of an account with the passphrase",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if passphrase == "" {
+				return fmt.Errorf("set a passphrase with --passphrase or $AGENT_WALLET_PASSPHRASE")
+			}
+			if err := w.EncryptAccount(account); err != nil {
+				return err
+			}
+
+			fmt.Printf("Encrypted account %s\n", account)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&account, "account", "", "Account name (required)")
+	cmd.MarkFlagRequired("account")
+
+	return cmd
+}
+
+func renameCmd() *cobra.Command {
+	var from, to string
+
+	cmd := &cobra.Command{
+		Use:   "rename",
+		Short: "Rename a stored account",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := w.RenameAccount(from, to); err != nil {
+				return err
+			}
+
+			fmt.Printf("Renamed account %s to %s\n", from, to)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&from, "from", "", "Current account name (required)")
+	cmd.Flags().StringVar(&to, "to", "", "New account name (required)")
+	cmd.MarkFlagRequired("from")
+	cmd.MarkFlagRequired("to")
+
+	return cmd
+}
+
+func deleteCmd() *cobra.Command {
+	var account string
+	var confirmed, force bool
+
+	cmd := &cobra.Command{
+		Use:   "delete",
+		Short: "Delete a stored account and its private key",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fmt.Fprintf(os.Stderr, "⚠️  WARNING: deleting an account removes its private key. Funds are lost unless the key is backed up.\n")
+
+			if !confirmed {
+				return fmt.Errorf("refusing to delete account without --yes")
+			}
+
+			if err := w.DeleteAccount(account, force); err != nil {
+				if err == wallet.ErrLastAccount {
+					return fmt.Errorf("%v; use --force to delete it anyway", err)
+				}
+				return err
+			}
+
+			fmt.Printf("Deleted account %s\n", account)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&account, "account", "", "Account name (required)")
+	cmd.Flags().BoolVar(&confirmed, "yes", false, "Confirm the deletion")
+	cmd.Flags().BoolVar(&force, "force", false, "Allow deleting the last account in the wallet")
+	cmd.MarkFlagRequired("account")
+
+	return cmd
+}
+
 func listCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "list",
@@ -120,6 +328,10 @@ func listCmd() *cobra.Command {
 			fmt.Printf("%-20s %s\n", "Name", "Address")
 			fmt.Printf("%-20s %s\n", "----", "-------")
 			for _, account := range accounts {
+				if account.WatchOnly {
+					fmt.Printf("%-20s %s (watch-only)\n", account.Name, account.Address)
+					continue
+				}
 				fmt.Printf("%-20s %s\n", account.Name, account.Address)
 			}
 
@@ -130,11 +342,16 @@ func listCmd() *cobra.Command {
 
 func balanceCmd() *cobra.Command {
 	var address, account string
+	var all bool
 
 	cmd := &cobra.Command{
 		Use:   "balance",
 		Short: "Get account balance",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if all {
+				return printAllBalances()
+			}
+
 			// Load account if specified
 			if account != "" {
 				if err := w.LoadAccount(account); err != nil {
@@ -148,20 +365,60 @@ func balanceCmd() *cobra.Command {
 				return err
 			}
 
-			fmt.Printf("Balance: %d\n", balance)
+			fmt.Printf("Balance: %s\n", w.FormatAmount(balance))
 			return nil
 		},
 	}
 
 	cmd.Flags().StringVar(&address, "address", "", "Address to check")
 	cmd.Flags().StringVar(&account, "account", "", "Account name to check")
+	cmd.Flags().BoolVar(&all, "all", false, "Show the balance of every stored account")
 
 	return cmd
 }
 
+// printAllBalances prints a table of every stored account's balance and their total
+func printAllBalances() error {
+	balances, err := w.GetAllBalances()
+	if err != nil {
+		return err
+	}
+
+	if len(balances) == 0 {
+		fmt.Println("No accounts found")
+		return nil
+	}
+
+	var total int64
+	failed := 0
+	fmt.Printf("%-20s %-42s %15s\n", "Name", "Address", "Balance")
+	for _, entry := range balances {
+		if entry.Err != nil {
+			failed++
+			fmt.Printf("%-20s %-42s %15s\n", entry.Name, entry.Address, "error")
+			continue
+		}
+		total += entry.Balance
+		fmt.Printf("%-20s %-42s %15s\n", entry.Name, entry.Address, w.FormatAmount(entry.Balance))
+	}
+	fmt.Printf("%-20s %-42s %15s\n", "Total", "", w.FormatAmount(total))
+
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "⚠️  WARNING: %d of %d balances could not be fetched and are not in the total\n", failed, len(balances))
+		for _, entry := range balances {
+			if entry.Err != nil {
+				fmt.Fprintf(os.Stderr, "  %s: %v\n", entry.Name, entry.Err)
+			}
+		}
+	}
+	return nil
+}
+
 func sendCmd() *cobra.Command {
-	var to, account string
-	var amount int64
+	var to, account, amountStr string
+	var fee int64
+	var wait bool
+	var waitTimeout time.Duration
 
 	cmd := &cobra.Command{
 		Use:   "send",
@@ -183,189 +440,841 @@ func sendCmd() *cobra.Command {
 				return err
 			}
 
-			txHash, err := w.SendTransaction(to, amount)
+			if fee < 0 {
+				return fmt.Errorf("fee must not be negative")
+			}
+
+			amount, err := w.ParseAmount(amountStr)
+			if err != nil {
+				return err
+			}
+
+			recipient, err := w.ResolveRecipient(to)
+			if err != nil {
+				return err
+			}
+
+			txHash, err := w.SendTransaction(recipient, amount, fee)
 			if err != nil {
 				return err
 			}
 
 			fmt.Printf("Transaction sent: %s\n", txHash)
-			return nil
+			if !wait {
+				return nil
+			}
+			return waitForReceipt(txHash, waitTimeout)
 		},
 	}
 
-	cmd.Flags().StringVar(&to, "to", "", "Recipient address (required)")
+	cmd.Flags().StringVar(&to, "to", "", "Recipient address or address book label (required)")
 	cmd.Flags().StringVar(&account, "account", "", "Sender account name (optional, uses first account if not specified)")
-	cmd.Flags().Int64Var(&amount, "amount", 0, "Amount to send (required)")
+	cmd.Flags().StringVar(&amountStr, "amount", "", "Amount to send in tokens, e.g. 1.5 (required)")
+	cmd.Flags().Int64Var(&fee, "fee", types.DefaultTxFee, "Transaction fee in base units, paid to the block validator")
+	cmd.Flags().BoolVar(&wait, "wait", false, "Wait until the transaction is mined")
+	cmd.Flags().DurationVar(&waitTimeout, "wait-timeout", defaultWaitTimeout, "How long --wait waits for the transaction to be mined")
 	cmd.MarkFlagRequired("to")
 	cmd.MarkFlagRequired("amount")
 
 	return cmd
 }
 
-func receiveCmd() *cobra.Command {
-	var account string
+// defaultWaitTimeout bounds how long --wait blocks for a transaction
+const defaultWaitTimeout = 2 * time.Minute
+
+// waitForReceipt blocks until the transaction is mined or the timeout elapses
+func waitForReceipt(txHash string, timeout time.Duration) error {
+	fmt.Printf("Waiting for confirmation...\n")
+	receipt, err := w.WaitForTransaction(txHash, timeout)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Mined in block #%d (%s)\n", receipt.BlockHeight, receipt.BlockHash)
+	if receipt.GasUsed > 0 {
+		fmt.Printf("Gas Used: %d\n", receipt.GasUsed)
+	}
+	return nil
+}
+
+func sendBatchCmd() *cobra.Command {
+	var file, account string
+	var fee int64
 
 	cmd := &cobra.Command{
-		Use:   "receive",
-		Short: "Show receive address for account",
+		Use:   "send-batch",
+		Short: "Send tokens to every recipient listed in a CSV file",
+		Long:  "Send tokens to many recipients. The file has one address,amount row per payment; a header row and lines starting with # are ignored.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// Load account
-			if account == "" {
-				return fmt.Errorf("account name required")
+			if fee < 0 {
+				return fmt.Errorf("fee must not be negative")
+			}
+
+			info, err := w.GetChainInfo()
+			if err != nil {
+				return fmt.Errorf("failed to get chain decimals: %v", err)
+			}
+
+			payments, err := readPayments(file, fee, info.Decimals)
+			if err != nil {
+				return err
+			}
+			if len(payments) == 0 {
+				return fmt.Errorf("no payments found in %s", file)
 			}
 
 			if err := w.LoadAccount(account); err != nil {
 				return err
 			}
 
-			// Get account info to show address
-			accounts, err := w.ListAccounts()
+			results, err := w.SendBatch(payments)
 			if err != nil {
 				return err
 			}
 
-			for _, acc := range accounts {
-				if acc.Name == account {
-					fmt.Printf("Receive Address: %s\n", acc.Address)
-					fmt.Printf("Account: %s\n", acc.Name)
-					return nil
+			failed := 0
+			for i, result := range results {
+				if result.Err != nil {
+					failed++
+					fmt.Printf("%4d %-44s %12s FAILED: %v\n", i+1, result.Payment.To, w.FormatAmount(result.Payment.Amount), result.Err)
+				} else {
+					fmt.Printf("%4d %-44s %12s sent %s\n", i+1, result.Payment.To, w.FormatAmount(result.Payment.Amount), result.TxHash)
 				}
 			}
 
-			return fmt.Errorf("account not found: %s", account)
+			fmt.Printf("\n%d of %d payments sent\n", len(results)-failed, len(results))
+			if failed > 0 {
+				return fmt.Errorf("%d payments failed", failed)
+			}
+			return nil
 		},
 	}
 
-	cmd.Flags().StringVar(&account, "account", "", "Account name (required)")
+	cmd.Flags().StringVar(&file, "file", "", "CSV file of address,amount rows (required)")
+	cmd.Flags().StringVar(&account, "account", "", "Sender account name (required)")
+	cmd.Flags().Int64Var(&fee, "fee", types.DefaultTxFee, "Fee in base units paid for each transaction")
+	cmd.MarkFlagRequired("file")
 	cmd.MarkFlagRequired("account")
 
 	return cmd
 }
 
-func submitPatchCmd() *cobra.Command {
-	var file, account, spec, code, codeHash string
-	var gas int64
+// readPayments parses address,amount rows, with amounts in tokens. Any
+// malformed row aborts the whole batch so nothing is sent from a half-valid file.
+func readPayments(path string, fee int64, decimals int) ([]wallet.Payment, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open payments file: %v", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse payments file: %v", err)
+	}
+
+	payments := make([]wallet.Payment, 0, len(records))
+	for i, record := range records {
+		address, amountStr := strings.TrimSpace(record[0]), strings.TrimSpace(record[1])
+		if i == 0 && strings.EqualFold(address, "address") {
+			continue
+		}
+
+		if _, err := crypto.AddressFromString(address); err != nil {
+			return nil, fmt.Errorf("row %d: invalid address: %v", i+1, err)
+		}
+		amount, err := types.ParseAmount(amountStr, decimals)
+		if err != nil || amount <= 0 {
+			return nil, fmt.Errorf("row %d: invalid amount %q", i+1, amountStr)
+		}
+
+		payments = append(payments, wallet.Payment{To: address, Amount: amount, Fee: fee})
+	}
+
+	return payments, nil
+}
 
+func addrCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "submit-patch",
-		Short: "Submit a patch set",
+		Use:   "addr",
+		Short: "Manage the address book of named recipients",
+	}
+
+	cmd.AddCommand(addrAddCmd())
+	cmd.AddCommand(addrListCmd())
+	cmd.AddCommand(addrRmCmd())
+
+	return cmd
+}
+
+func addrAddCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "add <label> <address>",
+		Short: "Store a recipient address under a label",
+		Args:  cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// If no account specified, try to use the first available account
-			if account == "" {
-				accounts, err := w.ListAccounts()
-				if err != nil {
-					return fmt.Errorf("failed to list accounts: %v", err)
-				}
-				if len(accounts) == 0 {
-					return fmt.Errorf("no accounts found, please create an account first")
-				}
-				account = accounts[0].Name
+			if err := w.AddAddress(args[0], args[1]); err != nil {
+				return err
 			}
 
-			if err := w.LoadAccount(account); err != nil {
+			fmt.Printf("Added %s: %s\n", args[0], args[1])
+			return nil
+		},
+	}
+}
+
+func addrListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the address book",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := w.ListAddresses()
+			if err != nil {
 				return err
 			}
 
-			// Determine which file to use
-			patchFile := file
-			if code != "" {
-				patchFile = code
+			if len(entries) == 0 {
+				fmt.Println("Address book is empty")
+				return nil
 			}
 
-			if patchFile == "" {
-				return fmt.Errorf("patch file required (use --file or --code)")
+			fmt.Printf("%-20s %s\n", "Label", "Address")
+			fmt.Printf("%-20s %s\n", "-----", "-------")
+			for _, entry := range entries {
+				fmt.Printf("%-20s %s\n", entry.Label, entry.Address)
 			}
+			return nil
+		},
+	}
+}
 
-			// Display submission details
-			fmt.Printf("Submitting PatchSet:\n")
-			fmt.Printf("  Spec: %s\n", spec)
-			fmt.Printf("  Code: %s\n", patchFile)
-			fmt.Printf("  Hash: %s\n", codeHash)
-			fmt.Printf("  Gas: %d\n", gas)
-			fmt.Printf("  Account: %s\n", account)
-			fmt.Println()
-
-			txHash, err := w.SubmitPatch(patchFile)
-			if err != nil {
+func addrRmCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rm <label>",
+		Short: "Remove a label from the address book",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := w.RemoveAddress(args[0]); err != nil {
 				return err
 			}
 
-			fmt.Printf("✅ Patch submitted successfully!\n")
-			fmt.Printf("Transaction Hash: %s\n", txHash)
-			fmt.Printf("The transaction will be packaged into the next block.\n")
+			fmt.Printf("Removed %s\n", args[0])
 			return nil
 		},
 	}
+}
 
-	cmd.Flags().StringVar(&file, "file", "", "Patch file path")
-	cmd.Flags().StringVar(&account, "account", "", "Account name (optional, uses first account if not specified)")
-	cmd.Flags().StringVar(&spec, "spec", "", "Specification ID (e.g., SYS-BOOTSTRAP-DEVNET-001)")
-	cmd.Flags().StringVar(&code, "code", "", "Code package file path")
-	cmd.Flags().StringVar(&codeHash, "code-hash", "", "SHA-256 hash of the code package")
-	cmd.Flags().Int64Var(&gas, "gas", 50000, "Gas limit for the transaction")
+func txCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tx",
+		Short: "Build, sign and broadcast transactions offline",
+	}
+
+	cmd.AddCommand(txBuildCmd())
+	cmd.AddCommand(txSignCmd())
+	cmd.AddCommand(txBroadcastCmd())
 
 	return cmd
 }
 
-func claimCmd() *cobra.Command {
-	var account string
-	var amount int64
-	var check bool
+func txBuildCmd() *cobra.Command {
+	var from, to string
+	var amount, fee, nonce, chainID int64
 
 	cmd := &cobra.Command{
-		Use:   "claim",
-		Short: "Claim available rewards",
+		Use:   "build",
+		Short: "Build an unsigned transfer as JSON",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// If no account specified, try to use the first available account
-			if account == "" {
-				accounts, err := w.ListAccounts()
-				if err != nil {
-					return fmt.Errorf("failed to list accounts: %v", err)
-				}
-				if len(accounts) == 0 {
-					return fmt.Errorf("no accounts found, please create an account first")
-				}
-				account = accounts[0].Name
+			if fee < 0 {
+				return fmt.Errorf("fee must not be negative")
 			}
 
-			if err := w.LoadAccount(account); err != nil {
+			rawTx, err := w.BuildUnsignedTransaction(from, to, amount, fee, nonce, chainID)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(rawTx)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&from, "from", "", "Sender address (required)")
+	cmd.Flags().StringVar(&to, "to", "", "Recipient address (required)")
+	cmd.Flags().Int64Var(&amount, "amount", 0, "Amount to send in base units (required)")
+	cmd.Flags().Int64Var(&fee, "fee", types.DefaultTxFee, "Transaction fee in base units, paid to the block validator")
+	cmd.Flags().Int64Var(&nonce, "nonce", 0, "Sender account nonce")
+	cmd.Flags().Int64Var(&chainID, "chain-id", 0, "Chain ID to bind the transfer to (default: ask the node)")
+	cmd.MarkFlagRequired("from")
+	cmd.MarkFlagRequired("to")
+	cmd.MarkFlagRequired("amount")
+
+	return cmd
+}
+
+func txSignCmd() *cobra.Command {
+	var account, file string
+
+	cmd := &cobra.Command{
+		Use:   "sign",
+		Short: "Sign an unsigned transaction without contacting a node",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rawTx, err := readTxInput(file)
+			if err != nil {
+				return err
+			}
+
+			if err := w.LoadAccount(account); err != nil {
+				return err
+			}
+
+			signedTx, err := w.SignRawTransaction(rawTx)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(signedTx)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&account, "account", "", "Signing account name (required)")
+	cmd.Flags().StringVar(&file, "file", "", "Unsigned transaction file (reads stdin if not specified)")
+	cmd.MarkFlagRequired("account")
+
+	return cmd
+}
+
+func txBroadcastCmd() *cobra.Command {
+	var file string
+
+	cmd := &cobra.Command{
+		Use:   "broadcast",
+		Short: "Submit a signed transaction to the node",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			signedTx, err := readTxInput(file)
+			if err != nil {
+				return err
+			}
+
+			txHash, err := w.BroadcastRawTransaction(signedTx)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Transaction sent: %s\n", txHash)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&file, "file", "", "Signed transaction file (reads stdin if not specified)")
+
+	return cmd
+}
+
+// readTxInput reads a transaction JSON from the given file, or stdin if empty
+func readTxInput(file string) (string, error) {
+	var data []byte
+	var err error
+
+	if file == "" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read transaction: %v", err)
+	}
+
+	return string(data), nil
+}
+
+func signCmd() *cobra.Command {
+	var account, message string
+
+	cmd := &cobra.Command{
+		Use:   "sign",
+		Short: "Sign a message with an account",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := w.LoadAccount(account); err != nil {
+				return err
+			}
+
+			signature, err := w.SignMessage(message)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Address: %s\n", w.GetAddress())
+			fmt.Printf("Signature: %s\n", signature)
+			fmt.Printf("(the signature embeds the signer's public key)\n")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&account, "account", "", "Account name (required)")
+	cmd.Flags().StringVar(&message, "message", "", "Message to sign (required)")
+	cmd.MarkFlagRequired("account")
+	cmd.MarkFlagRequired("message")
+
+	return cmd
+}
+
+func verifyCmd() *cobra.Command {
+	var address, message, signature string
+
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify a signed message against an address",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := wallet.VerifyMessage(address, message, signature); err != nil {
+				return fmt.Errorf("verification failed: %v", err)
+			}
+
+			fmt.Printf("Signature is valid for %s\n", address)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&address, "address", "", "Signer address (required)")
+	cmd.Flags().StringVar(&message, "message", "", "Signed message (required)")
+	cmd.Flags().StringVar(&signature, "signature", "", "Signature hex (required)")
+	cmd.MarkFlagRequired("address")
+	cmd.MarkFlagRequired("message")
+	cmd.MarkFlagRequired("signature")
+
+	return cmd
+}
+
+func receiveCmd() *cobra.Command {
+	var account, qrPNG string
+	var showQR bool
+
+	cmd := &cobra.Command{
+		Use:   "receive",
+		Short: "Show receive address for account",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Load account
+			if account == "" {
+				return fmt.Errorf("account name required")
+			}
+
+			if err := w.LoadAccount(account); err != nil {
+				return err
+			}
+
+			// Get account info to show address
+			accounts, err := w.ListAccounts()
+			if err != nil {
+				return err
+			}
+
+			for _, acc := range accounts {
+				if acc.Name == account {
+					fmt.Printf("Receive Address: %s\n", acc.Address)
+					fmt.Printf("Account: %s\n", acc.Name)
+					return writeAddressQR(acc.Address, showQR, qrPNG)
+				}
+			}
+
+			return fmt.Errorf("account not found: %s", account)
+		},
+	}
+
+	cmd.Flags().StringVar(&account, "account", "", "Account name (required)")
+	cmd.Flags().BoolVar(&showQR, "qr", false, "Show the address as a QR code in the terminal")
+	cmd.Flags().StringVar(&qrPNG, "qr-png", "", "Also write the address QR code to this PNG file")
+	cmd.MarkFlagRequired("account")
+
+	return cmd
+}
+
+// qrPNGSize is the width and height in pixels of QR codes written as PNG
+const qrPNGSize = 256
+
+// writeAddressQR renders the address as a QR code on the terminal and/or as
+// a PNG file
+func writeAddressQR(address string, show bool, pngFile string) error {
+	if !show && pngFile == "" {
+		return nil
+	}
+
+	code, err := qrcode.New(address, qrcode.Medium)
+	if err != nil {
+		return fmt.Errorf("failed to encode QR code: %v", err)
+	}
+
+	if show {
+		fmt.Println()
+		fmt.Print(code.ToSmallString(false))
+	}
+
+	if pngFile != "" {
+		if err := code.WriteFile(qrPNGSize, pngFile); err != nil {
+			return fmt.Errorf("failed to write QR code: %v", err)
+		}
+		fmt.Printf("QR code written to %s\n", pngFile)
+	}
+
+	return nil
+}
+
+func submitPatchCmd() *cobra.Command {
+	var file, account, spec, code, codeHash string
+	var gas int64
+	var wait, dryRun bool
+	var waitTimeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "submit-patch",
+		Short: "Submit a patch set",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if dryRun {
+				patchFile := file
+				if code != "" {
+					patchFile = code
+				}
+				if patchFile == "" {
+					return fmt.Errorf("patch file required (use --file or --code)")
+				}
+				return dryRunPatch(patchFile, spec, codeHash, gas)
+			}
+
+			// If no account specified, try to use the first available account
+			if account == "" {
+				accounts, err := w.ListAccounts()
+				if err != nil {
+					return fmt.Errorf("failed to list accounts: %v", err)
+				}
+				if len(accounts) == 0 {
+					return fmt.Errorf("no accounts found, please create an account first")
+				}
+				account = accounts[0].Name
+			}
+
+			if err := w.LoadAccount(account); err != nil {
+				return err
+			}
+
+			// Determine which file to use
+			patchFile := file
+			if code != "" {
+				patchFile = code
+			}
+
+			if patchFile == "" {
+				return fmt.Errorf("patch file required (use --file or --code)")
+			}
+
+			// Display submission details
+			fmt.Printf("Submitting PatchSet:\n")
+			fmt.Printf("  Spec: %s\n", spec)
+			fmt.Printf("  Code: %s\n", patchFile)
+			fmt.Printf("  Hash: %s\n", codeHash)
+			fmt.Printf("  Gas: %d\n", gas)
+			fmt.Printf("  Account: %s\n", account)
+			fmt.Println()
+
+			txHash, err := w.SubmitPatch(patchFile, codeHash, gas)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("✅ Patch submitted successfully!\n")
+			fmt.Printf("Transaction Hash: %s\n", txHash)
+			if !wait {
+				fmt.Printf("The transaction will be packaged into the next block.\n")
+				return nil
+			}
+			return waitForReceipt(txHash, waitTimeout)
+		},
+	}
+
+	cmd.Flags().StringVar(&file, "file", "", "Patch file path")
+	cmd.Flags().StringVar(&account, "account", "", "Account name (optional, uses first account if not specified)")
+	cmd.Flags().StringVar(&spec, "spec", "", "Specification ID (e.g., SYS-BOOTSTRAP-DEVNET-001), or a problem spec JSON file with --dry-run")
+	cmd.Flags().StringVar(&code, "code", "", "Code package file path")
+	cmd.Flags().StringVar(&codeHash, "code-hash", "", "Expected SHA-256 of the patch code; the submission is refused if it differs")
+	cmd.Flags().Int64Var(&gas, "gas", types.DefaultPatchGasLimit, "Gas limit for the transaction")
+	cmd.Flags().BoolVar(&wait, "wait", false, "Wait until the transaction is mined")
+	cmd.Flags().DurationVar(&waitTimeout, "wait-timeout", defaultWaitTimeout, "How long --wait waits for the transaction to be mined")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Evaluate the patch locally and report its gas without submitting it")
+
+	return cmd
+}
+
+// dryRunPatch evaluates a patch with the chain's own evaluator and reports
+// the gas it would use, without signing or broadcasting anything
+func dryRunPatch(patchFile, spec, codeHash string, gasLimit int64) error {
+	patch, err := wallet.ReadPatchSet(patchFile)
+	if err != nil {
+		return err
+	}
+	if err := wallet.StampCodeHash(patch, codeHash); err != nil {
+		return err
+	}
+
+	problem, err := loadDryRunSpec(spec, patch.ProblemID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Dry run of patch %s\n", patch.ID)
+	fmt.Printf("  Problem: %s (%s)\n", problem.ID, problem.Title)
+	if patch.ProblemID != problem.ID {
+		fmt.Printf("  Warning: patch names problem %q; on chain it would be evaluated against that problem\n", patch.ProblemID)
+	}
+	fmt.Printf("  Code Hash: %s\n", patch.CodeHash)
+	if patch.EncodedArtifact != "" {
+		fmt.Printf("  Artifact: %s\n", patch.ContentType)
+	}
+	fmt.Printf("  Size: %d bytes\n", patch.Size())
+	fmt.Printf("  Test cases: %d\n", len(problem.TestSuite))
+
+	gas := types.PatchGas(patch, len(problem.TestSuite))
+	fmt.Printf("  Gas: %d of limit %d\n", gas, gasLimit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), consensus.EvalTimeout)
+	defer cancel()
+	passed, evalErr := consensus.CheckPatch(ctx, patch)
+
+	switch {
+	case evalErr != nil:
+		fmt.Printf("  Result: ❌ evaluation failed: %v\n", evalErr)
+	case passed:
+		fmt.Printf("  Result: ✅ passed\n")
+	default:
+		fmt.Printf("  Result: ❌ failed\n")
+	}
+	fmt.Println("Nothing was submitted.")
+
+	if gas > gasLimit {
+		return fmt.Errorf("patch needs %d gas, more than the limit of %d", gas, gasLimit)
+	}
+	if evalErr != nil || !passed {
+		return fmt.Errorf("patch did not pass evaluation")
+	}
+	return nil
+}
+
+// loadDryRunSpec reads a problem spec from a JSON file, or fetches it from the
+// node by ID, defaulting to the problem the patch names
+func loadDryRunSpec(spec, problemID string) (*types.ProblemSpec, error) {
+	if spec != "" {
+		if data, err := os.ReadFile(spec); err == nil {
+			var problem types.ProblemSpec
+			if err := json.Unmarshal(data, &problem); err != nil {
+				return nil, fmt.Errorf("invalid problem spec %s: %v", spec, err)
+			}
+			return &problem, nil
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read problem spec: %v", err)
+		}
+		problemID = spec
+	}
+
+	problem, err := w.GetProblem(problemID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch problem %s: %v", problemID, err)
+	}
+	return &problem.Spec, nil
+}
+
+func claimCmd() *cobra.Command {
+	var account string
+	var amount int64
+	var check bool
+
+	cmd := &cobra.Command{
+		Use:   "claim",
+		Short: "Claim available rewards",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// If no account specified, try to use the first available account
+			if account == "" {
+				accounts, err := w.ListAccounts()
+				if err != nil {
+					return fmt.Errorf("failed to list accounts: %v", err)
+				}
+				if len(accounts) == 0 {
+					return fmt.Errorf("no accounts found, please create an account first")
+				}
+				account = accounts[0].Name
+			}
+
+			if err := w.LoadAccount(account); err != nil {
+				return err
+			}
+
+			if check {
+				// Check claimable amount
+				claimable, err := w.GetClaimableRewards()
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Claimable rewards for %s: %d tokens\n", account, claimable)
+				return nil
+			}
+
+			// Claim rewards
+			txHash, claimed, err := w.ClaimRewards(amount)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("✅ Rewards claimed successfully!\n")
+			fmt.Printf("Account: %s\n", account)
+			fmt.Printf("Amount claimed: %d tokens\n", claimed)
+			fmt.Printf("Transaction Hash: %s\n", txHash)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&account, "account", "", "Account name (optional, uses first account if not specified)")
+	cmd.Flags().Int64Var(&amount, "amount", 0, "Amount to claim (0 = claim all available)")
+	cmd.Flags().BoolVar(&check, "check", false, "Check claimable amount without claiming")
+
+	return cmd
+}
+
+func problemCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "problem",
+		Short: "Create, fund, close and inspect on-chain problems",
+	}
+
+	var account string
+	var fee int64
+
+	loadCreator := func() error {
+		if fee < 0 {
+			return fmt.Errorf("fee must not be negative")
+		}
+		return w.LoadAccount(account)
+	}
+
+	var specFile string
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Publish a problem and escrow its reward",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := os.ReadFile(specFile)
+			if err != nil {
+				return fmt.Errorf("failed to read problem spec: %v", err)
+			}
+
+			var spec types.ProblemSpec
+			if err := json.Unmarshal(data, &spec); err != nil {
+				return fmt.Errorf("failed to parse problem spec: %v", err)
+			}
+
+			if err := loadCreator(); err != nil {
+				return err
+			}
+
+			txHash, err := w.CreateProblem(&spec, fee)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Problem %s submitted with reward %d\n", spec.ID, spec.Reward)
+			fmt.Printf("Transaction: %s\n", txHash)
+			return nil
+		},
+	}
+	createCmd.Flags().StringVar(&specFile, "spec", "", "Problem spec JSON file (required)")
+	createCmd.MarkFlagRequired("spec")
+
+	var problemID, amountStr string
+	addRewardCmd := &cobra.Command{
+		Use:   "add-reward",
+		Short: "Increase the reward of an open problem you created",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := loadCreator(); err != nil {
+				return err
+			}
+
+			amount, err := w.ParseAmount(amountStr)
+			if err != nil {
+				return err
+			}
+
+			txHash, err := w.AddProblemReward(problemID, amount, fee)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Reward increase of %s submitted for problem %s\n", w.FormatAmount(amount), problemID)
+			fmt.Printf("Transaction: %s\n", txHash)
+			return nil
+		},
+	}
+	addRewardCmd.Flags().StringVar(&problemID, "id", "", "Problem ID (required)")
+	addRewardCmd.Flags().StringVar(&amountStr, "amount", "", "Amount in tokens to add to the reward (required)")
+	addRewardCmd.MarkFlagRequired("id")
+	addRewardCmd.MarkFlagRequired("amount")
+
+	closeCmd := &cobra.Command{
+		Use:   "close",
+		Short: "Close an unsolved problem you created and reclaim its escrow",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := loadCreator(); err != nil {
 				return err
 			}
 
-			if check {
-				// Check claimable amount
-				claimable, err := w.GetClaimableRewards()
-				if err != nil {
-					return err
-				}
-				fmt.Printf("Claimable rewards for %s: %d tokens\n", account, claimable)
-				return nil
+			txHash, err := w.CloseProblem(problemID, fee)
+			if err != nil {
+				return err
 			}
 
-			// Claim rewards
-			txHash, claimed, err := w.ClaimRewards(amount)
+			fmt.Printf("Close submitted for problem %s\n", problemID)
+			fmt.Printf("Transaction: %s\n", txHash)
+			return nil
+		},
+	}
+	closeCmd.Flags().StringVar(&problemID, "id", "", "Problem ID (required)")
+	closeCmd.MarkFlagRequired("id")
+
+	for _, sub := range []*cobra.Command{createCmd, addRewardCmd, closeCmd} {
+		sub.Flags().StringVar(&account, "account", "", "Creator account name (required)")
+		sub.Flags().Int64Var(&fee, "fee", types.DefaultTxFee, "Transaction fee paid to the block validator")
+		sub.MarkFlagRequired("account")
+	}
+
+	showCmd := &cobra.Command{
+		Use:   "show",
+		Short: "Show the on-chain state of a problem",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			problem, err := w.GetProblem(problemID)
 			if err != nil {
 				return err
 			}
 
-			fmt.Printf("✅ Rewards claimed successfully!\n")
-			fmt.Printf("Account: %s\n", account)
-			fmt.Printf("Amount claimed: %d tokens\n", claimed)
-			fmt.Printf("Transaction Hash: %s\n", txHash)
+			fmt.Printf("Problem: %s\n", problem.Spec.ID)
+			fmt.Printf("  Title: %s\n", problem.Spec.Title)
+			fmt.Printf("  Creator: %s\n", problem.Creator)
+			fmt.Printf("  Status: %s\n", problem.Status)
+			fmt.Printf("  Escrow: %d\n", problem.Escrow)
+			if problem.Status == types.ProblemStatusSolved {
+				fmt.Printf("  Solved By: %s\n", problem.SolvedBy)
+			}
 			return nil
 		},
 	}
+	showCmd.Flags().StringVar(&problemID, "id", "", "Problem ID (required)")
+	showCmd.MarkFlagRequired("id")
 
-	cmd.Flags().StringVar(&account, "account", "", "Account name (optional, uses first account if not specified)")
-	cmd.Flags().Int64Var(&amount, "amount", 0, "Amount to claim (0 = claim all available)")
-	cmd.Flags().BoolVar(&check, "check", false, "Check claimable amount without claiming")
-
+	cmd.AddCommand(createCmd, addRewardCmd, closeCmd, showCmd)
 	return cmd
 }
 
 func stakeCmd() *cobra.Command {
-	var account, role string
-	var amount int64
+	var account, role, validator, amountStr string
+	var fee int64
 	var unstake bool
 
 	cmd := &cobra.Command{
@@ -390,27 +1299,38 @@ func stakeCmd() *cobra.Command {
 
 			if unstake {
 				// Unstake tokens
-				txHash, unstakedAmount, err := w.Unstake()
+				txHash, unstakedAmount, err := w.Unstake(fee)
 				if err != nil {
 					return err
 				}
 				fmt.Printf("✅ Unstaking successful!\n")
 				fmt.Printf("Account: %s\n", account)
-				fmt.Printf("Amount unstaked: %d tokens\n", unstakedAmount)
+				fmt.Printf("Amount unstaked: %s tokens\n", w.FormatAmount(unstakedAmount))
 				fmt.Printf("Transaction Hash: %s\n", txHash)
-				fmt.Printf("Note: Unstaked tokens will be available after unbonding period\n")
+				if info, err := w.GetChainInfo(); err == nil && info.UnbondingPeriod > 0 {
+					fmt.Printf("Tokens return to your balance %d blocks after the transaction is included\n", info.UnbondingPeriod)
+				}
 				return nil
 			}
 
 			// Stake tokens
-			txHash, err := w.Stake(amount, role)
+			var amount int64
+			if amountStr != "" {
+				parsed, err := w.ParseAmount(amountStr)
+				if err != nil {
+					return err
+				}
+				amount = parsed
+			}
+
+			txHash, err := w.Stake(amount, role, validator, fee)
 			if err != nil {
 				return err
 			}
 
 			fmt.Printf("✅ Staking successful!\n")
 			fmt.Printf("Account: %s\n", account)
-			fmt.Printf("Amount staked: %d tokens\n", amount)
+			fmt.Printf("Amount staked: %s tokens\n", w.FormatAmount(amount))
 			fmt.Printf("Role: %s\n", role)
 			fmt.Printf("Transaction Hash: %s\n", txHash)
 
@@ -435,8 +1355,10 @@ func stakeCmd() *cobra.Command {
 	}
 
 	cmd.Flags().StringVar(&account, "account", "", "Account name (optional, uses first account if not specified)")
-	cmd.Flags().Int64Var(&amount, "amount", 0, "Amount to stake (required for staking)")
+	cmd.Flags().StringVar(&amountStr, "amount", "", "Amount to stake in tokens (required for staking)")
 	cmd.Flags().StringVar(&role, "role", "delegator", "Staking role: validator or delegator")
+	cmd.Flags().StringVar(&validator, "validator", "", "Validator address to delegate to (delegators only)")
+	cmd.Flags().Int64Var(&fee, "fee", types.DefaultTxFee, "Transaction fee")
 	cmd.Flags().BoolVar(&unstake, "unstake", false, "Unstake all staked tokens")
 
 	return cmd
@@ -458,6 +1380,517 @@ func heightCmd() *cobra.Command {
 	}
 }
 
+func statusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show whether the node has caught up with its peers",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			status, err := w.GetSyncStatus()
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Height: %d\n", status.CurrentHeight)
+			fmt.Printf("Highest Peer Height: %d\n", status.HighestPeerHeight)
+			if status.Syncing {
+				fmt.Printf("Status: syncing (%d blocks behind)\n", status.HighestPeerHeight-status.CurrentHeight)
+			} else {
+				fmt.Println("Status: caught up")
+			}
+			return nil
+		},
+	}
+}
+
+func delegationsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delegations <validator>",
+		Short: "List the stake delegated to a validator",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			delegations, err := w.GetDelegations(args[0])
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Validator: %s\n", delegations.Validator)
+			fmt.Printf("Commission: %d%%\n", delegations.Commission)
+			fmt.Printf("Delegated: %s tokens\n", w.FormatAmount(delegations.Delegated))
+
+			if len(delegations.Delegations) == 0 {
+				fmt.Println("No delegations")
+				return nil
+			}
+
+			fmt.Printf("\n%-44s %s\n", "Delegator", "Amount")
+			for _, delegation := range delegations.Delegations {
+				fmt.Printf("%-44s %s\n", delegation.Address, w.FormatAmount(delegation.Amount))
+			}
+			return nil
+		},
+	}
+}
+
+func nextProposerCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "next-proposer",
+		Short: "Show the validator scheduled to propose the next block",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			proposer, height, err := w.GetNextProposer()
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Next Height: %d\n", height)
+			fmt.Printf("Proposer: %s\n", proposer)
+			return nil
+		},
+	}
+}
+
+func peersCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "peers",
+		Short: "List the peers the node is connected to",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			peers, err := w.GetPeers()
+			if err != nil {
+				return err
+			}
+
+			if len(peers) == 0 {
+				fmt.Println("No connected peers")
+				return nil
+			}
+
+			fmt.Printf("%-54s %-24s %s\n", "Peer ID", "Address", "Last Seen")
+			for _, peer := range peers {
+				address := "-"
+				if peer.Address != "" {
+					address = net.JoinHostPort(peer.Address, strconv.Itoa(peer.Port))
+				}
+				lastSeen := "-"
+				if !peer.LastSeen.IsZero() {
+					lastSeen = fmt.Sprintf("%s ago", time.Since(peer.LastSeen).Round(time.Second))
+				}
+				fmt.Printf("%-54s %-24s %s\n", peer.ID, address, lastSeen)
+			}
+			fmt.Printf("\n%d peers\n", len(peers))
+			return nil
+		},
+	}
+}
+
+func mempoolCmd() *cobra.Command {
+	var address string
+	var offset, limit int
+
+	cmd := &cobra.Command{
+		Use:   "mempool",
+		Short: "List transactions waiting in the node's pool",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, total, err := w.GetMempool(address, offset, limit)
+			if err != nil {
+				return err
+			}
+
+			if total == 0 {
+				fmt.Println("Mempool is empty")
+				return nil
+			}
+
+			fmt.Printf("%-68s %-14s %-42s %-42s %12s %6s %6s\n", "Hash", "Type", "From", "To", "Amount", "Fee", "Nonce")
+			for _, entry := range entries {
+				fmt.Printf("%-68s %-14s %-42s %-42s %12s %6d %6d\n",
+					entry.Hash, entry.Type, entry.From, entry.To, w.FormatAmount(entry.Amount), entry.Fee, entry.Nonce)
+			}
+			fmt.Printf("\nShowing %d-%d of %d pending transactions\n", offset+1, offset+len(entries), total)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&address, "address", "", "Only show transactions sent from or to this address")
+	cmd.Flags().IntVar(&offset, "offset", 0, "Number of entries to skip")
+	cmd.Flags().IntVar(&limit, "limit", 50, "Maximum number of entries to show")
+
+	return cmd
+}
+
+func blocksCmd() *cobra.Command {
+	var from, to int64
+
+	cmd := &cobra.Command{
+		Use:   "blocks",
+		Short: "List a range of blocks",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Default to the most recent blocks
+			if !cmd.Flags().Changed("to") {
+				height, err := w.GetHeight()
+				if err != nil {
+					return err
+				}
+				to = height
+			}
+			if !cmd.Flags().Changed("from") {
+				from = to - 9
+				if from < 0 {
+					from = 0
+				}
+			}
+
+			blocks, err := w.GetBlocks(from, to)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("%-8s %-68s %-25s %-42s %s\n", "Height", "Hash", "Time", "Validator", "Txs")
+			for _, block := range blocks {
+				fmt.Printf("%-8d %-68s %-25s %-42s %d\n",
+					block.Height, block.Hash, time.Unix(block.Timestamp, 0).Format(time.RFC3339), block.Validator, block.TxCount)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().Int64Var(&from, "from", 0, "First block height (default: 9 below --to)")
+	cmd.Flags().Int64Var(&to, "to", 0, "Last block height (default: chain tip)")
+
+	return cmd
+}
+
+func blockCmd() *cobra.Command {
+	var height int64
+	var hash string
+
+	cmd := &cobra.Command{
+		Use:   "block",
+		Short: "Show a block by height or hash",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var block *types.Block
+			var err error
+
+			switch {
+			case hash != "":
+				block, err = w.GetBlockByHash(hash)
+			case cmd.Flags().Changed("height"):
+				block, err = w.GetBlockByHeight(height)
+			default:
+				return fmt.Errorf("either --height or --hash is required")
+			}
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Block #%d\n", block.Header.Height)
+			fmt.Printf("  Hash: 0x%s\n", block.Header.Hash)
+			fmt.Printf("  Previous Hash: 0x%s\n", block.Header.PrevHash)
+			fmt.Printf("  Merkle Root: 0x%s\n", block.Header.MerkleRoot)
+			fmt.Printf("  State Root: 0x%s\n", block.Header.StateRoot)
+			fmt.Printf("  Timestamp: %s\n", time.Unix(block.Header.Timestamp, 0).Format(time.RFC3339))
+			fmt.Printf("  Validator: %s\n", block.Header.Validator)
+			fmt.Printf("  Transactions: %d\n", len(block.Txs))
+
+			for i, tx := range block.Txs {
+				fmt.Printf("\n  [%d] 0x%s\n", i, tx.Hash)
+				fmt.Printf("      Type: %s\n", tx.Type)
+				fmt.Printf("      From: %s\n", tx.From)
+				fmt.Printf("      To: %s\n", tx.To)
+				fmt.Printf("      Amount: %d\n", tx.Amount)
+				fmt.Printf("      Fee: %d\n", tx.Fee)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().Int64Var(&height, "height", 0, "Block height")
+	cmd.Flags().StringVar(&hash, "hash", "", "Block hash (0x-prefixed hex)")
+
+	return cmd
+}
+
+func verifyChainCmd() *cobra.Command {
+	var checkpointFile string
+
+	cmd := &cobra.Command{
+		Use:   "verify-chain",
+		Short: "Verify the node's header chain from a trusted checkpoint",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := os.ReadFile(checkpointFile)
+			if err != nil {
+				return fmt.Errorf("failed to read checkpoint: %v", err)
+			}
+
+			var checkpoint wallet.Checkpoint
+			if err := json.Unmarshal(data, &checkpoint); err != nil {
+				return fmt.Errorf("failed to parse checkpoint: %v", err)
+			}
+
+			result, err := w.VerifyChain(&checkpoint)
+			if err != nil {
+				return fmt.Errorf("chain verification failed: %v", err)
+			}
+
+			fmt.Printf("Chain is valid\n")
+			fmt.Printf("Checkpoint Height: %d\n", result.FromHeight)
+			fmt.Printf("Tip Height: %d\n", result.TipHeight)
+			fmt.Printf("Tip Hash: 0x%s\n", result.TipHash)
+			fmt.Printf("Headers Verified: %d\n", result.Headers)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&checkpointFile, "from-checkpoint", "", "Checkpoint file with trusted height and hash")
+	cmd.MarkFlagRequired("from-checkpoint")
+
+	return cmd
+}
+
+func tailEventsCmd() *cobra.Command {
+	var wsURL, address string
+	var eventTypes []string
+	var reconnectAttempts int
+
+	cmd := &cobra.Command{
+		Use:   "tail-events",
+		Short: "Stream new blocks, transactions and reorgs from the node",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if wsURL == "" {
+				wsURL = w.EventsURL()
+			}
+
+			filter := &wallet.EventFilter{Types: eventTypes}
+			if address != "" {
+				addr, err := crypto.AddressFromString(address)
+				if err != nil {
+					return fmt.Errorf("invalid address: %v", err)
+				}
+				filter.Address = &addr
+			}
+
+			reconnect := &wallet.Reconnect{
+				MaxAttempts: reconnectAttempts,
+				OnDisconnect: func(err error) {
+					fmt.Fprintf(os.Stderr, "Warning: %v; reconnecting\n", err)
+				},
+				OnGap: printEventGap,
+			}
+
+			fmt.Printf("Streaming events from %s (Ctrl+C to stop)\n", wsURL)
+			return w.SubscribeEvents(wsURL, filter, reconnect, func(event *blockchain.Event) error {
+				printEvent(event)
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&wsURL, "rpc-ws", "", "WebSocket event feed URL (default: derived from --rpc)")
+	cmd.Flags().StringSliceVar(&eventTypes, "type", nil, "Only show these event types (block, transaction, reorg)")
+	cmd.Flags().StringVar(&address, "address", "", "Only show blocks and transactions involving this address")
+	cmd.Flags().IntVar(&reconnectAttempts, "reconnect-attempts", -1, "Redials before giving up when the feed drops (0 disables, negative retries forever)")
+
+	return cmd
+}
+
+// printEventGap warns that events may have been missed while the feed was down
+func printEventGap(gap *wallet.EventGap) {
+	downtime := gap.Reconnected.Sub(gap.Disconnected).Round(time.Second)
+	fmt.Fprintf(os.Stderr, "Warning: reconnected after %s; ", downtime)
+
+	switch {
+	case gap.LastHeight >= 0 && gap.Height > gap.LastHeight:
+		fmt.Fprintf(os.Stderr, "events for blocks %d-%d may have been missed\n", gap.LastHeight+1, gap.Height)
+	case gap.LastHeight >= 0 && gap.Height >= 0:
+		fmt.Fprintf(os.Stderr, "no blocks were missed, but pending transaction events may have been\n")
+	default:
+		fmt.Fprintf(os.Stderr, "events may have been missed\n")
+	}
+}
+
+// printEvent writes a one-line summary of a chain event
+func printEvent(event *blockchain.Event) {
+	stamp := time.Unix(event.Time, 0).Format("15:04:05")
+
+	switch event.Type {
+	case blockchain.EventBlock:
+		if event.Block == nil {
+			return
+		}
+		header := event.Block.Header
+		fmt.Printf("[%s] block #%d 0x%s validator %s txs %d\n",
+			stamp, header.Height, header.Hash, header.Validator, len(event.Block.Txs))
+	case blockchain.EventTransaction:
+		if event.Transaction == nil {
+			return
+		}
+		tx := event.Transaction
+		fmt.Printf("[%s] tx 0x%s %s %s -> %s amount %d fee %d\n",
+			stamp, tx.Hash, tx.Type, tx.From, tx.To, tx.Amount, tx.Fee)
+	case blockchain.EventReorg:
+		if event.Reorg == nil {
+			return
+		}
+		reorg := event.Reorg
+		fmt.Printf("[%s] reorg 0x%s -> 0x%s (ancestor #%d, -%d/+%d blocks)\n",
+			stamp, reorg.OldTip, reorg.NewTip, reorg.Ancestor, reorg.Disconnected, reorg.Connected)
+	default:
+		fmt.Printf("[%s] %s\n", stamp, event.Type)
+	}
+}
+
+func historyCmd() *cobra.Command {
+	var address, account, format, outFile, txType string
+	var offset, limit int
+
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Show or export an account's transaction history, newest first",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "csv" {
+				return fmt.Errorf("unsupported format %q (use table or csv)", format)
+			}
+
+			if account != "" {
+				if err := w.LoadAccount(account); err != nil {
+					return err
+				}
+				address = w.GetAddress().String()
+			}
+			if address == "" {
+				return fmt.Errorf("either --account or --address is required")
+			}
+
+			owner, err := crypto.AddressFromString(address)
+			if err != nil {
+				return fmt.Errorf("invalid address: %v", err)
+			}
+
+			entries, total, err := w.GetHistory(address, txType, offset, limit)
+			if err != nil {
+				return err
+			}
+
+			out := io.Writer(os.Stdout)
+			if outFile != "" {
+				file, err := os.Create(outFile)
+				if err != nil {
+					return fmt.Errorf("failed to create output file: %v", err)
+				}
+				defer file.Close()
+				out = file
+			}
+
+			if format == "csv" {
+				if err := writeHistoryCSV(out, owner, entries); err != nil {
+					return err
+				}
+			} else {
+				writeHistoryTable(out, owner, entries)
+				if len(entries) > 0 && offset+len(entries) < total {
+					fmt.Fprintf(out, "Showing %d-%d of %d transactions\n", offset+1, offset+len(entries), total)
+				}
+			}
+
+			if outFile != "" {
+				fmt.Printf("Wrote %d transactions to %s\n", len(entries), outFile)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&account, "account", "", "Account name")
+	cmd.Flags().StringVar(&address, "address", "", "Address to show history for")
+	cmd.Flags().StringVar(&format, "format", "table", "Output format (table or csv)")
+	cmd.Flags().StringVar(&outFile, "out", "", "Write to this file instead of stdout")
+	cmd.Flags().StringVar(&txType, "type", "", "Only show transactions of this type (e.g. transfer, stake)")
+	cmd.Flags().IntVar(&offset, "offset", 0, "Number of newest matching transactions to skip")
+	cmd.Flags().IntVar(&limit, "limit", 0, "Maximum number of transactions to show (0 for all)")
+
+	return cmd
+}
+
+// historyRow describes a transaction from the point of view of owner
+type historyRow struct {
+	Time         string
+	Height       int64
+	Type         string
+	Direction    string
+	Counterparty string
+	Amount       int64
+	Fee          int64
+	Hash         string
+}
+
+func newHistoryRow(owner types.Address, entry *wallet.HistoryEntry) historyRow {
+	tx := &entry.Transaction
+	row := historyRow{
+		Time:   time.Unix(entry.BlockTime, 0).UTC().Format(time.RFC3339),
+		Height: entry.BlockHeight,
+		Type:   tx.Type,
+		Amount: tx.Amount,
+		Hash:   "0x" + tx.Hash.String(),
+	}
+
+	// Only the sender pays the fee
+	switch {
+	case tx.From == owner && tx.To == owner:
+		row.Direction = "self"
+		row.Fee = tx.Fee
+	case tx.From == owner:
+		row.Direction = "out"
+		row.Fee = tx.Fee
+		if tx.To != (types.Address{}) {
+			row.Counterparty = tx.To.String()
+		}
+	default:
+		row.Direction = "in"
+		row.Counterparty = tx.From.String()
+	}
+
+	return row
+}
+
+// writeHistoryCSV writes history entries as CSV with a header row
+func writeHistoryCSV(out io.Writer, owner types.Address, entries []wallet.HistoryEntry) error {
+	writer := csv.NewWriter(out)
+	writer.Write([]string{"timestamp", "height", "type", "direction", "counterparty", "amount", "fee", "tx_hash"})
+
+	for i := range entries {
+		row := newHistoryRow(owner, &entries[i])
+		writer.Write([]string{
+			row.Time,
+			fmt.Sprintf("%d", row.Height),
+			row.Type,
+			row.Direction,
+			row.Counterparty,
+			fmt.Sprintf("%d", row.Amount),
+			fmt.Sprintf("%d", row.Fee),
+			row.Hash,
+		})
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV: %v", err)
+	}
+	return nil
+}
+
+// writeHistoryTable writes history entries as an aligned table
+func writeHistoryTable(out io.Writer, owner types.Address, entries []wallet.HistoryEntry) {
+	if len(entries) == 0 {
+		fmt.Fprintf(out, "No transactions found\n")
+		return
+	}
+
+	fmt.Fprintf(out, "%-20s %8s %-14s %-4s %-42s %12s %8s\n", "Time", "Height", "Type", "Dir", "Counterparty", "Amount", "Fee")
+	for i := range entries {
+		row := newHistoryRow(owner, &entries[i])
+		fmt.Fprintf(out, "%-20s %8d %-14s %-4s %-42s %12d %8d\n",
+			row.Time, row.Height, row.Type, row.Direction, row.Counterparty, row.Amount, row.Fee)
+	}
+}
+
 func getDefaultDataDir() string {
 	home, err := os.UserHomeDir()
 	if err != nil {
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"agent-chain/pkg/types"
+)
+
+// writeJSON writes v to name in a temporary directory and returns its path
+func writeJSON(t *testing.T, name string, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func TestDryRunPatch(t *testing.T) {
+	spec := writeJSON(t, "spec.json", types.ProblemSpec{
+		ID:        "PROB-1",
+		Title:     "Add two numbers",
+		Reward:    100,
+		TestSuite: []types.TestCase{{Input: "1 2", Expected: "3", Weight: 1}},
+	})
+
+	tests := []struct {
+		name  string
+		patch types.PatchSet
+		gas   int64
+		err   string
+	}{
+		{"passing patch", types.PatchSet{
+			ID:        "patch-1",
+			ProblemID: "PROB-1",
+			Code:      "func add(a, b int) int { return a + b }",
+			Language:  "go",
+		}, types.DefaultPatchGasLimit, ""},
+		{"patch without code", types.PatchSet{
+			ID:        "patch-2",
+			ProblemID: "PROB-1",
+			Language:  "go",
+		}, types.DefaultPatchGasLimit, "did not pass evaluation"},
+		{"gas limit too low", types.PatchSet{
+			ID:        "patch-3",
+			ProblemID: "PROB-1",
+			Code:      "func add(a, b int) int { return a + b }",
+			Language:  "go",
+		}, 1, "more than the limit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patchFile := writeJSON(t, "patch.json", tt.patch)
+			err := dryRunPatch(patchFile, spec, "", tt.gas)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("dryRunPatch: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("dryRunPatch error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
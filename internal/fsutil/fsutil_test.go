@@ -0,0 +1,52 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	tests := []struct {
+		name string
+		data string
+		perm os.FileMode
+	}{
+		{"creates the file", `{"height":1}`, 0644},
+		{"replaces the file", `{"height":2}`, 0600},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := WriteFileAtomic(path, []byte(tt.data), tt.perm); err != nil {
+				t.Fatalf("WriteFileAtomic: %v", err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			if string(data) != tt.data {
+				t.Errorf("contents = %s, want %s", data, tt.data)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("Stat: %v", err)
+			}
+			if info.Mode().Perm() != tt.perm {
+				t.Errorf("mode = %v, want %v", info.Mode().Perm(), tt.perm)
+			}
+
+			// No temporary file is left beside the target
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("ReadDir: %v", err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("directory holds %d files, want 1", len(entries))
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"agent-chain/pkg/types"
+)
+
+// AuditEntry records a single applied transaction and its effect on balances
+type AuditEntry struct {
+	Time        int64            `json:"time"`
+	BlockHeight int64            `json:"block_height"`
+	BlockHash   string           `json:"block_hash"`
+	TxHash      string           `json:"tx_hash"`
+	Type        string           `json:"type"`
+	From        string           `json:"from"`
+	To          string           `json:"to"`
+	Amount      int64            `json:"amount"`
+	Fee         int64            `json:"fee"`
+	Balances    map[string]int64 `json:"balances"`
+}
+
+// openAuditLog opens the append-only audit log when audit logging is enabled
+func (bc *Blockchain) openAuditLog() error {
+	if !bc.config.AuditLog {
+		return nil
+	}
+
+	file, err := os.OpenFile(filepath.Join(bc.dataDir, "audit.jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	bc.auditLog = file
+	return nil
+}
+
+// recordAudit queues an entry for an applied transaction, including the
+// resulting balances of every account it touched. Entries are written by
+// flushAudit once the whole block has applied.
+func (bc *Blockchain) recordAudit(tx *types.Transaction, header *types.BlockHeader) {
+	if bc.auditLog == nil {
+		return
+	}
+
+	touched := []types.Address{tx.From}
+	if tx.Type == types.TxTypeTransfer || tx.Type == types.TxTypePatchReward {
+		touched = append(touched, tx.To)
+	}
+	if (tx.Fee > 0 && tx.Type != types.TxTypePatchSubmit) || tx.GasUsed*bc.config.GasPrice > 0 {
+		touched = append(touched, header.Validator)
+	}
+
+	balances := make(map[string]int64, len(touched))
+	for _, addr := range touched {
+		balances[addr.String()] = bc.GetAccount(addr).Balance
+	}
+
+	bc.pendingAudit = append(bc.pendingAudit, AuditEntry{
+		Time:        time.Now().Unix(),
+		BlockHeight: header.Height,
+		BlockHash:   "0x" + header.Hash.String(),
+		TxHash:      "0x" + tx.Hash.String(),
+		Type:        tx.Type,
+		From:        tx.From.String(),
+		To:          tx.To.String(),
+		Amount:      tx.Amount,
+		Fee:         tx.Fee,
+		Balances:    balances,
+	})
+}
+
+// flushAudit appends the queued entries to the audit log
+func (bc *Blockchain) flushAudit() error {
+	entries := bc.pendingAudit
+	bc.pendingAudit = nil
+
+	if bc.auditLog == nil || len(entries) == 0 {
+		return nil
+	}
+
+	var buf []byte
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, data...), '\n')
+	}
+
+	if _, err := bc.auditLog.Write(buf); err != nil {
+		return err
+	}
+	return bc.auditLog.Sync()
+}
@@ -1,37 +1,133 @@
 package blockchain
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"agent-chain/internal/fsutil"
+	"agent-chain/pkg/crypto"
 	"agent-chain/pkg/types"
 )
 
+// ErrClosed is returned for writes attempted after Close
+var ErrClosed = errors.New("blockchain is closed")
+
+// InvalidBlockError reports a block that is invalid in itself: a wrong hash,
+// signature, proof of work or proposer, or a forged transaction. Unlike a
+// block that does not fit the local chain or clock yet, it proves that the
+// peer sending it misbehaves.
+type InvalidBlockError struct {
+	Reason string
+}
+
+func (e *InvalidBlockError) Error() string {
+	return e.Reason
+}
+
+// invalidBlock returns an InvalidBlockError with a formatted reason
+func invalidBlock(format string, args ...interface{}) error {
+	return &InvalidBlockError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// IsInvalidBlock reports whether err is, or wraps, an InvalidBlockError
+func IsInvalidBlock(err error) bool {
+	var invalid *InvalidBlockError
+	return errors.As(err, &invalid)
+}
+
+// txLocation identifies where a mined transaction is stored
+type txLocation struct {
+	height int64
+	index  int
+}
+
+// TransactionInfo describes a transaction returned by GetTransaction
+type TransactionInfo struct {
+	Transaction *types.Transaction
+	Pending     bool
+	BlockHeight int64
+	BlockHash   types.Hash
+	BlockTime   int64
+	Index       int
+}
+
 // Blockchain represents the main blockchain structure
 type Blockchain struct {
-	mu        sync.RWMutex
-	blocks    []*types.Block
-	accounts  map[types.Address]*types.Account
-	txPool    map[types.Hash]*types.Transaction
-	config    *types.ChainConfig
-	dataDir   string
-	lastBlock *types.Block
-	height    int64
+	mu         sync.RWMutex
+	blocks     []*types.Block
+	blockIndex map[types.Hash]int64
+	txIndex    map[types.Hash]txLocation
+	addrIndex  map[types.Address][]types.Hash
+	accounts   map[types.Address]*types.Account
+	txPool     map[types.Hash]*types.Transaction
+	problems   map[string]*types.Problem
+	config     *types.ChainConfig
+	dataDir    string
+	lastBlock  *types.Block
+	genesis    types.Hash
+	height     int64
+	finalized  int64
+	auditLog   *os.File
+	closed     bool
+
+	pendingAudit   []AuditEntry
+	pendingPatches map[types.Hash]*types.Transaction
+	stakes         map[types.Address]*types.Stake
+	patchCodes     map[string]types.Hash
+	sideBlocks     map[types.Hash]*types.Block
+	undo           map[types.Hash]*blockUndo
+	txAppliers     map[string]TxApplier
+	blockEarnings  int64
+
+	subsMu      sync.Mutex
+	subscribers map[int]chan Event
+	nextSubID   int
+
+	blocksConnected int64
+	txsProcessed    int64
+	txsPooled       int64
+}
+
+// Stats reports chain activity counters since the node started
+type Stats struct {
+	Height                int64
+	MempoolSize           int
+	BlocksConnected       int64
+	TransactionsProcessed int64
+	TransactionsPooled    int64
 }
 
 // NewBlockchain creates a new blockchain instance
 func NewBlockchain(config *types.ChainConfig, dataDir string) (*Blockchain, error) {
 	bc := &Blockchain{
-		blocks:   make([]*types.Block, 0),
-		accounts: make(map[types.Address]*types.Account),
-		txPool:   make(map[types.Hash]*types.Transaction),
-		config:   config,
-		dataDir:  dataDir,
-		height:   0,
+		blocks:     make([]*types.Block, 0),
+		blockIndex: make(map[types.Hash]int64),
+		txIndex:    make(map[types.Hash]txLocation),
+		addrIndex:  make(map[types.Address][]types.Hash),
+		accounts:   make(map[types.Address]*types.Account),
+		txPool:     make(map[types.Hash]*types.Transaction),
+		problems:   make(map[string]*types.Problem),
+		config:     config,
+		dataDir:    dataDir,
+		height:     0,
+
+		pendingPatches: make(map[types.Hash]*types.Transaction),
+		stakes:         make(map[types.Address]*types.Stake),
+		patchCodes:     make(map[string]types.Hash),
+		sideBlocks:     make(map[types.Hash]*types.Block),
+		undo:           make(map[types.Hash]*blockUndo),
+		txAppliers:     defaultTxAppliers(),
+		subscribers:    make(map[int]chan Event),
 	}
 
 	// Create data directory
@@ -39,11 +135,30 @@ func NewBlockchain(config *types.ChainConfig, dataDir string) (*Blockchain, erro
 		return nil, fmt.Errorf("failed to create data directory: %v", err)
 	}
 
+	// Finish a write cut short by a crash before reading anything back
+	if err := bc.recoverCommit(); err != nil {
+		return nil, fmt.Errorf("failed to recover interrupted write: %v", err)
+	}
+
+	// Upgrade data written by older versions before reading any of it
+	if err := migrateDataDir(dataDir); err != nil {
+		return nil, err
+	}
+
 	// Initialize genesis block
 	if err := bc.initGenesis(); err != nil {
 		return nil, fmt.Errorf("failed to initialize genesis: %v", err)
 	}
 
+	if err := bc.openAuditLog(); err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %v", err)
+	}
+
+	// Restore pending transactions from the previous run
+	if err := bc.loadMempool(); err != nil {
+		return nil, fmt.Errorf("failed to load mempool: %v", err)
+	}
+
 	return bc, nil
 }
 
@@ -52,58 +167,355 @@ func (bc *Blockchain) initGenesis() error {
 	// Check if genesis already exists
 	genesisPath := filepath.Join(bc.dataDir, "genesis.json")
 	if _, err := os.Stat(genesisPath); err == nil {
-		return bc.loadFromDisk()
-	}
-
-	// Create genesis block
-	genesis := &types.Block{
-		Header: types.BlockHeader{
-			Height:     0,
-			PrevHash:   types.Hash{},
-			Timestamp:  time.Now().Unix(),
-			Difficulty: 1,
-			Nonce:      0,
-		},
-		Txs: []types.Transaction{},
+		if err := bc.loadFromDisk(); err != nil {
+			return err
+		}
+		return bc.loadGenesisHash(genesisPath)
 	}
 
-	genesis.Header.Hash = genesis.CalculateHash()
+	// Initialize genesis accounts
+	bc.accounts = genesisState(bc.config)
+	genesis := GenesisBlock(bc.config)
+	bc.genesis = genesis.Header.Hash
 	bc.blocks = append(bc.blocks, genesis)
 	bc.lastBlock = genesis
+	bc.indexBlock(genesis)
 
-	// Initialize genesis accounts
-	for _, acc := range bc.config.GenesisAccounts {
-		bc.accounts[acc.Address] = &acc
+	if err := bc.saveToDisk(genesis); err != nil {
+		return err
 	}
 
-	return bc.saveToDisk()
+	// Write the genesis marker last so a partially initialized directory is recreated
+	genesisData, err := json.MarshalIndent(genesis, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(genesisPath, genesisData, 0644)
 }
 
-// AddBlock adds a new block to the blockchain
-func (bc *Blockchain) AddBlock(block *types.Block) error {
+// AddBlock adds a new block to the blockchain. A block that does not extend
+// the tip is kept as a side branch, and the chain reorganizes onto that
+// branch once it becomes longer.
+//
+// The context can only abort the call before the block is connected, which
+// includes the time spent waiting behind another block's disk write. Once
+// connected, the block is written out in full so the files on disk stay
+// consistent with one another.
+func (bc *Blockchain) AddBlock(ctx context.Context, block *types.Block) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("not adding block #%d: %v", block.Header.Height, err)
+	}
+
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 
+	if bc.closed {
+		return ErrClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("not adding block #%d: %v", block.Header.Height, err)
+	}
+
+	if bc.lastBlock != nil && block.Header.PrevHash != bc.lastBlock.Header.Hash {
+		return bc.addSideBlock(block)
+	}
+
+	if err := bc.connectBlock(block); err != nil {
+		return err
+	}
+	bc.publish(Event{Type: EventBlock, Block: block})
+
+	if err := bc.saveToDisk(block); err != nil {
+		return err
+	}
+
+	if err := bc.maybeSnapshot(); err != nil {
+		return fmt.Errorf("block added but snapshot failed: %v", err)
+	}
+
+	return nil
+}
+
+// connectBlock validates a block extending the tip, applies it and makes it
+// the new tip, recording what is needed to undo it; the caller must hold the lock
+func (bc *Blockchain) connectBlock(block *types.Block) error {
 	// Validate block
 	if err := bc.validateBlock(block); err != nil {
-		return fmt.Errorf("invalid block: %v", err)
+		return fmt.Errorf("invalid block: %w", err)
+	}
+
+	// Apply transactions to a copy of the state so that a failing
+	// transaction leaves the live state exactly as it was
+	prev := bc.currentState()
+	bc.setState(prev.copy())
+	if err := bc.applyBlock(block); err != nil {
+		bc.setState(prev)
+		bc.pendingAudit = nil
+		return fmt.Errorf("failed to apply transaction: %v", err)
 	}
 
-	// Apply transactions
+	// The header must commit to the state the block produces
+	if bc.stateRoot() != block.Header.StateRoot {
+		bc.setState(prev)
+		bc.pendingAudit = nil
+		return fmt.Errorf("invalid block: %w", invalidBlock("state root mismatch"))
+	}
+
+	if err := bc.flushAudit(); err != nil {
+		bc.setState(prev)
+		return fmt.Errorf("failed to write audit log: %v", err)
+	}
+
+	// Remove from tx pool
 	for _, tx := range block.Txs {
-		if err := bc.applyTransaction(&tx); err != nil {
-			return fmt.Errorf("failed to apply transaction: %v", err)
-		}
-		// Remove from tx pool
 		delete(bc.txPool, tx.Hash)
 	}
+	bc.dropExpired(block.Header.Height)
+
+	bc.recordUndo(block, prev)
 
 	// Add block
 	bc.blocks = append(bc.blocks, block)
 	bc.lastBlock = block
 	bc.height = block.Header.Height
+	bc.indexBlock(block)
+	bc.trimBlocks()
+	bc.advanceFinalized()
+
+	bc.blocksConnected++
+	bc.txsProcessed += int64(len(block.Txs))
+
+	return nil
+}
+
+// applyBlock applies a block's transactions and the per-block staking steps
+// to the live state; the caller must hold the lock and restore the state if
+// it fails
+func (bc *Blockchain) applyBlock(block *types.Block) error {
+	bc.blockEarnings = 0
+	for i := range block.Txs {
+		if err := bc.applyTransaction(&block.Txs[i], &block.Header); err != nil {
+			return err
+		}
+	}
+	bc.distributeEarnings(block.Header.Validator)
+	bc.releaseUnbonded(block.Header.Height)
+	return nil
+}
+
+// trimBlocks drops the oldest in-memory blocks beyond the configured window;
+// they remain available on disk through GetBlockByHeight
+func (bc *Blockchain) trimBlocks() {
+	limit := bc.config.MaxBlocksInMemory
+	if limit <= 0 || len(bc.blocks) <= limit {
+		return
+	}
+	bc.blocks = bc.blocks[len(bc.blocks)-limit:]
+}
+
+// ChainID returns the ID transactions must carry to be valid on this chain
+func (bc *Blockchain) ChainID() int64 {
+	return bc.config.ChainID
+}
+
+// Config returns a copy of the chain configuration
+func (bc *Blockchain) Config() types.ChainConfig {
+	return *bc.config
+}
+
+// GetBlockByHeight returns the block at the given height, loading it from
+// disk if it is no longer held in memory
+func (bc *Blockchain) GetBlockByHeight(height int64) (*types.Block, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.blockAt(height)
+}
+
+// blockAt returns the block at the given height; the caller must hold the lock
+func (bc *Blockchain) blockAt(height int64) (*types.Block, error) {
+	if height < 0 || height > bc.height {
+		return nil, fmt.Errorf("block not found at height %d", height)
+	}
+
+	if len(bc.blocks) > 0 {
+		first := bc.blocks[0].Header.Height
+		if height >= first {
+			return bc.blocks[height-first], nil
+		}
+	}
+
+	return bc.loadBlock(height)
+}
+
+// GetBlockByHash returns the block with the given hash
+func (bc *Blockchain) GetBlockByHash(hash types.Hash) (*types.Block, error) {
+	bc.mu.RLock()
+	height, exists := bc.blockIndex[hash]
+	bc.mu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("block not found with hash %s", hash)
+	}
+
+	return bc.GetBlockByHeight(height)
+}
+
+// GetHeaders returns up to count consecutive block headers starting at from
+func (bc *Blockchain) GetHeaders(from int64, count int) ([]types.BlockHeader, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if from < 0 || from > bc.height {
+		return nil, fmt.Errorf("block not found at height %d", from)
+	}
+
+	headers := make([]types.BlockHeader, 0, count)
+	for h := from; h <= bc.height && len(headers) < count; h++ {
+		block, err := bc.blockAt(h)
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, block.Header)
+	}
 
-	return bc.saveToDisk()
+	return headers, nil
+}
+
+// GetBlocks returns the blocks from height from through to, inclusive
+func (bc *Blockchain) GetBlocks(from, to int64) ([]*types.Block, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if from > to {
+		return nil, fmt.Errorf("invalid range: from %d is after to %d", from, to)
+	}
+	if from < 0 || to > bc.height {
+		return nil, fmt.Errorf("range [%d, %d] is outside the chain (height %d)", from, to, bc.height)
+	}
+
+	blocks := make([]*types.Block, 0, to-from+1)
+	for h := from; h <= to; h++ {
+		block, err := bc.blockAt(h)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+
+	return blocks, nil
+}
+
+// GetTransaction looks up a transaction by hash in the pool and in mined blocks
+func (bc *Blockchain) GetTransaction(hash types.Hash) (*TransactionInfo, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if tx, exists := bc.txPool[hash]; exists {
+		return &TransactionInfo{
+			Transaction: tx,
+			Pending:     true,
+		}, nil
+	}
+
+	return bc.minedTransaction(hash)
+}
+
+// minedTransaction looks up a transaction in the chain; the caller must hold
+// the lock
+func (bc *Blockchain) minedTransaction(hash types.Hash) (*TransactionInfo, error) {
+	loc, exists := bc.txIndex[hash]
+	if !exists {
+		return nil, fmt.Errorf("transaction not found: %s", hash)
+	}
+
+	block, err := bc.blockAt(loc.height)
+	if err != nil {
+		return nil, err
+	}
+	if loc.index >= len(block.Txs) {
+		return nil, fmt.Errorf("transaction index out of range in block %d", loc.height)
+	}
+
+	return &TransactionInfo{
+		Transaction: &block.Txs[loc.index],
+		BlockHeight: loc.height,
+		BlockHash:   block.Header.Hash,
+		BlockTime:   block.Header.Timestamp,
+		Index:       loc.index,
+	}, nil
+}
+
+// GetAddressTransactions returns a page of the mined transactions sent from or
+// to the address, newest first, along with the total number that match. An
+// empty txType matches every transaction type.
+func (bc *Blockchain) GetAddressTransactions(addr types.Address, txType string, offset, limit int) ([]*TransactionInfo, int, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	hashes := bc.addrIndex[addr]
+	infos := make([]*TransactionInfo, 0)
+	total := 0
+	for i := len(hashes) - 1; i >= 0; i-- {
+		info, err := bc.minedTransaction(hashes[i])
+		if err != nil {
+			return nil, 0, err
+		}
+		if txType != "" && info.Transaction.Type != txType {
+			continue
+		}
+		if total >= offset && len(infos) < limit {
+			infos = append(infos, info)
+		}
+		total++
+	}
+
+	return infos, total, nil
+}
+
+// indexBlock records a block and its transactions in the lookup indexes
+func (bc *Blockchain) indexBlock(block *types.Block) {
+	bc.blockIndex[block.Header.Hash] = block.Header.Height
+	for i, tx := range block.Txs {
+		bc.txIndex[tx.Hash] = txLocation{height: block.Header.Height, index: i}
+		bc.addrIndex[tx.From] = append(bc.addrIndex[tx.From], tx.Hash)
+		if tx.To != tx.From {
+			bc.addrIndex[tx.To] = append(bc.addrIndex[tx.To], tx.Hash)
+		}
+	}
+}
+
+// unindexBlock removes the tip block's transactions from the lookup indexes.
+// They were the last to be indexed, so each is at the end of its address list.
+func (bc *Blockchain) unindexBlock(block *types.Block) {
+	delete(bc.blockIndex, block.Header.Hash)
+	for i := len(block.Txs) - 1; i >= 0; i-- {
+		tx := &block.Txs[i]
+		delete(bc.txIndex, tx.Hash)
+		bc.popAddressTx(tx.From, tx.Hash)
+		if tx.To != tx.From {
+			bc.popAddressTx(tx.To, tx.Hash)
+		}
+	}
+}
+
+// popAddressTx drops hash from the end of an address's transaction list
+func (bc *Blockchain) popAddressTx(addr types.Address, hash types.Hash) {
+	hashes := bc.addrIndex[addr]
+	if n := len(hashes); n > 0 && hashes[n-1] == hash {
+		hashes = hashes[:n-1]
+	}
+	if len(hashes) == 0 {
+		delete(bc.addrIndex, addr)
+	} else {
+		bc.addrIndex[addr] = hashes
+	}
+}
+
+// ValidateBlock checks whether a block would be accepted as the next block
+func (bc *Blockchain) ValidateBlock(block *types.Block) error {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.validateBlock(block)
 }
 
 // validateBlock validates a block
@@ -118,17 +530,102 @@ func (bc *Blockchain) validateBlock(block *types.Block) error {
 		return fmt.Errorf("invalid previous hash")
 	}
 
+	if err := bc.checkBlockTimestamp(block); err != nil {
+		return err
+	}
+
+	// Check transaction count
+	if bc.config.MaxTxPerBlock > 0 && len(block.Txs) > bc.config.MaxTxPerBlock {
+		return fmt.Errorf("too many transactions: %d exceeds limit of %d", len(block.Txs), bc.config.MaxTxPerBlock)
+	}
+
+	// Check serialized block size
+	if bc.config.MaxBlockSize > 0 {
+		blockData, err := json.Marshal(block)
+		if err != nil {
+			return fmt.Errorf("failed to serialize block: %v", err)
+		}
+		if int64(len(blockData)) > bc.config.MaxBlockSize {
+			return fmt.Errorf("block too large: %d bytes exceeds limit of %d", len(blockData), bc.config.MaxBlockSize)
+		}
+	}
+
 	// Validate hash
 	expectedHash := block.CalculateHash()
 	if block.Header.Hash != expectedHash {
-		return fmt.Errorf("invalid block hash")
+		return invalidBlock("invalid block hash")
+	}
+
+	if bc.powEnabled() {
+		if err := bc.checkProofOfWork(block); err != nil {
+			return invalidBlock("%v", err)
+		}
+	}
+
+	// Only the holder of the validator's key may produce its blocks
+	if err := crypto.VerifyBlockHeader(&block.Header); err != nil {
+		return invalidBlock("%v", err)
 	}
 
-	// Validate transactions
+	// Validate transactions. Each sender's nonces must follow on from its
+	// account nonce in the order they appear in the block.
+	nonces := make(map[types.Address]int64)
 	for _, tx := range block.Txs {
-		if err := bc.validateTransaction(&tx); err != nil {
+		if err := crypto.VerifyTransaction(&tx); err != nil {
+			return invalidBlock("invalid transaction %s: %v", tx.Hash, err)
+		}
+		if err := bc.checkTransaction(&tx); err != nil {
 			return fmt.Errorf("invalid transaction: %v", err)
 		}
+		if consumesNonce(&tx) {
+			expected, seen := nonces[tx.From]
+			if !seen {
+				expected = bc.GetAccount(tx.From).Nonce
+			}
+			if tx.Nonce != expected {
+				return fmt.Errorf("invalid transaction: %s has nonce %d, expected %d", tx.Hash, tx.Nonce, expected)
+			}
+			nonces[tx.From] = expected + 1
+		}
+		if tx.Type == types.TxTypePatchReward && tx.From != block.Header.Validator {
+			return invalidBlock("patch reward %s not issued by the block validator", tx.Hash)
+		}
+	}
+
+	if err := bc.checkProposer(block, bc.lastBlock); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// checkProposer requires, once validators have staked, that the block comes
+// from the proposer scheduled after parent; under proof of work any miner may
+// produce. The caller must hold the lock.
+func (bc *Blockchain) checkProposer(block, parent *types.Block) error {
+	if bc.powEnabled() {
+		return nil
+	}
+	if proposer, scheduled := bc.proposerAfter(parent); scheduled && block.Header.Validator != proposer {
+		return invalidBlock("block #%d proposed by %s, expected %s", block.Header.Height, block.Header.Validator, proposer)
+	}
+	return nil
+}
+
+// checkBlockTimestamp requires a block to be stamped after its parent and not
+// too far ahead of the local clock. The first block is not compared against
+// genesis, whose timestamp is local to each node.
+func (bc *Blockchain) checkBlockTimestamp(block *types.Block) error {
+	if bc.lastBlock != nil && bc.lastBlock.Header.Height > 0 && block.Header.Timestamp <= bc.lastBlock.Header.Timestamp {
+		return fmt.Errorf("block timestamp %d is not after parent timestamp %d", block.Header.Timestamp, bc.lastBlock.Header.Timestamp)
+	}
+
+	drift := bc.config.MaxClockDrift
+	if drift <= 0 {
+		drift = types.DefaultMaxClockDrift
+	}
+	if limit := time.Now().Add(drift).Unix(); block.Header.Timestamp > limit {
+		return fmt.Errorf("block timestamp %d is more than %v in the future", block.Header.Timestamp, drift)
 	}
 
 	return nil
@@ -139,6 +636,10 @@ func (bc *Blockchain) AddTransaction(tx *types.Transaction) error {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 
+	if bc.closed {
+		return ErrClosed
+	}
+
 	// Validate transaction
 	if err := bc.validateTransaction(tx); err != nil {
 		return err
@@ -147,9 +648,27 @@ func (bc *Blockchain) AddTransaction(tx *types.Transaction) error {
 	// Calculate hash
 	tx.Hash = tx.CalculateHash()
 
+	evicted, err := bc.makeRoom(tx)
+	if err != nil {
+		return err
+	}
+
 	// Add to pool
+	if evicted != nil {
+		delete(bc.txPool, evicted.Hash)
+	}
 	bc.txPool[tx.Hash] = tx
 
+	if err := bc.saveMempool(); err != nil {
+		delete(bc.txPool, tx.Hash)
+		if evicted != nil {
+			bc.txPool[evicted.Hash] = evicted
+		}
+		return fmt.Errorf("failed to persist mempool: %v", err)
+	}
+
+	bc.txsPooled++
+	bc.publish(Event{Type: EventTransaction, Transaction: tx})
 	return nil
 }
 
@@ -160,68 +679,206 @@ func (bc *Blockchain) validateTransaction(tx *types.Transaction) error {
 		return fmt.Errorf("transaction already in pool")
 	}
 
-	// Validate signature (simplified)
-	if len(tx.Signature) == 0 {
-		return fmt.Errorf("missing signature")
+	// Patch rewards are added to blocks by the validator that evaluated them
+	if tx.Type == types.TxTypePatchReward {
+		return fmt.Errorf("patch rewards cannot be submitted to the pool")
 	}
 
-	// Check account balance for transfer transactions
-	if tx.Type == types.TxTypeTransfer {
-		account := bc.GetAccount(tx.From)
-		if account.Balance < tx.Amount {
-			return fmt.Errorf("insufficient balance")
-		}
+	if err := bc.checkPooledDuplicatePatch(tx); err != nil {
+		return err
 	}
 
+	if err := bc.checkTransaction(tx); err != nil {
+		return err
+	}
+
+	// A sender's pooled transactions are mined in nonce order, so a new one
+	// must take the nonce after those already waiting
+	if expected := bc.pendingNonce(tx.From); tx.Nonce != expected {
+		return fmt.Errorf("invalid nonce: expected %d, got %d", expected, tx.Nonce)
+	}
 	return nil
 }
 
-// applyTransaction applies a transaction to the state
-func (bc *Blockchain) applyTransaction(tx *types.Transaction) error {
-	switch tx.Type {
-	case types.TxTypeTransfer:
-		return bc.applyTransfer(tx)
-	case types.TxTypePatchSubmit:
-		return bc.applyPatchSubmit(tx)
-	default:
-		return fmt.Errorf("unknown transaction type: %s", tx.Type)
+// checkTransaction validates a transaction against the current state, regardless
+// of whether it is pooled; blocks legitimately contain pooled transactions
+func (bc *Blockchain) checkTransaction(tx *types.Transaction) error {
+	// A transaction applies once, however long its expiry leaves it valid
+	if _, mined := bc.txIndex[tx.Hash]; mined {
+		return fmt.Errorf("transaction already mined")
 	}
+
+	// Only the holder of the sender's key may spend from its account
+	if err := crypto.VerifyTransaction(tx); err != nil {
+		return err
+	}
+
+	// Transactions signed for another network must not replay here
+	if tx.ChainID != bc.config.ChainID {
+		return fmt.Errorf("wrong chain ID: expected %d, got %d", bc.config.ChainID, tx.ChainID)
+	}
+
+	if tx.Fee < 0 {
+		return fmt.Errorf("negative fee")
+	}
+
+	// The next block is the earliest that could include the transaction
+	if tx.ValidUntil != 0 && tx.ValidUntil <= bc.height {
+		return fmt.Errorf("transaction expired at height %d", tx.ValidUntil)
+	}
+
+	// A nonce the account has moved past is spent and can never be mined again
+	if consumesNonce(tx) {
+		if nonce := bc.GetAccount(tx.From).Nonce; tx.Nonce < nonce {
+			return fmt.Errorf("nonce too low: account is at nonce %d, got %d", nonce, tx.Nonce)
+		}
+	}
+
+	applier, err := bc.txApplier(tx.Type)
+	if err != nil {
+		return err
+	}
+	return applier.Check(bc, tx)
+}
+
+// applyTransaction applies a transaction to the state. It requires the
+// sender's next nonce and advances it, so a transaction applies only once.
+func (bc *Blockchain) applyTransaction(tx *types.Transaction, header *types.BlockHeader) error {
+	applier, err := bc.txApplier(tx.Type)
+	if err != nil {
+		return err
+	}
+	if consumesNonce(tx) {
+		if nonce := bc.GetAccount(tx.From).Nonce; tx.Nonce != nonce {
+			return fmt.Errorf("invalid nonce: expected %d, got %d", nonce, tx.Nonce)
+		}
+	}
+	if err := applier.Apply(bc, tx, header); err != nil {
+		return err
+	}
+	if consumesNonce(tx) {
+		account := bc.GetAccount(tx.From)
+		account.Nonce++
+		bc.accounts[tx.From] = account
+	}
+
+	bc.recordAudit(tx, header)
+	return nil
+}
+
+// consumesNonce reports whether a transaction uses up its sender's nonce.
+// Patch rewards are issued by the validator and are instead settled once
+// through the pending patch set.
+func consumesNonce(tx *types.Transaction) bool {
+	return tx.Type != types.TxTypePatchReward
 }
 
 // applyTransfer applies a transfer transaction
-func (bc *Blockchain) applyTransfer(tx *types.Transaction) error {
+func (bc *Blockchain) applyTransfer(tx *types.Transaction, header *types.BlockHeader) error {
 	fromAccount := bc.GetAccount(tx.From)
 	toAccount := bc.GetAccount(tx.To)
 
-	if fromAccount.Balance < tx.Amount {
+	if fromAccount.Balance < tx.Amount+tx.Fee {
 		return fmt.Errorf("insufficient balance")
 	}
 
-	fromAccount.Balance -= tx.Amount
-	fromAccount.Nonce++
+	fromAccount.Balance -= tx.Amount + tx.Fee
 	toAccount.Balance += tx.Amount
 
 	bc.accounts[tx.From] = fromAccount
 	bc.accounts[tx.To] = toAccount
 
+	// Credit the fee to the validator that included the transaction
+	bc.creditValidator(header, tx.Fee)
+
 	return nil
 }
 
-// applyPatchSubmit applies a patch submission transaction
-func (bc *Blockchain) applyPatchSubmit(tx *types.Transaction) error {
+// applyPatchSubmit applies a patch submission transaction. The author pays
+// for the gas it uses and the patch is queued for evaluation; its reward is
+// paid by a later patch_reward transaction.
+func (bc *Blockchain) applyPatchSubmit(tx *types.Transaction, header *types.BlockHeader) error {
 	if tx.PatchSet == nil {
 		return fmt.Errorf("missing patch set")
 	}
 
-	// Award tokens for successful patch submission
+	if problem, exists := bc.problems[tx.PatchSet.ProblemID]; exists && problem.Status != types.ProblemStatusOpen {
+		return fmt.Errorf("problem %s is %s", problem.Spec.ID, problem.Status)
+	}
+
+	if err := crypto.VerifyPatchSet(tx.PatchSet); err != nil {
+		return err
+	}
+
+	if err := bc.checkDuplicatePatch(tx); err != nil {
+		return err
+	}
+
+	if err := bc.checkPatchGas(tx); err != nil {
+		return err
+	}
+	tx.GasUsed = bc.patchGas(tx)
+	cost := tx.GasUsed * bc.config.GasPrice
+
 	account := bc.GetAccount(tx.From)
-	account.Balance += bc.config.InitialReward
-	account.Nonce++
+	account.Balance -= cost
 	bc.accounts[tx.From] = account
 
+	// Gas is paid to the validator that included the transaction
+	bc.creditValidator(header, cost)
+
+	patchTx := *tx
+	bc.pendingPatches[tx.Hash] = &patchTx
+	bc.patchCodes[patchCodeKey(tx.PatchSet)] = tx.Hash
+
+	return nil
+}
+
+// patchGas returns the gas a patch submission uses: a base charge, one unit per
+// byte of code and a charge per test case of the problem it targets
+func (bc *Blockchain) patchGas(tx *types.Transaction) int64 {
+	tests := 0
+	if tx.PatchSet != nil {
+		if problem, exists := bc.problems[tx.PatchSet.ProblemID]; exists {
+			tests = len(problem.Spec.TestSuite)
+		}
+	}
+	return types.PatchGas(tx.PatchSet, tests)
+}
+
+// checkPatchGas rejects a patch submission that would run out of gas or that
+// its author cannot pay for
+func (bc *Blockchain) checkPatchGas(tx *types.Transaction) error {
+	gas := bc.patchGas(tx)
+	if gas > tx.GasLimit {
+		return fmt.Errorf("out of gas: patch needs %d gas, limit is %d", gas, tx.GasLimit)
+	}
+	if bc.GetAccount(tx.From).Balance < gas*bc.config.GasPrice {
+		return fmt.Errorf("insufficient balance for %d gas at price %d", gas, bc.config.GasPrice)
+	}
 	return nil
 }
 
+// CurrentReward returns the block reward at the current height
+func (bc *Blockchain) CurrentReward() int64 {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.rewardAt(bc.height)
+}
+
+// rewardAt computes InitialReward * RewardDecay^height, rounded down and never below 1
+func (bc *Blockchain) rewardAt(height int64) int64 {
+	if bc.config.RewardDecay <= 0 {
+		return bc.config.InitialReward
+	}
+
+	reward := int64(math.Floor(float64(bc.config.InitialReward) * math.Pow(bc.config.RewardDecay, float64(height))))
+	if reward < 1 {
+		reward = 1
+	}
+	return reward
+}
+
 // GetAccount returns account information
 func (bc *Blockchain) GetAccount(addr types.Address) *types.Account {
 	if account, exists := bc.accounts[addr]; exists {
@@ -236,6 +893,56 @@ func (bc *Blockchain) GetAccount(addr types.Address) *types.Account {
 	}
 }
 
+// stateMaps holds the state that transactions modify
+type stateMaps struct {
+	accounts map[types.Address]*types.Account
+	problems map[string]*types.Problem
+	patches  map[types.Hash]*types.Transaction
+	stakes   map[types.Address]*types.Stake
+	codes    map[string]types.Hash
+}
+
+// currentState returns the live state; the caller must hold the lock
+func (bc *Blockchain) currentState() stateMaps {
+	return stateMaps{
+		accounts: bc.accounts,
+		problems: bc.problems,
+		patches:  bc.pendingPatches,
+		stakes:   bc.stakes,
+		codes:    bc.patchCodes,
+	}
+}
+
+// setState replaces the live state; the caller must hold the lock
+func (bc *Blockchain) setState(state stateMaps) {
+	bc.accounts = state.accounts
+	bc.problems = state.problems
+	bc.pendingPatches = state.patches
+	bc.stakes = state.stakes
+	bc.patchCodes = state.codes
+}
+
+// copy returns a copy of the state that can be modified independently
+func (s stateMaps) copy() stateMaps {
+	return stateMaps{
+		accounts: copyAccounts(s.accounts),
+		problems: copyProblems(s.problems),
+		patches:  copyPendingPatches(s.patches),
+		stakes:   copyStakes(s.stakes),
+		codes:    copyPatchCodes(s.codes),
+	}
+}
+
+// copyAccounts returns a deep copy of the account state
+func copyAccounts(accounts map[types.Address]*types.Account) map[types.Address]*types.Account {
+	copied := make(map[types.Address]*types.Account, len(accounts))
+	for addr, account := range accounts {
+		accountCopy := *account
+		copied[addr] = &accountCopy
+	}
+	return copied
+}
+
 // GetHeight returns current blockchain height
 func (bc *Blockchain) GetHeight() int64 {
 	bc.mu.RLock()
@@ -250,7 +957,22 @@ func (bc *Blockchain) GetLastBlock() *types.Block {
 	return bc.lastBlock
 }
 
-// GetPendingTransactions returns pending transactions
+// Stats returns the current height, mempool size and activity counters
+func (bc *Blockchain) Stats() Stats {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	return Stats{
+		Height:                bc.height,
+		MempoolSize:           len(bc.txPool),
+		BlocksConnected:       bc.blocksConnected,
+		TransactionsProcessed: bc.txsProcessed,
+		TransactionsPooled:    bc.txsPooled,
+	}
+}
+
+// GetPendingTransactions returns pending transactions in nonce order, so each
+// sender's transactions can be mined in sequence
 func (bc *Blockchain) GetPendingTransactions() []*types.Transaction {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
@@ -259,23 +981,27 @@ func (bc *Blockchain) GetPendingTransactions() []*types.Transaction {
 	for _, tx := range bc.txPool {
 		txs = append(txs, tx)
 	}
+	sort.Slice(txs, func(i, j int) bool {
+		if txs[i].Nonce != txs[j].Nonce {
+			return txs[i].Nonce < txs[j].Nonce
+		}
+		return txs[i].Timestamp < txs[j].Timestamp
+	})
 	return txs
 }
 
-// saveToDisk saves blockchain state to disk
-func (bc *Blockchain) saveToDisk() error {
-	// Save blocks
-	blocksPath := filepath.Join(bc.dataDir, "blocks.json")
-	blocksData, err := json.MarshalIndent(bc.blocks, "", "  ")
-	if err != nil {
-		return err
-	}
-	if err := os.WriteFile(blocksPath, blocksData, 0644); err != nil {
-		return err
+// saveToDisk commits the given newly connected blocks together with the
+// state they lead to, so a crash cannot leave the stored tip out of step with
+// the stored state. Earlier blocks were written when they were connected.
+func (bc *Blockchain) saveToDisk(blocks ...*types.Block) error {
+	batch := make(fileBatch)
+	for _, block := range blocks {
+		if err := bc.saveBlock(batch, block); err != nil {
+			return err
+		}
 	}
 
 	// Save accounts - convert map to slice for JSON serialization
-	accountsPath := filepath.Join(bc.dataDir, "accounts.json")
 	accountsList := make([]*types.Account, 0, len(bc.accounts))
 	for _, account := range bc.accounts {
 		accountsList = append(accountsList, account)
@@ -284,21 +1010,253 @@ func (bc *Blockchain) saveToDisk() error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(accountsPath, accountsData, 0644)
+	batch[filepath.Join(bc.dataDir, "accounts.json")] = accountsData
+
+	if err := bc.saveProblems(batch); err != nil {
+		return err
+	}
+
+	if err := bc.savePendingPatches(batch); err != nil {
+		return err
+	}
+
+	if err := bc.saveStakes(batch); err != nil {
+		return err
+	}
+
+	if err := bc.savePatchCodes(batch); err != nil {
+		return err
+	}
+
+	if err := bc.saveFinalized(batch); err != nil {
+		return err
+	}
+
+	if err := bc.commitFiles(batch); err != nil {
+		return err
+	}
+
+	// Mined transactions have left the pool, so rewrite it as well
+	return bc.saveMempool()
+}
+
+// SaveMempool writes the pending transactions to disk
+func (bc *Blockchain) SaveMempool() error {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.saveMempool()
+}
+
+// Close commits the chain state and flushes the mempool, releases the audit
+// log and rejects any further blocks or transactions. Because it takes the write lock, a block being added
+// concurrently is fully written before Close proceeds. If that write is stuck
+// past the context's deadline Close returns an error instead of blocking; the
+// chain is then closed as soon as the write completes.
+func (bc *Blockchain) Close(ctx context.Context) error {
+	locked := make(chan struct{})
+	result := make(chan error, 1)
+	go func() {
+		bc.mu.Lock()
+		close(locked)
+		defer bc.mu.Unlock()
+		result <- bc.closeLocked()
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+	}
+
+	select {
+	case <-locked:
+		// The lock was acquired just as the deadline passed
+		return <-result
+	default:
+		return fmt.Errorf("timed out waiting for a disk write to finish: %v", ctx.Err())
+	}
+}
+
+// closeLocked implements Close; the caller must hold the lock
+func (bc *Blockchain) closeLocked() error {
+	if bc.closed {
+		return nil
+	}
+	bc.closed = true
+
+	// The state goes through the same commit as a block, so a crash during
+	// shutdown cannot leave it out of step with the tip
+	err := bc.saveToDisk()
+	if bc.auditLog != nil {
+		if closeErr := bc.auditLog.Close(); err == nil {
+			err = closeErr
+		}
+		bc.auditLog = nil
+	}
+	return err
+}
+
+// saveMempool writes the pending transactions to disk; the caller must hold the lock
+func (bc *Blockchain) saveMempool() error {
+	txs := make([]*types.Transaction, 0, len(bc.txPool))
+	for _, tx := range bc.txPool {
+		txs = append(txs, tx)
+	}
+
+	// Keep arrival order so the file reads naturally
+	sort.Slice(txs, func(i, j int) bool {
+		return txs[i].Timestamp < txs[j].Timestamp
+	})
+
+	data, err := json.MarshalIndent(txs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(filepath.Join(bc.dataDir, "mempool.json"), data, 0644)
+}
+
+// loadMempool restores pending transactions saved by a previous run,
+// dropping any that were mined or are no longer valid against current state
+func (bc *Blockchain) loadMempool() error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	data, err := os.ReadFile(filepath.Join(bc.dataDir, "mempool.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var txs []*types.Transaction
+	if err := json.Unmarshal(data, &txs); err != nil {
+		return err
+	}
+
+	// Each sender's transactions are readmitted in nonce order
+	sort.SliceStable(txs, func(i, j int) bool {
+		return txs[i].Nonce < txs[j].Nonce
+	})
+
+	dropped := 0
+	for _, tx := range txs {
+		if _, mined := bc.txIndex[tx.Hash]; mined || tx.Hash != tx.CalculateHash() {
+			dropped++
+			continue
+		}
+		if err := bc.validateTransaction(tx); err != nil {
+			dropped++
+			continue
+		}
+		// The limits may have been lowered since the pool was saved
+		evicted, err := bc.makeRoom(tx)
+		if err != nil {
+			dropped++
+			continue
+		}
+		if evicted != nil {
+			delete(bc.txPool, evicted.Hash)
+			dropped++
+		}
+		bc.txPool[tx.Hash] = tx
+	}
+
+	if dropped > 0 {
+		return bc.saveMempool()
+	}
+	return nil
+}
+
+// blockPath returns the on-disk location of the block at the given height
+func (bc *Blockchain) blockPath(height int64) string {
+	return filepath.Join(bc.dataDir, "blocks", fmt.Sprintf("%d.json", height))
+}
+
+// saveBlock adds a single block to the batch for the block store
+func (bc *Blockchain) saveBlock(batch fileBatch, block *types.Block) error {
+	if err := os.MkdirAll(filepath.Join(bc.dataDir, "blocks"), 0755); err != nil {
+		return err
+	}
+
+	blockData, err := json.MarshalIndent(block, "", "  ")
+	if err != nil {
+		return err
+	}
+	batch[bc.blockPath(block.Header.Height)] = blockData
+	return nil
+}
+
+// loadBlock reads a single block from the block store
+func (bc *Blockchain) loadBlock(height int64) (*types.Block, error) {
+	blockData, err := os.ReadFile(bc.blockPath(height))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block %d: %v", height, err)
+	}
+
+	var block types.Block
+	if err := json.Unmarshal(blockData, &block); err != nil {
+		return nil, fmt.Errorf("failed to parse block %d: %v", height, err)
+	}
+	return &block, nil
+}
+
+// storedHeight returns the highest block height present in the block store
+func (bc *Blockchain) storedHeight() (int64, error) {
+	entries, err := os.ReadDir(filepath.Join(bc.dataDir, "blocks"))
+	if err != nil {
+		return 0, err
+	}
+
+	height := int64(-1)
+	for _, entry := range entries {
+		h, err := strconv.ParseInt(strings.TrimSuffix(entry.Name(), ".json"), 10, 64)
+		if err != nil {
+			continue
+		}
+		if h > height {
+			height = h
+		}
+	}
+
+	if height < 0 {
+		return 0, fmt.Errorf("no blocks found in store")
+	}
+	return height, nil
 }
 
 // loadFromDisk loads blockchain state from disk
 func (bc *Blockchain) loadFromDisk() error {
-	// Load blocks
-	blocksPath := filepath.Join(bc.dataDir, "blocks.json")
-	blocksData, err := os.ReadFile(blocksPath)
+	// Load the most recent window of blocks
+	height, err := bc.storedHeight()
 	if err != nil {
 		return err
 	}
-	if err := json.Unmarshal(blocksData, &bc.blocks); err != nil {
+
+	// A chain imported from a snapshot has no blocks below its base
+	base, err := bc.loadSnapshotBase()
+	if err != nil {
 		return err
 	}
 
+	from := base
+	if limit := int64(bc.config.MaxBlocksInMemory); limit > 0 && height+1-limit > from {
+		from = height + 1 - limit
+	}
+
+	// Every block is indexed, but only the recent window is kept in memory
+	bc.blocks = make([]*types.Block, 0, height-from+1)
+	for h := base; h <= height; h++ {
+		block, err := bc.loadBlock(h)
+		if err != nil {
+			return err
+		}
+		bc.indexBlock(block)
+		if h >= from {
+			bc.blocks = append(bc.blocks, block)
+		}
+	}
+
 	// Load accounts - convert slice back to map
 	accountsPath := filepath.Join(bc.dataDir, "accounts.json")
 	accountsData, err := os.ReadFile(accountsPath)
@@ -316,10 +1274,37 @@ func (bc *Blockchain) loadFromDisk() error {
 		bc.accounts[account.Address] = account
 	}
 
+	if err := bc.loadPendingPatches(); err != nil {
+		return err
+	}
+
+	if err := bc.loadStakes(); err != nil {
+		return err
+	}
+
+	if err := bc.loadPatchCodes(); err != nil {
+		return err
+	}
+
+	if err := bc.loadProblems(); err != nil {
+		return err
+	}
+
 	// Set last block and height
 	if len(bc.blocks) > 0 {
 		bc.lastBlock = bc.blocks[len(bc.blocks)-1]
 		bc.height = bc.lastBlock.Header.Height
+
+		// The tip and the state are committed together, so a mismatch means
+		// the data dir was modified behind the node's back
+		if root := bc.stateRoot(); root != bc.lastBlock.Header.StateRoot {
+			return fmt.Errorf("stored state does not match block #%d: the block commits to state root %s, but the stored accounts hash to %s", bc.height, bc.lastBlock.Header.StateRoot, root)
+		}
+
+		if err := bc.loadFinalized(); err != nil {
+			return err
+		}
+		bc.advanceFinalized()
 	}
 
 	return nil
@@ -0,0 +1,647 @@
+package blockchain
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"agent-chain/pkg/types"
+)
+
+func TestValidateBlockClassifiesFailures(t *testing.T) {
+	validator, alice, mallory := newKey(t), newKey(t), newKey(t)
+	bc := newTestChain(t, testConfig(1000, alice))
+	addBlock(t, bc, validator)
+
+	forged := transfer(t, mallory, mallory.GetAddress(), 10, 1, 0)
+	forged.From = alice.GetAddress()
+	forged.Hash = forged.CalculateHash()
+
+	tests := []struct {
+		name    string
+		block   func() *types.Block
+		invalid bool
+	}{
+		{"timestamp ahead of local clock", func() *types.Block {
+			block := nextBlock(t, bc, validator)
+			block.Header.Timestamp = time.Now().Add(time.Hour).Unix()
+			if err := validator.SignBlock(block); err != nil {
+				t.Fatalf("SignBlock: %v", err)
+			}
+			return block
+		}, false},
+		{"wrong height", func() *types.Block {
+			block := nextBlock(t, bc, validator)
+			block.Header.Height++
+			if err := validator.SignBlock(block); err != nil {
+				t.Fatalf("SignBlock: %v", err)
+			}
+			return block
+		}, false},
+		{"hash does not match header", func() *types.Block {
+			block := nextBlock(t, bc, validator)
+			block.Header.Timestamp++
+			return block
+		}, true},
+		{"bad proposer signature", func() *types.Block {
+			block := nextBlock(t, bc, validator)
+			block.Header.Signature[0] ^= 0xff
+			return block
+		}, true},
+		{"forged transaction", func() *types.Block {
+			return nextBlock(t, bc, validator, *forged)
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := bc.ValidateBlock(tt.block())
+			if err == nil {
+				t.Fatal("block was accepted")
+			}
+			if got := IsInvalidBlock(err); got != tt.invalid {
+				t.Errorf("IsInvalidBlock(%v) = %v, want %v", err, got, tt.invalid)
+			}
+		})
+	}
+}
+
+func TestGetAddressTransactions(t *testing.T) {
+	validator, alice, bob := newKey(t), newKey(t), newKey(t)
+	bc := newTestChain(t, testConfig(1_000_000, alice, bob))
+
+	// Mixed types over several blocks: alice sends, receives and submits a patch
+	toBob := transfer(t, alice, bob.GetAddress(), 100, 1, 0)
+	addBlock(t, bc, validator, *toBob)
+	toAlice := transfer(t, bob, alice.GetAddress(), 50, 1, 0)
+	patch := patchSubmit(t, alice, "p1", "func Solve() int { return 42 }", 1)
+	addBlock(t, bc, validator, *toAlice, *patch)
+	unrelated := transfer(t, bob, validator.GetAddress(), 5, 1, 1)
+	addBlock(t, bc, validator, *unrelated)
+
+	hashes := func(infos []*TransactionInfo) []types.Hash {
+		out := make([]types.Hash, len(infos))
+		for i, info := range infos {
+			out[i] = info.Transaction.Hash
+		}
+		return out
+	}
+
+	tests := []struct {
+		name          string
+		txType        string
+		offset, limit int
+		want          []types.Hash
+		total         int
+	}{
+		{"all newest first", "", 0, 10, []types.Hash{patch.Hash, toAlice.Hash, toBob.Hash}, 3},
+		{"first page", "", 0, 2, []types.Hash{patch.Hash, toAlice.Hash}, 3},
+		{"second page", "", 2, 2, []types.Hash{toBob.Hash}, 3},
+		{"past the end", "", 5, 2, []types.Hash{}, 3},
+		{"transfers", types.TxTypeTransfer, 0, 10, []types.Hash{toAlice.Hash, toBob.Hash}, 2},
+		{"patches", types.TxTypePatchSubmit, 0, 10, []types.Hash{patch.Hash}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			infos, total, err := bc.GetAddressTransactions(alice.GetAddress(), tt.txType, tt.offset, tt.limit)
+			if err != nil {
+				t.Fatalf("GetAddressTransactions: %v", err)
+			}
+			if total != tt.total {
+				t.Errorf("total = %d, want %d", total, tt.total)
+			}
+			if got := hashes(infos); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// The validator is only party to the last transfer
+	infos, total, err := bc.GetAddressTransactions(validator.GetAddress(), "", 0, 10)
+	if err != nil || total != 1 || len(infos) != 1 || infos[0].Transaction.Hash != unrelated.Hash {
+		t.Fatalf("validator history = %v, %d, %v; want the one transfer", hashes(infos), total, err)
+	}
+}
+
+func TestValidateBlockLimits(t *testing.T) {
+	validator, alice, bob := newKey(t), newKey(t), newKey(t)
+
+	txs := func() []types.Transaction {
+		out := make([]types.Transaction, 3)
+		for i := range out {
+			out[i] = *transfer(t, alice, bob.GetAddress(), 10, 1, int64(i))
+		}
+		return out
+	}()
+
+	t.Run("too many transactions", func(t *testing.T) {
+		config := testConfig(1000, alice)
+		config.MaxTxPerBlock = 2
+		bc := newTestChain(t, config)
+
+		err := bc.ValidateBlock(nextBlock(t, bc, validator, txs...))
+		if err == nil || !strings.Contains(err.Error(), "too many transactions") {
+			t.Fatalf("over-limit block: got %v", err)
+		}
+		if err := bc.ValidateBlock(nextBlock(t, bc, validator, txs[:2]...)); err != nil {
+			t.Fatalf("block at the limit rejected: %v", err)
+		}
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		config := testConfig(1000, alice)
+		bc := newTestChain(t, config)
+		atLimit := nextBlock(t, bc, validator, txs[:1]...)
+		data, err := json.Marshal(atLimit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bc.config.MaxBlockSize = int64(len(data))
+
+		if err := bc.ValidateBlock(atLimit); err != nil {
+			t.Fatalf("block at the size limit rejected: %v", err)
+		}
+		err = bc.ValidateBlock(nextBlock(t, bc, validator, txs[:2]...))
+		if err == nil || !strings.Contains(err.Error(), "block too large") {
+			t.Fatalf("oversized block: got %v", err)
+		}
+	})
+}
+
+func TestRewardDecay(t *testing.T) {
+	config := testConfig(0)
+	config.InitialReward = 1000
+	config.RewardDecay = 0.99
+	bc := newTestChain(t, config)
+
+	tests := []struct {
+		height int64
+		want   int64
+	}{
+		{0, 1000},
+		{100, 366}, // 1000 * 0.99^100 = 366.03
+		{1000, 1},  // 0.04 rounds down, but the reward never drops below 1
+	}
+	for _, tt := range tests {
+		if got := bc.rewardAt(tt.height); got != tt.want {
+			t.Errorf("reward at height %d = %d, want %d", tt.height, got, tt.want)
+		}
+	}
+
+	// Without a decay rate the reward stays flat
+	bc.config.RewardDecay = 0
+	if got := bc.rewardAt(1000); got != 1000 {
+		t.Errorf("undecayed reward at height 1000 = %d, want 1000", got)
+	}
+}
+
+func TestTransferFeesPaidToValidator(t *testing.T) {
+	validator, alice, bob := newKey(t), newKey(t), newKey(t)
+	bc := newTestChain(t, testConfig(1000, alice))
+
+	addBlock(t, bc, validator,
+		*transfer(t, alice, bob.GetAddress(), 100, 3, 0),
+		*transfer(t, alice, bob.GetAddress(), 50, 5, 1),
+	)
+
+	if got := bc.GetAccount(validator.GetAddress()).Balance; got != 8 {
+		t.Errorf("validator balance = %d, want the 8 in fees", got)
+	}
+	if got := bc.GetAccount(alice.GetAddress()).Balance; got != 1000-150-8 {
+		t.Errorf("sender balance = %d, want %d", got, 1000-150-8)
+	}
+	if got := bc.GetAccount(bob.GetAddress()).Balance; got != 150 {
+		t.Errorf("recipient balance = %d, want 150", got)
+	}
+
+	// A sender must cover the fee as well as the amount
+	err := bc.AddTransaction(transfer(t, alice, bob.GetAddress(), 1000-158, 1, 2))
+	if err == nil {
+		t.Error("accepted a transfer whose fee the sender cannot pay")
+	}
+}
+
+func TestGetTransaction(t *testing.T) {
+	validator, alice, bob := newKey(t), newKey(t), newKey(t)
+	config := testConfig(1000, alice)
+	dataDir := t.TempDir()
+	bc := openTestChain(t, config, dataDir)
+
+	mined := transfer(t, alice, bob.GetAddress(), 10, 1, 1)
+	block := addBlock(t, bc, validator, *transfer(t, alice, bob.GetAddress(), 5, 1, 0), *mined)
+	pending := transfer(t, alice, bob.GetAddress(), 20, 1, 2)
+	if err := bc.AddTransaction(pending); err != nil {
+		t.Fatalf("AddTransaction: %v", err)
+	}
+
+	info, err := bc.GetTransaction(pending.Hash)
+	if err != nil {
+		t.Fatalf("pending: %v", err)
+	}
+	if !info.Pending || info.Transaction.Hash != pending.Hash {
+		t.Errorf("pending lookup = %+v", info)
+	}
+
+	info, err = bc.GetTransaction(mined.Hash)
+	if err != nil {
+		t.Fatalf("mined: %v", err)
+	}
+	if info.Pending || info.BlockHeight != 1 || info.BlockHash != block.Header.Hash || info.Index != 1 {
+		t.Errorf("mined lookup = height %d, hash %s, index %d, pending %v", info.BlockHeight, info.BlockHash, info.Index, info.Pending)
+	}
+
+	if _, err := bc.GetTransaction(types.NewHash([]byte("unknown"))); err == nil {
+		t.Error("found an unknown transaction")
+	}
+
+	// The index is rebuilt when the chain is reopened
+	if err := bc.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	reopened := openTestChain(t, config, dataDir)
+	info, err = reopened.GetTransaction(mined.Hash)
+	if err != nil || info.BlockHeight != 1 || info.Index != 1 {
+		t.Errorf("mined lookup after reopen = %+v, %v", info, err)
+	}
+}
+
+// copyDataDir copies the files of a data dir, one level of subdirectories deep
+func copyDataDir(t *testing.T, from, to string) {
+	t.Helper()
+	for _, dir := range []string{"", "blocks"} {
+		entries, err := os.ReadDir(filepath.Join(from, dir))
+		if err != nil {
+			t.Fatalf("ReadDir: %v", err)
+		}
+		if err := os.MkdirAll(filepath.Join(to, dir), 0755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(from, dir, entry.Name()))
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(to, dir, entry.Name()), data, 0644); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+		}
+	}
+}
+
+func TestInterruptedWriteRecovery(t *testing.T) {
+	validator, alice, bob := newKey(t), newKey(t), newKey(t)
+	config := testConfig(1000, alice)
+
+	// Record the data dir at #1 and at #2 to stage a crash between the two
+	before, after := t.TempDir(), t.TempDir()
+	bc := openTestChain(t, config, after)
+	first := addBlock(t, bc, validator, *transfer(t, alice, bob.GetAddress(), 100, 1, 0))
+	if err := bc.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	copyDataDir(t, after, before)
+	bc = openTestChain(t, config, after)
+	second := addBlock(t, bc, validator, *transfer(t, alice, bob.GetAddress(), 50, 1, 1))
+	if err := bc.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	committed := []string{
+		filepath.Join("blocks", "2.json"),
+		"accounts.json",
+		"problems.json",
+		"pending_patches.json",
+		"stakes.json",
+		"patch_codes.json",
+		"finalized.json",
+	}
+	stage := func(t *testing.T, dataDir string, journal bool) {
+		for _, name := range committed {
+			data, err := os.ReadFile(filepath.Join(after, name))
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(dataDir, name+stagedSuffix), data, 0644); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+		}
+		if !journal {
+			return
+		}
+		data, err := json.Marshal(committed)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dataDir, "commit.json"), data, 0644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		crash   func(t *testing.T, dataDir string)
+		tip     *types.Block
+		balance int64
+		err     string
+	}{
+		{"files staged but not journaled", func(t *testing.T, dataDir string) {
+			stage(t, dataDir, false)
+		}, first, 100, ""},
+		{"journaled but not moved into place", func(t *testing.T, dataDir string) {
+			stage(t, dataDir, true)
+		}, second, 150, ""},
+		{"journaled and partly moved into place", func(t *testing.T, dataDir string) {
+			stage(t, dataDir, true)
+			for _, name := range committed[:2] {
+				path := filepath.Join(dataDir, name)
+				if err := os.Rename(path+stagedSuffix, path); err != nil {
+					t.Fatalf("Rename: %v", err)
+				}
+			}
+		}, second, 150, ""},
+		{"new block next to stale accounts", func(t *testing.T, dataDir string) {
+			data, err := os.ReadFile(filepath.Join(after, "blocks", "2.json"))
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(dataDir, "blocks", "2.json"), data, 0644); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+		}, nil, 0, "stored state does not match block #2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			copyDataDir(t, before, dataDir)
+			tt.crash(t, dataDir)
+
+			reopened, err := NewBlockchain(config, dataDir)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("NewBlockchain error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewBlockchain: %v", err)
+			}
+			t.Cleanup(func() { reopened.Close(context.Background()) })
+
+			if got := reopened.GetLastBlock(); got.Header.Hash != tt.tip.Header.Hash {
+				t.Fatalf("reopened at #%d, want #%d", got.Header.Height, tt.tip.Header.Height)
+			}
+			if got := reopened.GetAccount(bob.GetAddress()).Balance; got != tt.balance {
+				t.Errorf("recipient balance = %d, want %d", got, tt.balance)
+			}
+			for _, name := range committed {
+				if _, err := os.Stat(filepath.Join(dataDir, name+stagedSuffix)); !os.IsNotExist(err) {
+					t.Errorf("%s left behind after recovery", name+stagedSuffix)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(dataDir, "commit.json")); !os.IsNotExist(err) {
+				t.Error("commit journal left behind after recovery")
+			}
+		})
+	}
+}
+
+func TestCloseCommitsState(t *testing.T) {
+	validator, alice, bob := newKey(t), newKey(t), newKey(t)
+	config := testConfig(1000, alice)
+	dataDir := t.TempDir()
+	bc := openTestChain(t, config, dataDir)
+	tip := addBlock(t, bc, validator, *transfer(t, alice, bob.GetAddress(), 100, 1, 0))
+
+	// Lose the state written with the block; the shutdown flush restores it
+	if err := os.Remove(filepath.Join(dataDir, "accounts.json")); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := bc.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dataDir, "commit.json")); !os.IsNotExist(err) {
+		t.Error("commit journal left behind after Close")
+	}
+	reopened := openTestChain(t, config, dataDir)
+	if got := reopened.GetLastBlock(); got.Header.Hash != tip.Header.Hash {
+		t.Fatalf("reopened at #%d, want #%d", got.Header.Height, tip.Header.Height)
+	}
+	if got := reopened.GetAccount(bob.GetAddress()).Balance; got != 100 {
+		t.Errorf("recipient balance = %d, want 100", got)
+	}
+}
+
+func TestChainIDMismatchRejected(t *testing.T) {
+	validator, alice, bob := newKey(t), newKey(t), newKey(t)
+	bc := newTestChain(t, testConfig(1000, alice))
+
+	// Signed for another network, as a replayed transaction would be
+	replayed := transfer(t, alice, bob.GetAddress(), 10, 1, 0)
+	replayed.ChainID = testChainID + 1
+	if err := alice.SignTransaction(replayed); err != nil {
+		t.Fatalf("SignTransaction: %v", err)
+	}
+
+	if err := bc.AddTransaction(replayed); err == nil {
+		t.Error("pooled a transaction for another chain")
+	}
+	if err := bc.ValidateBlock(nextBlock(t, bc, validator, *replayed)); err == nil {
+		t.Error("accepted a block carrying a transaction for another chain")
+	}
+
+	// Rewriting the chain ID breaks the signature, which covers it
+	retargeted := *replayed
+	retargeted.ChainID = testChainID
+	if retargeted.CalculateHash() == replayed.Hash {
+		t.Fatal("chain ID is not part of the transaction hash")
+	}
+	retargeted.Hash = retargeted.CalculateHash()
+	if err := bc.AddTransaction(&retargeted); err == nil {
+		t.Error("pooled a transaction whose chain ID was rewritten after signing")
+	}
+
+	if err := bc.AddTransaction(transfer(t, alice, bob.GetAddress(), 10, 1, 0)); err != nil {
+		t.Errorf("transaction for this chain: %v", err)
+	}
+}
+
+func TestNonceReplayRejected(t *testing.T) {
+	validator, alice, bob := newKey(t), newKey(t), newKey(t)
+	bc := newTestChain(t, testConfig(1000, alice))
+	addBlock(t, bc, validator, *transfer(t, alice, bob.GetAddress(), 10, 1, 0))
+
+	// unapplied builds a block on the tip without computing its state, as
+	// the transactions are not expected to apply
+	unapplied := func(txs ...*types.Transaction) *types.Block {
+		tip := bc.GetLastBlock()
+		block := emptyBlockOn(t, tip, validator, tip.Header.Timestamp+1)
+		for _, tx := range txs {
+			block.Txs = append(block.Txs, *tx)
+		}
+		if err := validator.SignBlock(block); err != nil {
+			t.Fatalf("SignBlock: %v", err)
+		}
+		return block
+	}
+
+	next := transfer(t, alice, bob.GetAddress(), 20, 1, 1)
+
+	// The pool is shared, so the case that pools a transaction comes last
+	tests := []struct {
+		name string
+		txs  []*types.Transaction
+	}{
+		{"spent nonce", []*types.Transaction{transfer(t, alice, bob.GetAddress(), 10, 2, 0)}},
+		{"nonce gap", []*types.Transaction{transfer(t, alice, bob.GetAddress(), 10, 1, 2)}},
+		{"same nonce twice", []*types.Transaction{next, transfer(t, alice, bob.GetAddress(), 30, 1, 1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := bc.ValidateBlock(unapplied(tt.txs...)); err == nil || !strings.Contains(err.Error(), "nonce") {
+				t.Errorf("ValidateBlock error = %v, want a nonce error", err)
+			}
+
+			last := len(tt.txs) - 1
+			for _, tx := range tt.txs[:last] {
+				if err := bc.AddTransaction(tx); err != nil {
+					t.Fatalf("AddTransaction: %v", err)
+				}
+			}
+			if err := bc.AddTransaction(tt.txs[last]); err == nil || !strings.Contains(err.Error(), "nonce") {
+				t.Errorf("AddTransaction error = %v, want a nonce error", err)
+			}
+		})
+	}
+
+	// Consecutive nonces from one sender may share a block
+	following := transfer(t, alice, bob.GetAddress(), 40, 1, 2)
+	if err := bc.AddTransaction(following); err != nil {
+		t.Fatalf("AddTransaction: %v", err)
+	}
+	addBlock(t, bc, validator, *next, *following)
+	if got := bc.GetAccount(alice.GetAddress()); got.Nonce != 3 || got.Balance != 1000-73 {
+		t.Errorf("sender has nonce %d and balance %d, want 3 and %d", got.Nonce, got.Balance, 1000-73)
+	}
+}
+
+func TestValidateBlockTimestamps(t *testing.T) {
+	validator := newKey(t)
+	config := testConfig(0)
+	config.MaxClockDrift = time.Minute
+	bc := newTestChain(t, config)
+
+	parent := addBlock(t, bc, validator)
+	now := time.Now().Unix()
+	if parent.Header.Timestamp > now {
+		t.Fatalf("parent stamped %d, after the current time %d", parent.Header.Timestamp, now)
+	}
+
+	tests := []struct {
+		name      string
+		timestamp int64
+		wantErr   bool
+	}{
+		{"after parent", parent.Header.Timestamp + 1, false},
+		{"within drift", now + 50, false},
+		{"same as parent", parent.Header.Timestamp, true},
+		{"before parent", parent.Header.Timestamp - 10, true},
+		{"beyond drift", now + 120, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := emptyBlockOn(t, parent, validator, tt.timestamp)
+			err := bc.ValidateBlock(block)
+			if tt.wantErr && err == nil {
+				t.Error("block was accepted")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("ValidateBlock: %v", err)
+			}
+		})
+	}
+
+	// The first block is not held to genesis, whose time is local
+	fresh := newTestChain(t, config)
+	genesis := fresh.GetLastBlock()
+	if err := fresh.ValidateBlock(emptyBlockOn(t, genesis, validator, genesis.Header.Timestamp-10)); err != nil {
+		t.Errorf("first block stamped before genesis: %v", err)
+	}
+}
+
+// holdWriteLock stands in for a disk write stuck for d, holding the chain's
+// lock as saveToDisk does
+func holdWriteLock(bc *Blockchain, d time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	bc.mu.Lock()
+	go func() {
+		defer close(done)
+		time.Sleep(d)
+		bc.mu.Unlock()
+	}()
+	return done
+}
+
+func TestCloseGivesUpOnStuckWrite(t *testing.T) {
+	validator := newKey(t)
+	bc := newTestChain(t, testConfig(0))
+
+	written := holdWriteLock(bc, 300*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := bc.Close(ctx); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("Close error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("Close waited %v for the stuck write", elapsed)
+	}
+
+	// The chain still closes once the write completes
+	<-written
+	deadline := time.Now().Add(time.Second)
+	for {
+		err := bc.AddBlock(context.Background(), emptyBlockOn(t, bc.GetLastBlock(), validator, time.Now().Unix()))
+		if err == ErrClosed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("AddBlock after the write = %v, want ErrClosed", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAddBlockCancelledBehindStuckWrite(t *testing.T) {
+	validator := newKey(t)
+	bc := newTestChain(t, testConfig(0))
+	block := emptyBlockOn(t, bc.GetLastBlock(), validator, time.Now().Unix())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	written := holdWriteLock(bc, 100*time.Millisecond)
+	result := make(chan error, 1)
+	go func() { result <- bc.AddBlock(ctx, block) }()
+
+	// Shutdown begins while the block waits for the write
+	cancel()
+	<-written
+	if err := <-result; err == nil {
+		t.Fatal("block was added after its context was cancelled")
+	}
+	if height := bc.GetHeight(); height != 0 {
+		t.Errorf("height = %d, want 0", height)
+	}
+
+	if err := bc.AddBlock(context.Background(), block); err != nil {
+		t.Errorf("AddBlock with a live context: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"agent-chain/internal/fsutil"
+)
+
+// stagedSuffix marks a file written for a commit but not yet moved into place
+const stagedSuffix = ".staged"
+
+// fileBatch collects the contents of files that must be replaced together,
+// keyed by path
+type fileBatch map[string][]byte
+
+// commitPath returns the location of the journal of a commit in progress
+func (bc *Blockchain) commitPath() string {
+	return filepath.Join(bc.dataDir, "commit.json")
+}
+
+// commitFiles replaces every file in the batch so that a crash leaves either
+// all of the old contents or all of the new ones. Each file is first staged
+// beside its target; the journal listing them is then written as the commit
+// point, after which the staged files are moved into place. A journal left
+// behind by a crash is finished by recoverCommit on the next start.
+func (bc *Blockchain) commitFiles(batch fileBatch) error {
+	names := make([]string, 0, len(batch))
+	for path, data := range batch {
+		name, err := filepath.Rel(bc.dataDir, path)
+		if err != nil {
+			return err
+		}
+		if err := fsutil.WriteFileAtomic(path+stagedSuffix, data, 0644); err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	journal, err := json.MarshalIndent(names, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := fsutil.WriteFileAtomic(bc.commitPath(), journal, 0644); err != nil {
+		return err
+	}
+	return bc.recoverCommit()
+}
+
+// recoverCommit moves the files of a journaled commit into place and
+// discards files staged for a commit that never reached its journal
+func (bc *Blockchain) recoverCommit() error {
+	data, err := os.ReadFile(bc.commitPath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		var names []string
+		if err := json.Unmarshal(data, &names); err != nil {
+			return fmt.Errorf("failed to parse commit journal: %v", err)
+		}
+
+		// Files moved before a crash are simply missing their staged copy
+		dirs := make(map[string]bool)
+		for _, name := range names {
+			path := filepath.Join(bc.dataDir, name)
+			if err := os.Rename(path+stagedSuffix, path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			dirs[filepath.Dir(path)] = true
+		}
+		for dir := range dirs {
+			fsutil.SyncDir(dir)
+		}
+
+		if err := os.Remove(bc.commitPath()); err != nil {
+			return err
+		}
+		fsutil.SyncDir(bc.dataDir)
+	}
+
+	for _, dir := range []string{bc.dataDir, filepath.Join(bc.dataDir, "blocks")} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		for _, entry := range entries {
+			if !strings.HasSuffix(entry.Name(), stagedSuffix) {
+				continue
+			}
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
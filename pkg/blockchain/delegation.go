@@ -0,0 +1,98 @@
+package blockchain
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+
+	"agent-chain/pkg/types"
+)
+
+// Delegations returns the active delegations backing a validator, ordered
+// by delegator address
+func (bc *Blockchain) Delegations(validator types.Address) []types.Stake {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	delegations := bc.delegations(validator)
+	copied := make([]types.Stake, len(delegations))
+	for i, stake := range delegations {
+		copied[i] = *stake
+	}
+	return copied
+}
+
+// delegations lists the stakes other accounts have bonded to validator,
+// ordered by delegator address; the caller must hold the lock
+func (bc *Blockchain) delegations(validator types.Address) []*types.Stake {
+	var delegations []*types.Stake
+	for _, stake := range bc.stakes {
+		if stake.Validator == validator && stake.Address != validator && stake.Amount > 0 {
+			delegations = append(delegations, stake)
+		}
+	}
+	sort.Slice(delegations, func(i, j int) bool {
+		return bytes.Compare(delegations[i].Address[:], delegations[j].Address[:]) < 0
+	})
+	return delegations
+}
+
+// creditValidator pays the fees or gas of a transaction to the validator
+// that included it, and adds them to what the block's validator earned for
+// distributeEarnings; the caller must hold the lock
+func (bc *Blockchain) creditValidator(header *types.BlockHeader, amount int64) {
+	if amount <= 0 {
+		return
+	}
+
+	validatorAccount := bc.GetAccount(header.Validator)
+	validatorAccount.Balance += amount
+	bc.accounts[header.Validator] = validatorAccount
+	bc.blockEarnings += amount
+}
+
+// distributeEarnings shares what the validator earned in a block with the
+// accounts delegating to it. The validator keeps its commission; the rest is
+// split pro-rata over all stake backing the validator, its own included, and
+// rounding dust stays with the validator. The caller must hold the lock.
+func (bc *Blockchain) distributeEarnings(validator types.Address) {
+	earned := bc.blockEarnings
+	bc.blockEarnings = 0
+	if earned <= 0 {
+		return
+	}
+
+	delegations := bc.delegations(validator)
+	if len(delegations) == 0 {
+		return
+	}
+
+	var total int64
+	if self, exists := bc.stakes[validator]; exists && self.Validator == validator {
+		total += self.Amount
+	}
+	for _, stake := range delegations {
+		total += stake.Amount
+	}
+
+	shared := earned - mulDiv(earned, bc.config.ValidatorCommission, 100)
+	validatorAccount := bc.GetAccount(validator)
+	for _, stake := range delegations {
+		share := mulDiv(shared, stake.Amount, total)
+		if share == 0 {
+			continue
+		}
+
+		validatorAccount.Balance -= share
+		account := bc.GetAccount(stake.Address)
+		account.Balance += share
+		bc.accounts[stake.Address] = account
+	}
+	bc.accounts[validator] = validatorAccount
+}
+
+// mulDiv returns a*b/c rounded down, without overflowing in a*b
+func mulDiv(a, b, c int64) int64 {
+	product := new(big.Int).Mul(big.NewInt(a), big.NewInt(b))
+	return product.Quo(product, big.NewInt(c)).Int64()
+}
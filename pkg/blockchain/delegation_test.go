@@ -0,0 +1,70 @@
+package blockchain
+
+import (
+	"testing"
+
+	"agent-chain/pkg/types"
+)
+
+func TestDelegatorsShareEarnings(t *testing.T) {
+	tests := []struct {
+		name       string
+		commission int64
+		fee        int64
+		// balance changes from the block
+		wantValidator, wantFirst, wantSecond int64
+	}{
+		{"default commission", types.DefaultValidatorCommission, 1000, 640, 270, 90},
+		{"no commission", 0, 1000, 600, 300, 100},
+		{"full commission", 100, 1000, 1000, 0, 0},
+		{"rounding dust stays with the validator", 10, 7, 5, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator, first, second, sender := newKey(t), newKey(t), newKey(t), newKey(t)
+			config := testConfig(10000, validator, first, second, sender)
+			config.ValidatorCommission = tt.commission
+			bc := newTestChain(t, config)
+
+			// 600 of the validator's own and 400 delegated, 3:1 between the two
+			addBlock(t, bc, validator, *stakeTx(t, validator, types.TxTypeStake, types.Address{}, 600, 0))
+			addBlock(t, bc, validator,
+				*stakeTx(t, first, types.TxTypeStake, validator.GetAddress(), 300, 0),
+				*stakeTx(t, second, types.TxTypeStake, validator.GetAddress(), 100, 0))
+
+			delegations := bc.Delegations(validator.GetAddress())
+			if len(delegations) != 2 {
+				t.Fatalf("delegations = %+v, want two", delegations)
+			}
+			var delegated int64
+			for _, d := range delegations {
+				delegated += d.Amount
+			}
+			if delegated != 400 {
+				t.Fatalf("delegated = %d, want 400", delegated)
+			}
+
+			balances := func() (int64, int64, int64) {
+				return bc.GetAccount(validator.GetAddress()).Balance,
+					bc.GetAccount(first.GetAddress()).Balance,
+					bc.GetAccount(second.GetAddress()).Balance
+			}
+			v0, f0, s0 := balances()
+			addBlock(t, bc, validator, *transfer(t, sender, types.Address{1}, 1, tt.fee, 0))
+			v1, f1, s1 := balances()
+
+			if got := v1 - v0; got != tt.wantValidator {
+				t.Errorf("validator earned %d, want %d", got, tt.wantValidator)
+			}
+			if got := f1 - f0; got != tt.wantFirst {
+				t.Errorf("first delegator earned %d, want %d", got, tt.wantFirst)
+			}
+			if got := s1 - s0; got != tt.wantSecond {
+				t.Errorf("second delegator earned %d, want %d", got, tt.wantSecond)
+			}
+			if total := (v1 - v0) + (f1 - f0) + (s1 - s0); total != tt.fee {
+				t.Errorf("shares add up to %d, want the fee of %d", total, tt.fee)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package blockchain
+
+import (
+	"time"
+
+	"agent-chain/pkg/types"
+)
+
+// Event types published to subscribers
+const (
+	EventBlock       = "block"
+	EventTransaction = "transaction"
+	EventReorg       = "reorg"
+)
+
+// eventBufferSize is how many events a slow subscriber may fall behind by
+// before further events are dropped for it
+const eventBufferSize = 256
+
+// Event describes a change to the chain: a block becoming the tip, a
+// transaction entering the pool, or a reorg onto another branch
+type Event struct {
+	Type        string             `json:"type"`
+	Time        int64              `json:"time"`
+	Block       *types.Block       `json:"block,omitempty"`
+	Transaction *types.Transaction `json:"transaction,omitempty"`
+	Reorg       *ReorgEvent        `json:"reorg,omitempty"`
+}
+
+// ReorgEvent describes a switch from one branch to another
+type ReorgEvent struct {
+	OldTip       types.Hash `json:"old_tip"`
+	NewTip       types.Hash `json:"new_tip"`
+	Ancestor     int64      `json:"ancestor"`
+	Disconnected int        `json:"disconnected"`
+	Connected    int        `json:"connected"`
+}
+
+// Subscribe returns a channel receiving chain events and a function that
+// ends the subscription
+func (bc *Blockchain) Subscribe() (<-chan Event, func()) {
+	bc.subsMu.Lock()
+	defer bc.subsMu.Unlock()
+
+	ch := make(chan Event, eventBufferSize)
+	id := bc.nextSubID
+	bc.nextSubID++
+	bc.subscribers[id] = ch
+
+	return ch, func() {
+		bc.subsMu.Lock()
+		defer bc.subsMu.Unlock()
+		if _, exists := bc.subscribers[id]; exists {
+			delete(bc.subscribers, id)
+			close(ch)
+		}
+	}
+}
+
+// publish delivers an event to every subscriber without blocking
+func (bc *Blockchain) publish(event Event) {
+	event.Time = time.Now().Unix()
+
+	bc.subsMu.Lock()
+	defer bc.subsMu.Unlock()
+
+	for _, ch := range bc.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
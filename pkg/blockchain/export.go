@@ -0,0 +1,36 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"agent-chain/pkg/types"
+)
+
+// ReadStoredBlocks calls fn for every block from height from to height to in
+// the block store under dataDir, reading straight from disk so it can run
+// while the node is stopped. A negative to reads up to the stored tip.
+func ReadStoredBlocks(dataDir string, from, to int64, fn func(*types.Block) error) error {
+	store := &Blockchain{dataDir: dataDir}
+
+	tip, err := store.storedHeight()
+	if err != nil {
+		return err
+	}
+	if to < 0 || to > tip {
+		to = tip
+	}
+	if from < 0 || from > to {
+		return fmt.Errorf("invalid height range %d-%d (tip is %d)", from, to, tip)
+	}
+
+	for height := from; height <= to; height++ {
+		block, err := store.loadBlock(height)
+		if err != nil {
+			return err
+		}
+		if err := fn(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
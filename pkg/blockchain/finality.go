@@ -0,0 +1,88 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"agent-chain/pkg/types"
+)
+
+// finalityDepth returns how many blocks must be built on a block before it
+// is final
+func (bc *Blockchain) finalityDepth() int64 {
+	if bc.config.FinalityDepth > 0 {
+		return bc.config.FinalityDepth
+	}
+	return types.DefaultFinalityDepth
+}
+
+// maxReorgDepth returns how far below the tip a competing branch may fork
+// before it is rejected outright
+func (bc *Blockchain) maxReorgDepth() int64 {
+	if bc.config.MaxReorgDepth > 0 {
+		return bc.config.MaxReorgDepth
+	}
+	return types.DefaultMaxReorgDepth
+}
+
+// advanceFinalized finalizes every block buried deeper than the finality
+// depth. Finality never moves backwards, even when the tip is disconnected
+// during a reorg. The caller must hold the lock.
+func (bc *Blockchain) advanceFinalized() {
+	if height := bc.height - bc.finalityDepth(); height > bc.finalized {
+		bc.finalized = height
+	}
+}
+
+// GetFinalizedHeight returns the height of the newest finalized block; no
+// reorg can replace it or any block below it
+func (bc *Blockchain) GetFinalizedHeight() int64 {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.finalized
+}
+
+// finalizedCheckpoint is the on-disk record of the finalized height
+type finalizedCheckpoint struct {
+	Height int64 `json:"height"`
+}
+
+// finalizedPath returns the on-disk location of the finality checkpoint
+func (bc *Blockchain) finalizedPath() string {
+	return filepath.Join(bc.dataDir, "finalized.json")
+}
+
+// saveFinalized adds the finality checkpoint to the batch so that raising
+// the finality depth across a restart cannot unfinalize blocks
+func (bc *Blockchain) saveFinalized(batch fileBatch) error {
+	data, err := json.MarshalIndent(finalizedCheckpoint{Height: bc.finalized}, "", "  ")
+	if err != nil {
+		return err
+	}
+	batch[bc.finalizedPath()] = data
+	return nil
+}
+
+// loadFinalized reads the finality checkpoint, which is absent on older data
+// dirs. A checkpoint above the stored tip is capped at the tip.
+func (bc *Blockchain) loadFinalized() error {
+	data, err := os.ReadFile(bc.finalizedPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var checkpoint finalizedCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return err
+	}
+
+	bc.finalized = checkpoint.Height
+	if bc.finalized > bc.height {
+		bc.finalized = bc.height
+	}
+	return nil
+}
@@ -0,0 +1,400 @@
+package blockchain
+
+import (
+	"fmt"
+	"reflect"
+
+	"agent-chain/pkg/crypto"
+	"agent-chain/pkg/types"
+)
+
+// Side blocks are bounded so that peers cannot exhaust memory with forks
+const (
+	maxSideBlocksPerHeight = 4
+	maxSideBlocks          = 1024
+)
+
+// blockUndo holds the state a block overwrote, so it can be disconnected
+// during a reorg. A nil value means the entry did not exist before the block.
+type blockUndo struct {
+	accounts map[types.Address]*types.Account
+	problems map[string]*types.Problem
+	patches  map[types.Hash]*types.Transaction
+	stakes   map[types.Address]*types.Stake
+	codes    map[string]*types.Hash
+}
+
+// recordUndo diffs the state before and after a block and keeps the
+// overwritten entries, dropping undo data beyond the maximum reorg depth;
+// the caller must hold the lock
+func (bc *Blockchain) recordUndo(block *types.Block, prev stateMaps) {
+	undo := &blockUndo{
+		accounts: make(map[types.Address]*types.Account),
+		problems: make(map[string]*types.Problem),
+		patches:  make(map[types.Hash]*types.Transaction),
+		stakes:   make(map[types.Address]*types.Stake),
+		codes:    make(map[string]*types.Hash),
+	}
+
+	for addr, account := range bc.accounts {
+		if old, exists := prev.accounts[addr]; !exists || *old != *account {
+			undo.accounts[addr] = old
+		}
+	}
+	for id, problem := range bc.problems {
+		if old, exists := prev.problems[id]; !exists || !reflect.DeepEqual(old, problem) {
+			undo.problems[id] = old
+		}
+	}
+	for hash, tx := range bc.pendingPatches {
+		if old, exists := prev.patches[hash]; !exists || old != tx {
+			undo.patches[hash] = old
+		}
+	}
+	for hash, tx := range prev.patches {
+		if _, exists := bc.pendingPatches[hash]; !exists {
+			undo.patches[hash] = tx
+		}
+	}
+	for addr, stake := range bc.stakes {
+		if old, exists := prev.stakes[addr]; !exists || *old != *stake {
+			undo.stakes[addr] = old
+		}
+	}
+	for addr, stake := range prev.stakes {
+		if _, exists := bc.stakes[addr]; !exists {
+			undo.stakes[addr] = stake
+		}
+	}
+
+	// Patch codes are only ever added
+	for key := range bc.patchCodes {
+		if _, exists := prev.codes[key]; !exists {
+			undo.codes[key] = nil
+		}
+	}
+
+	bc.undo[block.Header.Hash] = undo
+
+	// Undo data is only kept for blocks that may still be reorganized away
+	if expired, err := bc.blockAt(block.Header.Height - bc.maxReorgDepth()); err == nil {
+		delete(bc.undo, expired.Header.Hash)
+	}
+}
+
+// disconnectTip reverts the tip block's state changes and makes its parent
+// the tip, returning the removed block; the caller must hold the lock
+func (bc *Blockchain) disconnectTip() (*types.Block, error) {
+	block := bc.lastBlock
+	undo, exists := bc.undo[block.Header.Hash]
+	if !exists {
+		return nil, fmt.Errorf("no undo data for block #%d", block.Header.Height)
+	}
+
+	parent, err := bc.blockAt(block.Header.Height - 1)
+	if err != nil {
+		return nil, err
+	}
+
+	for addr, account := range undo.accounts {
+		if account == nil {
+			delete(bc.accounts, addr)
+		} else {
+			bc.accounts[addr] = account
+		}
+	}
+	for id, problem := range undo.problems {
+		if problem == nil {
+			delete(bc.problems, id)
+		} else {
+			bc.problems[id] = problem
+		}
+	}
+	for hash, tx := range undo.patches {
+		if tx == nil {
+			delete(bc.pendingPatches, hash)
+		} else {
+			bc.pendingPatches[hash] = tx
+		}
+	}
+	for addr, stake := range undo.stakes {
+		if stake == nil {
+			delete(bc.stakes, addr)
+		} else {
+			bc.stakes[addr] = stake
+		}
+	}
+
+	for key, hash := range undo.codes {
+		if hash == nil {
+			delete(bc.patchCodes, key)
+		} else {
+			bc.patchCodes[key] = *hash
+		}
+	}
+
+	delete(bc.undo, block.Header.Hash)
+	bc.unindexBlock(block)
+
+	if n := len(bc.blocks); n > 0 && bc.blocks[n-1] == block {
+		bc.blocks = bc.blocks[:n-1]
+	}
+	bc.lastBlock = parent
+	bc.height = parent.Header.Height
+
+	return block, nil
+}
+
+// addSideBlock stores a block that does not extend the tip and switches to
+// its branch if that branch is now longer; the caller must hold the lock
+func (bc *Blockchain) addSideBlock(block *types.Block) error {
+	hash := block.Header.Hash
+	if _, exists := bc.blockIndex[hash]; exists {
+		return nil
+	}
+	if _, exists := bc.sideBlocks[hash]; exists {
+		return nil
+	}
+
+	parent, ok := bc.branchBlock(block.Header.PrevHash)
+	if !ok {
+		return fmt.Errorf("unknown parent %s for block #%d", block.Header.PrevHash, block.Header.Height)
+	}
+	if block.Header.Height != parent.Header.Height+1 {
+		return fmt.Errorf("invalid height: expected %d, got %d", parent.Header.Height+1, block.Header.Height)
+	}
+	if block.Header.Height <= bc.height-bc.maxReorgDepth() {
+		return fmt.Errorf("block #%d forks deeper than the maximum reorg depth", block.Header.Height)
+	}
+	if block.Header.Height <= bc.finalized {
+		return fmt.Errorf("block #%d conflicts with finalized block #%d", block.Header.Height, bc.finalized)
+	}
+
+	if err := bc.checkSideBlock(block, parent); err != nil {
+		return fmt.Errorf("invalid block: %w", err)
+	}
+
+	bc.pruneSideBlocks()
+	if err := bc.sideBlockRoom(block.Header.Height); err != nil {
+		return err
+	}
+	bc.sideBlocks[hash] = block
+
+	// Fork choice: follow the longest chain
+	if block.Header.Height > bc.height {
+		return bc.reorgTo(hash)
+	}
+	return nil
+}
+
+// checkSideBlock runs the checks a side block must pass before it is stored.
+// Its transactions and exact difficulty depend on the state of its branch
+// and are checked if the branch is ever connected. The caller must hold the
+// lock.
+func (bc *Blockchain) checkSideBlock(block, parent *types.Block) error {
+	if block.CalculateHash() != block.Header.Hash {
+		return invalidBlock("invalid block hash")
+	}
+
+	if err := crypto.VerifyBlockHeader(&block.Header); err != nil {
+		return invalidBlock("%v", err)
+	}
+
+	// Difficulty moves at most maxRetargetFactor per block, so a cheaper
+	// block cannot belong to any valid branch
+	if bc.powEnabled() {
+		floor := max(bc.config.PowDifficulty, 1)
+		if parent.Header.Height > 0 {
+			floor = max(parent.Header.Difficulty/maxRetargetFactor, 1)
+		}
+		if block.Header.Difficulty < floor {
+			return invalidBlock("difficulty %d is below %d", block.Header.Difficulty, floor)
+		}
+		if !block.Header.MeetsDifficulty() {
+			return invalidBlock("block hash does not meet difficulty %d", block.Header.Difficulty)
+		}
+	}
+
+	return bc.checkProposer(block, parent)
+}
+
+// sideBlockRoom rejects a side block at height once that height, or the side
+// block store as a whole, is full; the caller must hold the lock
+func (bc *Blockchain) sideBlockRoom(height int64) error {
+	if len(bc.sideBlocks) >= maxSideBlocks {
+		return fmt.Errorf("too many side blocks: %d stored", len(bc.sideBlocks))
+	}
+
+	count := 0
+	for _, block := range bc.sideBlocks {
+		if block.Header.Height == height {
+			count++
+		}
+	}
+	if count >= maxSideBlocksPerHeight {
+		return fmt.Errorf("too many side blocks at height %d", height)
+	}
+	return nil
+}
+
+// branchBlock returns a known canonical or side block; the caller must hold
+// the lock
+func (bc *Blockchain) branchBlock(hash types.Hash) (*types.Block, bool) {
+	if height, exists := bc.blockIndex[hash]; exists {
+		block, err := bc.blockAt(height)
+		return block, err == nil
+	}
+	block, exists := bc.sideBlocks[hash]
+	return block, exists
+}
+
+// pruneSideBlocks drops side blocks too old to ever be reorganized onto
+func (bc *Blockchain) pruneSideBlocks() {
+	for hash, block := range bc.sideBlocks {
+		if block.Header.Height <= bc.height-bc.maxReorgDepth() || block.Header.Height <= bc.finalized {
+			delete(bc.sideBlocks, hash)
+		}
+	}
+}
+
+// reorgTo makes the side branch ending at tip the canonical chain. Canonical
+// blocks back to the common ancestor are disconnected and kept as a side
+// branch, and their transactions return to the pool. If any block on the new
+// branch fails to apply, the original chain and pool are restored and the
+// failing block is forgotten along with everything built on it. The caller
+// must hold the lock.
+func (bc *Blockchain) reorgTo(tip types.Hash) error {
+	// Walk back from the new tip to the canonical chain
+	var branch []*types.Block
+	for hash := tip; ; {
+		if _, canonical := bc.blockIndex[hash]; canonical {
+			break
+		}
+		block, exists := bc.sideBlocks[hash]
+		if !exists {
+			return fmt.Errorf("branch to %s is incomplete", tip)
+		}
+		branch = append([]*types.Block{block}, branch...)
+		hash = block.Header.PrevHash
+	}
+	ancestor := branch[0].Header.Height - 1
+	oldTip := bc.lastBlock.Header.Hash
+
+	// Finalized blocks are never rewritten
+	if ancestor < bc.finalized {
+		return fmt.Errorf("cannot reorg below finalized block #%d", bc.finalized)
+	}
+	finalized := bc.finalized
+
+	// Keep the current chain so a failed reorg can be rolled back
+	oldBlocks := make([]*types.Block, 0, bc.height-ancestor)
+	for bc.height > ancestor {
+		block, err := bc.disconnectTip()
+		if err != nil {
+			if restoreErr := bc.restoreChain(oldBlocks); restoreErr != nil {
+				return fmt.Errorf("failed to reorg: %v; failed to restore chain: %v", err, restoreErr)
+			}
+			return fmt.Errorf("failed to reorg: %v", err)
+		}
+		oldBlocks = append([]*types.Block{block}, oldBlocks...)
+	}
+
+	for i, block := range branch {
+		if err := bc.connectBlock(block); err != nil {
+			for j := 0; j < i; j++ {
+				if _, undoErr := bc.disconnectTip(); undoErr != nil {
+					return fmt.Errorf("failed to reorg to block #%d: %v; failed to roll back: %v", block.Header.Height, err, undoErr)
+				}
+			}
+			// The invalid block and anything built on it can never be adopted,
+			// and nothing on the abandoned branch may stay finalized
+			bc.dropSideBranch(block.Header.Hash)
+			bc.finalized = finalized
+			if restoreErr := bc.restoreChain(oldBlocks); restoreErr != nil {
+				return fmt.Errorf("failed to reorg to block #%d: %v; failed to restore chain: %v", block.Header.Height, err, restoreErr)
+			}
+			// Connecting the valid part of the branch took its transactions
+			// out of the pool
+			bc.repoolTransactions(branch[:i])
+			return fmt.Errorf("failed to reorg to block #%d: %v", block.Header.Height, err)
+		}
+	}
+
+	for _, block := range branch {
+		delete(bc.sideBlocks, block.Header.Hash)
+	}
+
+	bc.publish(Event{Type: EventReorg, Reorg: &ReorgEvent{
+		OldTip:       oldTip,
+		NewTip:       tip,
+		Ancestor:     ancestor,
+		Disconnected: len(oldBlocks),
+		Connected:    len(branch),
+	}})
+	for _, block := range branch {
+		bc.publish(Event{Type: EventBlock, Block: block})
+	}
+
+	// The old branch stays available should it grow longer again
+	for _, block := range oldBlocks {
+		bc.sideBlocks[block.Header.Hash] = block
+	}
+	bc.repoolTransactions(oldBlocks)
+
+	// Blocks are stored by height, so the new branch overwrites the old one on disk
+	if err := bc.saveToDisk(branch...); err != nil {
+		return err
+	}
+
+	if err := bc.maybeSnapshot(); err != nil {
+		return fmt.Errorf("block added but snapshot failed: %v", err)
+	}
+
+	return nil
+}
+
+// repoolTransactions returns the transactions of blocks that left the chain
+// to the pool, skipping ones mined again on the current chain, patch rewards,
+// which only validators issue, and ones no longer valid; the caller must hold
+// the lock
+func (bc *Blockchain) repoolTransactions(blocks []*types.Block) {
+	for _, block := range blocks {
+		for i := range block.Txs {
+			tx := block.Txs[i]
+			if _, mined := bc.txIndex[tx.Hash]; mined || tx.Type == types.TxTypePatchReward {
+				continue
+			}
+			if bc.validateTransaction(&tx) == nil {
+				bc.txPool[tx.Hash] = &tx
+			}
+		}
+	}
+}
+
+// dropSideBranch forgets a side block and every side block built on it; the
+// caller must hold the lock
+func (bc *Blockchain) dropSideBranch(hash types.Hash) {
+	dropped := map[types.Hash]bool{hash: true}
+	delete(bc.sideBlocks, hash)
+	for changed := true; changed; {
+		changed = false
+		for h, block := range bc.sideBlocks {
+			if dropped[block.Header.PrevHash] {
+				dropped[h] = true
+				delete(bc.sideBlocks, h)
+				changed = true
+			}
+		}
+	}
+}
+
+// restoreChain reconnects previously disconnected blocks after a failed reorg;
+// the caller must hold the lock
+func (bc *Blockchain) restoreChain(blocks []*types.Block) error {
+	for _, block := range blocks {
+		if err := bc.connectBlock(block); err != nil {
+			return fmt.Errorf("block #%d: %v", block.Header.Height, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package blockchain
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"agent-chain/pkg/types"
+)
+
+func TestSideBlockRejectsForgeries(t *testing.T) {
+	validator, forger := newKey(t), newKey(t)
+	bc := newTestChain(t, testConfig(1000))
+	genesis, _ := bc.GetBlockByHeight(0)
+	addBlock(t, bc, validator)
+	addBlock(t, bc, validator)
+
+	now := time.Now().Unix()
+	tests := []struct {
+		name   string
+		mutate func(*types.Block)
+	}{
+		{"tampered header", func(b *types.Block) { b.Header.Timestamp++ }},
+		{"unsigned", func(b *types.Block) { b.Header.Signature = nil }},
+		{"signed by another key", func(b *types.Block) {
+			b.Header.Validator = validator.GetAddress()
+			b.Header.Hash = b.CalculateHash()
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := emptyBlockOn(t, genesis, forger, now)
+			tt.mutate(block)
+
+			err := bc.AddBlock(context.Background(), block)
+			if !IsInvalidBlock(err) {
+				t.Fatalf("got %v, want an invalid block error", err)
+			}
+			if got := len(bc.sideBlocks); got != 0 {
+				t.Errorf("stored %d side blocks", got)
+			}
+		})
+	}
+}
+
+func TestSideBlocksBoundedPerHeight(t *testing.T) {
+	validator := newKey(t)
+	bc := newTestChain(t, testConfig(1000))
+	genesis, _ := bc.GetBlockByHeight(0)
+	addBlock(t, bc, validator)
+	addBlock(t, bc, validator)
+
+	now := time.Now().Unix()
+	for i := 0; i < maxSideBlocksPerHeight; i++ {
+		block := emptyBlockOn(t, genesis, validator, now-int64(i)-10)
+		if err := bc.AddBlock(context.Background(), block); err != nil {
+			t.Fatalf("side block %d: %v", i, err)
+		}
+	}
+
+	err := bc.AddBlock(context.Background(), emptyBlockOn(t, genesis, validator, now-20))
+	if err == nil {
+		t.Fatal("side block beyond the per-height limit was stored")
+	}
+	if IsInvalidBlock(err) {
+		t.Errorf("a full store is not the sender's fault: %v", err)
+	}
+	if got := len(bc.sideBlocks); got != maxSideBlocksPerHeight {
+		t.Errorf("stored %d side blocks, want %d", got, maxSideBlocksPerHeight)
+	}
+}
+
+func TestReorgToLongerBranch(t *testing.T) {
+	validator := newKey(t)
+	bc := newTestChain(t, testConfig(1000))
+	genesis, _ := bc.GetBlockByHeight(0)
+	addBlock(t, bc, validator)
+
+	now := time.Now().Unix()
+	side1 := emptyBlockOn(t, genesis, validator, now-10)
+	if err := bc.AddBlock(context.Background(), side1); err != nil {
+		t.Fatalf("side block: %v", err)
+	}
+	if bc.GetHeight() != 1 || bc.GetLastBlock().Header.Hash == side1.Header.Hash {
+		t.Fatal("an equally long branch must not replace the tip")
+	}
+
+	side2 := emptyBlockOn(t, side1, validator, now-5)
+	if err := bc.AddBlock(context.Background(), side2); err != nil {
+		t.Fatalf("extending side branch: %v", err)
+	}
+	if got := bc.GetLastBlock().Header.Hash; got != side2.Header.Hash {
+		t.Fatalf("tip is %s, want the longer branch's %s", got, side2.Header.Hash)
+	}
+	if got, _ := bc.GetBlockByHeight(1); got.Header.Hash != side1.Header.Hash {
+		t.Errorf("block #1 was not replaced by the branch")
+	}
+}
+
+func TestReorgBelowFinalityRejected(t *testing.T) {
+	validator := newKey(t)
+	config := testConfig(1000)
+	config.FinalityDepth = 2
+	config.MaxReorgDepth = 10
+	dataDir := t.TempDir()
+	bc := openTestChain(t, config, dataDir)
+	for i := 0; i < 4; i++ {
+		addBlock(t, bc, validator)
+	}
+	if got := bc.GetFinalizedHeight(); got != 2 {
+		t.Fatalf("finalized height = %d, want 2", got)
+	}
+
+	tests := []struct {
+		name   string
+		parent int64
+		want   string
+	}{
+		{"fork at genesis", 0, "finalized"},
+		{"fork replacing the finalized block", 1, "finalized"},
+		{"fork above finality", 2, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent, err := bc.GetBlockByHeight(tt.parent)
+			if err != nil {
+				t.Fatalf("GetBlockByHeight: %v", err)
+			}
+			tip := bc.GetLastBlock().Header.Hash
+			err = bc.AddBlock(context.Background(), emptyBlockOn(t, parent, validator, parent.Header.Timestamp+5))
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("side block above finality: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %v, want an error mentioning %q", err, tt.want)
+			}
+			if got := bc.GetLastBlock().Header.Hash; got != tip {
+				t.Errorf("tip moved to %s", got)
+			}
+		})
+	}
+
+	// Finality survives a restart with a deeper finality depth
+	if err := bc.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	config.FinalityDepth = 50
+	reopened := openTestChain(t, config, dataDir)
+	if got := reopened.GetFinalizedHeight(); got != 2 {
+		t.Errorf("finalized height after restart = %d, want 2", got)
+	}
+	genesis, _ := reopened.GetBlockByHeight(0)
+	if err := reopened.AddBlock(context.Background(), emptyBlockOn(t, genesis, validator, genesis.Header.Timestamp+5)); err == nil {
+		t.Error("fork below the finalized height accepted after restart")
+	}
+}
+
+func TestReorgBeyondMaxDepthRejected(t *testing.T) {
+	validator := newKey(t)
+	config := testConfig(1000)
+	config.MaxReorgDepth = 2
+	bc := newTestChain(t, config)
+	for i := 0; i < 4; i++ {
+		addBlock(t, bc, validator)
+	}
+	if got := bc.GetFinalizedHeight(); got != 0 {
+		t.Fatalf("finalized height = %d, want 0 with the default finality depth", got)
+	}
+
+	parent, _ := bc.GetBlockByHeight(1)
+	err := bc.AddBlock(context.Background(), emptyBlockOn(t, parent, validator, parent.Header.Timestamp+5))
+	if err == nil || !strings.Contains(err.Error(), "maximum reorg depth") {
+		t.Fatalf("got %v, want a maximum reorg depth error", err)
+	}
+
+	parent, _ = bc.GetBlockByHeight(2)
+	if err := bc.AddBlock(context.Background(), emptyBlockOn(t, parent, validator, parent.Header.Timestamp+5)); err != nil {
+		t.Errorf("fork within the maximum reorg depth: %v", err)
+	}
+}
+
+func TestFailedReorgRestoresChainAndPool(t *testing.T) {
+	validator, alice := newKey(t), newKey(t)
+	config := testConfig(1000, alice)
+	bc := newTestChain(t, config)
+
+	// A second chain from the same genesis builds the competing branch
+	other := newTestChain(t, config)
+	genesis, _ := bc.GetBlockByHeight(0)
+	if otherGenesis, _ := other.GetBlockByHeight(0); otherGenesis.Header.Hash != genesis.Header.Hash {
+		t.Fatal("chains from the same config have different genesis blocks")
+	}
+
+	tx := transfer(t, alice, types.Address{1}, 10, 1, 0)
+	if err := bc.AddTransaction(tx); err != nil {
+		t.Fatalf("AddTransaction: %v", err)
+	}
+	addBlock(t, bc, validator)
+	tip := addBlock(t, bc, validator)
+
+	// The branch mines the pooled transfer, then commits to a bogus state
+	side1 := nextBlock(t, other, validator, *tx)
+	side2 := emptyBlockOn(t, side1, validator, side1.Header.Timestamp+1)
+	side2.Header.StateRoot = types.Hash{1}
+	if err := validator.SignBlock(side2); err != nil {
+		t.Fatalf("SignBlock: %v", err)
+	}
+	side3 := emptyBlockOn(t, side2, validator, side2.Header.Timestamp+1)
+
+	for _, block := range []*types.Block{side1, side2} {
+		if err := bc.AddBlock(context.Background(), block); err != nil {
+			t.Fatalf("side block #%d: %v", block.Header.Height, err)
+		}
+	}
+	if err := bc.AddBlock(context.Background(), side3); err == nil {
+		t.Fatal("reorg onto a branch with an invalid block succeeded")
+	}
+
+	if got := bc.GetLastBlock().Header.Hash; got != tip.Header.Hash {
+		t.Fatalf("tip is %s after the failed reorg, want %s", got, tip.Header.Hash)
+	}
+	if got := bc.GetAccount(alice.GetAddress()).Balance; got != 1000 {
+		t.Errorf("alice balance = %d, want 1000", got)
+	}
+	if info, err := bc.GetTransaction(tx.Hash); err != nil || !info.Pending {
+		t.Errorf("transfer from the rolled back block is not pooled: %+v, %v", info, err)
+	}
+
+	// The valid block stays as a side block; the invalid one and its
+	// descendant are gone
+	if _, exists := bc.sideBlocks[side1.Header.Hash]; !exists {
+		t.Error("valid side block was dropped")
+	}
+	for _, block := range []*types.Block{side2, side3} {
+		if _, exists := bc.sideBlocks[block.Header.Hash]; exists {
+			t.Errorf("side block #%d built on the invalid block is still stored", block.Header.Height)
+		}
+	}
+}
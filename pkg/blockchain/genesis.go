@@ -0,0 +1,171 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"agent-chain/pkg/crypto"
+	"agent-chain/pkg/types"
+)
+
+// Genesis describes the starting point of a network. Every node started
+// from the same genesis builds the same genesis block.
+type Genesis struct {
+	ChainID   int64            `json:"chain_id"`
+	BlockTime string           `json:"block_time,omitempty"` // e.g. "10s"; defaults to DefaultBlockTime
+	Timestamp int64            `json:"timestamp"`
+	Accounts  []GenesisAccount `json:"accounts"`
+}
+
+// GenesisAccount is an account funded in the genesis state
+type GenesisAccount struct {
+	Address string `json:"address"`
+	Balance int64  `json:"balance"`
+}
+
+// LoadGenesis reads and validates a genesis file
+func LoadGenesis(path string) (*Genesis, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read genesis file: %v", err)
+	}
+	return ParseGenesis(data)
+}
+
+// ParseGenesis decodes and validates a genesis document
+func ParseGenesis(data []byte) (*Genesis, error) {
+	var genesis Genesis
+	if err := json.Unmarshal(data, &genesis); err != nil {
+		return nil, fmt.Errorf("invalid genesis: %v", err)
+	}
+
+	if genesis.ChainID <= 0 {
+		return nil, fmt.Errorf("invalid genesis: chain_id must be positive")
+	}
+	// A fixed timestamp is what makes the genesis block reproducible
+	if genesis.Timestamp <= 0 {
+		return nil, fmt.Errorf("invalid genesis: timestamp must be positive")
+	}
+	if _, err := genesis.blockTime(); err != nil {
+		return nil, err
+	}
+	if _, err := genesis.accounts(); err != nil {
+		return nil, err
+	}
+
+	return &genesis, nil
+}
+
+// Apply sets the chain ID, block time and genesis state of config
+func (g *Genesis) Apply(config *types.ChainConfig) error {
+	blockTime, err := g.blockTime()
+	if err != nil {
+		return err
+	}
+	accounts, err := g.accounts()
+	if err != nil {
+		return err
+	}
+
+	config.ChainID = g.ChainID
+	config.BlockTime = blockTime
+	config.GenesisTime = g.Timestamp
+	config.GenesisAccounts = accounts
+	return nil
+}
+
+// GenesisBlock builds the genesis block for config. With a fixed GenesisTime
+// the result depends only on the config, so nodes sharing a genesis file
+// agree on its hash.
+func GenesisBlock(config *types.ChainConfig) *types.Block {
+	accounts := make([]*types.Account, 0, len(config.GenesisAccounts))
+	for _, account := range genesisState(config) {
+		accounts = append(accounts, account)
+	}
+
+	timestamp := config.GenesisTime
+	if timestamp <= 0 {
+		timestamp = time.Now().Unix()
+	}
+
+	genesis := &types.Block{
+		Header: types.BlockHeader{
+			Height:     0,
+			PrevHash:   types.Hash{},
+			StateRoot:  types.StateRoot(accounts),
+			Timestamp:  timestamp,
+			Difficulty: 1,
+			Nonce:      0,
+		},
+		Txs: []types.Transaction{},
+	}
+	genesis.Header.Hash = genesis.CalculateHash()
+	return genesis
+}
+
+// genesisState returns the accounts funded by config at genesis
+func genesisState(config *types.ChainConfig) map[types.Address]*types.Account {
+	accounts := make(map[types.Address]*types.Account, len(config.GenesisAccounts))
+	for _, acc := range config.GenesisAccounts {
+		account := acc
+		accounts[acc.Address] = &account
+	}
+	return accounts
+}
+
+// GenesisHash returns the hash of this chain's genesis block
+func (bc *Blockchain) GenesisHash() types.Hash {
+	return bc.genesis
+}
+
+// loadGenesisHash records the genesis hash of an existing data dir
+func (bc *Blockchain) loadGenesisHash(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var genesis types.Block
+	if err := json.Unmarshal(data, &genesis); err != nil {
+		return fmt.Errorf("invalid genesis marker: %v", err)
+	}
+	bc.genesis = genesis.Header.Hash
+	return nil
+}
+
+// blockTime parses the block time, falling back to the default
+func (g *Genesis) blockTime() (time.Duration, error) {
+	if g.BlockTime == "" {
+		return types.DefaultBlockTime, nil
+	}
+	blockTime, err := time.ParseDuration(g.BlockTime)
+	if err != nil {
+		return 0, fmt.Errorf("invalid genesis block_time %q: %v", g.BlockTime, err)
+	}
+	if blockTime < types.MinBlockTime {
+		return 0, fmt.Errorf("invalid genesis block_time %q: must be at least %v", g.BlockTime, types.MinBlockTime)
+	}
+	return blockTime, nil
+}
+
+// accounts converts the prefunded accounts, rejecting duplicates
+func (g *Genesis) accounts() ([]types.Account, error) {
+	accounts := make([]types.Account, 0, len(g.Accounts))
+	seen := make(map[types.Address]bool, len(g.Accounts))
+	for _, entry := range g.Accounts {
+		address, err := crypto.AddressFromString(entry.Address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid genesis account %q: %v", entry.Address, err)
+		}
+		if entry.Balance <= 0 {
+			return nil, fmt.Errorf("genesis account %s must have a positive balance", address)
+		}
+		if seen[address] {
+			return nil, fmt.Errorf("genesis account %s is listed twice", address)
+		}
+		seen[address] = true
+		accounts = append(accounts, types.Account{Address: address, Balance: entry.Balance})
+	}
+	return accounts, nil
+}
@@ -0,0 +1,88 @@
+package blockchain
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"agent-chain/pkg/types"
+)
+
+const testGenesis = `{
+  "chain_id": 7,
+  "block_time": "5s",
+  "timestamp": 1735689600,
+  "accounts": [
+    {"address": "0x5a040a69c5f3ba8649d27101c192b22ad237c1b7", "balance": 1000},
+    {"address": "0x1396780f5e7d4859274fe7f3713c579144b8171e", "balance": 2000}
+  ]
+}`
+
+// chainFromGenesis opens a chain in a fresh directory configured by the
+// genesis document
+func chainFromGenesis(t *testing.T, doc string) *Blockchain {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "genesis.json")
+	if err := os.WriteFile(path, []byte(doc), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	genesis, err := LoadGenesis(path)
+	if err != nil {
+		t.Fatalf("LoadGenesis: %v", err)
+	}
+
+	config := testConfig(0)
+	if err := genesis.Apply(config); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	return newTestChain(t, config)
+}
+
+func TestSameGenesisFileSameHash(t *testing.T) {
+	a, b := chainFromGenesis(t, testGenesis), chainFromGenesis(t, testGenesis)
+	if a.GenesisHash() != b.GenesisHash() {
+		t.Fatalf("genesis hashes differ: %s and %s", a.GenesisHash(), b.GenesisHash())
+	}
+	if a.ChainID() != 7 {
+		t.Errorf("chain ID = %d, want 7", a.ChainID())
+	}
+
+	other := chainFromGenesis(t, strings.Replace(testGenesis, "2000", "2001", 1))
+	if other.GenesisHash() == a.GenesisHash() {
+		t.Error("a different genesis balance gave the same genesis hash")
+	}
+}
+
+func TestParseGenesisRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		{"not json", `chain_id: 7`},
+		{"no chain id", `{"timestamp": 1735689600}`},
+		{"no timestamp", `{"chain_id": 7}`},
+		{"bad block time", `{"chain_id": 7, "timestamp": 1735689600, "block_time": "soon"}`},
+		{"block time below minimum", `{"chain_id": 7, "timestamp": 1735689600, "block_time": "50ms"}`},
+		{"bad address", `{"chain_id": 7, "timestamp": 1735689600, "accounts": [{"address": "0x12", "balance": 1}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseGenesis([]byte(tt.doc)); err == nil {
+				t.Error("ParseGenesis accepted an invalid genesis")
+			}
+		})
+	}
+
+	genesis, err := ParseGenesis([]byte(testGenesis))
+	if err != nil {
+		t.Fatalf("ParseGenesis: %v", err)
+	}
+	var config types.ChainConfig
+	if err := genesis.Apply(&config); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if config.BlockTime.Seconds() != 5 || len(config.GenesisAccounts) != 2 {
+		t.Errorf("applied block time %v with %d accounts, want 5s with 2", config.BlockTime, len(config.GenesisAccounts))
+	}
+}
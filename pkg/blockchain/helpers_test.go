@@ -0,0 +1,148 @@
+package blockchain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"agent-chain/pkg/crypto"
+	"agent-chain/pkg/types"
+)
+
+// testChainID is the chain ID test chains and transactions use
+const testChainID = 1337
+
+// testConfig returns a chain config that funds each key pair with balance
+func testConfig(balance int64, keys ...*crypto.KeyPair) *types.ChainConfig {
+	config := &types.ChainConfig{
+		ChainID:       testChainID,
+		BlockTime:     types.DefaultBlockTime,
+		MaxBlockSize:  types.DefaultMaxBlockSize,
+		MaxTxPerBlock: types.DefaultMaxTxPerBlock,
+		InitialReward: types.DefaultInitialReward,
+		GenesisTime:   time.Now().Add(-time.Hour).Unix(),
+		GasPrice:      types.DefaultGasPrice,
+	}
+	for _, kp := range keys {
+		config.GenesisAccounts = append(config.GenesisAccounts, types.Account{
+			Address: kp.GetAddress(),
+			Balance: balance,
+		})
+	}
+	return config
+}
+
+// newTestChain opens a chain in a temporary directory and closes it when the
+// test ends
+func newTestChain(t *testing.T, config *types.ChainConfig) *Blockchain {
+	t.Helper()
+	return openTestChain(t, config, t.TempDir())
+}
+
+// openTestChain opens a chain in dataDir and closes it when the test ends
+func openTestChain(t *testing.T, config *types.ChainConfig, dataDir string) *Blockchain {
+	t.Helper()
+	bc, err := NewBlockchain(config, dataDir)
+	if err != nil {
+		t.Fatalf("NewBlockchain: %v", err)
+	}
+	t.Cleanup(func() { bc.Close(context.Background()) })
+	return bc
+}
+
+// newKey generates a key pair or fails the test
+func newKey(t *testing.T) *crypto.KeyPair {
+	t.Helper()
+	kp, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+	return kp
+}
+
+// signTx signs a transaction for the test chain
+func signTx(t *testing.T, kp *crypto.KeyPair, tx *types.Transaction) *types.Transaction {
+	t.Helper()
+	tx.From = kp.GetAddress()
+	tx.ChainID = testChainID
+	if tx.Timestamp == 0 {
+		tx.Timestamp = time.Now().Unix()
+	}
+
+	if err := kp.SignTransaction(tx); err != nil {
+		t.Fatalf("SignTransaction: %v", err)
+	}
+	return tx
+}
+
+// transfer returns a signed transfer
+func transfer(t *testing.T, from *crypto.KeyPair, to types.Address, amount, fee, nonce int64) *types.Transaction {
+	t.Helper()
+	return signTx(t, from, &types.Transaction{
+		Type:   types.TxTypeTransfer,
+		To:     to,
+		Amount: amount,
+		Fee:    fee,
+		Nonce:  nonce,
+	})
+}
+
+// nextBlock builds a block on the tip carrying txs, signed by validator
+func nextBlock(t *testing.T, bc *Blockchain, validator *crypto.KeyPair, txs ...types.Transaction) *types.Block {
+	t.Helper()
+	last := bc.GetLastBlock()
+	block := &types.Block{
+		Header: types.BlockHeader{
+			Height:     last.Header.Height + 1,
+			PrevHash:   last.Header.Hash,
+			Timestamp:  last.Header.Timestamp + 1,
+			Difficulty: 1,
+			Validator:  validator.GetAddress(),
+		},
+		Txs: txs,
+	}
+	if block.Header.Height == 1 {
+		block.Header.Timestamp = time.Now().Unix()
+	}
+
+	stateRoot, err := bc.StateRootAfter(block)
+	if err != nil {
+		t.Fatalf("StateRootAfter: %v", err)
+	}
+	block.Header.StateRoot = stateRoot
+	if err := validator.SignBlock(block); err != nil {
+		t.Fatalf("SignBlock: %v", err)
+	}
+	return block
+}
+
+// addBlock builds the next block and adds it to the chain
+func addBlock(t *testing.T, bc *Blockchain, validator *crypto.KeyPair, txs ...types.Transaction) *types.Block {
+	t.Helper()
+	block := nextBlock(t, bc, validator, txs...)
+	if err := bc.AddBlock(context.Background(), block); err != nil {
+		t.Fatalf("AddBlock #%d: %v", block.Header.Height, err)
+	}
+	return block
+}
+
+// emptyBlockOn builds an empty block on any parent, canonical or not. An
+// empty block leaves the state unchanged, so it reuses the parent's root.
+func emptyBlockOn(t *testing.T, parent *types.Block, validator *crypto.KeyPair, timestamp int64) *types.Block {
+	t.Helper()
+	block := &types.Block{
+		Header: types.BlockHeader{
+			Height:     parent.Header.Height + 1,
+			PrevHash:   parent.Header.Hash,
+			StateRoot:  parent.Header.StateRoot,
+			Timestamp:  timestamp,
+			Difficulty: 1,
+			Validator:  validator.GetAddress(),
+		},
+		Txs: []types.Transaction{},
+	}
+	if err := validator.SignBlock(block); err != nil {
+		t.Fatalf("SignBlock: %v", err)
+	}
+	return block
+}
@@ -0,0 +1,162 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"agent-chain/pkg/types"
+)
+
+// makeRoom checks the pool limits for an incoming transaction. When the pool
+// is full it returns the pooled transaction the incoming one displaces, which
+// must pay a strictly higher fee than the cheapest pooled transaction; the
+// caller must hold the lock.
+func (bc *Blockchain) makeRoom(tx *types.Transaction) (*types.Transaction, error) {
+	if limit := bc.config.MaxMempoolPerSender; limit > 0 {
+		count := 0
+		for _, pooled := range bc.txPool {
+			if pooled.From == tx.From {
+				count++
+			}
+		}
+		if count >= limit {
+			return nil, fmt.Errorf("sender %s already has %d pending transactions", tx.From, count)
+		}
+	}
+
+	limit := bc.config.MaxMempoolSize
+	if limit <= 0 || len(bc.txPool) < limit {
+		return nil, nil
+	}
+
+	cheapest := bc.cheapestPooled()
+	if tx.Fee <= cheapest.Fee {
+		return nil, fmt.Errorf("mempool full: fee %d must exceed minimum pooled fee %d", tx.Fee, cheapest.Fee)
+	}
+	return cheapest, nil
+}
+
+// cheapestPooled returns the pooled transaction to evict first: the lowest
+// fee, and among equal fees the most recent arrival; the caller must hold the lock
+func (bc *Blockchain) cheapestPooled() *types.Transaction {
+	var cheapest *types.Transaction
+	for _, tx := range bc.txPool {
+		if cheapest == nil || evictsBefore(tx, cheapest) {
+			cheapest = tx
+		}
+	}
+	return cheapest
+}
+
+// evictsBefore orders transactions for eviction
+func evictsBefore(a, b *types.Transaction) bool {
+	if a.Fee != b.Fee {
+		return a.Fee < b.Fee
+	}
+	if a.Timestamp != b.Timestamp {
+		return a.Timestamp > b.Timestamp
+	}
+	return a.Hash.String() > b.Hash.String()
+}
+
+// PendingNonce returns the nonce the address's next transaction should use:
+// its account nonce, advanced past every consecutive nonce already pooled
+func (bc *Blockchain) PendingNonce(addr types.Address) int64 {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.pendingNonce(addr)
+}
+
+// pendingNonce implements PendingNonce; the caller must hold the lock
+func (bc *Blockchain) pendingNonce(addr types.Address) int64 {
+	pooled := make(map[int64]bool)
+	for _, tx := range bc.txPool {
+		if tx.From == addr {
+			pooled[tx.Nonce] = true
+		}
+	}
+
+	nonce := bc.GetAccount(addr).Nonce
+	for pooled[nonce] {
+		nonce++
+	}
+	return nonce
+}
+
+// dropExpired removes pooled transactions that can no longer be mined once
+// the chain reaches height; the caller must hold the lock
+func (bc *Blockchain) dropExpired(height int64) {
+	for hash, tx := range bc.txPool {
+		if tx.ValidUntil != 0 && tx.ValidUntil <= height {
+			delete(bc.txPool, hash)
+		}
+	}
+}
+
+// SelectTransactions picks the candidates a block with the given header can
+// include, in order and at most limit of them (zero means no limit). Each
+// candidate must be valid against the current state, as validateBlock
+// requires, and must apply on top of the ones picked before it. Pooled
+// transactions that are invalid against the current state are evicted so they
+// are not retried every block; ones that only conflict with an earlier pick
+// stay pooled for a later block.
+func (bc *Blockchain) SelectTransactions(header *types.BlockHeader, candidates []types.Transaction, limit int) []types.Transaction {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	// Apply to a scratch copy and always put the live state back
+	prev := bc.currentState()
+	bc.setState(prev.copy())
+	defer func() {
+		bc.setState(prev)
+		bc.pendingAudit = nil
+	}()
+
+	var selected []types.Transaction
+	evicted := false
+	for i := range candidates {
+		if limit > 0 && len(selected) >= limit {
+			break
+		}
+		tx := candidates[i]
+
+		if err := bc.checkTransactionAgainst(prev, &tx); err != nil {
+			if _, pooled := bc.txPool[tx.Hash]; pooled {
+				delete(bc.txPool, tx.Hash)
+				evicted = true
+			}
+			continue
+		}
+		if err := bc.applyTransaction(&tx, header); err != nil {
+			// The failed transaction may have been partly applied
+			bc.replaySelected(prev, selected, header)
+			continue
+		}
+		selected = append(selected, tx)
+	}
+
+	// A stale file is harmless: loadMempool drops the same transactions
+	if evicted {
+		_ = bc.saveMempool()
+	}
+	return selected
+}
+
+// checkTransactionAgainst runs checkTransaction against the given state
+// rather than the scratch state being built; the caller must hold the lock
+func (bc *Blockchain) checkTransactionAgainst(state stateMaps, tx *types.Transaction) error {
+	scratch := bc.currentState()
+	bc.setState(state)
+	defer bc.setState(scratch)
+	return bc.checkTransaction(tx)
+}
+
+// replaySelected rebuilds the scratch state from prev and the transactions
+// selected so far; the caller must hold the lock
+func (bc *Blockchain) replaySelected(prev stateMaps, selected []types.Transaction, header *types.BlockHeader) {
+	bc.setState(prev.copy())
+	bc.pendingAudit = nil
+	for i := range selected {
+		// These applied cleanly against the same state a moment ago
+		_ = bc.applyTransaction(&selected[i], header)
+	}
+}
@@ -0,0 +1,320 @@
+package blockchain
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"agent-chain/pkg/crypto"
+	"agent-chain/pkg/types"
+)
+
+func TestPendingNonceSkipsPooledTransactions(t *testing.T) {
+	alice, bob := newKey(t), newKey(t)
+	bc := newTestChain(t, testConfig(1000, alice))
+
+	if got := bc.PendingNonce(alice.GetAddress()); got != 0 {
+		t.Fatalf("fresh account: got nonce %d, want 0", got)
+	}
+
+	for nonce := int64(0); nonce < 2; nonce++ {
+		if err := bc.AddTransaction(transfer(t, alice, bob.GetAddress(), 10, 1, nonce)); err != nil {
+			t.Fatalf("AddTransaction(nonce %d): %v", nonce, err)
+		}
+	}
+	if got := bc.PendingNonce(alice.GetAddress()); got != 2 {
+		t.Errorf("two pooled: got nonce %d, want 2", got)
+	}
+	if got := bc.PendingNonce(bob.GetAddress()); got != 0 {
+		t.Errorf("other sender: got nonce %d, want 0", got)
+	}
+}
+
+func TestAddTransactionVerifiesSignature(t *testing.T) {
+	alice, mallory := newKey(t), newKey(t)
+	bc := newTestChain(t, testConfig(1000, alice))
+
+	tx := transfer(t, alice, mallory.GetAddress(), 10, 1, 0)
+	tx.Amount = 900
+	tx.Hash = tx.CalculateHash()
+	if err := bc.AddTransaction(tx); err == nil {
+		t.Error("tampered transaction was pooled")
+	}
+
+	// Mallory signs a spend from Alice's account with their own key
+	forged := transfer(t, mallory, mallory.GetAddress(), 10, 1, 0)
+	forged.From = alice.GetAddress()
+	forged.Hash = forged.CalculateHash()
+	if err := bc.AddTransaction(forged); err == nil {
+		t.Error("transaction signed by another key was pooled")
+	}
+
+	if err := bc.AddTransaction(transfer(t, alice, mallory.GetAddress(), 10, 1, 0)); err != nil {
+		t.Errorf("valid transaction rejected: %v", err)
+	}
+}
+
+func TestSelectTransactionsDefersConflicts(t *testing.T) {
+	alice, bob := newKey(t), newKey(t)
+	bc := newTestChain(t, testConfig(100, alice))
+
+	first := transfer(t, alice, bob.GetAddress(), 90, 1, 0)
+	second := transfer(t, alice, bob.GetAddress(), 90, 1, 1)
+	for _, tx := range []*types.Transaction{first, second} {
+		if err := bc.AddTransaction(tx); err != nil {
+			t.Fatalf("AddTransaction: %v", err)
+		}
+	}
+
+	// Each is valid alone, but only one fits in alice's balance
+	header := &types.BlockHeader{Height: 1, Validator: bob.GetAddress()}
+	selected := bc.SelectTransactions(header, []types.Transaction{*first, *second}, 0)
+	if len(selected) != 1 || selected[0].Hash != first.Hash {
+		t.Fatalf("selected %d transactions, want only the first", len(selected))
+	}
+	if got := len(bc.GetPendingTransactions()); got != 2 {
+		t.Errorf("pool has %d transactions, want the conflicting one kept", got)
+	}
+	if got := bc.GetAccount(alice.GetAddress()).Balance; got != 100 {
+		t.Errorf("selection changed live balance to %d", got)
+	}
+
+	// Once the first is mined the second can never apply, so it is evicted
+	addBlock(t, bc, bob, selected...)
+	header = &types.BlockHeader{Height: 2, Validator: bob.GetAddress()}
+	if selected := bc.SelectTransactions(header, []types.Transaction{*second}, 0); len(selected) != 0 {
+		t.Errorf("selected %d transactions, want none", len(selected))
+	}
+	if got := len(bc.GetPendingTransactions()); got != 0 {
+		t.Errorf("pool has %d transactions, want the invalid one evicted", got)
+	}
+}
+
+func TestSelectTransactionsLimit(t *testing.T) {
+	alice, bob := newKey(t), newKey(t)
+	bc := newTestChain(t, testConfig(1000, alice))
+
+	var candidates []types.Transaction
+	for nonce := int64(0); nonce < 5; nonce++ {
+		candidates = append(candidates, *transfer(t, alice, bob.GetAddress(), 10, 1, nonce))
+	}
+	header := &types.BlockHeader{Height: 1, Validator: bob.GetAddress()}
+
+	if got := len(bc.SelectTransactions(header, candidates, 3)); got != 3 {
+		t.Errorf("limit 3: selected %d", got)
+	}
+	if got := len(bc.SelectTransactions(header, candidates, 0)); got != 5 {
+		t.Errorf("limit 0 (unlimited): selected %d", got)
+	}
+}
+
+func TestMempoolSurvivesRestart(t *testing.T) {
+	alice, bob, broke := newKey(t), newKey(t), newKey(t)
+	config := testConfig(1000, alice)
+	dataDir := t.TempDir()
+	bc := openTestChain(t, config, dataDir)
+
+	pooled := []*types.Transaction{
+		transfer(t, alice, bob.GetAddress(), 10, 1, 0),
+		transfer(t, alice, bob.GetAddress(), 20, 1, 1),
+	}
+	for _, tx := range pooled {
+		if err := bc.AddTransaction(tx); err != nil {
+			t.Fatalf("AddTransaction: %v", err)
+		}
+	}
+	if err := bc.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// Slip in a transaction that is no longer valid when the node restarts
+	path := filepath.Join(dataDir, "mempool.json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("mempool not saved: %v", err)
+	}
+	var saved []*types.Transaction
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("saved mempool: %v", err)
+	}
+	saved = append(saved, transfer(t, broke, bob.GetAddress(), 10, 1, 0))
+	if data, err = json.Marshal(saved); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := openTestChain(t, config, dataDir)
+	pending := reopened.GetPendingTransactions()
+	if len(pending) != len(pooled) {
+		t.Fatalf("got %d pending transactions after restart, want %d", len(pending), len(pooled))
+	}
+	for _, tx := range pooled {
+		info, err := reopened.GetTransaction(tx.Hash)
+		if err != nil || !info.Pending {
+			t.Errorf("transaction %s not pending after restart: %v", tx.Hash, err)
+		}
+	}
+}
+
+func TestMempoolEvictsLowestFee(t *testing.T) {
+	senders := make([]*crypto.KeyPair, 6)
+	for i := range senders {
+		senders[i] = newKey(t)
+	}
+	config := testConfig(1000, senders...)
+	config.MaxMempoolSize = 3
+	bc := newTestChain(t, config)
+	to := newKey(t).GetAddress()
+
+	// send returns a transaction from senders[sender] paying fee, stamped
+	// age seconds ago
+	send := func(sender, fee, age int64) *types.Transaction {
+		return signTx(t, senders[sender], &types.Transaction{
+			Type:      types.TxTypeTransfer,
+			To:        to,
+			Amount:    10,
+			Fee:       fee,
+			Timestamp: time.Now().Unix() - age,
+		})
+	}
+	pooled := func(tx *types.Transaction) bool {
+		info, err := bc.GetTransaction(tx.Hash)
+		return err == nil && info.Pending
+	}
+
+	older, newer, rich := send(0, 3, 20), send(1, 3, 10), send(2, 8, 10)
+	for _, tx := range []*types.Transaction{older, newer, rich} {
+		if err := bc.AddTransaction(tx); err != nil {
+			t.Fatalf("AddTransaction: %v", err)
+		}
+	}
+
+	// A better fee pushes out the cheapest transaction, and among equal
+	// fees the most recent
+	if err := bc.AddTransaction(send(3, 4, 0)); err != nil {
+		t.Fatalf("fee 4 into a full pool: %v", err)
+	}
+	if pooled(newer) || !pooled(older) {
+		t.Errorf("evicted the wrong fee 3 transaction: older pooled %v, newer pooled %v", pooled(older), pooled(newer))
+	}
+
+	// Matching the lowest pooled fee is not enough
+	if err := bc.AddTransaction(send(4, 3, 0)); err == nil || !strings.Contains(err.Error(), "mempool full") {
+		t.Errorf("fee 3 with fee 3 pooled: got %v, want a mempool full error", err)
+	}
+
+	if err := bc.AddTransaction(send(5, 5, 0)); err != nil {
+		t.Fatalf("fee 5 into a full pool: %v", err)
+	}
+	if pooled(older) {
+		t.Error("the last fee 3 transaction was not evicted")
+	}
+	if got := len(bc.GetPendingTransactions()); got != 3 {
+		t.Errorf("pool holds %d transactions, want 3", got)
+	}
+}
+
+func TestMempoolPerSenderLimit(t *testing.T) {
+	alice, bob := newKey(t), newKey(t)
+	config := testConfig(1000, alice, bob)
+	config.MaxMempoolPerSender = 2
+	bc := newTestChain(t, config)
+
+	for nonce := int64(0); nonce < 2; nonce++ {
+		if err := bc.AddTransaction(transfer(t, alice, bob.GetAddress(), 10, 1, nonce)); err != nil {
+			t.Fatalf("AddTransaction(nonce %d): %v", nonce, err)
+		}
+	}
+	if err := bc.AddTransaction(transfer(t, alice, bob.GetAddress(), 10, 100, 2)); err == nil {
+		t.Error("pooled a third transaction from one sender")
+	}
+	if err := bc.AddTransaction(transfer(t, bob, alice.GetAddress(), 10, 1, 0)); err != nil {
+		t.Errorf("other sender: %v", err)
+	}
+}
+
+func TestExpiredTransactionNotMined(t *testing.T) {
+	alice, bob, validator := newKey(t), newKey(t), newKey(t)
+	bc := newTestChain(t, testConfig(1000, alice))
+
+	// Valid through height 2, so it expires once the chain reaches it
+	expiring := signTx(t, alice, &types.Transaction{
+		Type:       types.TxTypeTransfer,
+		To:         bob.GetAddress(),
+		Amount:     10,
+		Fee:        1,
+		ValidUntil: 2,
+	})
+	if err := bc.AddTransaction(expiring); err != nil {
+		t.Fatalf("AddTransaction: %v", err)
+	}
+	addBlock(t, bc, validator)
+	if pending := bc.GetPendingTransactions(); len(pending) != 1 {
+		t.Fatalf("%d transactions pooled at height 1, want the unexpired one", len(pending))
+	}
+	addBlock(t, bc, validator)
+
+	if pending := bc.GetPendingTransactions(); len(pending) != 0 {
+		t.Errorf("%d transactions still pooled after expiry", len(pending))
+	}
+	header := &nextBlock(t, bc, validator).Header
+	if selected := bc.SelectTransactions(header, []types.Transaction{*expiring}, 0); len(selected) != 0 {
+		t.Error("producer selected an expired transaction")
+	}
+	if err := bc.ValidateBlock(nextBlock(t, bc, validator, *expiring)); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("ValidateBlock error = %v, want an expiry error", err)
+	}
+	if err := bc.AddTransaction(expiring); err == nil {
+		t.Error("pooled an expired transaction")
+	}
+}
+
+func TestMinedTransactionReplayRejected(t *testing.T) {
+	alice, bob, validator := newKey(t), newKey(t), newKey(t)
+	bc := newTestChain(t, testConfig(1000, alice))
+
+	// Still far from expiry, so only the mined check stops the replay
+	mined := signTx(t, alice, &types.Transaction{
+		Type:       types.TxTypeTransfer,
+		To:         bob.GetAddress(),
+		Amount:     10,
+		Fee:        1,
+		ValidUntil: 100,
+	})
+	addBlock(t, bc, validator, *mined)
+
+	replayed := *mined
+	if err := bc.AddTransaction(&replayed); err == nil || !strings.Contains(err.Error(), "already mined") {
+		t.Errorf("AddTransaction error = %v, want an already mined error", err)
+	}
+	header := &nextBlock(t, bc, validator).Header
+	if selected := bc.SelectTransactions(header, []types.Transaction{replayed}, 0); len(selected) != 0 {
+		t.Error("producer selected a mined transaction")
+	}
+
+	tip := bc.GetLastBlock()
+	block := emptyBlockOn(t, tip, validator, tip.Header.Timestamp+1)
+	block.Txs = []types.Transaction{replayed}
+	if err := validator.SignBlock(block); err != nil {
+		t.Fatalf("SignBlock: %v", err)
+	}
+	if err := bc.ValidateBlock(block); err == nil || !strings.Contains(err.Error(), "already mined") {
+		t.Errorf("ValidateBlock error = %v, want an already mined error", err)
+	}
+	if err := bc.AddBlock(context.Background(), block); err == nil {
+		t.Error("added a block replaying a mined transaction")
+	}
+
+	if got := bc.GetAccount(bob.GetAddress()).Balance; got != 10 {
+		t.Errorf("recipient balance = %d, want 10", got)
+	}
+	if got := bc.GetAccount(alice.GetAddress()).Balance; got != 989 {
+		t.Errorf("sender balance = %d, want 989", got)
+	}
+}
@@ -0,0 +1,133 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"agent-chain/internal/fsutil"
+	"agent-chain/pkg/types"
+)
+
+// DataVersion is the data dir format written by this version of the node.
+//
+//	1: every block in a single blocks.json, rewritten on each block
+//	2: one file per block under blocks/, written once when the block is added
+const DataVersion = 2
+
+// migrations upgrade a data dir from the version they are keyed by to the next
+var migrations = map[int]func(dataDir string) error{
+	1: migrateBlocksFile,
+}
+
+// versionPath returns the location of the data dir's format version
+func versionPath(dataDir string) string {
+	return filepath.Join(dataDir, "version")
+}
+
+// migrateDataDir brings the data dir up to DataVersion one step at a time,
+// recording the version after each step so an interrupted upgrade resumes
+// where it stopped
+func migrateDataDir(dataDir string) error {
+	version, err := dataVersion(dataDir)
+	if err != nil {
+		return err
+	}
+	if version > DataVersion {
+		return fmt.Errorf("data dir %s has format version %d, but this node only supports up to %d; upgrade the node or use another data dir", dataDir, version, DataVersion)
+	}
+
+	for ; version < DataVersion; version++ {
+		migrate, ok := migrations[version]
+		if !ok {
+			return fmt.Errorf("no migration from data dir format version %d; re-sync into an empty data dir", version)
+		}
+		if err := migrate(dataDir); err != nil {
+			return fmt.Errorf("failed to migrate data dir from version %d to %d: %v", version, version+1, err)
+		}
+		if err := writeDataVersion(dataDir, version+1); err != nil {
+			return err
+		}
+	}
+
+	// Data dirs written before the version file existed are already current
+	if _, err := os.Stat(versionPath(dataDir)); os.IsNotExist(err) {
+		return writeDataVersion(dataDir, DataVersion)
+	}
+	return nil
+}
+
+// dataVersion reads the format version, inferring it for data dirs written
+// before the version file was introduced
+func dataVersion(dataDir string) (int, error) {
+	data, err := os.ReadFile(versionPath(dataDir))
+	if err == nil {
+		version, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			return 0, fmt.Errorf("invalid data dir version %q", strings.TrimSpace(string(data)))
+		}
+		return version, nil
+	}
+	if !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	if _, err := os.Stat(filepath.Join(dataDir, "blocks.json")); err == nil {
+		return 1, nil
+	}
+	return DataVersion, nil
+}
+
+// writeDataVersion records the data dir's format version
+func writeDataVersion(dataDir string, version int) error {
+	return fsutil.WriteFileAtomic(versionPath(dataDir), []byte(strconv.Itoa(version)+"\n"), 0644)
+}
+
+// migrateBlocksFile splits the version 1 blocks.json into one file per block.
+// Version 1 never wrote the genesis marker, so it is written here from the
+// first block; without it the chain would be reinitialized on startup.
+func migrateBlocksFile(dataDir string) error {
+	blocksPath := filepath.Join(dataDir, "blocks.json")
+	data, err := os.ReadFile(blocksPath)
+	if err != nil {
+		return err
+	}
+
+	var blocks []*types.Block
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		return fmt.Errorf("failed to parse blocks.json: %v", err)
+	}
+	if len(blocks) == 0 || blocks[0].Header.Height != 0 {
+		return fmt.Errorf("blocks.json does not start with the genesis block")
+	}
+
+	store := &Blockchain{dataDir: dataDir}
+	batch := make(fileBatch)
+	for i, block := range blocks {
+		if block.Header.Height != int64(i) {
+			return fmt.Errorf("blocks.json has block %d at position %d", block.Header.Height, i)
+		}
+		if err := store.saveBlock(batch, block); err != nil {
+			return err
+		}
+	}
+	if err := store.commitFiles(batch); err != nil {
+		return err
+	}
+
+	genesisPath := filepath.Join(dataDir, "genesis.json")
+	if _, err := os.Stat(genesisPath); os.IsNotExist(err) {
+		genesisData, err := json.MarshalIndent(blocks[0], "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := fsutil.WriteFileAtomic(genesisPath, genesisData, 0644); err != nil {
+			return err
+		}
+	}
+
+	return os.Remove(blocksPath)
+}
@@ -0,0 +1,122 @@
+package blockchain
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"agent-chain/pkg/types"
+)
+
+// writeV1DataDir lays out bc's chain the way version 1 stored it: every block
+// in blocks.json, beside the state files, with no genesis marker or version
+func writeV1DataDir(t *testing.T, bc *Blockchain, srcDir string) string {
+	t.Helper()
+	var blocks []*types.Block
+	for height := int64(0); height <= bc.GetHeight(); height++ {
+		block, err := bc.GetBlockByHeight(height)
+		if err != nil {
+			t.Fatalf("GetBlockByHeight(%d): %v", height, err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	dataDir := t.TempDir()
+	entries, err := os.ReadDir(srcDir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name() == "genesis.json" || entry.Name() == "version" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(srcDir, entry.Name()))
+		if err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dataDir, entry.Name()), data, 0644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+
+	data, err := json.Marshal(blocks)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "blocks.json"), data, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return dataDir
+}
+
+func TestUpgradeV1DataDir(t *testing.T) {
+	alice, bob, validator := newKey(t), newKey(t), newKey(t)
+	config := testConfig(1000, alice)
+	srcDir := t.TempDir()
+	source := openTestChain(t, config, srcDir)
+	addBlock(t, source, validator, *transfer(t, alice, bob.GetAddress(), 100, 1, 0))
+	addBlock(t, source, validator)
+	tip := source.GetLastBlock()
+	if err := source.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	dataDir := writeV1DataDir(t, source, srcDir)
+	upgraded := openTestChain(t, config, dataDir)
+
+	if got := upgraded.GetLastBlock().Header.Hash; got != tip.Header.Hash {
+		t.Errorf("upgraded tip %s, want %s", got, tip.Header.Hash)
+	}
+	if got := upgraded.GetAccount(bob.GetAddress()).Balance; got != 100 {
+		t.Errorf("bob's balance = %d, want 100", got)
+	}
+	if upgraded.GenesisHash() != source.GenesisHash() {
+		t.Errorf("genesis hash %s, want %s", upgraded.GenesisHash(), source.GenesisHash())
+	}
+
+	if _, err := os.Stat(filepath.Join(dataDir, "blocks.json")); !os.IsNotExist(err) {
+		t.Error("blocks.json was kept after the upgrade")
+	}
+	for height := int64(0); height <= tip.Header.Height; height++ {
+		if _, err := os.Stat(upgraded.blockPath(height)); err != nil {
+			t.Errorf("block #%d not in the block store: %v", height, err)
+		}
+	}
+	if version, err := dataVersion(dataDir); err != nil || version != DataVersion {
+		t.Errorf("data version = %d, %v; want %d", version, err, DataVersion)
+	}
+
+	// The upgraded chain keeps growing
+	addBlock(t, upgraded, validator)
+}
+
+func TestMigrateDataDirRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		err   string
+	}{
+		{"newer format", map[string]string{"version": "99\n"}, "only supports up to"},
+		{"unreadable version", map[string]string{"version": "two\n"}, "invalid data dir version"},
+		{"corrupt blocks file", map[string]string{"blocks.json": "[{"}, "failed to parse blocks.json"},
+		{"blocks file without genesis", map[string]string{"blocks.json": `[{"header": {"height": 1}}]`}, "genesis"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dataDir, name), []byte(content), 0644); err != nil {
+					t.Fatalf("WriteFile: %v", err)
+				}
+			}
+			err := migrateDataDir(dataDir)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("migrateDataDir error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"agent-chain/pkg/types"
+)
+
+// PendingPatches returns the mined patch submissions still awaiting
+// evaluation, oldest first
+func (bc *Blockchain) PendingPatches() []*types.Transaction {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	patches := make([]*types.Transaction, 0, len(bc.pendingPatches))
+	for _, tx := range bc.pendingPatches {
+		txCopy := *tx
+		patches = append(patches, &txCopy)
+	}
+	sort.Slice(patches, func(i, j int) bool {
+		return patches[i].Timestamp < patches[j].Timestamp
+	})
+	return patches
+}
+
+// PatchReward returns the amount a passing evaluation of the pending patch
+// would pay if applied in the next block
+func (bc *Blockchain) PatchReward(patchTx types.Hash) (int64, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	patch, exists := bc.pendingPatches[patchTx]
+	if !exists {
+		return 0, fmt.Errorf("no pending patch %s", patchTx)
+	}
+	return bc.patchReward(patch), nil
+}
+
+// patchReward computes the payout for a passing patch: the escrow of an open
+// registered problem, nothing for one that is no longer open, and the block
+// reward otherwise
+func (bc *Blockchain) patchReward(patch *types.Transaction) int64 {
+	if problem, exists := bc.problems[patch.PatchSet.ProblemID]; exists {
+		if problem.Status != types.ProblemStatusOpen {
+			return 0
+		}
+		return problem.Escrow
+	}
+	return bc.rewardAt(bc.height)
+}
+
+// checkPatchReward validates a patch_reward transaction. An amount of zero
+// records a failed evaluation; any other amount must match the reward due.
+func (bc *Blockchain) checkPatchReward(tx *types.Transaction) error {
+	if tx.PatchTx == nil {
+		return fmt.Errorf("missing patch transaction")
+	}
+
+	patch, exists := bc.pendingPatches[*tx.PatchTx]
+	if !exists {
+		return fmt.Errorf("no pending patch %s", tx.PatchTx)
+	}
+	if tx.To != patch.From {
+		return fmt.Errorf("patch reward must pay the patch author %s", patch.From)
+	}
+	if tx.Fee != 0 {
+		return fmt.Errorf("patch rewards carry no fee")
+	}
+	if tx.Amount != 0 && tx.Amount != bc.patchReward(patch) {
+		return fmt.Errorf("patch reward %d does not match %d due", tx.Amount, bc.patchReward(patch))
+	}
+
+	return nil
+}
+
+// applyPatchReward settles an evaluated patch, paying its author when it passed
+func (bc *Blockchain) applyPatchReward(tx *types.Transaction) error {
+	if err := bc.checkPatchReward(tx); err != nil {
+		return err
+	}
+
+	patch := bc.pendingPatches[*tx.PatchTx]
+	delete(bc.pendingPatches, *tx.PatchTx)
+
+	if tx.Amount == 0 {
+		return nil
+	}
+
+	if problem, exists := bc.problems[patch.PatchSet.ProblemID]; exists {
+		problem.Escrow = 0
+		problem.Status = types.ProblemStatusSolved
+		problem.SolvedBy = patch.From
+	}
+
+	account := bc.GetAccount(tx.To)
+	account.Balance += tx.Amount
+	bc.accounts[tx.To] = account
+
+	return nil
+}
+
+// patchCodeKey identifies a patch's normalized code within its problem
+func patchCodeKey(patch *types.PatchSet) string {
+	return patch.ProblemID + "/" + patch.NormalizedHash().String()
+}
+
+// checkDuplicatePatch rejects a patch whose normalized code was already
+// submitted for the same problem
+func (bc *Blockchain) checkDuplicatePatch(tx *types.Transaction) error {
+	if tx.PatchSet == nil {
+		return nil
+	}
+	if first, exists := bc.patchCodes[patchCodeKey(tx.PatchSet)]; exists && first != tx.Hash {
+		return fmt.Errorf("duplicate patch for problem %s: same code as %s", tx.PatchSet.ProblemID, first)
+	}
+	return nil
+}
+
+// checkPooledDuplicatePatch rejects a patch whose normalized code is already
+// waiting in the pool for the same problem, since only one of them could be mined
+func (bc *Blockchain) checkPooledDuplicatePatch(tx *types.Transaction) error {
+	if tx.Type != types.TxTypePatchSubmit || tx.PatchSet == nil {
+		return nil
+	}
+
+	key := patchCodeKey(tx.PatchSet)
+	for _, pooled := range bc.txPool {
+		if pooled.Type != types.TxTypePatchSubmit || pooled.PatchSet == nil {
+			continue
+		}
+		if pooled.PatchSet.ProblemID == tx.PatchSet.ProblemID && patchCodeKey(pooled.PatchSet) == key {
+			return fmt.Errorf("duplicate patch for problem %s: same code as pooled %s", tx.PatchSet.ProblemID, pooled.Hash)
+		}
+	}
+	return nil
+}
+
+// copyPatchCodes returns a copy of the submitted patch code registry
+func copyPatchCodes(codes map[string]types.Hash) map[string]types.Hash {
+	copied := make(map[string]types.Hash, len(codes))
+	for key, hash := range codes {
+		copied[key] = hash
+	}
+	return copied
+}
+
+// patchCodesPath returns the on-disk location of the patch code registry
+func (bc *Blockchain) patchCodesPath() string {
+	return filepath.Join(bc.dataDir, "patch_codes.json")
+}
+
+// savePatchCodes adds the submitted patch code registry to the batch
+func (bc *Blockchain) savePatchCodes(batch fileBatch) error {
+	data, err := json.MarshalIndent(bc.patchCodes, "", "  ")
+	if err != nil {
+		return err
+	}
+	batch[bc.patchCodesPath()] = data
+	return nil
+}
+
+// loadPatchCodes reads the patch code registry, which is absent on older data dirs
+func (bc *Blockchain) loadPatchCodes() error {
+	data, err := os.ReadFile(bc.patchCodesPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	codes := make(map[string]types.Hash)
+	if err := json.Unmarshal(data, &codes); err != nil {
+		return err
+	}
+
+	bc.patchCodes = codes
+	return nil
+}
+
+// copyPendingPatches returns a copy of the pending patch set; the
+// transactions themselves are never modified
+func copyPendingPatches(patches map[types.Hash]*types.Transaction) map[types.Hash]*types.Transaction {
+	copied := make(map[types.Hash]*types.Transaction, len(patches))
+	for hash, tx := range patches {
+		copied[hash] = tx
+	}
+	return copied
+}
+
+// pendingPatchesPath returns the on-disk location of the pending patch set
+func (bc *Blockchain) pendingPatchesPath() string {
+	return filepath.Join(bc.dataDir, "pending_patches.json")
+}
+
+// savePendingPatches adds the patches awaiting evaluation to the batch
+func (bc *Blockchain) savePendingPatches(batch fileBatch) error {
+	patches := make([]*types.Transaction, 0, len(bc.pendingPatches))
+	for _, tx := range bc.pendingPatches {
+		patches = append(patches, tx)
+	}
+	sort.Slice(patches, func(i, j int) bool {
+		return patches[i].Timestamp < patches[j].Timestamp
+	})
+
+	data, err := json.MarshalIndent(patches, "", "  ")
+	if err != nil {
+		return err
+	}
+	batch[bc.pendingPatchesPath()] = data
+	return nil
+}
+
+// loadPendingPatches reads the pending patch set, which is absent on older data dirs
+func (bc *Blockchain) loadPendingPatches() error {
+	data, err := os.ReadFile(bc.pendingPatchesPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var patches []*types.Transaction
+	if err := json.Unmarshal(data, &patches); err != nil {
+		return err
+	}
+
+	bc.pendingPatches = make(map[types.Hash]*types.Transaction, len(patches))
+	for _, tx := range patches {
+		bc.pendingPatches[tx.Hash] = tx
+	}
+	return nil
+}
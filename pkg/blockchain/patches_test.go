@@ -0,0 +1,162 @@
+package blockchain
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"agent-chain/pkg/crypto"
+	"agent-chain/pkg/types"
+)
+
+// patchSubmit returns a signed submission of code for problem
+func patchSubmit(t *testing.T, kp *crypto.KeyPair, problem, code string, nonce int64) *types.Transaction {
+	t.Helper()
+	patch := &types.PatchSet{
+		ID:        problem + "-" + kp.GetAddress().String()[:8],
+		ProblemID: problem,
+		Author:    kp.GetAddress(),
+		Code:      code,
+		Language:  "go",
+	}
+	if err := kp.SignPatchSet(patch); err != nil {
+		t.Fatalf("SignPatchSet: %v", err)
+	}
+	return signTx(t, kp, &types.Transaction{
+		Type:     types.TxTypePatchSubmit,
+		PatchSet: patch,
+		GasLimit: types.DefaultPatchGasLimit,
+		Nonce:    nonce,
+	})
+}
+
+func TestDuplicatePatchRejected(t *testing.T) {
+	author, copier, validator := newKey(t), newKey(t), newKey(t)
+	bc := newTestChain(t, testConfig(1_000_000, author, copier))
+
+	const code = `func Greet() string { return "hello, world" }`
+	addBlock(t, bc, validator, *patchSubmit(t, author, "p1", code, 0))
+
+	tests := []struct {
+		name    string
+		code    string
+		problem string
+		wantErr bool
+	}{
+		{"exact duplicate", code, "p1", true},
+		{"whitespace variant", "func Greet() string {\n\treturn \"hello, world\"\n}\n", "p1", true},
+		{"comment variant", "// Greet greets\n" + code, "p1", true},
+		{"different string", `func Greet() string { return "hello,world" }`, "p1", false},
+		{"other problem", code, "p2", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nonce := bc.PendingNonce(copier.GetAddress())
+			err := bc.AddTransaction(patchSubmit(t, copier, tt.problem, tt.code, nonce))
+			if tt.wantErr && (err == nil || !strings.Contains(err.Error(), "duplicate patch")) {
+				t.Errorf("got %v, want a duplicate patch error", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("got %v, want no error", err)
+			}
+		})
+	}
+}
+
+func TestPatchOutOfGas(t *testing.T) {
+	author, validator := newKey(t), newKey(t)
+	config := testConfig(1_000_000, author)
+	bc := newTestChain(t, config)
+
+	const code = `func Add(a, b int) int { return a + b }`
+	need := types.PatchGasBase + int64(len(code))*types.PatchGasPerByte
+
+	withLimit := func(limit int64) *types.Transaction {
+		tx := patchSubmit(t, author, "add", code, 0)
+		tx.GasLimit = limit
+		if err := author.SignTransaction(tx); err != nil {
+			t.Fatalf("SignTransaction: %v", err)
+		}
+		return tx
+	}
+
+	err := bc.AddTransaction(withLimit(need - 1))
+	if err == nil || !strings.Contains(err.Error(), "out of gas") {
+		t.Fatalf("patch one unit short of gas: got %v, want an out of gas error", err)
+	}
+
+	// Exactly enough gas goes through, and the gas used is charged and
+	// recorded on the transaction
+	tx := withLimit(need)
+	addBlock(t, bc, validator, *tx)
+
+	info, err := bc.GetTransaction(tx.Hash)
+	if err != nil {
+		t.Fatalf("GetTransaction: %v", err)
+	}
+	if info.Transaction.GasUsed != need {
+		t.Errorf("gas used = %d, want %d", info.Transaction.GasUsed, need)
+	}
+	cost := need * config.GasPrice
+	if got := bc.GetAccount(author.GetAddress()).Balance; got != 1_000_000-cost {
+		t.Errorf("author balance = %d, want %d", got, 1_000_000-cost)
+	}
+}
+
+func TestPatchCodeHashVerified(t *testing.T) {
+	author := newKey(t)
+	bc := newTestChain(t, testConfig(1_000_000, author))
+
+	const code = `func Add(a, b int) int { return a + b }`
+	tests := []struct {
+		name     string
+		codeHash func(patch *types.PatchSet) string
+		err      bool
+	}{
+		{"matching hash", func(patch *types.PatchSet) string { return patch.ComputeCodeHash() }, false},
+		{"no hash from an older client", func(*types.PatchSet) string { return "" }, false},
+		{"hash of other code", func(*types.PatchSet) string {
+			return (&types.PatchSet{Code: code + " // changed"}).ComputeCodeHash()
+		}, true},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := patchSubmit(t, author, fmt.Sprintf("p%d", i), code, int64(i))
+			tx.PatchSet.CodeHash = tt.codeHash(tx.PatchSet)
+			if err := author.SignPatchSet(tx.PatchSet); err != nil {
+				t.Fatalf("SignPatchSet: %v", err)
+			}
+			signTx(t, author, tx)
+
+			err := bc.AddTransaction(tx)
+			if tt.err {
+				if err == nil || !strings.Contains(err.Error(), "code hash") {
+					t.Fatalf("AddTransaction error = %v, want a code hash error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AddTransaction: %v", err)
+			}
+		})
+	}
+}
+
+func TestTamperedPatchSignatureRejected(t *testing.T) {
+	author := newKey(t)
+	bc := newTestChain(t, testConfig(1_000_000, author))
+
+	// The transaction is re-signed after the patch changed, so only the
+	// patch's own signature catches the edit
+	tx := patchSubmit(t, author, "p1", `func Add(a, b int) int { return a + b }`, 0)
+	tx.PatchSet.Code = `func Add(a, b int) int { return a - b }`
+	signTx(t, author, tx)
+
+	if err := bc.AddTransaction(tx); err == nil || !strings.Contains(err.Error(), "invalid patch signature") {
+		t.Fatalf("AddTransaction error = %v, want an invalid patch signature", err)
+	}
+	if err := bc.AddTransaction(patchSubmit(t, author, "p1", `func Add(a, b int) int { return a + b }`, 0)); err != nil {
+		t.Errorf("AddTransaction with an intact patch: %v", err)
+	}
+}
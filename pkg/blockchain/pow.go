@@ -0,0 +1,95 @@
+package blockchain
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"agent-chain/pkg/types"
+)
+
+// maxRetargetFactor bounds how far difficulty moves in one retarget
+const maxRetargetFactor = 4
+
+// powEnabled reports whether blocks must carry proof of work
+func (bc *Blockchain) powEnabled() bool {
+	return bc.config.Consensus == types.ConsensusPoW
+}
+
+// NextDifficulty returns the difficulty the next block must be mined at
+func (bc *Blockchain) NextDifficulty() (int64, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.nextDifficulty()
+}
+
+// nextDifficulty derives the difficulty of the block after the tip. It stays
+// constant within a retarget window and is then scaled by how far the
+// window's blocks were from the configured block time; the caller must hold
+// the lock.
+func (bc *Blockchain) nextDifficulty() (int64, error) {
+	parent := bc.lastBlock
+	if parent.Header.Height == 0 {
+		return max(bc.config.PowDifficulty, 1), nil
+	}
+
+	interval := bc.config.PowRetargetInterval
+	if interval <= 0 {
+		interval = types.DefaultPowRetargetInterval
+	}
+	if parent.Header.Height%interval != 0 {
+		return parent.Header.Difficulty, nil
+	}
+
+	first, err := bc.blockAt(parent.Header.Height - interval)
+	if err != nil {
+		return 0, err
+	}
+
+	// Compare durations, as whole seconds would truncate a sub-second block
+	// time to zero and stop retargeting altogether
+	expected := time.Duration(interval) * bc.config.BlockTime
+	actual := time.Duration(parent.Header.Timestamp-first.Header.Timestamp) * time.Second
+	return retarget(parent.Header.Difficulty, int64(expected), int64(actual)), nil
+}
+
+// retarget scales difficulty by expected/actual window duration, moving at
+// most maxRetargetFactor either way
+func retarget(difficulty, expected, actual int64) int64 {
+	if expected <= 0 {
+		return difficulty
+	}
+	if actual < 1 {
+		actual = 1
+	}
+
+	next := new(big.Int).Mul(big.NewInt(difficulty), big.NewInt(expected))
+	next.Div(next, big.NewInt(actual))
+
+	upper := new(big.Int).Mul(big.NewInt(difficulty), big.NewInt(maxRetargetFactor))
+	if next.Cmp(upper) > 0 {
+		next = upper
+	}
+	if !next.IsInt64() {
+		return difficulty
+	}
+
+	lower := difficulty / maxRetargetFactor
+	return max(next.Int64(), lower, 1)
+}
+
+// checkProofOfWork verifies the block's difficulty and that its hash meets
+// it; the caller must hold the lock
+func (bc *Blockchain) checkProofOfWork(block *types.Block) error {
+	difficulty, err := bc.nextDifficulty()
+	if err != nil {
+		return fmt.Errorf("failed to compute difficulty: %v", err)
+	}
+	if block.Header.Difficulty != difficulty {
+		return fmt.Errorf("invalid difficulty: expected %d, got %d", difficulty, block.Header.Difficulty)
+	}
+	if !block.Header.MeetsDifficulty() {
+		return fmt.Errorf("block hash does not meet difficulty %d", difficulty)
+	}
+	return nil
+}
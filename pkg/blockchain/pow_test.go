@@ -0,0 +1,160 @@
+package blockchain
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"agent-chain/pkg/crypto"
+	"agent-chain/pkg/types"
+)
+
+// powConfig returns a proof-of-work chain config that retargets every
+// interval blocks, starting from difficulty
+func powConfig(difficulty, interval int64) *types.ChainConfig {
+	config := testConfig(0)
+	config.Consensus = types.ConsensusPoW
+	config.PowDifficulty = difficulty
+	config.PowRetargetInterval = interval
+	config.GenesisTime = time.Now().Add(-time.Minute).Unix()
+	return config
+}
+
+// minedBlock builds an empty block on the tip at timestamp and searches for
+// a nonce that meets difficulty
+func minedBlock(t *testing.T, bc *Blockchain, validator *crypto.KeyPair, timestamp, difficulty int64) *types.Block {
+	t.Helper()
+	block := nextBlock(t, bc, validator)
+	block.Header.Timestamp = timestamp
+	block.Header.Difficulty = difficulty
+	for nonce := int64(0); ; nonce++ {
+		block.Header.Nonce = nonce
+		if err := validator.SignBlock(block); err != nil {
+			t.Fatalf("SignBlock: %v", err)
+		}
+		if block.Header.MeetsDifficulty() {
+			return block
+		}
+	}
+}
+
+func TestProofOfWorkValidation(t *testing.T) {
+	validator := newKey(t)
+	bc := newTestChain(t, powConfig(16, 100))
+	timestamp := bc.GetLastBlock().Header.Timestamp + 10
+
+	tests := []struct {
+		name  string
+		block func() *types.Block
+		err   string
+	}{
+		{"hash above target", func() *types.Block {
+			block := nextBlock(t, bc, validator)
+			block.Header.Timestamp = timestamp
+			block.Header.Difficulty = 16
+			for nonce := int64(0); ; nonce++ {
+				block.Header.Nonce = nonce
+				if err := validator.SignBlock(block); err != nil {
+					t.Fatalf("SignBlock: %v", err)
+				}
+				if !block.Header.MeetsDifficulty() {
+					return block
+				}
+			}
+		}, "does not meet difficulty"},
+		{"easier difficulty than required", func() *types.Block {
+			return minedBlock(t, bc, validator, timestamp, 1)
+		}, "invalid difficulty"},
+		{"mined at the required difficulty", func() *types.Block {
+			return minedBlock(t, bc, validator, timestamp, 16)
+		}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := bc.ValidateBlock(tt.block())
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("ValidateBlock: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("ValidateBlock error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRetarget(t *testing.T) {
+	tests := []struct {
+		name             string
+		difficulty       int64
+		expected, actual int64
+		want             int64
+	}{
+		{"on schedule", 100, 100, 100, 100},
+		{"twice as fast", 100, 100, 50, 200},
+		{"twice as slow", 100, 100, 200, 50},
+		{"increase capped", 100, 100, 1, 400},
+		{"decrease capped", 100, 100, 10_000, 25},
+		{"never below 1", 2, 100, 10_000, 1},
+		{"no expected duration", 100, 0, 50, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retarget(tt.difficulty, tt.expected, tt.actual); got != tt.want {
+				t.Errorf("retarget(%d, %d, %d) = %d, want %d", tt.difficulty, tt.expected, tt.actual, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDifficultyRetargetsOnChain(t *testing.T) {
+	blockTime := int64(types.DefaultBlockTime.Seconds())
+
+	tests := []struct {
+		name      string
+		blockTime time.Duration
+		offsets   []int64 // block timestamps after genesis
+		want      int64
+	}{
+		// The first window runs on schedule and the second ten times too
+		// fast; raising the difficulty tenfold is capped at four times
+		{"fast window capped", types.DefaultBlockTime, []int64{blockTime, 2 * blockTime, 2*blockTime + 1, 2*blockTime + 2}, 64},
+		// Two seconds for a window of two half-second blocks
+		{"sub-second block time", 500 * time.Millisecond, []int64{1, 2}, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := newKey(t)
+			config := powConfig(16, 2)
+			config.BlockTime = tt.blockTime
+			bc := newTestChain(t, config)
+			genesis := bc.GetLastBlock().Header.Timestamp
+
+			for i, offset := range tt.offsets {
+				difficulty, err := bc.NextDifficulty()
+				if err != nil {
+					t.Fatalf("NextDifficulty: %v", err)
+				}
+				if difficulty != 16 {
+					t.Fatalf("difficulty of block #%d = %d, want 16", i+1, difficulty)
+				}
+				if err := bc.AddBlock(context.Background(), minedBlock(t, bc, validator, genesis+offset, difficulty)); err != nil {
+					t.Fatalf("AddBlock #%d: %v", i+1, err)
+				}
+			}
+
+			difficulty, err := bc.NextDifficulty()
+			if err != nil {
+				t.Fatalf("NextDifficulty: %v", err)
+			}
+			if difficulty != tt.want {
+				t.Errorf("difficulty after the window = %d, want %d", difficulty, tt.want)
+			}
+		})
+	}
+}
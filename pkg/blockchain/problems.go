@@ -0,0 +1,154 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"agent-chain/pkg/types"
+)
+
+// GetProblem returns a copy of the on-chain problem with the given ID
+func (bc *Blockchain) GetProblem(id string) (*types.Problem, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	problem, exists := bc.problems[id]
+	if !exists {
+		return nil, fmt.Errorf("problem not found: %s", id)
+	}
+
+	problemCopy := *problem
+	return &problemCopy, nil
+}
+
+// checkProblemTransaction validates problem create, update and close transactions
+func (bc *Blockchain) checkProblemTransaction(tx *types.Transaction) error {
+	account := bc.GetAccount(tx.From)
+
+	if tx.Type == types.TxTypeProblemCreate {
+		if tx.Problem == nil {
+			return fmt.Errorf("missing problem spec")
+		}
+		if err := tx.Problem.Validate(); err != nil {
+			return err
+		}
+		if _, exists := bc.problems[tx.Problem.ID]; exists {
+			return fmt.Errorf("problem %s already exists", tx.Problem.ID)
+		}
+		if account.Balance < tx.Problem.Reward+tx.Fee {
+			return fmt.Errorf("insufficient balance")
+		}
+		return nil
+	}
+
+	problem, exists := bc.problems[tx.ProblemID]
+	if !exists {
+		return fmt.Errorf("problem not found: %s", tx.ProblemID)
+	}
+	if problem.Creator != tx.From {
+		return fmt.Errorf("only the creator can modify problem %s", tx.ProblemID)
+	}
+	if problem.Status != types.ProblemStatusOpen {
+		return fmt.Errorf("problem %s is %s", tx.ProblemID, problem.Status)
+	}
+
+	switch tx.Type {
+	case types.TxTypeProblemUpdate:
+		if tx.Amount <= 0 {
+			return fmt.Errorf("reward increase must be positive")
+		}
+		if account.Balance < tx.Amount+tx.Fee {
+			return fmt.Errorf("insufficient balance")
+		}
+	case types.TxTypeProblemClose:
+		if account.Balance+problem.Escrow < tx.Fee {
+			return fmt.Errorf("insufficient balance")
+		}
+	}
+
+	return nil
+}
+
+// applyProblemTransaction moves funds into or out of a problem's escrow
+func (bc *Blockchain) applyProblemTransaction(tx *types.Transaction, header *types.BlockHeader) error {
+	if err := bc.checkProblemTransaction(tx); err != nil {
+		return err
+	}
+
+	account := bc.GetAccount(tx.From)
+
+	switch tx.Type {
+	case types.TxTypeProblemCreate:
+		account.Balance -= tx.Problem.Reward
+		bc.problems[tx.Problem.ID] = &types.Problem{
+			Spec:    *tx.Problem,
+			Creator: tx.From,
+			Escrow:  tx.Problem.Reward,
+			Status:  types.ProblemStatusOpen,
+		}
+	case types.TxTypeProblemUpdate:
+		problem := bc.problems[tx.ProblemID]
+		account.Balance -= tx.Amount
+		problem.Escrow += tx.Amount
+		problem.Spec.Reward = problem.Escrow
+	case types.TxTypeProblemClose:
+		// Refund the remaining escrow to the creator
+		problem := bc.problems[tx.ProblemID]
+		account.Balance += problem.Escrow
+		problem.Escrow = 0
+		problem.Status = types.ProblemStatusClosed
+	}
+
+	account.Balance -= tx.Fee
+	bc.accounts[tx.From] = account
+
+	bc.creditValidator(header, tx.Fee)
+
+	return nil
+}
+
+// copyProblems returns a deep copy of the problem registry
+func copyProblems(problems map[string]*types.Problem) map[string]*types.Problem {
+	copied := make(map[string]*types.Problem, len(problems))
+	for id, problem := range problems {
+		problemCopy := *problem
+		copied[id] = &problemCopy
+	}
+	return copied
+}
+
+// problemsPath returns the on-disk location of the problem registry
+func (bc *Blockchain) problemsPath() string {
+	return filepath.Join(bc.dataDir, "problems.json")
+}
+
+// saveProblems adds the problem registry to the batch
+func (bc *Blockchain) saveProblems(batch fileBatch) error {
+	data, err := json.MarshalIndent(bc.problems, "", "  ")
+	if err != nil {
+		return err
+	}
+	batch[bc.problemsPath()] = data
+	return nil
+}
+
+// loadProblems reads the problem registry, which is absent on older data dirs
+func (bc *Blockchain) loadProblems() error {
+	data, err := os.ReadFile(bc.problemsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	problems := make(map[string]*types.Problem)
+	if err := json.Unmarshal(data, &problems); err != nil {
+		return err
+	}
+
+	bc.problems = problems
+	return nil
+}
@@ -0,0 +1,71 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+
+	"agent-chain/pkg/types"
+)
+
+func TestProblemCreateValidatesSpec(t *testing.T) {
+	creator := newKey(t)
+	bc := newTestChain(t, testConfig(1_000_000, creator))
+
+	validSpec := func() *types.ProblemSpec {
+		return &types.ProblemSpec{
+			ID:            "sum",
+			Title:         "Sum two numbers",
+			TimeLimitMs:   1000,
+			MemoryLimitMb: 64,
+			Reward:        100,
+			TestSuite:     []types.TestCase{{Input: "1 2", Expected: "3", Weight: 1}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*types.ProblemSpec)
+		field  string
+	}{
+		{"valid", func(*types.ProblemSpec) {}, ""},
+		{"empty id", func(ps *types.ProblemSpec) { ps.ID = " " }, "id"},
+		{"empty title", func(ps *types.ProblemSpec) { ps.Title = "" }, "title"},
+		{"zero reward", func(ps *types.ProblemSpec) { ps.Reward = 0 }, "reward"},
+		{"negative reward", func(ps *types.ProblemSpec) { ps.Reward = -5 }, "reward"},
+		{"no time limit", func(ps *types.ProblemSpec) { ps.TimeLimitMs = 0 }, "time_limit_ms"},
+		{"time limit too long", func(ps *types.ProblemSpec) { ps.TimeLimitMs = types.MaxProblemTimeLimitMs + 1 }, "time_limit_ms"},
+		{"memory limit too large", func(ps *types.ProblemSpec) { ps.MemoryLimitMb = types.MaxProblemMemoryLimitMb + 1 }, "memory_limit_mb"},
+		{"no test cases", func(ps *types.ProblemSpec) { ps.TestSuite = nil }, "test_suite"},
+		{"negative weight", func(ps *types.ProblemSpec) {
+			ps.TestSuite = append(ps.TestSuite, types.TestCase{Input: "2 2", Expected: "4", Weight: -1})
+		}, "test_suite[1].weight"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := validSpec()
+			tt.mutate(spec)
+			tx := signTx(t, creator, &types.Transaction{
+				Type:    types.TxTypeProblemCreate,
+				Problem: spec,
+				Fee:     1,
+			})
+
+			err := bc.AddTransaction(tx)
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("AddTransaction: %v", err)
+				}
+				return
+			}
+
+			var specErr *types.ProblemSpecError
+			if !errors.As(err, &specErr) {
+				t.Fatalf("AddTransaction error = %v, want a ProblemSpecError", err)
+			}
+			if specErr.Field != tt.field {
+				t.Errorf("rejected field = %q, want %q", specErr.Field, tt.field)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"agent-chain/internal/fsutil"
+	"agent-chain/pkg/types"
+)
+
+// Snapshot captures the full account state as of a given block. Exported
+// snapshots also carry the rest of the chain state, so that a node can be
+// started from one without replaying history.
+type Snapshot struct {
+	Header   types.BlockHeader `json:"header"`
+	Accounts []*types.Account  `json:"accounts"`
+
+	Problems       map[string]*types.Problem `json:"problems,omitempty"`
+	PendingPatches []*types.Transaction      `json:"pending_patches,omitempty"`
+	Stakes         []*types.Stake            `json:"stakes,omitempty"`
+	PatchCodes     map[string]types.Hash     `json:"patch_codes,omitempty"`
+}
+
+// snapshotsDir returns the directory holding automatic snapshots
+func (bc *Blockchain) snapshotsDir() string {
+	return filepath.Join(bc.dataDir, "snapshots")
+}
+
+// CurrentSnapshot returns a snapshot of the current account state and tip
+func (bc *Blockchain) CurrentSnapshot() *Snapshot {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.newSnapshot()
+}
+
+// newSnapshot builds a snapshot of the current state; the caller must hold the lock
+func (bc *Blockchain) newSnapshot() *Snapshot {
+	accounts := make([]*types.Account, 0, len(bc.accounts))
+	for _, account := range bc.accounts {
+		accountCopy := *account
+		accounts = append(accounts, &accountCopy)
+	}
+
+	// Sort by address so identical states produce identical snapshots
+	sort.Slice(accounts, func(i, j int) bool {
+		return bytes.Compare(accounts[i].Address[:], accounts[j].Address[:]) < 0
+	})
+
+	return &Snapshot{
+		Header:   bc.lastBlock.Header,
+		Accounts: accounts,
+	}
+}
+
+// ExportSnapshot writes the full chain state as of the current tip to w
+func (bc *Blockchain) ExportSnapshot(w io.Writer) error {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	snapshot := bc.newSnapshot()
+	snapshot.Problems = copyProblems(bc.problems)
+	snapshot.PatchCodes = copyPatchCodes(bc.patchCodes)
+
+	for _, tx := range copyPendingPatches(bc.pendingPatches) {
+		snapshot.PendingPatches = append(snapshot.PendingPatches, tx)
+	}
+	sort.Slice(snapshot.PendingPatches, func(i, j int) bool {
+		return snapshot.PendingPatches[i].Timestamp < snapshot.PendingPatches[j].Timestamp
+	})
+
+	for _, stake := range copyStakes(bc.stakes) {
+		snapshot.Stakes = append(snapshot.Stakes, stake)
+	}
+	sort.Slice(snapshot.Stakes, func(i, j int) bool {
+		return bytes.Compare(snapshot.Stakes[i].Address[:], snapshot.Stakes[j].Address[:]) < 0
+	})
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(snapshot)
+}
+
+// ImportSnapshot initializes a fresh chain from a snapshot written by
+// ExportSnapshot. The snapshot's header becomes the tip, and blocks below it
+// are not available locally. The state is rejected unless its root matches
+// the one committed to by the header.
+func (bc *Blockchain) ImportSnapshot(r io.Reader) error {
+	var snapshot Snapshot
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return fmt.Errorf("failed to decode snapshot: %v", err)
+	}
+
+	header := snapshot.Header
+	if header.Height <= 0 {
+		return fmt.Errorf("snapshot must be taken above genesis")
+	}
+	if header.CalculateHash() != header.Hash {
+		return fmt.Errorf("snapshot header hash mismatch")
+	}
+	if root := types.StateRoot(snapshot.Accounts); root != header.StateRoot {
+		return fmt.Errorf("snapshot state root mismatch: header has %s, accounts hash to %s", header.StateRoot, root)
+	}
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if bc.closed {
+		return ErrClosed
+	}
+	if bc.height != 0 {
+		return fmt.Errorf("cannot import a snapshot into a chain at height %d", bc.height)
+	}
+
+	state := stateMaps{
+		accounts: make(map[types.Address]*types.Account, len(snapshot.Accounts)),
+		problems: snapshot.Problems,
+		patches:  make(map[types.Hash]*types.Transaction, len(snapshot.PendingPatches)),
+		stakes:   make(map[types.Address]*types.Stake, len(snapshot.Stakes)),
+		codes:    snapshot.PatchCodes,
+	}
+	for _, account := range snapshot.Accounts {
+		state.accounts[account.Address] = account
+	}
+	for _, tx := range snapshot.PendingPatches {
+		state.patches[tx.Hash] = tx
+	}
+	for _, stake := range snapshot.Stakes {
+		state.stakes[stake.Address] = stake
+	}
+	if state.problems == nil {
+		state.problems = make(map[string]*types.Problem)
+	}
+	if state.codes == nil {
+		state.codes = make(map[string]types.Hash)
+	}
+	bc.setState(state)
+
+	// The tip is kept header-only; its transactions were never downloaded
+	tip := &types.Block{Header: header, Txs: []types.Transaction{}}
+	bc.blocks = []*types.Block{tip}
+	bc.indexBlock(tip)
+	bc.lastBlock = tip
+	bc.height = header.Height
+	bc.finalized = header.Height
+
+	if err := bc.saveToDisk(tip); err != nil {
+		return err
+	}
+
+	// Written last, so an interrupted import leaves the chain at genesis
+	return bc.saveSnapshotBase(header.Height)
+}
+
+// snapshotBasePath records the height a chain was imported at
+func (bc *Blockchain) snapshotBasePath() string {
+	return filepath.Join(bc.dataDir, "snapshot_base.json")
+}
+
+// saveSnapshotBase records the height below which blocks are not stored
+func (bc *Blockchain) saveSnapshotBase(height int64) error {
+	data, err := json.Marshal(height)
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(bc.snapshotBasePath(), data, 0644)
+}
+
+// loadSnapshotBase returns the height the chain was imported at, or 0 for a
+// chain built from genesis
+func (bc *Blockchain) loadSnapshotBase() (int64, error) {
+	data, err := os.ReadFile(bc.snapshotBasePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	var height int64
+	if err := json.Unmarshal(data, &height); err != nil {
+		return 0, err
+	}
+	return height, nil
+}
+
+// maybeSnapshot writes a snapshot when the current height hits the configured
+// interval and prunes snapshots beyond the retention count
+func (bc *Blockchain) maybeSnapshot() error {
+	interval := bc.config.SnapshotInterval
+	if interval <= 0 || bc.height == 0 || bc.height%interval != 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(bc.snapshotsDir(), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(bc.newSnapshot(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(bc.snapshotsDir(), fmt.Sprintf("snapshot-%d.json", bc.height))
+	if err := fsutil.WriteFileAtomic(path, data, 0644); err != nil {
+		return err
+	}
+
+	return bc.pruneSnapshots()
+}
+
+// pruneSnapshots removes the oldest snapshots beyond the retention count
+func (bc *Blockchain) pruneSnapshots() error {
+	retention := bc.config.SnapshotRetention
+	if retention <= 0 {
+		return nil
+	}
+
+	heights, err := bc.snapshotHeights()
+	if err != nil {
+		return err
+	}
+
+	for len(heights) > retention {
+		path := filepath.Join(bc.snapshotsDir(), fmt.Sprintf("snapshot-%d.json", heights[0]))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		heights = heights[1:]
+	}
+
+	return nil
+}
+
+// snapshotHeights lists the heights of stored snapshots in ascending order
+func (bc *Blockchain) snapshotHeights() ([]int64, error) {
+	entries, err := os.ReadDir(bc.snapshotsDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var heights []int64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, "snapshot-") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		h, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, "snapshot-"), ".json"), 10, 64)
+		if err != nil {
+			continue
+		}
+		heights = append(heights, h)
+	}
+
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	return heights, nil
+}
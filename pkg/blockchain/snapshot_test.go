@@ -0,0 +1,99 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"agent-chain/pkg/crypto"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	alice, bob, validator := newKey(t), newKey(t), newKey(t)
+	config := testConfig(1_000_000, alice, bob)
+	source := newTestChain(t, config)
+
+	addBlock(t, source, validator, *transfer(t, alice, bob.GetAddress(), 100, 1, 0))
+	addBlock(t, source, validator, *patchSubmit(t, bob, "p1", `func Add(a, b int) int { return a + b }`, 0))
+	addBlock(t, source, validator, *transfer(t, bob, alice.GetAddress(), 50, 1, 1))
+
+	var exported bytes.Buffer
+	if err := source.ExportSnapshot(&exported); err != nil {
+		t.Fatalf("ExportSnapshot: %v", err)
+	}
+
+	dataDir := t.TempDir()
+	imported := openTestChain(t, config, dataDir)
+	if err := imported.ImportSnapshot(bytes.NewReader(exported.Bytes())); err != nil {
+		t.Fatalf("ImportSnapshot: %v", err)
+	}
+
+	// Exporting again yields the same snapshot, so no state was lost
+	var reexported bytes.Buffer
+	if err := imported.ExportSnapshot(&reexported); err != nil {
+		t.Fatalf("ExportSnapshot after import: %v", err)
+	}
+	if !bytes.Equal(exported.Bytes(), reexported.Bytes()) {
+		t.Errorf("re-exported snapshot differs:\n%s\nwant:\n%s", reexported.Bytes(), exported.Bytes())
+	}
+	for _, kp := range []*crypto.KeyPair{alice, bob, validator} {
+		if got, want := imported.GetAccount(kp.GetAddress()), source.GetAccount(kp.GetAddress()); *got != *want {
+			t.Errorf("account %s = %+v, want %+v", kp.GetAddress(), got, want)
+		}
+	}
+
+	// The imported chain extends like the source
+	next := nextBlock(t, source, validator, *transfer(t, alice, bob.GetAddress(), 10, 1, 1))
+	for name, bc := range map[string]*Blockchain{"source": source, "imported": imported} {
+		if err := bc.AddBlock(context.Background(), next); err != nil {
+			t.Fatalf("%s: AddBlock: %v", name, err)
+		}
+	}
+	if imported.stateRoot() != source.stateRoot() {
+		t.Error("state diverged after a block on the imported chain")
+	}
+
+	// And it reopens at the imported height
+	if err := imported.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	reopened := openTestChain(t, config, dataDir)
+	if got := reopened.GetLastBlock().Header.Hash; got != next.Header.Hash {
+		t.Errorf("reopened at %s, want %s", got, next.Header.Hash)
+	}
+}
+
+func TestImportSnapshotRejectsTamperedState(t *testing.T) {
+	alice, validator := newKey(t), newKey(t)
+	config := testConfig(1000, alice)
+	source := newTestChain(t, config)
+	addBlock(t, source, validator)
+
+	var exported bytes.Buffer
+	if err := source.ExportSnapshot(&exported); err != nil {
+		t.Fatalf("ExportSnapshot: %v", err)
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(exported.Bytes(), &snapshot); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	for _, account := range snapshot.Accounts {
+		if account.Address == alice.GetAddress() {
+			account.Balance *= 1000
+		}
+	}
+	tampered, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	imported := newTestChain(t, config)
+	if err := imported.ImportSnapshot(bytes.NewReader(tampered)); err == nil || !strings.Contains(err.Error(), "state root mismatch") {
+		t.Fatalf("ImportSnapshot error = %v, want a state root mismatch", err)
+	}
+	if height := imported.GetHeight(); height != 0 {
+		t.Errorf("height after a rejected import = %d, want 0", height)
+	}
+}
@@ -0,0 +1,371 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"agent-chain/pkg/types"
+)
+
+// ValidatorInfo describes a staked validator and the stake backing it
+type ValidatorInfo struct {
+	Address   types.Address `json:"address"`
+	SelfStake int64         `json:"self_stake"`
+	Delegated int64         `json:"delegated"`
+}
+
+// TotalStake returns the validator's own and delegated stake combined
+func (v *ValidatorInfo) TotalStake() int64 {
+	return v.SelfStake + v.Delegated
+}
+
+// GetStake returns a copy of the stake held by an address
+func (bc *Blockchain) GetStake(addr types.Address) (*types.Stake, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	stake, exists := bc.stakes[addr]
+	if !exists {
+		return nil, fmt.Errorf("no stake for %s", addr)
+	}
+
+	stakeCopy := *stake
+	return &stakeCopy, nil
+}
+
+// Validators returns the staked validator set ordered by address
+func (bc *Blockchain) Validators() []ValidatorInfo {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.validators()
+}
+
+// validators builds the validator set from the stakes; the caller must hold the lock
+func (bc *Blockchain) validators() []ValidatorInfo {
+	byAddr := make(map[types.Address]*ValidatorInfo)
+	for _, stake := range bc.stakes {
+		// A validator that is only unbonding no longer validates
+		if stake.Validator == stake.Address && stake.Amount > 0 {
+			byAddr[stake.Address] = &ValidatorInfo{Address: stake.Address, SelfStake: stake.Amount}
+		}
+	}
+	for _, stake := range bc.stakes {
+		if validator, exists := byAddr[stake.Validator]; exists && stake.Validator != stake.Address {
+			validator.Delegated += stake.Amount
+		}
+	}
+
+	validators := make([]ValidatorInfo, 0, len(byAddr))
+	for _, validator := range byAddr {
+		validators = append(validators, *validator)
+	}
+	sort.Slice(validators, func(i, j int) bool {
+		return bytes.Compare(validators[i].Address[:], validators[j].Address[:]) < 0
+	})
+	return validators
+}
+
+// StakingStats summarizes participation in staking
+type StakingStats struct {
+	TotalStaked       int64 `json:"total_staked"`
+	Validators        int   `json:"validators"`
+	Delegators        int   `json:"delegators"`
+	AverageStake      int64 `json:"average_stake"`
+	MinValidatorStake int64 `json:"min_validator_stake"`
+	MaxValidatorStake int64 `json:"max_validator_stake"`
+}
+
+// StakingStats aggregates the current stakes. Validator figures use each
+// validator's total stake, its own plus delegations.
+func (bc *Blockchain) StakingStats() *StakingStats {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	stats := &StakingStats{}
+	for _, stake := range bc.stakes {
+		stats.TotalStaked += stake.Amount
+		if stake.Validator != stake.Address && stake.Amount > 0 {
+			stats.Delegators++
+		}
+	}
+
+	validators := bc.validators()
+	stats.Validators = len(validators)
+
+	var validatorStake int64
+	for i, validator := range validators {
+		total := validator.TotalStake()
+		validatorStake += total
+		if i == 0 || total < stats.MinValidatorStake {
+			stats.MinValidatorStake = total
+		}
+		if total > stats.MaxValidatorStake {
+			stats.MaxValidatorStake = total
+		}
+	}
+	if len(validators) > 0 {
+		stats.AverageStake = validatorStake / int64(len(validators))
+	}
+
+	return stats
+}
+
+// NextProposer returns the validator scheduled to propose the next block. It
+// reports false while no validator has staked, in which case any node may
+// produce blocks.
+func (bc *Blockchain) NextProposer() (types.Address, bool) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.proposerAfter(bc.lastBlock)
+}
+
+// proposerAfter selects the proposer of the block following parent from the
+// current validator set. The choice is weighted by stake and seeded by
+// proposerSeed, so every node computes the same proposer without
+// coordination. The caller must hold the lock.
+func (bc *Blockchain) proposerAfter(parent *types.Block) (types.Address, bool) {
+	validators := bc.validators()
+
+	var total int64
+	for _, validator := range validators {
+		total += validator.TotalStake()
+	}
+	if total <= 0 {
+		return types.Address{}, false
+	}
+
+	seed := proposerSeed(parent, validators)
+	slot := int64(binary.BigEndian.Uint64(seed[:8]) % uint64(total))
+	for _, validator := range validators {
+		if slot < validator.TotalStake() {
+			return validator.Address, true
+		}
+		slot -= validator.TotalStake()
+	}
+	return validators[len(validators)-1].Address, true
+}
+
+// proposerSeed derives the selection seed from the parent block hash, the
+// next height and the validator set with its stakes. The parent hash is fixed
+// before the next proposer is known, and binding the validator set means
+// changing stakes cannot steer an already known seed.
+func proposerSeed(parent *types.Block, validators []ValidatorInfo) types.Hash {
+	h := sha256.New()
+	h.Write(parent.Header.Hash[:])
+
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(parent.Header.Height+1))
+	h.Write(buf[:])
+
+	for _, validator := range validators {
+		h.Write(validator.Address[:])
+		binary.BigEndian.PutUint64(buf[:], uint64(validator.TotalStake()))
+		h.Write(buf[:])
+	}
+
+	var seed types.Hash
+	copy(seed[:], h.Sum(nil))
+	return seed
+}
+
+// stakeTarget returns the validator a stake transaction bonds to: the sender
+// itself when To is empty or the sender, otherwise the validator in To
+func stakeTarget(tx *types.Transaction) types.Address {
+	if tx.To == (types.Address{}) {
+		return tx.From
+	}
+	return tx.To
+}
+
+// checkStakeTransaction validates stake and unstake transactions
+func (bc *Blockchain) checkStakeTransaction(tx *types.Transaction) error {
+	if tx.Amount <= 0 {
+		return fmt.Errorf("stake amount must be positive")
+	}
+
+	account := bc.GetAccount(tx.From)
+	existing, staked := bc.stakes[tx.From]
+
+	if tx.Type == types.TxTypeUnstake {
+		if !staked || existing.Amount == 0 {
+			return fmt.Errorf("no stake for %s", tx.From)
+		}
+		if tx.Amount > existing.Amount {
+			return fmt.Errorf("unstake amount %d exceeds stake of %d", tx.Amount, existing.Amount)
+		}
+		if remaining := existing.Amount - tx.Amount; remaining > 0 {
+			if err := bc.checkMinStake(tx.From, existing.Validator, remaining); err != nil {
+				return fmt.Errorf("%v; unstake everything instead", err)
+			}
+		}
+		// Unbonding tokens cannot pay the fee
+		available := account.Balance
+		if bc.config.UnbondingPeriod <= 0 {
+			available += tx.Amount
+		}
+		if available < tx.Fee {
+			return fmt.Errorf("insufficient balance")
+		}
+		return nil
+	}
+
+	target := stakeTarget(tx)
+	if staked && existing.Validator != target {
+		return fmt.Errorf("already staked with %s; unstake first", existing.Validator)
+	}
+	if target != tx.From {
+		validator, exists := bc.stakes[target]
+		if !exists || validator.Validator != target {
+			return fmt.Errorf("%s is not a validator", target)
+		}
+	}
+	total := tx.Amount
+	if staked {
+		total += existing.Amount
+	}
+	if err := bc.checkMinStake(tx.From, target, total); err != nil {
+		return err
+	}
+	if account.Balance < tx.Amount+tx.Fee {
+		return fmt.Errorf("insufficient balance")
+	}
+
+	return nil
+}
+
+// checkMinStake rejects a stake below the configured minimum for its role;
+// addr is a validator when it bonds to itself
+func (bc *Blockchain) checkMinStake(addr, validator types.Address, amount int64) error {
+	if addr == validator {
+		if amount < bc.config.MinValidatorStake {
+			return fmt.Errorf("stake of %d is below the minimum validator stake of %d", amount, bc.config.MinValidatorStake)
+		}
+		return nil
+	}
+	if amount < bc.config.MinDelegatorStake {
+		return fmt.Errorf("stake of %d is below the minimum delegator stake of %d", amount, bc.config.MinDelegatorStake)
+	}
+	return nil
+}
+
+// applyStakeTransaction moves funds between an account's balance and its stake
+func (bc *Blockchain) applyStakeTransaction(tx *types.Transaction, header *types.BlockHeader) error {
+	if err := bc.checkStakeTransaction(tx); err != nil {
+		return err
+	}
+
+	account := bc.GetAccount(tx.From)
+
+	switch tx.Type {
+	case types.TxTypeStake:
+		stake, exists := bc.stakes[tx.From]
+		if !exists {
+			stake = &types.Stake{Address: tx.From, Validator: stakeTarget(tx)}
+			bc.stakes[tx.From] = stake
+		}
+		stake.Amount += tx.Amount
+		account.Balance -= tx.Amount
+	case types.TxTypeUnstake:
+		// Another unstake restarts the unbonding period of everything
+		// still unbonding
+		stake := bc.stakes[tx.From]
+		stake.Amount -= tx.Amount
+		if bc.config.UnbondingPeriod > 0 {
+			stake.Unbonding += tx.Amount
+			stake.UnbondingUntil = header.Height + bc.config.UnbondingPeriod
+		} else {
+			account.Balance += tx.Amount
+		}
+		if stake.Amount == 0 && stake.Unbonding == 0 {
+			delete(bc.stakes, tx.From)
+		}
+	}
+
+	account.Balance -= tx.Fee
+	bc.accounts[tx.From] = account
+
+	bc.creditValidator(header, tx.Fee)
+
+	return nil
+}
+
+// releaseUnbonded returns unstaked tokens whose unbonding period ends at or
+// before height to their owners; the caller must hold the lock
+func (bc *Blockchain) releaseUnbonded(height int64) {
+	for addr, stake := range bc.stakes {
+		if stake.Unbonding == 0 || stake.UnbondingUntil > height {
+			continue
+		}
+
+		account := bc.GetAccount(addr)
+		account.Balance += stake.Unbonding
+		bc.accounts[addr] = account
+
+		stake.Unbonding = 0
+		stake.UnbondingUntil = 0
+		if stake.Amount == 0 {
+			delete(bc.stakes, addr)
+		}
+	}
+}
+
+// copyStakes returns a deep copy of the staking state
+func copyStakes(stakes map[types.Address]*types.Stake) map[types.Address]*types.Stake {
+	copied := make(map[types.Address]*types.Stake, len(stakes))
+	for addr, stake := range stakes {
+		stakeCopy := *stake
+		copied[addr] = &stakeCopy
+	}
+	return copied
+}
+
+// stakesPath returns the on-disk location of the staking state
+func (bc *Blockchain) stakesPath() string {
+	return filepath.Join(bc.dataDir, "stakes.json")
+}
+
+// saveStakes adds the staking state to the batch
+func (bc *Blockchain) saveStakes(batch fileBatch) error {
+	stakes := make([]*types.Stake, 0, len(bc.stakes))
+	for _, stake := range bc.stakes {
+		stakes = append(stakes, stake)
+	}
+	sort.Slice(stakes, func(i, j int) bool {
+		return bytes.Compare(stakes[i].Address[:], stakes[j].Address[:]) < 0
+	})
+
+	data, err := json.MarshalIndent(stakes, "", "  ")
+	if err != nil {
+		return err
+	}
+	batch[bc.stakesPath()] = data
+	return nil
+}
+
+// loadStakes reads the staking state, which is absent on older data dirs
+func (bc *Blockchain) loadStakes() error {
+	data, err := os.ReadFile(bc.stakesPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var stakes []*types.Stake
+	if err := json.Unmarshal(data, &stakes); err != nil {
+		return err
+	}
+
+	bc.stakes = make(map[types.Address]*types.Stake, len(stakes))
+	for _, stake := range stakes {
+		bc.stakes[stake.Address] = stake
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package blockchain
+
+import (
+	"strings"
+	"testing"
+
+	"agent-chain/pkg/crypto"
+	"agent-chain/pkg/types"
+)
+
+// stakeTx returns a signed stake or unstake; a zero to stakes with yourself
+func stakeTx(t *testing.T, kp *crypto.KeyPair, txType string, to types.Address, amount, nonce int64) *types.Transaction {
+	t.Helper()
+	return signTx(t, kp, &types.Transaction{
+		Type:   txType,
+		To:     to,
+		Amount: amount,
+		Fee:    1,
+		Nonce:  nonce,
+	})
+}
+
+func TestStakeBelowMinimumRejected(t *testing.T) {
+	validator, delegator, newcomer := newKey(t), newKey(t), newKey(t)
+	config := testConfig(1000, validator, delegator, newcomer)
+	config.MinValidatorStake = 500
+	config.MinDelegatorStake = 50
+	bc := newTestChain(t, config)
+
+	// Exactly the minimums are enough; once staked, the validator proposes
+	// every block
+	addBlock(t, bc, validator, *stakeTx(t, validator, types.TxTypeStake, types.Address{}, 500, 0))
+	addBlock(t, bc, validator, *stakeTx(t, delegator, types.TxTypeStake, validator.GetAddress(), 50, 0))
+	if got := len(bc.Validators()); got != 1 {
+		t.Fatalf("validators = %d, want 1", got)
+	}
+
+	tests := []struct {
+		name string
+		tx   *types.Transaction
+		want string
+	}{
+		{"validator below minimum", stakeTx(t, newcomer, types.TxTypeStake, types.Address{}, 499, 0),
+			"below the minimum validator stake of 500"},
+		{"delegator below minimum", stakeTx(t, newcomer, types.TxTypeStake, validator.GetAddress(), 49, 0),
+			"below the minimum delegator stake of 50"},
+		{"validator unstakes below minimum", stakeTx(t, validator, types.TxTypeUnstake, types.Address{}, 1, 1),
+			"unstake everything instead"},
+		{"delegator unstakes below minimum", stakeTx(t, delegator, types.TxTypeUnstake, types.Address{}, 10, 1),
+			"unstake everything instead"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := bc.AddTransaction(tt.tx)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %v, want an error mentioning %q", err, tt.want)
+			}
+		})
+	}
+
+	// Topping up counts the existing stake, and a full unstake is always allowed
+	addBlock(t, bc, validator, *stakeTx(t, delegator, types.TxTypeStake, validator.GetAddress(), 1, 1))
+	addBlock(t, bc, validator, *stakeTx(t, delegator, types.TxTypeUnstake, types.Address{}, 51, 2))
+	if _, err := bc.GetStake(delegator.GetAddress()); err == nil {
+		t.Error("delegator still has a stake after unstaking everything")
+	}
+	if got := bc.GetAccount(delegator.GetAddress()).Balance; got != 997 {
+		t.Errorf("delegator balance = %d, want 997 after three fees", got)
+	}
+}
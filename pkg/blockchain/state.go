@@ -0,0 +1,101 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"agent-chain/pkg/types"
+)
+
+// StateProof proves an account's state against the state root of a block
+type StateProof struct {
+	Height    int64               `json:"height"`
+	BlockHash types.Hash          `json:"block_hash"`
+	StateRoot types.Hash          `json:"state_root"`
+	Account   types.Account       `json:"account"`
+	Proof     *types.AccountProof `json:"proof"`
+}
+
+// GetAccountProof returns an account together with the Merkle path linking it
+// to the state root in the tip's header
+func (bc *Blockchain) GetAccountProof(addr types.Address) (*StateProof, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	account, exists := bc.accounts[addr]
+	if !exists {
+		return nil, fmt.Errorf("account not found: %s", addr)
+	}
+
+	root, proof, err := types.BuildAccountProof(bc.stateAccounts(), addr)
+	if err != nil {
+		return nil, err
+	}
+	if root != bc.lastBlock.Header.StateRoot {
+		return nil, fmt.Errorf("tip block #%d does not commit to the current state", bc.height)
+	}
+
+	return &StateProof{
+		Height:    bc.height,
+		BlockHash: bc.lastBlock.Header.Hash,
+		StateRoot: root,
+		Account:   *account,
+		Proof:     proof,
+	}, nil
+}
+
+// StateRootAfter returns the state root that results from applying a block's
+// transactions on top of the tip, for the proposer to put in its header
+func (bc *Blockchain) StateRootAfter(block *types.Block) (types.Hash, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if bc.lastBlock != nil && block.Header.PrevHash != bc.lastBlock.Header.Hash {
+		return types.Hash{}, fmt.Errorf("block does not extend the tip")
+	}
+
+	// Apply to a scratch copy and always put the live state back
+	prev := bc.currentState()
+	bc.setState(prev.copy())
+	defer func() {
+		bc.setState(prev)
+		bc.pendingAudit = nil
+	}()
+
+	if err := bc.applyBlock(block); err != nil {
+		return types.Hash{}, err
+	}
+	return bc.stateRoot(), nil
+}
+
+// stateRoot commits to the live account state; the caller must hold the lock
+func (bc *Blockchain) stateRoot() types.Hash {
+	return types.StateRoot(bc.stateAccounts())
+}
+
+// stateAccounts lists the live accounts; the caller must hold the lock
+func (bc *Blockchain) stateAccounts() []*types.Account {
+	accounts := make([]*types.Account, 0, len(bc.accounts))
+	for _, account := range bc.accounts {
+		accounts = append(accounts, account)
+	}
+	return accounts
+}
+
+// SnapshotAccounts returns a copy of every account, sorted by address. The
+// copy is taken under the read lock, so callers may iterate it while blocks
+// keep being applied.
+func (bc *Blockchain) SnapshotAccounts() []types.Account {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	accounts := make([]types.Account, 0, len(bc.accounts))
+	for _, account := range bc.accounts {
+		accounts = append(accounts, *account)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return bytes.Compare(accounts[i].Address[:], accounts[j].Address[:]) < 0
+	})
+	return accounts
+}
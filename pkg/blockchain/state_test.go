@@ -0,0 +1,95 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"agent-chain/pkg/crypto"
+	"agent-chain/pkg/types"
+)
+
+func TestGetAccountProofMatchesHeader(t *testing.T) {
+	validator, alice, bob := newKey(t), newKey(t), newKey(t)
+	bc := newTestChain(t, testConfig(1000, alice))
+	tip := addBlock(t, bc, validator, *transfer(t, alice, bob.GetAddress(), 100, 1, 0))
+
+	for _, kp := range []*crypto.KeyPair{alice, bob, validator} {
+		proof, err := bc.GetAccountProof(kp.GetAddress())
+		if err != nil {
+			t.Fatalf("GetAccountProof: %v", err)
+		}
+		if proof.StateRoot != tip.Header.StateRoot || proof.BlockHash != tip.Header.Hash {
+			t.Fatalf("proof against %s at block %s, want the tip's", proof.StateRoot, proof.BlockHash)
+		}
+		if err := types.VerifyAccountProof(tip.Header.StateRoot, &proof.Account, proof.Proof); err != nil {
+			t.Errorf("proof of %s rejected: %v", kp.GetAddress(), err)
+		}
+	}
+
+	// A light client shown an inflated balance for bob rejects the proof
+	proof, err := bc.GetAccountProof(bob.GetAddress())
+	if err != nil {
+		t.Fatalf("GetAccountProof: %v", err)
+	}
+	proof.Account.Balance = 1_000_000
+	if err := types.VerifyAccountProof(tip.Header.StateRoot, &proof.Account, proof.Proof); err == nil {
+		t.Error("accepted a proof with a tampered balance")
+	}
+
+	if _, err := bc.GetAccountProof(newKey(t).GetAddress()); err == nil {
+		t.Error("proved an account that does not exist")
+	}
+}
+
+func TestSnapshotAccountsDuringTransfers(t *testing.T) {
+	validator, alice, bob := newKey(t), newKey(t), newKey(t)
+	config := testConfig(1000, alice, bob)
+	config.MaxClockDrift = time.Minute
+	bc := newTestChain(t, config)
+
+	// Fee-free transfers move funds between alice and bob, so every
+	// consistent snapshot holds the same total for the two of them
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			accounts := bc.SnapshotAccounts()
+			var total int64
+			for i, account := range accounts {
+				if i > 0 && bytes.Compare(accounts[i-1].Address[:], account.Address[:]) >= 0 {
+					t.Errorf("accounts not sorted at index %d", i)
+					return
+				}
+				if account.Address == alice.GetAddress() || account.Address == bob.GetAddress() {
+					total += account.Balance
+				}
+				// The copy is the caller's to change
+				accounts[i].Balance = -1
+			}
+			if total != 2000 {
+				t.Errorf("snapshot holds %d for alice and bob, want 2000", total)
+				return
+			}
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	const rounds = 50
+	for nonce := int64(0); nonce < rounds; nonce++ {
+		addBlock(t, bc, validator, *transfer(t, alice, bob.GetAddress(), 10, 0, nonce))
+	}
+
+	if got := bc.GetAccount(bob.GetAddress()).Balance; got != 1000+rounds*10 {
+		t.Errorf("bob's balance = %d, want %d", got, 1000+rounds*10)
+	}
+}
@@ -0,0 +1,117 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"agent-chain/pkg/crypto"
+	"agent-chain/pkg/types"
+)
+
+// TxApplier implements one transaction type. Check validates a transaction
+// against the current state without changing it; Apply changes the state
+// when the transaction is included in a block. Both run with the lock held.
+// The sender's nonce is checked and advanced by the chain, not by Apply.
+type TxApplier struct {
+	Check func(bc *Blockchain, tx *types.Transaction) error
+	Apply func(bc *Blockchain, tx *types.Transaction, header *types.BlockHeader) error
+}
+
+// defaultTxAppliers returns the built-in transaction types
+func defaultTxAppliers() map[string]TxApplier {
+	problem := TxApplier{
+		Check: (*Blockchain).checkProblemTransaction,
+		Apply: (*Blockchain).applyProblemTransaction,
+	}
+	stake := TxApplier{
+		Check: (*Blockchain).checkStakeTransaction,
+		Apply: (*Blockchain).applyStakeTransaction,
+	}
+
+	return map[string]TxApplier{
+		types.TxTypeTransfer: {
+			Check: (*Blockchain).checkTransfer,
+			Apply: (*Blockchain).applyTransfer,
+		},
+		types.TxTypePatchSubmit: {
+			Check: (*Blockchain).checkPatchSubmit,
+			Apply: (*Blockchain).applyPatchSubmit,
+		},
+		types.TxTypePatchReward: {
+			Check: (*Blockchain).checkPatchReward,
+			Apply: func(bc *Blockchain, tx *types.Transaction, _ *types.BlockHeader) error {
+				return bc.applyPatchReward(tx)
+			},
+		},
+		types.TxTypeProblemCreate: problem,
+		types.TxTypeProblemUpdate: problem,
+		types.TxTypeProblemClose:  problem,
+		types.TxTypeStake:         stake,
+		types.TxTypeUnstake:       stake,
+	}
+}
+
+// RegisterTxType adds a transaction type to the chain. It fails when the
+// type is already registered, so built-in types cannot be replaced.
+func (bc *Blockchain) RegisterTxType(txType string, applier TxApplier) error {
+	if txType == "" {
+		return fmt.Errorf("transaction type is required")
+	}
+	if applier.Check == nil || applier.Apply == nil {
+		return fmt.Errorf("transaction type %s needs both a check and an apply function", txType)
+	}
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if _, exists := bc.txAppliers[txType]; exists {
+		return fmt.Errorf("transaction type %s is already registered", txType)
+	}
+	bc.txAppliers[txType] = applier
+	return nil
+}
+
+// txApplier returns the implementation of a transaction type; the caller
+// must hold the lock
+func (bc *Blockchain) txApplier(txType string) (TxApplier, error) {
+	applier, exists := bc.txAppliers[txType]
+	if !exists {
+		return TxApplier{}, fmt.Errorf("unknown transaction type: %s", txType)
+	}
+	return applier, nil
+}
+
+// checkTransfer validates a transfer against the sender's balance
+func (bc *Blockchain) checkTransfer(tx *types.Transaction) error {
+	if bc.config.DustThreshold > 0 && tx.Amount < bc.config.DustThreshold {
+		return fmt.Errorf("transfer amount %d below dust threshold %d", tx.Amount, bc.config.DustThreshold)
+	}
+
+	account := bc.GetAccount(tx.From)
+	if account.Balance < tx.Amount+tx.Fee {
+		return fmt.Errorf("insufficient balance")
+	}
+	return nil
+}
+
+// checkPatchSubmit validates a patch submission and the gas it will use
+func (bc *Blockchain) checkPatchSubmit(tx *types.Transaction) error {
+	if tx.PatchSet != nil {
+		if problem, exists := bc.problems[tx.PatchSet.ProblemID]; exists && problem.Status != types.ProblemStatusOpen {
+			return fmt.Errorf("problem %s is %s", problem.Spec.ID, problem.Status)
+		}
+		// Older clients do not stamp a code hash
+		if tx.PatchSet.CodeHash != "" && tx.PatchSet.CodeHash != tx.PatchSet.ComputeCodeHash() {
+			return fmt.Errorf("patch code does not match its code hash")
+		}
+		if _, err := tx.PatchSet.Artifact(); err != nil {
+			return err
+		}
+		if err := crypto.VerifyPatchSet(tx.PatchSet); err != nil {
+			return err
+		}
+		if err := bc.checkDuplicatePatch(tx); err != nil {
+			return err
+		}
+	}
+	return bc.checkPatchGas(tx)
+}
@@ -0,0 +1,96 @@
+package blockchain
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"agent-chain/pkg/types"
+)
+
+// burnApplier is a custom transaction type that destroys the sender's coins
+var burnApplier = TxApplier{
+	Check: func(bc *Blockchain, tx *types.Transaction) error {
+		if bc.GetAccount(tx.From).Balance < tx.Amount+tx.Fee {
+			return fmt.Errorf("insufficient balance to burn")
+		}
+		return nil
+	},
+	Apply: func(bc *Blockchain, tx *types.Transaction, header *types.BlockHeader) error {
+		account := bc.GetAccount(tx.From)
+		account.Balance -= tx.Amount + tx.Fee
+		bc.accounts[tx.From] = account
+		bc.creditValidator(header, tx.Fee)
+		return nil
+	},
+}
+
+func TestRegisterTxTypeRejects(t *testing.T) {
+	bc := newTestChain(t, testConfig(0))
+
+	tests := []struct {
+		name    string
+		txType  string
+		applier TxApplier
+		want    string
+	}{
+		{"no type", "", burnApplier, "required"},
+		{"no apply", "burn", TxApplier{Check: burnApplier.Check}, "check and an apply"},
+		{"no check", "burn", TxApplier{Apply: burnApplier.Apply}, "check and an apply"},
+		{"built-in type", types.TxTypeTransfer, burnApplier, "already registered"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := bc.RegisterTxType(tt.txType, tt.applier)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error mentioning %q", err, tt.want)
+			}
+		})
+	}
+
+	if err := bc.RegisterTxType("burn", burnApplier); err != nil {
+		t.Fatalf("RegisterTxType: %v", err)
+	}
+	if err := bc.RegisterTxType("burn", burnApplier); err == nil {
+		t.Error("registered the same type twice")
+	}
+}
+
+func TestCustomTxTypeApplied(t *testing.T) {
+	alice, validator := newKey(t), newKey(t)
+	bc := newTestChain(t, testConfig(1000, alice))
+
+	tx := signTx(t, alice, &types.Transaction{Type: "burn", Amount: 100, Fee: 1})
+	if err := bc.AddTransaction(tx); err == nil || !strings.Contains(err.Error(), "unknown transaction type") {
+		t.Fatalf("got %v before registering, want an unknown transaction type error", err)
+	}
+
+	if err := bc.RegisterTxType("burn", burnApplier); err != nil {
+		t.Fatalf("RegisterTxType: %v", err)
+	}
+
+	// The type's own check runs when the transaction enters the pool
+	tooMuch := signTx(t, alice, &types.Transaction{Type: "burn", Amount: 5000, Fee: 1})
+	if err := bc.AddTransaction(tooMuch); err == nil || !strings.Contains(err.Error(), "insufficient balance to burn") {
+		t.Fatalf("got %v, want the custom check to reject the burn", err)
+	}
+
+	if err := bc.AddTransaction(tx); err != nil {
+		t.Fatalf("AddTransaction: %v", err)
+	}
+	addBlock(t, bc, validator, *tx)
+
+	account := bc.GetAccount(alice.GetAddress())
+	if account.Balance != 899 || account.Nonce != 1 {
+		t.Errorf("alice has balance %d nonce %d, want 899 and 1", account.Balance, account.Nonce)
+	}
+	if _, err := bc.GetTransaction(tx.Hash); err != nil {
+		t.Errorf("burn transaction not found on chain: %v", err)
+	}
+
+	// Built-in types behave as before alongside the custom one
+	addBlock(t, bc, validator, *transfer(t, alice, validator.GetAddress(), 50, 1, 1))
+	if got := bc.GetAccount(alice.GetAddress()).Balance; got != 848 {
+		t.Errorf("alice balance after transfer = %d, want 848", got)
+	}
+}
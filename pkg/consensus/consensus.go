@@ -2,8 +2,11 @@ package consensus
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -22,12 +25,16 @@ type Engine struct {
 	keyPair    *crypto.KeyPair
 	config     *types.ChainConfig
 	logger     *logrus.Logger
+	evaluator  *Evaluator
 
 	mu          sync.RWMutex
 	isValidator bool
 	isRunning   bool
 	ctx         context.Context
 	cancel      context.CancelFunc
+	loops       sync.WaitGroup
+
+	blocksProduced atomic.Int64
 }
 
 // NewEngine creates a new consensus engine
@@ -40,6 +47,7 @@ func NewEngine(bc *blockchain.Blockchain, net *network.Network, keyPair *crypto.
 		keyPair:     keyPair,
 		config:      config,
 		logger:      logger,
+		evaluator:   NewEvaluator(DefaultEvalWorkers, DefaultEvalQueueSize, CheckPatch, logger),
 		isValidator: true, // For simplicity, all nodes can validate
 		ctx:         ctx,
 		cancel:      cancel,
@@ -61,31 +69,38 @@ func (e *Engine) Start() error {
 	e.network.RegisterHandler(network.MsgTypeBlock, e.handleBlock)
 	e.network.RegisterHandler(network.MsgTypeTransaction, e.handleTransaction)
 	e.network.RegisterHandler(network.MsgTypeGetHeight, e.handleGetHeight)
+	e.network.RegisterHandler(network.MsgTypeHeight, e.handleHeight)
+	e.network.OnPeerConnected(e.onPeerConnected)
 	e.network.RegisterHandler(network.MsgTypeGetBlocks, e.handleGetBlocks)
 
-	// Start block production if validator
+	// Start block production and patch evaluation if validator
 	if e.isValidator {
+		e.evaluator.Start(e.ctx)
+		e.loops.Add(1)
 		go e.blockProductionLoop()
 	}
 
 	// Start sync loop
+	e.loops.Add(1)
 	go e.syncLoop()
 
 	e.logger.Info("Consensus engine started")
 	return nil
 }
 
-// Stop stops the consensus engine
+// Stop stops the consensus engine and waits for a block being produced to
+// finish, so the chain is not written to after Stop returns
 func (e *Engine) Stop() error {
 	e.mu.Lock()
-	defer e.mu.Unlock()
-
 	if !e.isRunning {
+		e.mu.Unlock()
 		return nil
 	}
-
 	e.cancel()
 	e.isRunning = false
+	e.mu.Unlock()
+
+	e.loops.Wait()
 
 	e.logger.Info("Consensus engine stopped")
 	return nil
@@ -93,6 +108,8 @@ func (e *Engine) Stop() error {
 
 // blockProductionLoop produces new blocks
 func (e *Engine) blockProductionLoop() {
+	defer e.loops.Done()
+
 	ticker := time.NewTicker(e.config.BlockTime)
 	defer ticker.Stop()
 
@@ -108,42 +125,87 @@ func (e *Engine) blockProductionLoop() {
 	}
 }
 
-// produceBlock creates and broadcasts a new block
+// produceBlock creates and broadcasts a new block if this node is the
+// scheduled proposer; other nodes wait for the proposer's block
 func (e *Engine) produceBlock() error {
+	if proposer, scheduled := e.blockchain.NextProposer(); scheduled && proposer != e.keyPair.GetAddress() {
+		e.logger.Debugf("Waiting for block #%d from proposer %s", e.blockchain.GetHeight()+1, proposer)
+		return nil
+	}
+
+	// Settle finished patch evaluations first; a limit of zero is unlimited,
+	// as in validateBlock
+	maxTxs := e.config.MaxTxPerBlock
+	candidates := e.patchRewards(maxTxs)
+
 	// Get pending transactions
 	pendingTxs := e.blockchain.GetPendingTransactions()
+	if e.config.PrioritizeOwnTxs {
+		pendingTxs = e.ownTxsFirst(pendingTxs)
+	}
+	for _, tx := range pendingTxs {
+		candidates = append(candidates, *tx)
+	}
 
-	// Limit transactions per block
-	maxTxs := e.config.MaxTxPerBlock
-	if len(pendingTxs) > maxTxs {
-		pendingTxs = pendingTxs[:maxTxs]
+	lastBlock := e.blockchain.GetLastBlock()
+	header := types.BlockHeader{
+		Height:     e.blockchain.GetHeight() + 1,
+		PrevHash:   lastBlock.Header.Hash,
+		Difficulty: 1, // Simplified difficulty
+		Nonce:      0,
+		Validator:  e.keyPair.GetAddress(),
 	}
 
-	// Convert to transaction slice
-	txs := make([]types.Transaction, len(pendingTxs))
-	for i, tx := range pendingTxs {
-		txs[i] = *tx
+	// Keep only transactions that still apply, so one stale transaction
+	// cannot make the whole block invalid
+	txs := e.blockchain.SelectTransactions(&header, candidates, maxTxs)
+
+	// Without transactions, only produce a block once the chain has been
+	// idle long enough that timestamps need to advance
+	if len(txs) == 0 && !e.config.ProduceEmptyBlocks {
+		if time.Since(time.Unix(lastBlock.Header.Timestamp, 0)) < e.emptyBlockInterval() {
+			return nil
+		}
 	}
 
-	// Create new block
-	lastBlock := e.blockchain.GetLastBlock()
+	// Timestamps must increase even if blocks come faster than the clock ticks
+	timestamp := time.Now().Unix()
+	if timestamp <= lastBlock.Header.Timestamp {
+		timestamp = lastBlock.Header.Timestamp + 1
+	}
+
+	header.Timestamp = timestamp
 	block := &types.Block{
-		Header: types.BlockHeader{
-			Height:     e.blockchain.GetHeight() + 1,
-			PrevHash:   lastBlock.Header.Hash,
-			Timestamp:  time.Now().Unix(),
-			Difficulty: 1, // Simplified difficulty
-			Nonce:      0,
-			Validator:  e.keyPair.GetAddress(),
-		},
-		Txs: txs,
-	}
-
-	// Calculate block hash
-	block.Header.Hash = block.CalculateHash()
-
-	// Add block to blockchain
-	if err := e.blockchain.AddBlock(block); err != nil {
+		Header: header,
+		Txs:    txs,
+	}
+
+	stateRoot, err := e.blockchain.StateRootAfter(block)
+	if err != nil {
+		return fmt.Errorf("failed to compute state root: %v", err)
+	}
+	block.Header.StateRoot = stateRoot
+
+	if e.config.Consensus == types.ConsensusPoW {
+		mined, err := e.mine(block)
+		if err != nil {
+			return err
+		}
+		if !mined {
+			return nil
+		}
+	}
+
+	// Calculate block hash and sign it as the proposer
+	if err := e.keyPair.SignBlock(block); err != nil {
+		return fmt.Errorf("failed to sign block: %v", err)
+	}
+
+	// Add block to blockchain, unless shutdown begins before it is written
+	if err := e.blockchain.AddBlock(e.ctx, block); err != nil {
+		if e.ctx.Err() != nil {
+			return nil
+		}
 		return fmt.Errorf("failed to add block: %v", err)
 	}
 
@@ -152,12 +214,115 @@ func (e *Engine) produceBlock() error {
 		e.logger.Errorf("Failed to broadcast block: %v", err)
 	}
 
+	e.blocksProduced.Add(1)
 	e.logger.Infof("Produced block #%d with %d transactions", block.Header.Height, len(block.Txs))
 	return nil
 }
 
+// emptyBlockInterval returns the longest the chain may go without a block
+// when empty blocks are skipped
+func (e *Engine) emptyBlockInterval() time.Duration {
+	if e.config.EmptyBlockInterval > 0 {
+		return e.config.EmptyBlockInterval
+	}
+	return types.DefaultEmptyBlockInterval
+}
+
+// ownTxsFirst moves transactions sent by this node's key to the front of the
+// pool, in nonce order, so they survive the per-block limit under load
+func (e *Engine) ownTxsFirst(txs []*types.Transaction) []*types.Transaction {
+	self := e.keyPair.GetAddress()
+
+	ordered := make([]*types.Transaction, 0, len(txs))
+	for _, tx := range txs {
+		if tx.From == self {
+			ordered = append(ordered, tx)
+		}
+	}
+	own := len(ordered)
+	sort.Slice(ordered, func(i, j int) bool {
+		return ordered[i].Nonce < ordered[j].Nonce
+	})
+
+	for _, tx := range txs {
+		if tx.From != self {
+			ordered = append(ordered, tx)
+		}
+	}
+
+	if own > 0 {
+		e.logger.Debugf("Prioritizing %d own transactions", own)
+	}
+	return ordered
+}
+
+// patchRewards queues newly mined patches for evaluation and turns finished
+// evaluations into signed patch_reward transactions, at most limit of them
+// unless limit is zero
+func (e *Engine) patchRewards(limit int) []types.Transaction {
+	pending := e.blockchain.PendingPatches()
+	stillPending := make(map[types.Hash]bool, len(pending))
+	for _, tx := range pending {
+		stillPending[tx.Hash] = true
+		e.evaluator.Enqueue(tx)
+	}
+	e.evaluator.Prune(stillPending)
+
+	var rewards []types.Transaction
+	solved := make(map[string]bool)
+	for _, result := range e.evaluator.Results() {
+		if limit > 0 && len(rewards) >= limit {
+			break
+		}
+
+		// Paying one patch changes what others for the same problem are
+		// owed, so settle at most one passing patch per problem per block
+		if result.Passed && solved[result.ProblemID] {
+			continue
+		}
+
+		amount := int64(0)
+		if result.Passed {
+			reward, err := e.blockchain.PatchReward(result.PatchTx)
+			if err != nil {
+				continue
+			}
+			amount = reward
+			solved[result.ProblemID] = true
+		}
+
+		patchTx := result.PatchTx
+		tx := types.Transaction{
+			Type:      types.TxTypePatchReward,
+			From:      e.keyPair.GetAddress(),
+			To:        result.Author,
+			Amount:    amount,
+			PatchTx:   &patchTx,
+			Timestamp: time.Now().Unix(),
+			ChainID:   e.config.ChainID,
+		}
+		if err := e.signTransaction(&tx); err != nil {
+			e.logger.Errorf("Failed to sign patch reward: %v", err)
+			continue
+		}
+		rewards = append(rewards, tx)
+	}
+
+	return rewards
+}
+
+// signTransaction signs a transaction with the validator key and sets its hash
+func (e *Engine) signTransaction(tx *types.Transaction) error {
+	if err := e.keyPair.SignTransaction(tx); err != nil {
+		return fmt.Errorf("failed to sign transaction: %v", err)
+	}
+	return nil
+}
+
 // syncLoop synchronizes with other nodes
 func (e *Engine) syncLoop() {
+	defer e.loops.Done()
+
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
@@ -184,33 +349,111 @@ func (e *Engine) syncWithPeers() {
 	}
 }
 
+// onPeerConnected asks a new peer for its height right away, instead of
+// waiting for the next sync tick, so that a node behind it starts catching up
+func (e *Engine) onPeerConnected(pid peer.ID) {
+	if e.ctx.Err() != nil {
+		return
+	}
+	if err := e.network.RequestHeight(pid.String()); err != nil {
+		e.logger.Debugf("Failed to request height from new peer %s: %v", pid, err)
+	}
+}
+
 // handleBlock handles incoming block messages
 func (e *Engine) handleBlock(msg *network.Message, from peer.ID) error {
-	_, ok := msg.Data.(map[string]interface{})
-	if !ok {
+	data, err := json.Marshal(msg.Data)
+	if err != nil {
 		return fmt.Errorf("invalid block data format")
 	}
 
-	// Convert to block (simplified)
-	// In a real implementation, you'd properly deserialize the block
-	// For now, we'll skip detailed validation
+	var block types.Block
+	if err := json.Unmarshal(data, &block); err != nil {
+		e.network.BanPeer(from, network.DefaultBanDuration)
+		return fmt.Errorf("invalid block data format: %v", err)
+	}
+	// Blocks served during sync are older than the peer's tip
+	if block.Header.Height > e.network.PeerHeight(from) {
+		e.network.SetPeerHeight(from, block.Header.Height)
+	}
 
-	e.logger.Infof("Received block from peer %s", from)
+	// Only a block extending our tip can be checked against our state; others
+	// are duplicates or competing forks, which the blockchain keeps as side
+	// branches for fork choice. Neither makes the peer misbehaving, unless
+	// the block is invalid in itself.
+	lastBlock := e.blockchain.GetLastBlock()
+	if block.Header.Height != lastBlock.Header.Height+1 || block.Header.PrevHash != lastBlock.Header.Hash {
+		if err := e.blockchain.AddBlock(e.ctx, &block); err != nil {
+			if blockchain.IsInvalidBlock(err) {
+				e.network.BanPeer(from, network.DefaultBanDuration)
+				return fmt.Errorf("peer %s sent invalid side block #%d: %v", from, block.Header.Height, err)
+			}
+			e.logger.Debugf("Ignoring block #%d from peer %s at local height %d: %v", block.Header.Height, from, lastBlock.Header.Height, err)
+			return nil
+		}
+		if newTip := e.blockchain.GetLastBlock(); newTip.Header.Hash != lastBlock.Header.Hash {
+			e.logger.Infof("Reorganized to block #%d from peer %s", newTip.Header.Height, from)
+		}
+		return nil
+	}
+
+	// Only provable misbehaviour bans the peer; a block failing on something
+	// local, such as a timestamp ahead of our clock, is dropped unrelayed
+	if err := e.blockchain.ValidateBlock(&block); err != nil {
+		if blockchain.IsInvalidBlock(err) {
+			e.network.BanPeer(from, network.DefaultBanDuration)
+			return fmt.Errorf("peer %s sent invalid block #%d: %v", from, block.Header.Height, err)
+		}
+		e.logger.Debugf("Dropping block #%d from peer %s: %v", block.Header.Height, from, err)
+		return network.ErrSkipRelay
+	}
+
+	if err := e.blockchain.AddBlock(e.ctx, &block); err != nil {
+		if blockchain.IsInvalidBlock(err) {
+			e.network.BanPeer(from, network.DefaultBanDuration)
+		}
+		return fmt.Errorf("failed to add block: %v", err)
+	}
+
+	e.logger.Infof("Accepted block #%d from peer %s", block.Header.Height, from)
+
+	// Keep downloading while the peer is still ahead
+	e.requestMissingBlocks(from)
 	return nil
 }
 
-// handleTransaction handles incoming transaction messages
+// handleTransaction handles incoming transaction messages, adding valid
+// transactions to the local pool so they reach whichever node proposes next
 func (e *Engine) handleTransaction(msg *network.Message, from peer.ID) error {
-	_, ok := msg.Data.(map[string]interface{})
-	if !ok {
+	data, err := json.Marshal(msg.Data)
+	if err != nil {
 		return fmt.Errorf("invalid transaction data format")
 	}
 
-	// Convert to transaction (simplified)
-	// In a real implementation, you'd properly deserialize the transaction
-	// For now, we'll skip adding to blockchain
+	var tx types.Transaction
+	if err := json.Unmarshal(data, &tx); err != nil {
+		e.network.BanPeer(from, network.DefaultBanDuration)
+		return fmt.Errorf("invalid transaction data format: %v", err)
+	}
+
+	if tx.Hash != tx.CalculateHash() {
+		e.network.BanPeer(from, network.DefaultBanDuration)
+		return fmt.Errorf("peer %s sent transaction with invalid hash", from)
+	}
+
+	// A transaction we already hold has been relayed before
+	if _, err := e.blockchain.GetTransaction(tx.Hash); err == nil {
+		return network.ErrSkipRelay
+	}
+
+	// Rejections are usually benign races such as a nonce already used by a
+	// mined transaction, so they neither ban the peer nor get relayed
+	if err := e.blockchain.AddTransaction(&tx); err != nil {
+		e.logger.Debugf("Ignoring transaction %s from peer %s: %v", tx.Hash, from, err)
+		return network.ErrSkipRelay
+	}
 
-	e.logger.Infof("Received transaction from peer %s", from)
+	e.logger.Debugf("Pooled transaction %s from peer %s", tx.Hash, from)
 	return nil
 }
 
@@ -223,7 +466,43 @@ func (e *Engine) handleGetHeight(msg *network.Message, from peer.ID) error {
 	})
 }
 
-// handleGetBlocks handles block requests
+// handleHeight records a peer's reported height and starts downloading
+// blocks when the peer is ahead
+func (e *Engine) handleHeight(msg *network.Message, from peer.ID) error {
+	data, ok := msg.Data.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid height data format")
+	}
+
+	height, ok := data["height"].(float64)
+	if !ok {
+		return fmt.Errorf("invalid height")
+	}
+
+	e.network.SetPeerHeight(from, int64(height))
+	e.requestMissingBlocks(from)
+	return nil
+}
+
+// requestMissingBlocks asks a peer for the block after our tip if the peer
+// reported a greater height
+func (e *Engine) requestMissingBlocks(from peer.ID) {
+	localHeight := e.blockchain.GetHeight()
+	peerHeight := e.network.PeerHeight(from)
+	if peerHeight <= localHeight {
+		return
+	}
+
+	e.logger.Debugf("Peer %s is at height %d, requesting block #%d", from, peerHeight, localHeight+1)
+	if err := e.network.RequestBlocks(from.String(), localHeight+1); err != nil {
+		e.logger.Errorf("Failed to request blocks from peer %s: %v", from, err)
+	}
+}
+
+// handleGetBlocks handles block requests. Only the block at the requested
+// height is sent: every message travels on its own stream, so a batch could
+// arrive out of order, and the requester asks for the next block once it
+// has connected this one.
 func (e *Engine) handleGetBlocks(msg *network.Message, from peer.ID) error {
 	data, ok := msg.Data.(map[string]interface{})
 	if !ok {
@@ -235,9 +514,13 @@ func (e *Engine) handleGetBlocks(msg *network.Message, from peer.ID) error {
 		return fmt.Errorf("invalid from_height")
 	}
 
-	// In a real implementation, you'd send the requested blocks
-	e.logger.Infof("Received blocks request from peer %s, from height %d", from, int64(fromHeight))
-	return nil
+	block, err := e.blockchain.GetBlockByHeight(int64(fromHeight))
+	if err != nil {
+		e.logger.Debugf("Cannot serve block #%d to peer %s: %v", int64(fromHeight), from, err)
+		return nil
+	}
+
+	return e.network.SendToPeer(from.String(), network.MsgTypeBlock, block)
 }
 
 // SubmitTransaction submits a transaction to the network
@@ -255,11 +538,41 @@ func (e *Engine) SubmitTransaction(tx *types.Transaction) error {
 	return nil
 }
 
+// BlocksProduced returns how many blocks this node has produced since it started
+func (e *Engine) BlocksProduced() int64 {
+	return e.blocksProduced.Load()
+}
+
 // GetBlockchain returns the blockchain instance
 func (e *Engine) GetBlockchain() *blockchain.Blockchain {
 	return e.blockchain
 }
 
+// NextProposer returns the address expected to propose the next block: the
+// staked validator whose turn it is. Before any validator has staked every
+// validating node produces its own blocks, so this is the local validator
+// address, or the zero address when this node does not validate.
+func (e *Engine) NextProposer() types.Address {
+	if proposer, scheduled := e.blockchain.NextProposer(); scheduled {
+		return proposer
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if !e.isValidator {
+		return types.Address{}
+	}
+	return e.keyPair.GetAddress()
+}
+
+// SetEvaluator replaces the patch evaluator; it must be called before Start
+func (e *Engine) SetEvaluator(evaluator *Evaluator) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.evaluator = evaluator
+}
+
 // IsValidator returns whether this node is a validator
 func (e *Engine) IsValidator() bool {
 	e.mu.RLock()
@@ -0,0 +1,577 @@
+package consensus
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+
+	"agent-chain/pkg/blockchain"
+	"agent-chain/pkg/crypto"
+	"agent-chain/pkg/network"
+	"agent-chain/pkg/types"
+)
+
+// newTestEngine returns an engine over a fresh chain and an unconnected network
+func newTestEngine(t *testing.T) (*Engine, *crypto.KeyPair) {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	config := &types.ChainConfig{
+		ChainID:       1,
+		BlockTime:     types.DefaultBlockTime,
+		MaxTxPerBlock: types.DefaultMaxTxPerBlock,
+		InitialReward: types.DefaultInitialReward,
+		GenesisTime:   time.Now().Add(-time.Hour).Unix(),
+	}
+	bc, err := blockchain.NewBlockchain(config, t.TempDir())
+	if err != nil {
+		t.Fatalf("NewBlockchain: %v", err)
+	}
+	t.Cleanup(func() { bc.Close(context.Background()) })
+
+	net, err := network.NewNetwork(0, t.TempDir(), logger)
+	if err != nil {
+		t.Fatalf("NewNetwork: %v", err)
+	}
+	t.Cleanup(func() { net.Stop() })
+
+	kp, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+	return NewEngine(bc, net, kp, config, logger), kp
+}
+
+// signedBlock builds an empty block on the engine's tip
+func signedBlock(t *testing.T, e *Engine, kp *crypto.KeyPair, mutate func(*types.Block)) *types.Block {
+	t.Helper()
+	last := e.blockchain.GetLastBlock()
+	block := &types.Block{
+		Header: types.BlockHeader{
+			Height:     last.Header.Height + 1,
+			PrevHash:   last.Header.Hash,
+			StateRoot:  last.Header.StateRoot,
+			Timestamp:  time.Now().Unix(),
+			Difficulty: 1,
+			Validator:  kp.GetAddress(),
+		},
+		Txs: []types.Transaction{},
+	}
+	if mutate != nil {
+		mutate(block)
+	}
+	if err := kp.SignBlock(block); err != nil {
+		t.Fatalf("SignBlock: %v", err)
+	}
+	return block
+}
+
+func TestHandleBlockBansOnlyForMisbehaviour(t *testing.T) {
+	tests := []struct {
+		name   string
+		block  func(e *Engine, kp *crypto.KeyPair) *types.Block
+		banned bool
+	}{
+		{"valid block", func(e *Engine, kp *crypto.KeyPair) *types.Block {
+			return signedBlock(t, e, kp, nil)
+		}, false},
+		{"timestamp ahead of local clock", func(e *Engine, kp *crypto.KeyPair) *types.Block {
+			return signedBlock(t, e, kp, func(b *types.Block) {
+				b.Header.Timestamp = time.Now().Add(time.Hour).Unix()
+			})
+		}, false},
+		{"bad signature", func(e *Engine, kp *crypto.KeyPair) *types.Block {
+			block := signedBlock(t, e, kp, nil)
+			block.Header.Signature[0] ^= 0xff
+			return block
+		}, true},
+		{"bad hash", func(e *Engine, kp *crypto.KeyPair) *types.Block {
+			block := signedBlock(t, e, kp, nil)
+			block.Header.Timestamp--
+			return block
+		}, true},
+		{"forged side block", func(e *Engine, kp *crypto.KeyPair) *types.Block {
+			// Move the tip on so the block below is a competing fork
+			if err := e.blockchain.AddBlock(context.Background(), signedBlock(t, e, kp, nil)); err != nil {
+				t.Fatalf("AddBlock: %v", err)
+			}
+			genesis, _ := e.blockchain.GetBlockByHeight(0)
+			block := signedBlock(t, e, kp, func(b *types.Block) {
+				b.Header.Height = 1
+				b.Header.PrevHash = genesis.Header.Hash
+				b.Header.Timestamp -= 10
+			})
+			block.Header.Signature[0] ^= 0xff
+			return block
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, kp := newTestEngine(t)
+			from := peer.ID("sender")
+
+			msg := &network.Message{Type: network.MsgTypeBlock, Data: tt.block(e, kp)}
+			e.handleBlock(msg, from)
+
+			if got := e.network.IsBanned(from); got != tt.banned {
+				t.Errorf("banned = %v, want %v", got, tt.banned)
+			}
+		})
+	}
+}
+
+func TestValidatorsProposeInTurn(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	keys := make([]*crypto.KeyPair, 3)
+	config := &types.ChainConfig{
+		ChainID:            1,
+		BlockTime:          types.DefaultBlockTime,
+		MaxTxPerBlock:      types.DefaultMaxTxPerBlock,
+		InitialReward:      types.DefaultInitialReward,
+		GenesisTime:        time.Now().Add(-time.Hour).Unix(),
+		ProduceEmptyBlocks: true,
+		// Blocks come faster than the clock, each a second after the last
+		MaxClockDrift: time.Minute,
+	}
+	for i := range keys {
+		kp, err := crypto.GenerateKeyPair()
+		if err != nil {
+			t.Fatalf("GenerateKeyPair: %v", err)
+		}
+		keys[i] = kp
+		config.GenesisAccounts = append(config.GenesisAccounts, types.Account{
+			Address: kp.GetAddress(),
+			Balance: 100000,
+		})
+	}
+
+	bc, err := blockchain.NewBlockchain(config, t.TempDir())
+	if err != nil {
+		t.Fatalf("NewBlockchain: %v", err)
+	}
+	t.Cleanup(func() { bc.Close(context.Background()) })
+
+	net, err := network.NewNetwork(0, t.TempDir(), logger)
+	if err != nil {
+		t.Fatalf("NewNetwork: %v", err)
+	}
+	t.Cleanup(func() { net.Stop() })
+
+	// Three nodes sharing one chain, so each sees the others' blocks at once
+	engines := make(map[types.Address]*Engine)
+	for _, kp := range keys {
+		engines[kp.GetAddress()] = NewEngine(bc, net, kp, config, logger)
+	}
+
+	for _, kp := range keys {
+		tx := &types.Transaction{
+			Type:      types.TxTypeStake,
+			From:      kp.GetAddress(),
+			Amount:    types.DefaultMinValidatorStake,
+			Fee:       1,
+			Timestamp: time.Now().Unix(),
+			ChainID:   config.ChainID,
+		}
+		if err := kp.SignTransaction(tx); err != nil {
+			t.Fatalf("SignTransaction: %v", err)
+		}
+		if err := bc.AddTransaction(tx); err != nil {
+			t.Fatalf("AddTransaction: %v", err)
+		}
+	}
+
+	// Nobody has staked yet, so any node may produce the block with the stakes
+	if err := engines[keys[0].GetAddress()].produceBlock(); err != nil {
+		t.Fatalf("produceBlock: %v", err)
+	}
+	if got := len(bc.Validators()); got != len(keys) {
+		t.Fatalf("validators = %d, want %d", got, len(keys))
+	}
+
+	proposed := make(map[types.Address]int)
+	for i := 0; i < 60; i++ {
+		height := bc.GetHeight()
+		proposer, scheduled := bc.NextProposer()
+		if !scheduled {
+			t.Fatalf("no proposer scheduled for block #%d", height+1)
+		}
+
+		// Everyone else waits for the scheduled proposer
+		for addr, e := range engines {
+			if addr == proposer {
+				continue
+			}
+			if err := e.produceBlock(); err != nil {
+				t.Fatalf("produceBlock: %v", err)
+			}
+			if got := bc.GetHeight(); got != height {
+				t.Fatalf("%s produced block #%d out of turn", addr, got)
+			}
+		}
+
+		if err := engines[proposer].produceBlock(); err != nil {
+			t.Fatalf("produceBlock: %v", err)
+		}
+		if got := bc.GetHeight(); got != height+1 {
+			t.Fatalf("height after proposer's turn = %d, want %d", got, height+1)
+		}
+		block := bc.GetLastBlock()
+		if block.Header.Validator != proposer {
+			t.Fatalf("block #%d proposed by %s, want scheduled %s", block.Header.Height, block.Header.Validator, proposer)
+		}
+		proposed[proposer]++
+	}
+
+	for _, kp := range keys {
+		if proposed[kp.GetAddress()] == 0 {
+			t.Errorf("validator %s never proposed", kp.GetAddress())
+		}
+	}
+	var produced int64
+	for _, e := range engines {
+		produced += e.BlocksProduced()
+	}
+	if produced != 61 {
+		t.Errorf("blocks produced = %d, want 61", produced)
+	}
+}
+
+// newTestNode returns an engine for kp over its own chain and network
+func newTestNode(t *testing.T, config *types.ChainConfig, kp *crypto.KeyPair) *Engine {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	bc, err := blockchain.NewBlockchain(config, t.TempDir())
+	if err != nil {
+		t.Fatalf("NewBlockchain: %v", err)
+	}
+	t.Cleanup(func() { bc.Close(context.Background()) })
+
+	net, err := network.NewNetwork(0, t.TempDir(), logger)
+	if err != nil {
+		t.Fatalf("NewNetwork: %v", err)
+	}
+	t.Cleanup(func() { net.Stop() })
+
+	e := NewEngine(bc, net, kp, config, logger)
+	t.Cleanup(func() { e.Stop() })
+	return e
+}
+
+func TestTransactionReachesProposer(t *testing.T) {
+	sender, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+	config := &types.ChainConfig{
+		ChainID:       1,
+		BlockTime:     100 * time.Millisecond,
+		MaxTxPerBlock: types.DefaultMaxTxPerBlock,
+		InitialReward: types.DefaultInitialReward,
+		GenesisTime:   time.Now().Add(-time.Hour).Unix(),
+		GenesisAccounts: []types.Account{
+			{Address: sender.GetAddress(), Balance: 1000},
+		},
+	}
+
+	a := newTestNode(t, config, sender)
+	a.SetValidator(false)
+	b := newTestNode(t, config, sender)
+	for _, e := range []*Engine{a, b} {
+		if err := e.Start(); err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+	}
+
+	addr := b.network.GetAddresses()[0] + "/p2p/" + b.network.GetID()
+	if err := a.network.ConnectToPeer(addr); err != nil {
+		t.Fatalf("ConnectToPeer: %v", err)
+	}
+
+	tx := &types.Transaction{
+		Type:      types.TxTypeTransfer,
+		From:      sender.GetAddress(),
+		To:        types.Address{1},
+		Amount:    10,
+		Fee:       1,
+		Timestamp: time.Now().Unix(),
+		ChainID:   config.ChainID,
+	}
+	if err := sender.SignTransaction(tx); err != nil {
+		t.Fatalf("SignTransaction: %v", err)
+	}
+	if err := a.SubmitTransaction(tx); err != nil {
+		t.Fatalf("SubmitTransaction: %v", err)
+	}
+
+	// Gossip published before B joined the topic is lost, so keep
+	// announcing the transaction until B has it
+	mined := func(e *Engine) bool {
+		info, err := e.blockchain.GetTransaction(tx.Hash)
+		return err == nil && !info.Pending
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for !mined(b) {
+		if time.Now().After(deadline) {
+			t.Fatal("transaction submitted to A was not mined by B")
+		}
+		if _, err := b.blockchain.GetTransaction(tx.Hash); err != nil {
+			a.network.Broadcast(network.MsgTypeTransaction, tx)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// B's block then carries it back to A
+	for !mined(a) {
+		if time.Now().After(deadline) {
+			t.Fatal("A did not receive the block mining its transaction")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if got := a.BlocksProduced(); got != 0 {
+		t.Errorf("A produced %d blocks, want 0", got)
+	}
+}
+
+func TestShutdownDuringProductionKeepsChain(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	kp, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+	config := &types.ChainConfig{
+		ChainID:            1,
+		BlockTime:          time.Millisecond,
+		MaxTxPerBlock:      types.DefaultMaxTxPerBlock,
+		InitialReward:      types.DefaultInitialReward,
+		GenesisTime:        time.Now().Add(-time.Hour).Unix(),
+		ProduceEmptyBlocks: true,
+		MaxClockDrift:      time.Hour,
+	}
+	dataDir := t.TempDir()
+
+	net, err := network.NewNetwork(0, t.TempDir(), logger)
+	if err != nil {
+		t.Fatalf("NewNetwork: %v", err)
+	}
+	t.Cleanup(func() { net.Stop() })
+
+	// Shut down at a different point of the production cycle each round
+	for round := 0; round < 5; round++ {
+		bc, err := blockchain.NewBlockchain(config, dataDir)
+		if err != nil {
+			t.Fatalf("round %d: reopening chain: %v", round, err)
+		}
+		start := bc.GetHeight()
+
+		e := NewEngine(bc, net, kp, config, logger)
+		if err := e.Start(); err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		time.Sleep(time.Duration(20+round*7) * time.Millisecond)
+
+		// The chain closes while blocks are still coming, as on a kill
+		// signal, before the engine is told to stop
+		if err := bc.Close(context.Background()); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		tip := bc.GetLastBlock()
+		e.Stop()
+
+		if tip.Header.Height <= start {
+			t.Fatalf("round %d: no blocks produced", round)
+		}
+
+		reopened, err := blockchain.NewBlockchain(config, dataDir)
+		if err != nil {
+			t.Fatalf("round %d: reopening chain: %v", round, err)
+		}
+		if got := reopened.GetLastBlock(); got.Header.Hash != tip.Header.Hash {
+			t.Errorf("round %d: reopened at #%d %s, want #%d %s", round,
+				got.Header.Height, got.Header.Hash, tip.Header.Height, tip.Header.Hash)
+		}
+		reopened.Close(context.Background())
+	}
+}
+
+func TestEmptyBlockModes(t *testing.T) {
+	tests := []struct {
+		name        string
+		produce     bool
+		interval    time.Duration
+		wantHeights []int64 // height after each empty round
+	}{
+		{"empty blocks produced", true, 0, []int64{1, 2, 3}},
+		// Genesis is an hour old, so the first round is past the idle interval
+		{"empty blocks skipped", false, 0, []int64{1, 1, 1}},
+		{"empty blocks skipped with a long interval", false, 2 * time.Hour, []int64{0, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kp, err := crypto.GenerateKeyPair()
+			if err != nil {
+				t.Fatalf("GenerateKeyPair: %v", err)
+			}
+			config := &types.ChainConfig{
+				ChainID:            1,
+				BlockTime:          types.DefaultBlockTime,
+				MaxTxPerBlock:      types.DefaultMaxTxPerBlock,
+				InitialReward:      types.DefaultInitialReward,
+				GenesisTime:        time.Now().Add(-time.Hour).Unix(),
+				ProduceEmptyBlocks: tt.produce,
+				EmptyBlockInterval: tt.interval,
+				MaxClockDrift:      time.Minute,
+				GenesisAccounts: []types.Account{
+					{Address: kp.GetAddress(), Balance: 1000},
+				},
+			}
+			e := newTestNode(t, config, kp)
+			bc := e.blockchain
+
+			for i, want := range tt.wantHeights {
+				if err := e.produceBlock(); err != nil {
+					t.Fatalf("produceBlock: %v", err)
+				}
+				if got := bc.GetHeight(); got != want {
+					t.Fatalf("round %d: height = %d, want %d", i, got, want)
+				}
+			}
+
+			// A pending transaction always gets a block
+			height := bc.GetHeight()
+			tx := &types.Transaction{
+				Type:      types.TxTypeTransfer,
+				From:      kp.GetAddress(),
+				To:        types.Address{1},
+				Amount:    10,
+				Fee:       1,
+				Nonce:     0,
+				Timestamp: time.Now().Unix(),
+				ChainID:   config.ChainID,
+			}
+			if err := kp.SignTransaction(tx); err != nil {
+				t.Fatalf("SignTransaction: %v", err)
+			}
+			if err := bc.AddTransaction(tx); err != nil {
+				t.Fatalf("AddTransaction: %v", err)
+			}
+			if err := e.produceBlock(); err != nil {
+				t.Fatalf("produceBlock: %v", err)
+			}
+			if got := bc.GetHeight(); got != height+1 {
+				t.Fatalf("height = %d with a pending transaction, want %d", got, height+1)
+			}
+			if txs := bc.GetLastBlock().Txs; len(txs) != 1 || txs[0].Hash != tx.Hash {
+				t.Errorf("block carries %d transactions, want the pending transfer", len(txs))
+			}
+		})
+	}
+}
+
+func TestShortBlockTimeProducesQuickly(t *testing.T) {
+	kp, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+	config := &types.ChainConfig{
+		ChainID:            1,
+		BlockTime:          200 * time.Millisecond,
+		MaxTxPerBlock:      types.DefaultMaxTxPerBlock,
+		InitialReward:      types.DefaultInitialReward,
+		GenesisTime:        time.Now().Add(-time.Hour).Unix(),
+		ProduceEmptyBlocks: true,
+		MaxClockDrift:      time.Minute,
+	}
+	e := newTestNode(t, config, kp)
+	if err := e.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	// Three blocks are due within 600ms; allow well over that but far less
+	// than a single default block time
+	start := time.Now()
+	deadline := start.Add(2 * time.Second)
+	for e.blockchain.GetHeight() < 3 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if height := e.blockchain.GetHeight(); height < 3 {
+		t.Fatalf("height = %d after %v, want at least 3", height, time.Since(start))
+	}
+}
+
+func TestBehindNodeCatchesUp(t *testing.T) {
+	kp, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+	config := &types.ChainConfig{
+		ChainID:       1,
+		BlockTime:     types.DefaultBlockTime,
+		MaxTxPerBlock: types.DefaultMaxTxPerBlock,
+		InitialReward: types.DefaultInitialReward,
+		GenesisTime:   time.Now().Add(-time.Hour).Unix(),
+	}
+
+	// Neither produces, so only sync can move the behind node
+	ahead, behind := newTestNode(t, config, kp), newTestNode(t, config, kp)
+	for _, e := range []*Engine{ahead, behind} {
+		e.SetValidator(false)
+	}
+
+	const height = 20
+	for i := 0; i < height; i++ {
+		last := ahead.blockchain.GetLastBlock()
+		block := &types.Block{
+			Header: types.BlockHeader{
+				Height:     last.Header.Height + 1,
+				PrevHash:   last.Header.Hash,
+				StateRoot:  last.Header.StateRoot,
+				Timestamp:  last.Header.Timestamp + 1,
+				Difficulty: 1,
+				Validator:  kp.GetAddress(),
+			},
+			Txs: []types.Transaction{},
+		}
+		if err := kp.SignBlock(block); err != nil {
+			t.Fatalf("SignBlock: %v", err)
+		}
+		if err := ahead.blockchain.AddBlock(context.Background(), block); err != nil {
+			t.Fatalf("AddBlock #%d: %v", block.Header.Height, err)
+		}
+	}
+
+	for _, e := range []*Engine{ahead, behind} {
+		if err := e.Start(); err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+	}
+	addr := ahead.network.GetAddresses()[0] + "/p2p/" + ahead.network.GetID()
+	if err := behind.network.ConnectToPeer(addr); err != nil {
+		t.Fatalf("ConnectToPeer: %v", err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for behind.blockchain.GetHeight() < height {
+		if time.Now().After(deadline) {
+			t.Fatalf("behind node stuck at height %d of %d", behind.blockchain.GetHeight(), height)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if got, want := behind.blockchain.GetLastBlock().Header.Hash, ahead.blockchain.GetLastBlock().Header.Hash; got != want {
+		t.Errorf("caught-up tip %s, want %s", got, want)
+	}
+	if got := behind.network.HighestPeerHeight(); got != height {
+		t.Errorf("recorded peer height = %d, want %d", got, height)
+	}
+}
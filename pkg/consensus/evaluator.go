@@ -0,0 +1,169 @@
+package consensus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"agent-chain/pkg/types"
+)
+
+const (
+	// DefaultEvalWorkers is the number of patches evaluated concurrently by default
+	DefaultEvalWorkers = 4
+	// DefaultEvalQueueSize bounds the number of patches waiting for a worker
+	DefaultEvalQueueSize = 1024
+	// EvalTimeout bounds a single patch evaluation
+	EvalTimeout = 60 * time.Second
+)
+
+// EvaluateFunc runs a submitted patch and reports whether it solves its problem
+type EvaluateFunc func(ctx context.Context, patch *types.PatchSet) (bool, error)
+
+// EvaluationResult is the outcome of evaluating a mined patch submission
+type EvaluationResult struct {
+	PatchTx   types.Hash
+	Author    types.Address
+	ProblemID string
+	Passed    bool
+}
+
+// Evaluator evaluates patches on a bounded pool of workers so block
+// production never waits for submitted code to run
+type Evaluator struct {
+	evaluate EvaluateFunc
+	workers  int
+	queue    chan *types.Transaction
+	logger   *logrus.Logger
+
+	mu      sync.Mutex
+	pending map[types.Hash]bool
+	results map[types.Hash]EvaluationResult
+}
+
+// NewEvaluator creates an evaluator running up to workers evaluations at once
+// with at most queueSize patches waiting
+func NewEvaluator(workers, queueSize int, evaluate EvaluateFunc, logger *logrus.Logger) *Evaluator {
+	if workers <= 0 {
+		workers = DefaultEvalWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultEvalQueueSize
+	}
+
+	return &Evaluator{
+		evaluate: evaluate,
+		workers:  workers,
+		queue:    make(chan *types.Transaction, queueSize),
+		logger:   logger,
+		pending:  make(map[types.Hash]bool),
+		results:  make(map[types.Hash]EvaluationResult),
+	}
+}
+
+// Start launches the workers, which run until ctx is cancelled
+func (ev *Evaluator) Start(ctx context.Context) {
+	for i := 0; i < ev.workers; i++ {
+		go ev.worker(ctx)
+	}
+}
+
+// Enqueue schedules a patch submission for evaluation without blocking. It
+// returns false if the patch is already known or the queue is full; the
+// caller simply offers it again later.
+func (ev *Evaluator) Enqueue(tx *types.Transaction) bool {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+
+	if ev.pending[tx.Hash] {
+		return false
+	}
+	if _, done := ev.results[tx.Hash]; done {
+		return false
+	}
+
+	select {
+	case ev.queue <- tx:
+		ev.pending[tx.Hash] = true
+		return true
+	default:
+		return false
+	}
+}
+
+// Results returns the completed evaluations not yet settled on chain
+func (ev *Evaluator) Results() []EvaluationResult {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+
+	results := make([]EvaluationResult, 0, len(ev.results))
+	for _, result := range ev.results {
+		results = append(results, result)
+	}
+	return results
+}
+
+// Prune forgets every patch that is no longer awaiting evaluation on chain
+func (ev *Evaluator) Prune(stillPending map[types.Hash]bool) {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+
+	for hash := range ev.results {
+		if !stillPending[hash] {
+			delete(ev.results, hash)
+		}
+	}
+}
+
+func (ev *Evaluator) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case tx := <-ev.queue:
+			result := EvaluationResult{
+				PatchTx:   tx.Hash,
+				Author:    tx.From,
+				ProblemID: tx.PatchSet.ProblemID,
+			}
+
+			evalCtx, cancel := context.WithTimeout(ctx, EvalTimeout)
+			passed, err := ev.evaluate(evalCtx, tx.PatchSet)
+			cancel()
+			if err != nil {
+				ev.logger.Warnf("Evaluation of patch %s failed: %v", tx.PatchSet.ID, err)
+			}
+			result.Passed = passed && err == nil
+
+			ev.mu.Lock()
+			delete(ev.pending, tx.Hash)
+			ev.results[tx.Hash] = result
+			ev.mu.Unlock()
+		}
+	}
+}
+
+// CheckPatch is the default EvaluateFunc. It only checks that the patch
+// carries code; a sandboxed test runner can be plugged in via SetEvaluator.
+func CheckPatch(ctx context.Context, patch *types.PatchSet) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if patch.ProblemID == "" {
+		return false, fmt.Errorf("patch %s names no problem", patch.ID)
+	}
+	if patch.EncodedArtifact != "" {
+		artifact, err := patch.Artifact()
+		if err != nil {
+			return false, err
+		}
+		return len(artifact) > 0, nil
+	}
+	if patch.Code == "" && len(patch.Files) == 0 {
+		return false, nil
+	}
+	return true, nil
+}
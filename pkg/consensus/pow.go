@@ -0,0 +1,46 @@
+package consensus
+
+import (
+	"fmt"
+	"time"
+
+	"agent-chain/pkg/crypto"
+	"agent-chain/pkg/types"
+)
+
+// mineCheckInterval is how many nonces are tried between checks for shutdown
+// or a competing block
+const mineCheckInterval = 1024
+
+// mine searches for a nonce that makes the block hash meet the next
+// difficulty. It reports false without an error when shutdown begins or
+// another block extends the chain first.
+func (e *Engine) mine(block *types.Block) (bool, error) {
+	difficulty, err := e.blockchain.NextDifficulty()
+	if err != nil {
+		return false, fmt.Errorf("failed to compute difficulty: %v", err)
+	}
+	block.Header.Difficulty = difficulty
+
+	// The public key is hashed, so it has to be in place before searching;
+	// computing the full hash once also fixes the merkle root
+	block.Header.PublicKey = crypto.PublicKeyToBytes(e.keyPair.PublicKey)
+	block.CalculateHash()
+
+	start := time.Now()
+	for nonce := int64(0); ; nonce++ {
+		if nonce%mineCheckInterval == 0 {
+			if e.ctx.Err() != nil || e.blockchain.GetHeight() >= block.Header.Height {
+				return false, nil
+			}
+		}
+
+		block.Header.Nonce = nonce
+		block.Header.Hash = block.Header.CalculateHash()
+		if block.Header.MeetsDifficulty() {
+			e.logger.Debugf("Mined block #%d at difficulty %d after %d attempts in %v",
+				block.Header.Height, difficulty, nonce+1, time.Since(start))
+			return true, nil
+		}
+	}
+}
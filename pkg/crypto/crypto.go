@@ -8,6 +8,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"math/big"
+	"strings"
 
 	"agent-chain/pkg/types"
 )
@@ -33,8 +34,14 @@ func GenerateKeyPair() (*KeyPair, error) {
 
 // GetAddress derives address from public key
 func (kp *KeyPair) GetAddress() types.Address {
-	pubKeyBytes := append(kp.PublicKey.X.Bytes(), kp.PublicKey.Y.Bytes()...)
-	hash := sha256.Sum256(pubKeyBytes)
+	return AddressFromPublicKey(kp.PublicKey)
+}
+
+// AddressFromPublicKey derives the address belonging to a public key
+func AddressFromPublicKey(pubKey *ecdsa.PublicKey) types.Address {
+	// Use the fixed-width encoding so keys whose coordinates have leading
+	// zero bytes cannot collide with other keys
+	hash := sha256.Sum256(PublicKeyToBytes(pubKey))
 
 	var addr types.Address
 	copy(addr[:], hash[12:]) // Take last 20 bytes
@@ -49,8 +56,16 @@ func (kp *KeyPair) Sign(data []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	// Encode signature as r||s
-	signature := append(r.Bytes(), s.Bytes()...)
+	// Both s and n-s verify; always emit the low one so a signature cannot
+	// be rewritten into a second valid encoding
+	if isHighS(kp.PrivateKey.Curve, s) {
+		s = new(big.Int).Sub(kp.PrivateKey.Curve.Params().N, s)
+	}
+
+	// Encode signature as r||s, each left-padded to 32 bytes
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
 	return signature, nil
 }
 
@@ -63,12 +78,123 @@ func VerifySignature(pubKey *ecdsa.PublicKey, data, signature []byte) bool {
 	hash := sha256.Sum256(data)
 	r := new(big.Int).SetBytes(signature[:32])
 	s := new(big.Int).SetBytes(signature[32:])
+	if isHighS(pubKey.Curve, s) {
+		return false
+	}
 
 	return ecdsa.Verify(pubKey, hash[:], r, s)
 }
 
-// PublicKeyFromBytes reconstructs public key from bytes
+// isHighS reports whether s lies in the upper half of the curve order
+func isHighS(curve elliptic.Curve, s *big.Int) bool {
+	halfOrder := new(big.Int).Rsh(curve.Params().N, 1)
+	return s.Cmp(halfOrder) > 0
+}
+
+// SignBlock records the key pair's public key in the block header, fixes the
+// block hash and signs it
+func (kp *KeyPair) SignBlock(block *types.Block) error {
+	block.Header.PublicKey = PublicKeyToBytes(kp.PublicKey)
+	block.Header.Hash = block.CalculateHash()
+
+	signature, err := kp.Sign(block.Header.Hash[:])
+	if err != nil {
+		return err
+	}
+	block.Header.Signature = signature
+	return nil
+}
+
+// VerifyBlockHeader checks that a header is signed by the key of its validator
+func VerifyBlockHeader(header *types.BlockHeader) error {
+	if len(header.Signature) == 0 {
+		return fmt.Errorf("block is not signed")
+	}
+
+	pubKey, err := PublicKeyFromBytes(header.PublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid proposer public key: %v", err)
+	}
+	if AddressFromPublicKey(pubKey) != header.Validator {
+		return fmt.Errorf("proposer public key does not match validator %s", header.Validator)
+	}
+	if !VerifySignature(pubKey, header.Hash[:], header.Signature) {
+		return fmt.Errorf("invalid proposer signature")
+	}
+	return nil
+}
+
+// SignTransaction records the key pair's public key in the transaction, signs
+// its canonical encoding and sets its hash; the sender must already be set
+func (kp *KeyPair) SignTransaction(tx *types.Transaction) error {
+	tx.PublicKey = PublicKeyToBytes(kp.PublicKey)
+
+	signature, err := kp.Sign(tx.CanonicalBytes())
+	if err != nil {
+		return err
+	}
+	tx.Signature = signature
+	tx.Hash = tx.CalculateHash()
+	return nil
+}
+
+// VerifyTransaction checks that a transaction is signed by the key of its sender
+func VerifyTransaction(tx *types.Transaction) error {
+	if len(tx.Signature) == 0 {
+		return fmt.Errorf("missing signature")
+	}
+
+	pubKey, err := PublicKeyFromBytes(tx.PublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid sender public key: %v", err)
+	}
+	if AddressFromPublicKey(pubKey) != tx.From {
+		return fmt.Errorf("sender public key does not match %s", tx.From)
+	}
+	if !VerifySignature(pubKey, tx.CanonicalBytes(), tx.Signature) {
+		return fmt.Errorf("invalid transaction signature")
+	}
+	return nil
+}
+
+// SignPatchSet records the key pair's public key in the patch set and signs
+// its signing bytes; the author must already be set
+func (kp *KeyPair) SignPatchSet(ps *types.PatchSet) error {
+	ps.PublicKey = PublicKeyToBytes(kp.PublicKey)
+
+	signature, err := kp.Sign(ps.SigningBytes())
+	if err != nil {
+		return err
+	}
+	ps.Signature = signature
+	return nil
+}
+
+// VerifyPatchSet checks that a patch set is signed by the key of its author
+func VerifyPatchSet(ps *types.PatchSet) error {
+	if len(ps.Signature) == 0 {
+		return fmt.Errorf("patch set is not signed")
+	}
+
+	pubKey, err := PublicKeyFromBytes(ps.PublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid patch author public key: %v", err)
+	}
+	if AddressFromPublicKey(pubKey) != ps.Author {
+		return fmt.Errorf("patch public key does not match author %s", ps.Author)
+	}
+	if !VerifySignature(pubKey, ps.SigningBytes(), ps.Signature) {
+		return fmt.Errorf("invalid patch signature")
+	}
+	return nil
+}
+
+// PublicKeyFromBytes reconstructs public key from bytes, accepting either the
+// 64-byte uncompressed form or the 33-byte compressed form
 func PublicKeyFromBytes(data []byte) (*ecdsa.PublicKey, error) {
+	if len(data) == compressedPublicKeyLen {
+		return PublicKeyFromCompressedBytes(data)
+	}
 	if len(data) != 64 {
 		return nil, fmt.Errorf("invalid public key length: %d", len(data))
 	}
@@ -76,6 +202,10 @@ func PublicKeyFromBytes(data []byte) (*ecdsa.PublicKey, error) {
 	x := new(big.Int).SetBytes(data[:32])
 	y := new(big.Int).SetBytes(data[32:])
 
+	if !elliptic.P256().IsOnCurve(x, y) {
+		return nil, fmt.Errorf("public key is not on curve")
+	}
+
 	pubKey := &ecdsa.PublicKey{
 		Curve: elliptic.P256(),
 		X:     x,
@@ -87,7 +217,41 @@ func PublicKeyFromBytes(data []byte) (*ecdsa.PublicKey, error) {
 
 // PublicKeyToBytes converts public key to bytes
 func PublicKeyToBytes(pubKey *ecdsa.PublicKey) []byte {
-	return append(pubKey.X.Bytes(), pubKey.Y.Bytes()...)
+	data := make([]byte, 64)
+	pubKey.X.FillBytes(data[:32])
+	pubKey.Y.FillBytes(data[32:])
+	return data
+}
+
+// compressedPublicKeyLen is the size of a SEC 1 compressed P256 point
+const compressedPublicKeyLen = 33
+
+// PublicKeyToCompressedBytes converts public key to its 33-byte compressed
+// form: a 0x02 or 0x03 prefix giving the parity of Y, followed by X
+func PublicKeyToCompressedBytes(pubKey *ecdsa.PublicKey) []byte {
+	return elliptic.MarshalCompressed(elliptic.P256(), pubKey.X, pubKey.Y)
+}
+
+// PublicKeyFromCompressedBytes reconstructs public key from its compressed
+// form, recovering Y from the curve equation
+func PublicKeyFromCompressedBytes(data []byte) (*ecdsa.PublicKey, error) {
+	if len(data) != compressedPublicKeyLen {
+		return nil, fmt.Errorf("invalid compressed public key length: %d", len(data))
+	}
+	if data[0] != 0x02 && data[0] != 0x03 {
+		return nil, fmt.Errorf("invalid compressed public key prefix: 0x%02x", data[0])
+	}
+
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), data)
+	if x == nil {
+		return nil, fmt.Errorf("public key is not on curve")
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     x,
+		Y:     y,
+	}, nil
 }
 
 // PrivateKeyToHex converts private key to hex string
@@ -122,20 +286,13 @@ func Hash256(data []byte) types.Hash {
 	return sha256.Sum256(data)
 }
 
-// AddressFromString parses address from hex string
+// AddressFromString parses address from hex string. It is the single entry
+// point for user-supplied addresses; the node RPC and the wallet both use it
+// so malformed input is rejected the same way everywhere.
 func AddressFromString(s string) (types.Address, error) {
 	var addr types.Address
 
-	// Remove 0x prefix if present
-	if len(s) >= 2 && s[:2] == "0x" {
-		s = s[2:]
-	}
-
-	if len(s) != 40 {
-		return addr, fmt.Errorf("invalid address length: %d", len(s))
-	}
-
-	bytes, err := hex.DecodeString(s)
+	bytes, err := decodeHex(s, len(addr), "address")
 	if err != nil {
 		return addr, err
 	}
@@ -144,15 +301,12 @@ func AddressFromString(s string) (types.Address, error) {
 	return addr, nil
 }
 
-// HashFromString parses hash from hex string
+// HashFromString parses hash from hex string, with the same rules as
+// AddressFromString
 func HashFromString(s string) (types.Hash, error) {
 	var hash types.Hash
 
-	if len(s) != 64 {
-		return hash, fmt.Errorf("invalid hash length: %d", len(s))
-	}
-
-	bytes, err := hex.DecodeString(s)
+	bytes, err := decodeHex(s, len(hash), "hash")
 	if err != nil {
 		return hash, err
 	}
@@ -160,3 +314,30 @@ func HashFromString(s string) (types.Hash, error) {
 	copy(hash[:], bytes)
 	return hash, nil
 }
+
+// decodeHex decodes a fixed-size hex value. Surrounding whitespace and a 0x
+// or 0X prefix are ignored; anything else that is not a hex digit is
+// reported with its position.
+func decodeHex(s string, size int, kind string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		s = s[2:]
+	}
+
+	for i, c := range s {
+		if !isHexDigit(c) {
+			return nil, fmt.Errorf("invalid %s: non-hex character %q at position %d", kind, c, i)
+		}
+	}
+
+	if len(s) != size*2 {
+		return nil, fmt.Errorf("invalid %s length: %d", kind, len(s))
+	}
+
+	return hex.DecodeString(s)
+}
+
+// isHexDigit reports whether c is a hex digit in either case
+func isHexDigit(c rune) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
@@ -0,0 +1,438 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"agent-chain/pkg/types"
+)
+
+func signedTransfer(t *testing.T) (*KeyPair, *types.Transaction) {
+	t.Helper()
+	kp, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+	tx := &types.Transaction{
+		Type:      types.TxTypeTransfer,
+		From:      kp.GetAddress(),
+		Amount:    10,
+		Fee:       1,
+		Timestamp: 1700000000,
+		ChainID:   1,
+	}
+	if err := kp.SignTransaction(tx); err != nil {
+		t.Fatalf("SignTransaction: %v", err)
+	}
+	return kp, tx
+}
+
+func TestVerifyTransaction(t *testing.T) {
+	_, tx := signedTransfer(t)
+	if err := VerifyTransaction(tx); err != nil {
+		t.Fatalf("valid transaction rejected: %v", err)
+	}
+	if tx.Hash != tx.CalculateHash() {
+		t.Errorf("SignTransaction did not set the hash")
+	}
+}
+
+func TestVerifyTransactionRejects(t *testing.T) {
+	other, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(tx *types.Transaction)
+		want   string
+	}{
+		{"unsigned", func(tx *types.Transaction) { tx.Signature = nil }, "missing signature"},
+		{"tampered amount", func(tx *types.Transaction) { tx.Amount = 1000 }, "invalid transaction signature"},
+		{"tampered nonce", func(tx *types.Transaction) { tx.Nonce++ }, "invalid transaction signature"},
+		{"missing key", func(tx *types.Transaction) { tx.PublicKey = nil }, "invalid sender public key"},
+		{"key of another sender", func(tx *types.Transaction) { tx.PublicKey = PublicKeyToBytes(other.PublicKey) }, "does not match"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, tx := signedTransfer(t)
+			tt.mutate(tx)
+			err := VerifyTransaction(tx)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignTransactionForgedSender(t *testing.T) {
+	victim, tx := signedTransfer(t)
+	attacker, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+
+	// Signing with another key while claiming the victim's address fails
+	if err := attacker.SignTransaction(tx); err != nil {
+		t.Fatalf("SignTransaction: %v", err)
+	}
+	if tx.From != victim.GetAddress() {
+		t.Fatalf("SignTransaction changed the sender")
+	}
+	if err := VerifyTransaction(tx); err == nil {
+		t.Fatal("transaction signed by another key was accepted")
+	}
+}
+
+func TestVerifyBlockHeader(t *testing.T) {
+	proposer, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+	mallory, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+
+	block := func(signer *KeyPair, validator types.Address) *types.Block {
+		b := &types.Block{Header: types.BlockHeader{Height: 1, Timestamp: 1700000000, Validator: validator}}
+		if err := signer.SignBlock(b); err != nil {
+			t.Fatalf("SignBlock: %v", err)
+		}
+		return b
+	}
+
+	if err := VerifyBlockHeader(&block(proposer, proposer.GetAddress()).Header); err != nil {
+		t.Fatalf("correctly signed block rejected: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		block func() *types.Block
+	}{
+		{"signed by another key", func() *types.Block {
+			return block(mallory, proposer.GetAddress())
+		}},
+		{"signature from another key", func() *types.Block {
+			b := block(proposer, proposer.GetAddress())
+			b.Header.Signature = block(mallory, proposer.GetAddress()).Header.Signature
+			return b
+		}},
+		{"header changed after signing", func() *types.Block {
+			b := block(proposer, proposer.GetAddress())
+			b.Header.Timestamp++
+			b.Header.Hash = b.CalculateHash()
+			return b
+		}},
+		{"unsigned", func() *types.Block {
+			b := block(proposer, proposer.GetAddress())
+			b.Header.Signature = nil
+			return b
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := VerifyBlockHeader(&tt.block().Header); err == nil {
+				t.Error("forged block accepted")
+			}
+		})
+	}
+}
+
+func TestSignatureLowS(t *testing.T) {
+	kp, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+	n := kp.PublicKey.Curve.Params().N
+	halfOrder := new(big.Int).Rsh(n, 1)
+
+	// Raw ECDSA gives a high S about half the time, so a few dozen
+	// signatures exercise the normalization
+	for i := 0; i < 32; i++ {
+		data := []byte{byte(i)}
+		sig, err := kp.Sign(data)
+		if err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+		s := new(big.Int).SetBytes(sig[32:])
+		if s.Cmp(halfOrder) > 0 {
+			t.Fatalf("signature %d has a high S", i)
+		}
+		if !VerifySignature(kp.PublicKey, data, sig) {
+			t.Fatalf("signature %d rejected", i)
+		}
+
+		// The same signature with n-s verifies under plain ECDSA but is refused
+		high := append([]byte(nil), sig...)
+		new(big.Int).Sub(n, s).FillBytes(high[32:])
+		if VerifySignature(kp.PublicKey, data, high) {
+			t.Errorf("high S form of signature %d accepted", i)
+		}
+	}
+}
+
+func TestSignDeterministicVectors(t *testing.T) {
+	// RFC 6979 appendix A.2.5: P-256 with SHA-256
+	kp, err := PrivateKeyFromHex("c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721")
+	if err != nil {
+		t.Fatalf("PrivateKeyFromHex: %v", err)
+	}
+	if got := hex.EncodeToString(kp.PublicKey.X.Bytes()); got != "60fed4ba255a9d31c961eb74c6356d68c049b8923b61fa6ce669622e60f29fb6" {
+		t.Fatalf("public key x = %s", got)
+	}
+
+	n := kp.PrivateKey.Curve.Params().N
+	tests := []struct {
+		message string
+		r, s    string
+	}{
+		{"sample", "efd48b2aacb6a8fd1140dd9cd45e81d69d2c877b56aaf991c34d0ea84eaf3716", "f7cb1c942d657c41d436c7a1b6e29f65f3e900dbb9aff4064dc4ab2f843acda8"},
+		{"test", "f1abb023518351cd71d881567b1ea663ed3efcf6c5132b354f28d3b0b7d38367", "019f4113742a2b14bd25926b49c649155f267e60d3814b4c0cc84250e46f0083"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			r, _ := new(big.Int).SetString(tt.r, 16)
+			s, _ := new(big.Int).SetString(tt.s, 16)
+			// Signatures are emitted with the low s
+			if isHighS(kp.PrivateKey.Curve, s) {
+				s.Sub(n, s)
+			}
+			want := make([]byte, 64)
+			r.FillBytes(want[:32])
+			s.FillBytes(want[32:])
+
+			got, err := kp.SignDeterministic([]byte(tt.message))
+			if err != nil {
+				t.Fatalf("SignDeterministic: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("signature = %x, want %x", got, want)
+			}
+			if again, _ := kp.SignDeterministic([]byte(tt.message)); !bytes.Equal(again, got) {
+				t.Error("signing twice gave different signatures")
+			}
+			if !VerifySignature(kp.PublicKey, []byte(tt.message), got) {
+				t.Error("deterministic signature does not verify")
+			}
+		})
+	}
+}
+
+func TestCompressedPublicKeyRoundTrip(t *testing.T) {
+	// Keep generating keys until both parities of Y have been seen
+	seen := map[byte]bool{}
+	for i := 0; len(seen) < 2; i++ {
+		if i == 64 {
+			t.Fatalf("only saw prefixes %v in %d keys", seen, i)
+		}
+		kp, err := GenerateKeyPair()
+		if err != nil {
+			t.Fatalf("GenerateKeyPair: %v", err)
+		}
+		pub := &kp.PrivateKey.PublicKey
+
+		compressed := PublicKeyToCompressedBytes(pub)
+		if len(compressed) != 33 {
+			t.Fatalf("compressed key is %d bytes, want 33", len(compressed))
+		}
+		wantPrefix := byte(0x02) + byte(pub.Y.Bit(0))
+		if compressed[0] != wantPrefix {
+			t.Fatalf("prefix 0x%02x for Y parity %d, want 0x%02x", compressed[0], pub.Y.Bit(0), wantPrefix)
+		}
+		seen[compressed[0]] = true
+
+		decoded, err := PublicKeyFromCompressedBytes(compressed)
+		if err != nil {
+			t.Fatalf("PublicKeyFromCompressedBytes: %v", err)
+		}
+		if !decoded.Equal(pub) {
+			t.Fatalf("prefix 0x%02x: decoded a different key", compressed[0])
+		}
+
+		// Either form is accepted where a public key is read
+		for _, data := range [][]byte{compressed, PublicKeyToBytes(pub)} {
+			decoded, err := PublicKeyFromBytes(data)
+			if err != nil || !decoded.Equal(pub) {
+				t.Fatalf("PublicKeyFromBytes(%d bytes) = %v", len(data), err)
+			}
+		}
+	}
+
+	kp, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+	valid := PublicKeyToCompressedBytes(&kp.PrivateKey.PublicKey)
+	invalid := map[string][]byte{
+		"uncompressed prefix": append([]byte{0x04}, valid[1:]...),
+		"x beyond the field":  append([]byte{0x02}, bytes.Repeat([]byte{0xff}, 32)...),
+		"truncated":           valid[:32],
+	}
+	for name, data := range invalid {
+		if _, err := PublicKeyFromCompressedBytes(data); err == nil {
+			t.Errorf("%s: decoded an invalid compressed key", name)
+		}
+	}
+}
+
+func signedPatch(t *testing.T) *types.PatchSet {
+	t.Helper()
+	kp, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+	ps := &types.PatchSet{
+		ID:        "patch-1",
+		ProblemID: "PROB-1",
+		Author:    kp.GetAddress(),
+		Code:      "func Add(a, b int) int { return a + b }",
+		Language:  "go",
+		Files:     map[string]string{"add.go": "package add", "add_test.go": "package add"},
+		Timestamp: 1700000000,
+	}
+	ps.CodeHash = ps.ComputeCodeHash()
+	if err := kp.SignPatchSet(ps); err != nil {
+		t.Fatalf("SignPatchSet: %v", err)
+	}
+	return ps
+}
+
+func TestPatchSetSignatureRoundTrip(t *testing.T) {
+	// The node verifies the patch after it has been through JSON
+	data, err := json.Marshal(signedPatch(t))
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var received types.PatchSet
+	if err := json.Unmarshal(data, &received); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if err := VerifyPatchSet(&received); err != nil {
+		t.Fatalf("VerifyPatchSet: %v", err)
+	}
+}
+
+func TestVerifyPatchSetRejects(t *testing.T) {
+	other, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(ps *types.PatchSet)
+		want   string
+	}{
+		{"unsigned", func(ps *types.PatchSet) { ps.Signature = nil }, "not signed"},
+		{"tampered code", func(ps *types.PatchSet) { ps.Code += "// changed" }, "invalid patch signature"},
+		{"tampered file", func(ps *types.PatchSet) { ps.Files["add.go"] = "package evil" }, "invalid patch signature"},
+		{"other problem", func(ps *types.PatchSet) { ps.ProblemID = "PROB-2" }, "invalid patch signature"},
+		{"claimed by another author", func(ps *types.PatchSet) { ps.Author = other.GetAddress() }, "does not match author"},
+		{"re-signed by another key", func(ps *types.PatchSet) {
+			if err := other.SignPatchSet(ps); err != nil {
+				t.Fatalf("SignPatchSet: %v", err)
+			}
+		}, "does not match author"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := signedPatch(t)
+			tt.mutate(ps)
+			err := VerifyPatchSet(ps)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddressFromString(t *testing.T) {
+	const hexAddr = "5a040a69c5f3ba8649d27101c192b22ad237c1b7"
+	want, err := hex.DecodeString(hexAddr)
+	if err != nil {
+		t.Fatalf("DecodeString: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{"bare", hexAddr, ""},
+		{"0x prefix", "0x" + hexAddr, ""},
+		{"0X prefix", "0X" + hexAddr, ""},
+		{"upper case digits", "0x" + strings.ToUpper(hexAddr), ""},
+		{"surrounding whitespace", " \t0x" + hexAddr + "\n", ""},
+		{"empty", "", "invalid address length: 0"},
+		{"prefix only", "0x", "invalid address length: 0"},
+		{"odd length", "0x" + hexAddr[:39], "invalid address length: 39"},
+		{"too long", "0x" + hexAddr + "00", "invalid address length: 42"},
+		{"hash sized", "0x" + hexAddr + hexAddr[:24], "invalid address length: 64"},
+		{"non-hex character", "0x" + hexAddr[:39] + "g", `non-hex character 'g' at position 39`},
+		{"embedded space", "0x" + hexAddr[:20] + " " + hexAddr[20:39], `non-hex character ' ' at position 20`},
+		{"double prefix", "0x0x" + hexAddr[:38], `non-hex character 'x' at position 1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := AddressFromString(tt.input)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("AddressFromString(%q) error = %v, want %q", tt.input, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AddressFromString(%q): %v", tt.input, err)
+			}
+			if !bytes.Equal(addr[:], want) {
+				t.Errorf("AddressFromString(%q) = %x, want %s", tt.input, addr, hexAddr)
+			}
+		})
+	}
+}
+
+func TestHashFromString(t *testing.T) {
+	want := types.NewHash([]byte("block"))
+	hexHash := hex.EncodeToString(want[:])
+
+	tests := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{"bare", hexHash, ""},
+		{"0x prefix", "0x" + hexHash, ""},
+		{"0X prefix", "0X" + strings.ToUpper(hexHash), ""},
+		{"surrounding whitespace", "  " + hexHash + " ", ""},
+		{"empty", "", "invalid hash length: 0"},
+		{"odd length", hexHash[:63], "invalid hash length: 63"},
+		{"address sized", hexHash[:40], "invalid hash length: 40"},
+		{"non-hex character", "0x" + hexHash[:10] + "z" + hexHash[11:], `non-hex character 'z' at position 10`},
+		{"embedded tab", hexHash[:32] + "\t" + hexHash[33:], `non-hex character '\t' at position 32`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := HashFromString(tt.input)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("HashFromString(%q) error = %v, want %q", tt.input, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("HashFromString(%q): %v", tt.input, err)
+			}
+			if hash != want {
+				t.Errorf("HashFromString(%q) = %x, want %s", tt.input, hash, hexHash)
+			}
+		})
+	}
+}
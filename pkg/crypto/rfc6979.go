@@ -0,0 +1,107 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+)
+
+// SignDeterministic signs data like Sign, but derives the nonce from the
+// private key and message as specified in RFC 6979 instead of reading it from
+// the system random source. Identical inputs always produce identical
+// signatures, which makes test vectors reproducible.
+func (kp *KeyPair) SignDeterministic(data []byte) ([]byte, error) {
+	hash := sha256.Sum256(data)
+
+	curve := kp.PrivateKey.Curve
+	n := curve.Params().N
+	d := kp.PrivateKey.D
+	e := new(big.Int).SetBytes(hash[:])
+
+	nonces := newRFC6979Nonces(n, d, hash[:])
+	for i := 0; i < 16; i++ {
+		k := nonces.next()
+
+		x, _ := curve.ScalarBaseMult(k.FillBytes(make([]byte, 32)))
+		r := new(big.Int).Mod(x, n)
+		if r.Sign() == 0 {
+			continue
+		}
+
+		// s = k^-1 (e + r*d) mod n
+		s := new(big.Int).Mul(r, d)
+		s.Add(s, e)
+		s.Mul(s, new(big.Int).ModInverse(k, n))
+		s.Mod(s, n)
+		if s.Sign() == 0 {
+			continue
+		}
+
+		if isHighS(curve, s) {
+			s.Sub(n, s)
+		}
+
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+		return signature, nil
+	}
+
+	return nil, fmt.Errorf("failed to derive a usable nonce")
+}
+
+// rfc6979Nonces generates the candidate nonces of RFC 6979 section 3.2 for a
+// 256-bit curve order and SHA-256
+type rfc6979Nonces struct {
+	n       *big.Int
+	k, v    []byte
+	started bool
+}
+
+func newRFC6979Nonces(n, d *big.Int, hash []byte) *rfc6979Nonces {
+	x := d.FillBytes(make([]byte, 32))
+	h := new(big.Int).Mod(new(big.Int).SetBytes(hash), n).FillBytes(make([]byte, 32))
+
+	g := &rfc6979Nonces{
+		n: n,
+		k: make([]byte, 32),
+		v: make([]byte, 32),
+	}
+	for i := range g.v {
+		g.v[i] = 0x01
+	}
+
+	g.k = g.mac(g.v, []byte{0x00}, x, h)
+	g.v = g.mac(g.v)
+	g.k = g.mac(g.v, []byte{0x01}, x, h)
+	g.v = g.mac(g.v)
+	return g
+}
+
+// next returns the next candidate nonce in [1, n-1]
+func (g *rfc6979Nonces) next() *big.Int {
+	for {
+		// Every candidate after the first reseeds K and V
+		if g.started {
+			g.k = g.mac(g.v, []byte{0x00})
+			g.v = g.mac(g.v)
+		}
+		g.started = true
+
+		g.v = g.mac(g.v)
+		k := new(big.Int).SetBytes(g.v)
+		if k.Sign() > 0 && k.Cmp(g.n) < 0 {
+			return k
+		}
+	}
+}
+
+// mac computes HMAC-SHA256 keyed with K over the concatenated parts
+func (g *rfc6979Nonces) mac(parts ...[]byte) []byte {
+	m := hmac.New(sha256.New, g.k)
+	for _, part := range parts {
+		m.Write(part)
+	}
+	return m.Sum(nil)
+}
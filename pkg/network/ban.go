@@ -0,0 +1,102 @@
+package network
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// DefaultBanDuration is how long a misbehaving peer is refused by default
+const DefaultBanDuration = time.Hour
+
+// BanPeer disconnects a peer and refuses connections from it until the ban expires
+func (n *Network) BanPeer(pid peer.ID, duration time.Duration) {
+	n.bansMu.Lock()
+	n.bans[pid] = time.Now().Add(duration)
+	n.bansMu.Unlock()
+
+	n.removePeer(pid)
+	if err := n.host.Network().ClosePeer(pid); err != nil {
+		n.logger.Debugf("Failed to close connections to banned peer %s: %v", pid, err)
+	}
+
+	n.logger.Warnf("Banned peer %s for %s", pid, duration)
+}
+
+// IsBanned reports whether a peer is currently banned, clearing expired bans
+func (n *Network) IsBanned(pid peer.ID) bool {
+	n.bansMu.RLock()
+	expiry, exists := n.bans[pid]
+	n.bansMu.RUnlock()
+
+	if !exists {
+		return false
+	}
+
+	if time.Now().After(expiry) {
+		n.bansMu.Lock()
+		if current, ok := n.bans[pid]; ok && current == expiry {
+			delete(n.bans, pid)
+		}
+		n.bansMu.Unlock()
+		return false
+	}
+
+	return true
+}
+
+// checkDial refuses outbound connections to banned peers and beyond the peer limit
+func (n *Network) checkDial(pid peer.ID) error {
+	if n.IsBanned(pid) {
+		return fmt.Errorf("peer %s is banned", pid)
+	}
+
+	if n.host.Network().Connectedness(pid) != network.Connected && len(n.host.Network().Peers()) >= n.maxPeers {
+		return fmt.Errorf("peer limit of %d reached", n.maxPeers)
+	}
+
+	return nil
+}
+
+// onConnected enforces bans and the peer limit on every new connection, including inbound ones
+func (n *Network) onConnected(net network.Network, conn network.Conn) {
+	pid := conn.RemotePeer()
+
+	// Notifiee callbacks must not block, so close asynchronously
+	if n.IsBanned(pid) {
+		go conn.Close()
+		return
+	}
+
+	if len(net.Peers()) > n.maxPeers {
+		n.logger.Debugf("Rejecting peer %s: peer limit of %d reached", pid, n.maxPeers)
+		go conn.Close()
+		return
+	}
+
+	go n.sendHandshake(pid)
+
+	// Without a handshake the peer is ready as soon as it connects
+	if _, ok := n.chainStatus(); !ok {
+		n.notifyPeer(true, pid)
+	}
+}
+
+// disconnectPeer closes every connection to a peer without banning it, so
+// it may reconnect once it is compatible
+func (n *Network) disconnectPeer(pid peer.ID) {
+	n.removePeer(pid)
+	if err := n.host.Network().ClosePeer(pid); err != nil {
+		n.logger.Debugf("Failed to close connections to peer %s: %v", pid, err)
+	}
+}
+
+// removePeer stops tracking a peer
+func (n *Network) removePeer(pid peer.ID) {
+	n.peersMu.Lock()
+	defer n.peersMu.Unlock()
+	delete(n.peers, pid)
+	delete(n.handshakes, pid)
+}
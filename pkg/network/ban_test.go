@@ -0,0 +1,69 @@
+package network
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// connected reports whether a has a live connection to b
+func connected(a, b *Network) func() bool {
+	return func() bool {
+		return a.host.Network().Connectedness(b.host.ID()) == network.Connected
+	}
+}
+
+func TestPeerLimit(t *testing.T) {
+	a, b, c := newTestNetwork(t), newTestNetwork(t), newTestNetwork(t)
+	a.maxPeers = 1
+
+	connect(t, b, a)
+	waitFor(t, "first peer", connected(a, b))
+
+	// An inbound connection over the cap is dropped by a
+	if err := c.ConnectToPeer(peerAddr(t, a)); err == nil {
+		waitFor(t, "connection over the cap to close", func() bool { return !connected(a, c)() })
+	}
+
+	// and a does not dial out past it
+	err := a.ConnectToPeer(peerAddr(t, c))
+	if err == nil || !strings.Contains(err.Error(), "peer limit") {
+		t.Errorf("dial over the cap: got %v", err)
+	}
+	if !connected(a, b)() {
+		t.Error("existing peer was dropped")
+	}
+}
+
+func TestBanExpires(t *testing.T) {
+	a, b := newTestNetwork(t), newTestNetwork(t)
+	connect(t, a, b)
+
+	const ban = 300 * time.Millisecond
+	a.BanPeer(b.host.ID(), ban)
+	if !a.IsBanned(b.host.ID()) {
+		t.Fatal("peer not banned")
+	}
+	waitFor(t, "banned peer to be disconnected", func() bool { return !connected(a, b)() })
+
+	if err := a.ConnectToPeer(peerAddr(t, b)); err == nil || !strings.Contains(err.Error(), "banned") {
+		t.Errorf("dial to banned peer: got %v", err)
+	}
+	if err := b.ConnectToPeer(peerAddr(t, a)); err == nil {
+		waitFor(t, "banned peer's connection to close", func() bool { return !connected(a, b)() })
+	}
+
+	time.Sleep(ban)
+	if a.IsBanned(b.host.ID()) {
+		t.Fatal("ban did not expire")
+	}
+	if err := a.ConnectToPeer(peerAddr(t, b)); err != nil {
+		t.Fatalf("dial after the ban expired: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if !connected(a, b)() {
+		t.Error("connection after the ban expired was dropped")
+	}
+}
@@ -2,8 +2,13 @@ package network
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -23,6 +28,14 @@ var DNSSeeds = []string{
 }
 
 // 硬编码种子节点 - 类似比特币的硬编码节点
+//
+// 种子地址格式:
+//   - 完整 multiaddr（推荐）: /ip4/1.2.3.4/tcp/9001/p2p/<peerID>
+//     也支持 /ip6/... 与 /dns4/<host>/... 形式
+//   - 旧格式 IP:port: 只有当 peerstore 已通过 identify 得知该地址对应的
+//     peer ID 时才能连接，因为 libp2p 拨号必须知道对方 peer ID
+//
+// DNS 种子除 A 记录外还会读取 "dnsaddr=<multiaddr>" 形式的 TXT 记录
 var HardcodedSeeds = []string{
 	"127.0.0.1:9001",  // 本地测试节点
 	"127.0.0.1:9002",  // 本地测试节点2
@@ -38,8 +51,26 @@ const (
 	PeerExchangeInterval  = 60 * time.Second
 	MaxAddressAge         = 24 * time.Hour
 	AddressExchangeCount  = 100
+	MaxSavedAddresses     = 1000
+	MinSavedQuality       = 10
+	PeersFileName         = "peers.json"
+	MinReconnectBackoff   = DiscoveryInterval
+	MaxReconnectBackoff   = time.Hour
 )
 
+// DNS 种子解析参数
+const (
+	DefaultSeedPort   = 9001            // DNS 种子 A 记录对应节点的默认端口
+	DNSLookupTimeout  = 5 * time.Second // 单次 DNS 查询的超时
+	DNSLookupAttempts = 2               // 每条记录最多查询次数（含首次）
+)
+
+// Resolver 抽象 DNS 查询；*net.Resolver 满足该接口，测试时可替换
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
 // PeerDiscovery 处理节点发现和连接管理
 type PeerDiscovery struct {
 	network     *Network
@@ -49,15 +80,33 @@ type PeerDiscovery struct {
 	addrsMu     sync.RWMutex
 	logger      *logrus.Logger
 	isBootstrap bool
+	dataDir     string
+	resolver    Resolver
+	seedPort    int
 }
 
 // AddressInfo 存储节点地址信息
 type AddressInfo struct {
-	Address   string
-	LastSeen  time.Time
-	Quality   int
-	Attempts  int
-	Success   int
+	Address     string    `json:"address"`
+	LastSeen    time.Time `json:"last_seen"`
+	Quality     int       `json:"quality"`
+	Attempts    int       `json:"attempts"`
+	Success     int       `json:"success"`
+	// 连续失败次数及退避结束时间，连接成功后清零
+	Failures    int       `json:"failures,omitempty"`
+	NextAttempt time.Time `json:"next_attempt,omitempty"`
+}
+
+// reconnectBackoff 返回连续失败 failures 次后的等待时间，每次翻倍直至上限
+func reconnectBackoff(failures int) time.Duration {
+	backoff := MinReconnectBackoff
+	for i := 1; i < failures && backoff < MaxReconnectBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > MaxReconnectBackoff {
+		backoff = MaxReconnectBackoff
+	}
+	return backoff
 }
 
 // AddressMessage P2P地址交换消息
@@ -67,7 +116,8 @@ type AddressMessage struct {
 }
 
 // NewPeerDiscovery 创建新的节点发现实例
-func NewPeerDiscovery(network *Network, isBootstrap bool, logger *logrus.Logger) *PeerDiscovery {
+// dataDir 非空时，从 peers.json 恢复上次运行积累的地址及质量分数
+func NewPeerDiscovery(network *Network, isBootstrap bool, dataDir string, logger *logrus.Logger) *PeerDiscovery {
 	ctx, cancel := context.WithCancel(context.Background())
 	
 	pd := &PeerDiscovery{
@@ -77,6 +127,14 @@ func NewPeerDiscovery(network *Network, isBootstrap bool, logger *logrus.Logger)
 		knownAddrs:  make(map[string]*AddressInfo),
 		logger:      logger,
 		isBootstrap: isBootstrap,
+		dataDir:     dataDir,
+		resolver:    net.DefaultResolver,
+		seedPort:    DefaultSeedPort,
+	}
+	
+	// 恢复持久化的地址
+	if err := pd.loadPeers(); err != nil {
+		logger.Warnf("Failed to load saved peers: %v", err)
 	}
 	
 	// 注册地址交换消息处理器
@@ -108,6 +166,83 @@ func (pd *PeerDiscovery) Start() error {
 // Stop 停止节点发现
 func (pd *PeerDiscovery) Stop() error {
 	pd.cancel()
+	return pd.savePeers()
+}
+
+// peersFile 返回地址持久化文件路径
+func (pd *PeerDiscovery) peersFile() string {
+	return filepath.Join(pd.dataDir, PeersFileName)
+}
+
+// savePeers 将已知地址写入 peers.json，丢弃低质量地址并限制文件大小
+func (pd *PeerDiscovery) savePeers() error {
+	if pd.dataDir == "" {
+		return nil
+	}
+	
+	pd.addrsMu.RLock()
+	var addresses []AddressInfo
+	for _, info := range pd.knownAddrs {
+		if info.Quality < MinSavedQuality {
+			continue
+		}
+		addresses = append(addresses, *info)
+	}
+	pd.addrsMu.RUnlock()
+	
+	// 优先保留质量高的地址
+	sort.Slice(addresses, func(i, j int) bool {
+		if addresses[i].Quality != addresses[j].Quality {
+			return addresses[i].Quality > addresses[j].Quality
+		}
+		return addresses[i].LastSeen.After(addresses[j].LastSeen)
+	})
+	if len(addresses) > MaxSavedAddresses {
+		addresses = addresses[:MaxSavedAddresses]
+	}
+	
+	data, err := json.MarshalIndent(addresses, "", "  ")
+	if err != nil {
+		return err
+	}
+	
+	if err := os.MkdirAll(pd.dataDir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(pd.peersFile(), data, 0644)
+}
+
+// loadPeers 从 peers.json 恢复已知地址
+func (pd *PeerDiscovery) loadPeers() error {
+	if pd.dataDir == "" {
+		return nil
+	}
+	
+	data, err := os.ReadFile(pd.peersFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	
+	var addresses []AddressInfo
+	if err := json.Unmarshal(data, &addresses); err != nil {
+		return err
+	}
+	
+	pd.addrsMu.Lock()
+	defer pd.addrsMu.Unlock()
+	
+	for i := range addresses {
+		info := addresses[i]
+		if info.Address == "" {
+			continue
+		}
+		pd.knownAddrs[info.Address] = &info
+	}
+	
+	pd.logger.Infof("Loaded %d saved peer addresses", len(addresses))
 	return nil
 }
 
@@ -128,27 +263,94 @@ func (pd *PeerDiscovery) initializeSeedNodes() {
 }
 
 // discoverFromDNS 从DNS种子发现节点
+// 各种子并发查询且每次查询都有超时，单个失效的 DNS 服务器不会拖住启动
 func (pd *PeerDiscovery) discoverFromDNS() []string {
+	results := make([][]string, len(DNSSeeds))
+	var wg sync.WaitGroup
+	for i, seed := range DNSSeeds {
+		wg.Add(1)
+		go func(i int, seed string) {
+			defer wg.Done()
+			results[i] = pd.resolveSeed(seed)
+		}(i, seed)
+	}
+	wg.Wait()
+
+	// 不同种子可能指向同一节点，去重时保持种子顺序
+	seen := make(map[string]bool)
 	var addresses []string
-	
-	for _, seed := range DNSSeeds {
-		ips, err := net.LookupHost(seed)
-		if err != nil {
-			pd.logger.Debugf("Failed to resolve DNS seed %s: %v", seed, err)
-			continue
+	for i, resolved := range results {
+		pd.logger.Infof("DNS seed %s resolved %d addresses", DNSSeeds[i], len(resolved))
+		for _, addr := range resolved {
+			if !seen[addr] {
+				seen[addr] = true
+				addresses = append(addresses, addr)
+			}
 		}
-		
-		for _, ip := range ips {
-			// 默认使用9001端口
-			addr := fmt.Sprintf("%s:9001", ip)
+	}
+
+	pd.logger.Infof("Discovered %d addresses from DNS seeds", len(addresses))
+	return addresses
+}
+
+// resolveSeed 查询单个种子的 TXT 与 A/AAAA 记录，丢弃无法解析的结果
+func (pd *PeerDiscovery) resolveSeed(seed string) []string {
+	var addresses []string
+
+	// TXT 记录可携带包含 peer ID 的完整 multiaddr
+	if records, err := pd.lookupWithRetry(seed, pd.resolver.LookupTXT); err == nil {
+		for _, record := range records {
+			if !strings.HasPrefix(record, "dnsaddr=") {
+				continue
+			}
+			addr := strings.TrimPrefix(record, "dnsaddr=")
+			if _, err := multiaddr.NewMultiaddr(addr); err != nil {
+				pd.logger.Debugf("Ignoring invalid dnsaddr %q from DNS seed %s: %v", addr, seed, err)
+				continue
+			}
 			addresses = append(addresses, addr)
 		}
 	}
-	
-	pd.logger.Infof("Discovered %d addresses from DNS seeds", len(addresses))
+
+	ips, err := pd.lookupWithRetry(seed, pd.resolver.LookupHost)
+	if err != nil {
+		pd.logger.Debugf("Failed to resolve DNS seed %s: %v", seed, err)
+		return addresses
+	}
+
+	for _, ip := range ips {
+		if net.ParseIP(ip) == nil {
+			pd.logger.Debugf("Ignoring invalid IP %q from DNS seed %s", ip, seed)
+			continue
+		}
+		addresses = append(addresses, net.JoinHostPort(ip, strconv.Itoa(pd.seedPort)))
+	}
 	return addresses
 }
 
+// lookupWithRetry 执行一次带超时的 DNS 查询，失败时重试；域名不存在时不再重试
+func (pd *PeerDiscovery) lookupWithRetry(name string, lookup func(context.Context, string) ([]string, error)) ([]string, error) {
+	var err error
+	for attempt := 0; attempt < DNSLookupAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(pd.ctx, DNSLookupTimeout)
+		var results []string
+		results, err = lookup(ctx, name)
+		cancel()
+		if err == nil {
+			return results, nil
+		}
+		if dnsErr, ok := err.(*net.DNSError); (ok && dnsErr.IsNotFound) || pd.ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, err
+}
+
+// SetSeedPort 设置 DNS 种子 A 记录对应节点的端口
+func (pd *PeerDiscovery) SetSeedPort(port int) {
+	pd.seedPort = port
+}
+
 // addKnownAddress 添加已知地址
 func (pd *PeerDiscovery) addKnownAddress(address string) {
 	pd.addrsMu.Lock()
@@ -163,6 +365,27 @@ func (pd *PeerDiscovery) addKnownAddress(address string) {
 	}
 }
 
+// addKnownAddressWithQuality 以指定的初始质量分数添加地址，已知地址的分数只升不降
+func (pd *PeerDiscovery) addKnownAddressWithQuality(address string, quality int) {
+	pd.addrsMu.Lock()
+	defer pd.addrsMu.Unlock()
+	
+	info, exists := pd.knownAddrs[address]
+	if !exists {
+		pd.knownAddrs[address] = &AddressInfo{
+			Address:  address,
+			LastSeen: time.Now(),
+			Quality:  quality,
+		}
+		return
+	}
+	
+	info.LastSeen = time.Now()
+	if info.Quality < quality {
+		info.Quality = quality
+	}
+}
+
 // discoveryLoop 发现循环
 func (pd *PeerDiscovery) discoveryLoop() {
 	ticker := time.NewTicker(DiscoveryInterval)
@@ -213,9 +436,15 @@ func (pd *PeerDiscovery) getCandidateAddresses(count int) []string {
 	
 	var candidates []string
 	var addresses []*AddressInfo
+	now := time.Now()
 	
 	// 收集所有地址
 	for _, info := range pd.knownAddrs {
+		// 跳过仍在退避期内的地址
+		if now.Before(info.NextAttempt) {
+			continue
+		}
+		
 		// 跳过已连接的节点
 		if pd.network.IsConnected(info.Address) {
 			continue
@@ -234,6 +463,11 @@ func (pd *PeerDiscovery) getCandidateAddresses(count int) []string {
 		addresses[i], addresses[j] = addresses[j], addresses[i]
 	})
 	
+	// 最近连续失败较少的地址优先
+	sort.SliceStable(addresses, func(i, j int) bool {
+		return addresses[i].Failures < addresses[j].Failures
+	})
+	
 	// 选择前N个
 	for i, addr := range addresses {
 		if i >= count {
@@ -261,8 +495,12 @@ func (pd *PeerDiscovery) attemptConnection(address string) bool {
 		return false
 	}
 	
-	// 尝试连接
-	err = pd.network.ConnectToPeerByMultiaddr(maddr)
+	// 尝试连接：带 peer ID 的地址直接拨号，否则通过 peerstore 查找
+	if _, idErr := maddr.ValueForProtocol(multiaddr.P_P2P); idErr == nil {
+		err = pd.network.ConnectToPeerByMultiaddr(maddr)
+	} else {
+		err = pd.network.ConnectToAddress(maddr)
+	}
 	if err != nil {
 		pd.logger.Debugf("Failed to connect to %s: %v", address, err)
 		pd.updateAddressQuality(address, false)
@@ -276,13 +514,38 @@ func (pd *PeerDiscovery) attemptConnection(address string) bool {
 
 // parseAddress 解析地址为multiaddr
 func (pd *PeerDiscovery) parseAddress(address string) (multiaddr.Multiaddr, error) {
-	// 简单的TCP地址解析
-	parts := strings.Split(address, ":")
-	if len(parts) != 2 {
+	return ParseSeedAddress(address)
+}
+
+// ParseSeedAddress 解析种子地址，支持完整 multiaddr 与旧的 IP:port 格式
+func ParseSeedAddress(address string) (multiaddr.Multiaddr, error) {
+	// 完整 multiaddr，例如 /ip4/1.2.3.4/tcp/9001/p2p/<peerID>
+	if strings.HasPrefix(address, "/") {
+		maddr, err := multiaddr.NewMultiaddr(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid multiaddr %s: %v", address, err)
+		}
+		if _, err := maddr.ValueForProtocol(multiaddr.P_TCP); err != nil {
+			return nil, fmt.Errorf("multiaddr %s has no tcp port", address)
+		}
+		return maddr, nil
+	}
+	
+	// 旧格式 host:port
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || host == "" || port == "" {
 		return nil, fmt.Errorf("invalid address format: %s", address)
 	}
 	
-	return multiaddr.NewMultiaddr(fmt.Sprintf("/ip4/%s/tcp/%s", parts[0], parts[1]))
+	proto := "dns4"
+	if ip := net.ParseIP(host); ip != nil {
+		proto = "ip4"
+		if ip.To4() == nil {
+			proto = "ip6"
+		}
+	}
+	
+	return multiaddr.NewMultiaddr(fmt.Sprintf("/%s/%s/tcp/%s", proto, host, port))
 }
 
 // updateAddressQuality 更新地址质量
@@ -301,11 +564,15 @@ func (pd *PeerDiscovery) updateAddressQuality(address string, success bool) {
 		if info.Quality > 100 {
 			info.Quality = 100
 		}
+		info.Failures = 0
+		info.NextAttempt = time.Time{}
 	} else {
 		info.Quality -= 5
 		if info.Quality < 0 {
 			info.Quality = 0
 		}
+		info.Failures++
+		info.NextAttempt = time.Now().Add(reconnectBackoff(info.Failures))
 	}
 	
 	info.LastSeen = time.Now()
@@ -344,8 +611,11 @@ func (pd *PeerDiscovery) exchangeAddresses() {
 
 // handleGetAddressMessage 处理地址请求消息
 func (pd *PeerDiscovery) handleGetAddressMessage(msg *Message, from peer.ID) error {
-	// 发送我们知道的地址
+	// 发送我们知道的地址，并附上本节点带 peer ID 的完整地址
 	addresses := pd.getRandomAddresses(AddressExchangeCount)
+	for _, addr := range pd.network.GetAddresses() {
+		addresses = append(addresses, fmt.Sprintf("%s/p2p/%s", addr, pd.network.GetID()))
+	}
 	
 	response := &Message{
 		Type: "addr",
@@ -413,20 +683,13 @@ func (pd *PeerDiscovery) getRandomAddresses(count int) []string {
 
 // isValidAddress 验证地址有效性
 func (pd *PeerDiscovery) isValidAddress(address string) bool {
-	// 基本格式检查
-	parts := strings.Split(address, ":")
-	if len(parts) != 2 {
-		return false
-	}
-	
-	// IP地址检查
-	ip := net.ParseIP(parts[0])
-	if ip == nil {
+	maddr, err := ParseSeedAddress(address)
+	if err != nil {
 		return false
 	}
 	
-	// 端口检查
-	if parts[1] == "" {
+	// 不记录自己的地址
+	if id, err := maddr.ValueForProtocol(multiaddr.P_P2P); err == nil && id == pd.network.GetID() {
 		return false
 	}
 	
@@ -459,6 +722,11 @@ func (pd *PeerDiscovery) maintainConnections() {
 	
 	// 清理过期地址
 	pd.cleanupOldAddresses()
+	
+	// 定期持久化地址
+	if err := pd.savePeers(); err != nil {
+		pd.logger.Warnf("Failed to save peers: %v", err)
+	}
 }
 
 // cleanupOldAddresses 清理过期地址
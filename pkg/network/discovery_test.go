@@ -0,0 +1,248 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// newTestDiscovery returns discovery for n that persists to dataDir
+func newTestDiscovery(t *testing.T, n *Network, dataDir string) *PeerDiscovery {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	pd := NewPeerDiscovery(n, false, dataDir, logger)
+	t.Cleanup(func() { pd.cancel() })
+	return pd
+}
+
+func TestPeersSaveAndReload(t *testing.T) {
+	n := newTestNetwork(t)
+	dataDir := t.TempDir()
+
+	pd := newTestDiscovery(t, n, dataDir)
+	pd.addKnownAddressWithQuality("/ip4/10.0.0.1/tcp/9001", 80)
+	pd.addKnownAddressWithQuality("10.0.0.2:9001", 40)
+	pd.addKnownAddressWithQuality("10.0.0.3:9001", MinSavedQuality-1)
+	pd.updateAddressQuality("10.0.0.2:9001", false)
+	if err := pd.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	reloaded := newTestDiscovery(t, n, dataDir)
+	if got := len(reloaded.knownAddrs); got != 2 {
+		t.Fatalf("reloaded %d addresses, want 2", got)
+	}
+	if info := reloaded.knownAddrs["/ip4/10.0.0.1/tcp/9001"]; info == nil || info.Quality != 80 {
+		t.Errorf("multiaddr reloaded as %+v, want quality 80", info)
+	}
+	info := reloaded.knownAddrs["10.0.0.2:9001"]
+	if info == nil || info.Quality != 35 || info.Failures != 1 || info.NextAttempt.IsZero() {
+		t.Errorf("failing address reloaded as %+v, want quality 35 and its backoff", info)
+	}
+	if _, kept := reloaded.knownAddrs["10.0.0.3:9001"]; kept {
+		t.Error("low quality address was saved")
+	}
+}
+
+func TestCandidatesSkipConnectedPeers(t *testing.T) {
+	a, b := newTestNetwork(t), newTestNetwork(t)
+	connect(t, a, b)
+
+	pd := newTestDiscovery(t, a, "")
+	_, port, _ := splitMultiaddr(b.host.Addrs()[0])
+	connected := []string{
+		fmt.Sprintf("/ip4/127.0.0.1/tcp/%d/p2p/%s", port, b.GetID()),
+		fmt.Sprintf("/ip4/10.9.9.9/tcp/1/p2p/%s", b.GetID()), // another address of the same peer
+		fmt.Sprintf("127.0.0.1:%d", port),
+	}
+	idle := "10.0.0.1:9001"
+	for _, addr := range append(connected, idle) {
+		pd.addKnownAddress(addr)
+	}
+
+	candidates := pd.getCandidateAddresses(10)
+	if len(candidates) != 1 || candidates[0] != idle {
+		t.Errorf("candidates = %v, want only %s", candidates, idle)
+	}
+}
+
+func TestParseSeedAddress(t *testing.T) {
+	const id = "12D3KooWEXT3F2wCmN515jh6sENZHdQuWdbAMRqymok8SRz6fY8V"
+
+	tests := []struct {
+		seed string
+		want string // empty when the seed is rejected
+	}{
+		{"/ip4/1.2.3.4/tcp/9001/p2p/" + id, "/ip4/1.2.3.4/tcp/9001/p2p/" + id},
+		{"/ip6/::1/tcp/9001/p2p/" + id, "/ip6/::1/tcp/9001/p2p/" + id},
+		{"/dns4/seed.example.org/tcp/9001/p2p/" + id, "/dns4/seed.example.org/tcp/9001/p2p/" + id},
+		{"/ip4/1.2.3.4/tcp/9001", "/ip4/1.2.3.4/tcp/9001"},
+		{"1.2.3.4:9001", "/ip4/1.2.3.4/tcp/9001"},
+		{"[::1]:9001", "/ip6/::1/tcp/9001"},
+		{"seed.example.org:9001", "/dns4/seed.example.org/tcp/9001"},
+		{"/ip4/1.2.3.4/udp/9001", ""},
+		{"/ip4/1.2.3.4/tcp/9001/p2p/not-a-peer-id", ""},
+		{"/not/a/multiaddr", ""},
+		{"1.2.3.4", ""},
+		{":9001", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		maddr, err := ParseSeedAddress(tt.seed)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("ParseSeedAddress(%q) = %s, want an error", tt.seed, maddr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSeedAddress(%q): %v", tt.seed, err)
+			continue
+		}
+		if maddr.String() != tt.want {
+			t.Errorf("ParseSeedAddress(%q) = %s, want %s", tt.seed, maddr, tt.want)
+		}
+	}
+}
+
+func TestFailingAddressDeprioritized(t *testing.T) {
+	pd := newTestDiscovery(t, newTestNetwork(t), "")
+	healthy, flaky, failing := "10.0.0.1:9001", "10.0.0.2:9001", "10.0.0.3:9001"
+	for _, addr := range []string{healthy, flaky, failing} {
+		pd.addKnownAddress(addr)
+	}
+	pd.updateAddressQuality(flaky, false)
+	for i := 0; i < 3; i++ {
+		pd.updateAddressQuality(failing, false)
+	}
+
+	// Both are still backing off
+	if candidates := pd.getCandidateAddresses(10); len(candidates) != 1 || candidates[0] != healthy {
+		t.Fatalf("candidates = %v, want only %s while the others back off", candidates, healthy)
+	}
+
+	// Once their backoff ends they are tried again, fewest failures first
+	pd.addrsMu.Lock()
+	for _, addr := range []string{flaky, failing} {
+		pd.knownAddrs[addr].NextAttempt = time.Now().Add(-time.Second)
+	}
+	pd.addrsMu.Unlock()
+	for i := 0; i < 10; i++ {
+		candidates := pd.getCandidateAddresses(10)
+		want := []string{healthy, flaky, failing}
+		if strings.Join(candidates, " ") != strings.Join(want, " ") {
+			t.Fatalf("candidates = %v, want %v", candidates, want)
+		}
+	}
+
+	// A successful connection clears the record
+	pd.updateAddressQuality(failing, true)
+	pd.addrsMu.RLock()
+	info := *pd.knownAddrs[failing]
+	pd.addrsMu.RUnlock()
+	if info.Failures != 0 || !info.NextAttempt.IsZero() {
+		t.Errorf("after a success: %d failures, next attempt %v; want both cleared", info.Failures, info.NextAttempt)
+	}
+}
+
+func TestReconnectBackoffDoubles(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, MinReconnectBackoff},
+		{2, 2 * MinReconnectBackoff},
+		{3, 4 * MinReconnectBackoff},
+		{4, 8 * MinReconnectBackoff},
+		{100, MaxReconnectBackoff},
+	}
+	for _, tt := range tests {
+		if got := reconnectBackoff(tt.failures); got != tt.want {
+			t.Errorf("backoff after %d failures = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+// fakeResolver answers DNS queries from fixed tables, failing each name's
+// first failures[name] lookups with a temporary error
+type fakeResolver struct {
+	mu       sync.Mutex
+	hosts    map[string][]string
+	txt      map[string][]string
+	failures map[string]int
+	calls    map[string]int
+}
+
+func (r *fakeResolver) lookup(ctx context.Context, kind, name string, table map[string][]string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls[kind+" "+name]++
+	if r.failures[kind+" "+name] > 0 {
+		r.failures[kind+" "+name]--
+		return nil, &net.DNSError{Err: "server misbehaving", Name: name, IsTemporary: true}
+	}
+	records, exists := table[name]
+	if !exists {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return records, nil
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return r.lookup(ctx, "A", host, r.hosts)
+}
+
+func (r *fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return r.lookup(ctx, "TXT", name, r.txt)
+}
+
+func TestDiscoverFromDNS(t *testing.T) {
+	seeds := DNSSeeds
+	DNSSeeds = []string{"seed1.example", "seed2.example", "flaky.example", "gone.example"}
+	t.Cleanup(func() { DNSSeeds = seeds })
+
+	const peerAddr = "/ip4/10.0.0.9/tcp/4001/p2p/12D3KooWEyoppNCUx8Yx66oV9fJnriXwCcXwDDUA2kj6vnc6iDEp"
+	resolver := &fakeResolver{
+		hosts: map[string][]string{
+			"seed1.example": {"10.0.0.1", "10.0.0.2"},
+			"seed2.example": {"10.0.0.2", "not-an-ip", "2001:db8::1"},
+			"flaky.example": {"10.0.0.3"},
+		},
+		txt: map[string][]string{
+			"seed1.example": {"dnsaddr=" + peerAddr, "dnsaddr=/bogus", "v=spf1 -all"},
+		},
+		failures: map[string]int{"A flaky.example": 1},
+		calls:    map[string]int{},
+	}
+
+	pd := newTestDiscovery(t, newTestNetwork(t), "")
+	pd.resolver = resolver
+	pd.SetSeedPort(7000)
+
+	want := []string{
+		peerAddr,
+		"10.0.0.1:7000",
+		"10.0.0.2:7000",
+		"[2001:db8::1]:7000",
+		"10.0.0.3:7000",
+	}
+	if got := pd.discoverFromDNS(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("discovered %v, want %v", got, want)
+	}
+
+	// A temporary failure is retried; a missing name is not
+	if n := resolver.calls["A flaky.example"]; n != 2 {
+		t.Errorf("flaky seed looked up %d times, want 2", n)
+	}
+	if n := resolver.calls["A gone.example"]; n != 1 {
+		t.Errorf("missing seed looked up %d times, want 1", n)
+	}
+}
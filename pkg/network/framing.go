@@ -0,0 +1,52 @@
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// frameHeaderSize is the size of the length and checksum preceding a payload
+const frameHeaderSize = 8
+
+// writeFrame writes the payload prefixed with its length and CRC-32 checksum
+func writeFrame(w io.Writer, payload []byte) error {
+	if len(payload) > MaxMessageSize {
+		return fmt.Errorf("message too large: %d bytes exceeds limit of %d", len(payload), MaxMessageSize)
+	}
+
+	frame := make([]byte, frameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(payload))
+	copy(frame[frameHeaderSize:], payload)
+
+	_, err := w.Write(frame)
+	return err
+}
+
+// readFrame reads one frame and returns its payload. A payload shorter than
+// its declared length or not matching its checksum is rejected, so a
+// truncated or corrupted message is never handed to the JSON decoder.
+func readFrame(r io.Reader) ([]byte, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("failed to read frame header: %v", err)
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length > MaxMessageSize {
+		return nil, fmt.Errorf("message too large: %d bytes exceeds limit of %d", length, MaxMessageSize)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("truncated message: expected %d bytes: %v", length, err)
+	}
+
+	if checksum := binary.BigEndian.Uint32(header[4:8]); crc32.ChecksumIEEE(payload) != checksum {
+		return nil, fmt.Errorf("message checksum mismatch")
+	}
+
+	return payload, nil
+}
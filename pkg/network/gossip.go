@@ -0,0 +1,122 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ErrSkipRelay is returned by a handler that accepted a gossip message but
+// does not want it forwarded, for example because it was already known
+var ErrSkipRelay = errors.New("skip relay")
+
+// gossipTopics maps the message types spread through the network over
+// GossipSub, rather than delivered only to direct peers, to their topics
+var gossipTopics = map[string]string{
+	MsgTypeBlock:       "blocks",
+	MsgTypeTransaction: "transactions",
+}
+
+// startGossip joins the gossip topics, registering a validator for each that
+// hands incoming messages to the message handlers; GossipSub forwards a
+// message only once its validator accepts it. Our own messages are sent to
+// every peer on the topic, not just the mesh, so a freshly produced block
+// does not wait for the mesh to form.
+func (n *Network) startGossip() error {
+	ps, err := pubsub.NewGossipSub(n.ctx, n.host,
+		pubsub.WithMaxMessageSize(MaxMessageSize),
+		pubsub.WithFloodPublish(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to start gossipsub: %v", err)
+	}
+	n.pubsub = ps
+
+	for msgType, name := range gossipTopics {
+		if err := ps.RegisterTopicValidator(name, n.gossipValidator(msgType)); err != nil {
+			return fmt.Errorf("failed to register validator for topic %s: %v", name, err)
+		}
+		topic, err := ps.Join(name)
+		if err != nil {
+			return fmt.Errorf("failed to join topic %s: %v", name, err)
+		}
+		sub, err := topic.Subscribe()
+		if err != nil {
+			return fmt.Errorf("failed to subscribe to topic %s: %v", name, err)
+		}
+		n.topics[msgType] = topic
+		go n.drainSubscription(sub)
+	}
+
+	return nil
+}
+
+// drainSubscription discards delivered messages, which were already handled
+// by the topic validator; the subscription only keeps this node in the mesh
+func (n *Network) drainSubscription(sub *pubsub.Subscription) {
+	defer sub.Cancel()
+	for {
+		if _, err := sub.Next(n.ctx); err != nil {
+			return
+		}
+	}
+}
+
+// gossipValidator handles a gossip message of the given type. Messages the
+// handler accepts are relayed and the rest are dropped.
+func (n *Network) gossipValidator(msgType string) pubsub.ValidatorEx {
+	return func(ctx context.Context, from peer.ID, psMsg *pubsub.Message) pubsub.ValidationResult {
+		// Our own messages were handled before they were published
+		if from == n.host.ID() {
+			return pubsub.ValidationAccept
+		}
+
+		if n.IsBanned(from) {
+			return pubsub.ValidationReject
+		}
+
+		// Nothing is handled until the peer has shown it is on our chain
+		if !n.handshakeComplete(from) {
+			return pubsub.ValidationIgnore
+		}
+
+		var msg Message
+		if err := json.Unmarshal(psMsg.Data, &msg); err != nil || msg.Type != msgType {
+			n.logger.Debugf("Rejected malformed %s gossip from peer %s", msgType, from)
+			return pubsub.ValidationReject
+		}
+
+		n.handlersMu.RLock()
+		handler, exists := n.handlers[msgType]
+		n.handlersMu.RUnlock()
+		if !exists {
+			return pubsub.ValidationIgnore
+		}
+
+		// Only propagate gossip that passed local handling, and only count it
+		// against the peer when the handler found it misbehaving
+		if err := handler(&msg, from); err != nil {
+			if err != ErrSkipRelay {
+				n.logger.Errorf("Handler error for message type %s: %v", msgType, err)
+			}
+			if n.IsBanned(from) {
+				return pubsub.ValidationReject
+			}
+			return pubsub.ValidationIgnore
+		}
+		return pubsub.ValidationAccept
+	}
+}
+
+// publish gossips an encoded message on the topic of its type
+func (n *Network) publish(msgType string, data []byte) error {
+	topic, exists := n.topics[msgType]
+	if !exists {
+		return fmt.Errorf("no gossip topic for message type %s", msgType)
+	}
+	return topic.Publish(n.ctx, data)
+}
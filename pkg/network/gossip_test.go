@@ -0,0 +1,177 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+)
+
+// newTestNetwork starts a network on a random local port
+func newTestNetwork(t *testing.T) *Network {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	n, err := NewNetwork(0, t.TempDir(), logger)
+	if err != nil {
+		t.Fatalf("NewNetwork: %v", err)
+	}
+	t.Cleanup(func() { n.Stop() })
+	return n
+}
+
+// peerAddr returns the loopback multiaddr of n, including its peer ID
+func peerAddr(t *testing.T, n *Network) string {
+	t.Helper()
+	for _, addr := range n.host.Addrs() {
+		if _, port, ok := splitMultiaddr(addr); ok {
+			return fmt.Sprintf("/ip4/127.0.0.1/tcp/%d/p2p/%s", port, n.host.ID())
+		}
+	}
+	t.Fatal("peer has no tcp address")
+	return ""
+}
+
+// connect dials b from a over loopback
+func connect(t *testing.T, a, b *Network) {
+	t.Helper()
+	if err := a.ConnectToPeer(peerAddr(t, b)); err != nil {
+		t.Fatalf("ConnectToPeer: %v", err)
+	}
+}
+
+// waitFor polls cond until it holds or the deadline passes
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// gossipMsg is the payload used by the gossip tests
+type gossipMsg struct {
+	ID   int  `json:"id"`
+	Skip bool `json:"skip"`
+}
+
+// recordMessages registers a handler for msgType that reports each message
+// it sees and declines to relay those marked skip
+func recordMessages(n *Network, msgType string) chan gossipMsg {
+	received := make(chan gossipMsg, 64)
+	n.RegisterHandler(msgType, func(msg *Message, from peer.ID) error {
+		var m gossipMsg
+		data, _ := json.Marshal(msg.Data)
+		if err := json.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		received <- m
+		if m.Skip {
+			return ErrSkipRelay
+		}
+		return nil
+	})
+	return received
+}
+
+// broadcastUntil publishes fresh messages from n until one with a relayable
+// payload reaches got; until the mesh forms, relays may not happen
+func broadcastUntil(t *testing.T, n *Network, msgType string, got chan gossipMsg) {
+	t.Helper()
+	deadline := time.After(10 * time.Second)
+	for id := 1; ; id++ {
+		if err := n.Broadcast(msgType, gossipMsg{ID: id}); err != nil {
+			t.Fatalf("Broadcast: %v", err)
+		}
+		select {
+		case <-got:
+			return
+		case <-time.After(250 * time.Millisecond):
+		case <-deadline:
+			t.Fatalf("%s gossip never arrived", msgType)
+		}
+	}
+}
+
+// drain discards anything already received
+func drain(got chan gossipMsg) {
+	for {
+		select {
+		case <-got:
+		default:
+			return
+		}
+	}
+}
+
+// line connects three networks as a - b - c
+func line(t *testing.T) (a, b, c *Network) {
+	a, b, c = newTestNetwork(t), newTestNetwork(t), newTestNetwork(t)
+	connect(t, a, b)
+	connect(t, b, c)
+	return a, b, c
+}
+
+func TestGossipReachesIndirectPeers(t *testing.T) {
+	a, b, c := line(t)
+	gotB := recordMessages(b, MsgTypeBlock)
+	gotC := recordMessages(c, MsgTypeBlock)
+
+	// b hears a straight away since our own messages are flood published
+	if err := a.Broadcast(MsgTypeBlock, gossipMsg{ID: 0}); err != nil {
+		t.Fatalf("Broadcast: %v", err)
+	}
+	select {
+	case <-gotB:
+	case <-time.After(10 * time.Second):
+		t.Fatal("b did not receive the block")
+	}
+
+	// c only hears a through b
+	broadcastUntil(t, a, MsgTypeBlock, gotC)
+	if a.host.Network().Connectedness(c.host.ID()) == network.Connected {
+		t.Error("a and c became directly connected")
+	}
+}
+
+func TestGossipNotRelayedWhenSkipped(t *testing.T) {
+	a, b, c := line(t)
+	gotB := recordMessages(b, MsgTypeTransaction)
+	gotC := recordMessages(c, MsgTypeTransaction)
+
+	// Wait until b relays to c, so silence below is down to the handler
+	broadcastUntil(t, a, MsgTypeTransaction, gotC)
+	drain(gotB)
+	drain(gotC)
+
+	if err := a.Broadcast(MsgTypeTransaction, gossipMsg{ID: -1, Skip: true}); err != nil {
+		t.Fatalf("Broadcast: %v", err)
+	}
+	for {
+		select {
+		case m := <-gotB:
+			if !m.Skip {
+				continue
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("b did not receive the transaction")
+		}
+		break
+	}
+	select {
+	case m := <-gotC:
+		if m.Skip {
+			t.Error("c received a transaction b declined to relay")
+		}
+	case <-time.After(time.Second):
+	}
+}
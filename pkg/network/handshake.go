@@ -0,0 +1,125 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"agent-chain/pkg/types"
+)
+
+// Handshake is exchanged when two peers connect so that nodes of another
+// chain are dropped before they can send blocks or transactions
+type Handshake struct {
+	Version     string     `json:"version"`
+	ChainID     int64      `json:"chain_id"`
+	GenesisHash types.Hash `json:"genesis_hash"`
+	Height      int64      `json:"height"`
+}
+
+// SetChainStatus supplies the local side of the handshake. Until it is set no
+// handshake is sent and messages are accepted from any peer.
+func (n *Network) SetChainStatus(status func() Handshake) {
+	n.peersMu.Lock()
+	defer n.peersMu.Unlock()
+	n.status = status
+}
+
+// chainStatus returns the local handshake, or false when none is configured
+func (n *Network) chainStatus() (Handshake, bool) {
+	n.peersMu.RLock()
+	status := n.status
+	n.peersMu.RUnlock()
+
+	if status == nil {
+		return Handshake{}, false
+	}
+	hs := status()
+	hs.Version = ProtocolID
+	return hs, true
+}
+
+// sendHandshake introduces this node to a newly connected peer
+func (n *Network) sendHandshake(pid peer.ID) {
+	hs, ok := n.chainStatus()
+	if !ok {
+		return
+	}
+	if err := n.SendToPeer(pid.String(), MsgTypeHandshake, hs); err != nil {
+		n.logger.Debugf("Failed to send handshake to peer %s: %v", pid, err)
+	}
+}
+
+// handleHandshake records a peer's handshake, banning peers of another chain
+// and disconnecting peers that speak an incompatible protocol version
+func (n *Network) handleHandshake(msg *Message, from peer.ID) error {
+	data, err := json.Marshal(msg.Data)
+	if err != nil {
+		return fmt.Errorf("invalid handshake data format")
+	}
+
+	var remote Handshake
+	if err := json.Unmarshal(data, &remote); err != nil {
+		return fmt.Errorf("failed to unmarshal handshake: %v", err)
+	}
+
+	local, ok := n.chainStatus()
+	if !ok {
+		return nil
+	}
+
+	if !compatibleVersion(remote.Version) {
+		n.logger.Warnf("Dropping peer %s: protocol version %q is not compatible with %s", from, remote.Version, ProtocolID)
+		n.disconnectPeer(from)
+		return nil
+	}
+
+	if remote.ChainID != local.ChainID || remote.GenesisHash != local.GenesisHash {
+		n.logger.Warnf("Dropping peer %s: chain %d genesis %s does not match local chain %d genesis %s",
+			from, remote.ChainID, remote.GenesisHash, local.ChainID, local.GenesisHash)
+		n.BanPeer(from, DefaultBanDuration)
+		return nil
+	}
+
+	// A repeated handshake only refreshes the peer's state; the peer is
+	// reported as connected once
+	n.peersMu.Lock()
+	_, repeated := n.handshakes[from]
+	n.handshakes[from] = &remote
+	n.peersMu.Unlock()
+	n.SetPeerHeight(from, remote.Height)
+	if !repeated {
+		n.notifyPeer(true, from)
+	}
+
+	n.logger.Debugf("Handshake with peer %s: version %s, height %d", from, remote.Version, remote.Height)
+	return nil
+}
+
+// compatibleVersion reports whether a peer speaking version can exchange
+// messages with us: it must be an agent-chain protocol with our major version
+func compatibleVersion(version string) bool {
+	prefix, local, _ := strings.Cut(strings.TrimPrefix(ProtocolID, "/"), "/")
+	name, remote, ok := strings.Cut(strings.TrimPrefix(version, "/"), "/")
+	if !ok || name != prefix {
+		return false
+	}
+
+	localMajor, _, _ := strings.Cut(local, ".")
+	remoteMajor, _, _ := strings.Cut(remote, ".")
+	return remoteMajor != "" && remoteMajor == localMajor
+}
+
+// handshakeComplete reports whether messages from a peer may be handled
+func (n *Network) handshakeComplete(pid peer.ID) bool {
+	n.peersMu.RLock()
+	defer n.peersMu.RUnlock()
+
+	if n.status == nil {
+		return true
+	}
+	_, done := n.handshakes[pid]
+	return done
+}
@@ -0,0 +1,78 @@
+package network
+
+import (
+	"testing"
+
+	"agent-chain/pkg/types"
+)
+
+// withChain makes n introduce itself as a node of the given chain
+func withChain(n *Network, chainID int64, genesis types.Hash) {
+	n.SetChainStatus(func() Handshake {
+		return Handshake{ChainID: chainID, GenesisHash: genesis, Height: 3}
+	})
+}
+
+func TestHandshakeDropsOtherChains(t *testing.T) {
+	genesis := types.NewHash([]byte("genesis"))
+
+	tests := []struct {
+		name    string
+		chainID int64
+		genesis types.Hash
+		dropped bool
+	}{
+		{"same chain", 1, genesis, false},
+		{"other genesis", 1, types.NewHash([]byte("other genesis")), true},
+		{"other chain id", 2, genesis, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := newTestNetwork(t), newTestNetwork(t)
+			withChain(a, 1, genesis)
+			withChain(b, tt.chainID, tt.genesis)
+			connect(t, a, b)
+
+			if tt.dropped {
+				waitFor(t, "peer of another chain to be dropped", func() bool { return !connected(a, b)() })
+				// Whichever side reads the other's handshake first bans it
+				if !a.IsBanned(b.host.ID()) && !b.IsBanned(a.host.ID()) {
+					t.Error("neither peer banned the other")
+				}
+				if a.handshakeComplete(b.host.ID()) {
+					t.Error("handshake with a peer of another chain completed")
+				}
+				return
+			}
+
+			waitFor(t, "handshake", func() bool { return a.handshakeComplete(b.host.ID()) })
+			peers := a.GetPeers()
+			if len(peers) != 1 || peers[0].Version != ProtocolID {
+				t.Fatalf("peers = %+v, want one with version %s", peers, ProtocolID)
+			}
+			if got := a.PeerHeight(b.host.ID()); got != 3 {
+				t.Errorf("peer height = %d, want the 3 from its handshake", got)
+			}
+		})
+	}
+}
+
+func TestCompatibleVersion(t *testing.T) {
+	tests := map[string]bool{
+		ProtocolID:            true,
+		"/agent-chain/2.5.1":  true,
+		"/agent-chain/2":      true,
+		"/agent-chain/1.0.0":  false,
+		"/agent-chain/3.0.0":  false,
+		"/other-chain/2.0.0":  false,
+		"/agent-chain":        false,
+		"/agent-chain/":       false,
+		"":                    false,
+		"/agent-chain/20.0.0": false,
+	}
+	for version, want := range tests {
+		if got := compatibleVersion(version); got != want {
+			t.Errorf("compatibleVersion(%q) = %v, want %v", version, got, want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package network
+
+import (
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
+)
+
+const (
+	// MDNSServiceTag identifies agent-chain nodes on the local network
+	MDNSServiceTag = "agent-chain"
+	// MDNSAddressQuality is the initial quality given to addresses found over mDNS
+	MDNSAddressQuality = 90
+)
+
+// mdnsNotifee feeds peers found over mDNS into peer discovery
+type mdnsNotifee struct {
+	n *Network
+}
+
+// HandlePeerFound records every address of a discovered peer and dials it
+func (m *mdnsNotifee) HandlePeerFound(info peer.AddrInfo) {
+	if info.ID == m.n.host.ID() || m.n.discovery == nil {
+		return
+	}
+
+	addresses := make([]string, 0, len(info.Addrs))
+	for _, addr := range info.Addrs {
+		address := fmt.Sprintf("%s/p2p/%s", addr, info.ID)
+		m.n.discovery.addKnownAddressWithQuality(address, MDNSAddressQuality)
+		addresses = append(addresses, address)
+	}
+
+	if m.n.host.Network().Connectedness(info.ID) == network.Connected {
+		return
+	}
+
+	m.n.logger.Infof("Discovered peer %s via mDNS", info.ID)
+	go func() {
+		for _, address := range addresses {
+			if m.n.discovery.attemptConnection(address) {
+				return
+			}
+		}
+		m.n.logger.Debugf("Failed to connect to mDNS peer %s", info.ID)
+	}()
+}
+
+// EnableMDNS starts advertising and discovering peers on the local network
+// under the given service tag
+func (n *Network) EnableMDNS(serviceTag string) error {
+	if n.mdns != nil {
+		return nil
+	}
+
+	service := mdns.NewMdnsService(n.host, serviceTag, &mdnsNotifee{n: n})
+	if err := service.Start(); err != nil {
+		return fmt.Errorf("failed to start mDNS: %v", err)
+	}
+
+	n.mdns = service
+	n.logger.Infof("mDNS discovery enabled with service tag %q", serviceTag)
+	return nil
+}
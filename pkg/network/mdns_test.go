@@ -0,0 +1,37 @@
+package network
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMDNSDiscoversLocalPeer(t *testing.T) {
+	a, b := newTestNetwork(t), newTestNetwork(t)
+
+	// A tag of our own keeps other nodes on the machine out of the test
+	tag := fmt.Sprintf("agent-chain-test-%d", time.Now().UnixNano())
+	for _, n := range []*Network{a, b} {
+		if err := n.EnableMDNS(tag); err != nil {
+			t.Fatalf("EnableMDNS: %v", err)
+		}
+	}
+
+	waitFor(t, "peers to find each other over mDNS", func() bool {
+		return connected(a, b)() && connected(b, a)()
+	})
+
+	// Addresses learned over mDNS are kept with their higher quality
+	a.discovery.addrsMu.RLock()
+	defer a.discovery.addrsMu.RUnlock()
+	found := false
+	for address, info := range a.discovery.knownAddrs {
+		if info.Quality >= MDNSAddressQuality && strings.HasSuffix(address, "/p2p/"+b.GetID()) {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("b's address was not recorded by discovery")
+	}
+}
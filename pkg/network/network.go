@@ -4,14 +4,19 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/libp2p/go-libp2p"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
 	"github.com/multiformats/go-multiaddr"
 	"github.com/sirupsen/logrus"
 
@@ -19,7 +24,10 @@ import (
 )
 
 const (
-	ProtocolID = "/agent-chain/1.0.0"
+	// ProtocolID names the stream protocol; 1.1.0 frames each message with
+	// its length and checksum, 1.2.0 adds the handshake, 2.0.0 gossips
+	// blocks and transactions over GossipSub instead of the stream
+	ProtocolID = "/agent-chain/2.0.0"
 )
 
 // Message types
@@ -29,8 +37,12 @@ const (
 	MsgTypeGetBlocks   = "get_blocks"
 	MsgTypeGetHeight   = "get_height"
 	MsgTypeHeight      = "height"
+	MsgTypeHandshake   = "handshake"
 )
 
+// MaxMessageSize bounds the size of a single message read from a stream
+const MaxMessageSize = 8 * 1024 * 1024
+
 // Message represents a network message
 type Message struct {
 	Type      string      `json:"type"`
@@ -50,13 +62,25 @@ type Network struct {
 	handlersMu sync.RWMutex
 	logger     *logrus.Logger
 	discovery  *PeerDiscovery
+	pubsub     *pubsub.PubSub
+	topics     map[string]*pubsub.Topic
+	bans       map[peer.ID]time.Time
+	bansMu     sync.RWMutex
+	maxPeers   int
+	mdns       mdns.Service
+	status     func() Handshake
+	handshakes map[peer.ID]*Handshake
+
+	callbacksMu  sync.RWMutex
+	onConnect    []PeerCallback
+	onDisconnect []PeerCallback
 }
 
 // MessageHandler handles incoming messages
 type MessageHandler func(msg *Message, from peer.ID) error
 
-// NewNetwork creates a new network instance
-func NewNetwork(port int, logger *logrus.Logger) (*Network, error) {
+// NewNetwork creates a new network instance; peer addresses are persisted in dataDir
+func NewNetwork(port int, dataDir string, logger *logrus.Logger) (*Network, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	// Create libp2p host
@@ -70,19 +94,35 @@ func NewNetwork(port int, logger *logrus.Logger) (*Network, error) {
 	}
 
 	n := &Network{
-		host:     h,
-		ctx:      ctx,
-		cancel:   cancel,
-		peers:    make(map[peer.ID]*types.NodeInfo),
-		handlers: make(map[string]MessageHandler),
-		logger:   logger,
+		host:       h,
+		ctx:        ctx,
+		cancel:     cancel,
+		peers:      make(map[peer.ID]*types.NodeInfo),
+		handlers:   make(map[string]MessageHandler),
+		logger:     logger,
+		topics:     make(map[string]*pubsub.Topic),
+		bans:       make(map[peer.ID]time.Time),
+		maxPeers:   MaxPeers,
+		handshakes: make(map[peer.ID]*Handshake),
 	}
 
 	// Set stream handler
 	h.SetStreamHandler(protocol.ID(ProtocolID), n.handleStream)
 
+	// Drop connections from banned peers and beyond the peer limit
+	h.Network().Notify(&network.NotifyBundle{
+		ConnectedF:    n.onConnected,
+		DisconnectedF: n.onDisconnected,
+	})
+
+	if err := n.startGossip(); err != nil {
+		h.Close()
+		cancel()
+		return nil, err
+	}
+
 	// Initialize peer discovery
-	n.discovery = NewPeerDiscovery(n, false, logger)
+	n.discovery = NewPeerDiscovery(n, false, dataDir, logger)
 
 	return n, nil
 }
@@ -101,6 +141,16 @@ func (n *Network) Start() error {
 
 // Stop stops the network
 func (n *Network) Stop() error {
+	if err := n.discovery.Stop(); err != nil {
+		n.logger.Warnf("Failed to save peers: %v", err)
+	}
+
+	if n.mdns != nil {
+		if err := n.mdns.Close(); err != nil {
+			n.logger.Warnf("Failed to stop mDNS: %v", err)
+		}
+	}
+
 	n.cancel()
 	return n.host.Close()
 }
@@ -131,6 +181,10 @@ func (n *Network) ConnectToPeer(addr string) error {
 		return fmt.Errorf("failed to get peer info: %v", err)
 	}
 
+	if err := n.checkDial(info.ID); err != nil {
+		return err
+	}
+
 	ctx, cancel := context.WithTimeout(n.ctx, 10*time.Second)
 	defer cancel()
 
@@ -138,17 +192,57 @@ func (n *Network) ConnectToPeer(addr string) error {
 		return fmt.Errorf("failed to connect to peer: %v", err)
 	}
 
-	n.peersMu.Lock()
-	n.peers[info.ID] = &types.NodeInfo{
-		ID:       info.ID.String(),
-		LastSeen: time.Now(),
-	}
-	n.peersMu.Unlock()
+	n.trackPeer(info.ID, maddr)
 
 	n.logger.Infof("Connected to peer: %s", info.ID)
 	return nil
 }
 
+// trackPeer records a connected peer together with the address it was reached at
+func (n *Network) trackPeer(pid peer.ID, maddr multiaddr.Multiaddr) {
+	ip, port, _ := splitMultiaddr(maddr)
+
+	n.peersMu.Lock()
+	defer n.peersMu.Unlock()
+
+	info, exists := n.peers[pid]
+	if !exists {
+		info = &types.NodeInfo{ID: pid.String()}
+		n.peers[pid] = info
+	}
+	if ip != "" {
+		info.Address = ip
+		info.Port = port
+	}
+	info.LastSeen = time.Now()
+}
+
+// splitMultiaddr extracts the IP and TCP port from a multiaddr
+func splitMultiaddr(maddr multiaddr.Multiaddr) (string, int, bool) {
+	if maddr == nil {
+		return "", 0, false
+	}
+
+	ip, err := maddr.ValueForProtocol(multiaddr.P_IP4)
+	if err != nil {
+		ip, err = maddr.ValueForProtocol(multiaddr.P_IP6)
+		if err != nil {
+			return "", 0, false
+		}
+	}
+
+	portStr, err := maddr.ValueForProtocol(multiaddr.P_TCP)
+	if err != nil {
+		return "", 0, false
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", 0, false
+	}
+
+	return ip, port, true
+}
+
 // RegisterHandler registers a message handler
 func (n *Network) RegisterHandler(msgType string, handler MessageHandler) {
 	n.handlersMu.Lock()
@@ -156,7 +250,8 @@ func (n *Network) RegisterHandler(msgType string, handler MessageHandler) {
 	n.handlers[msgType] = handler
 }
 
-// Broadcast sends a message to all connected peers
+// Broadcast sends a message to all connected peers. Blocks and transactions
+// are gossiped over GossipSub, so they reach peers we are not connected to.
 func (n *Network) Broadcast(msgType string, data interface{}) error {
 	msg := &Message{
 		Type:      msgType,
@@ -170,6 +265,10 @@ func (n *Network) Broadcast(msgType string, data interface{}) error {
 		return fmt.Errorf("failed to marshal message: %v", err)
 	}
 
+	if _, gossip := gossipTopics[msgType]; gossip {
+		return n.publish(msgType, msgData)
+	}
+
 	n.peersMu.RLock()
 	peers := make([]peer.ID, 0, len(n.peers))
 	for peerID := range n.peers {
@@ -221,7 +320,7 @@ func (n *Network) sendToPeer(peerID peer.ID, data []byte) error {
 	}
 	defer stream.Close()
 
-	if _, err := stream.Write(data); err != nil {
+	if err := writeFrame(stream, data); err != nil {
 		return fmt.Errorf("failed to write to stream: %v", err)
 	}
 
@@ -230,31 +329,49 @@ func (n *Network) sendToPeer(peerID peer.ID, data []byte) error {
 
 // handleStream handles incoming streams
 func (n *Network) handleStream(stream network.Stream) {
+	// Ignore anything a banned peer manages to send
+	if n.IsBanned(stream.Conn().RemotePeer()) {
+		stream.Reset()
+		return
+	}
 	defer stream.Close()
 
-	buf := make([]byte, 4096)
-	bytesRead, err := stream.Read(buf)
+	data, err := readFrame(stream)
 	if err != nil {
-		n.logger.Errorf("Failed to read from stream: %v", err)
+		n.logger.Errorf("Rejected message from peer %s: %v", stream.Conn().RemotePeer(), err)
 		return
 	}
 
 	var msg Message
-	if err := json.Unmarshal(buf[:bytesRead], &msg); err != nil {
+	if err := json.Unmarshal(data, &msg); err != nil {
 		n.logger.Errorf("Failed to unmarshal message: %v", err)
 		return
 	}
 
 	// Update peer info
 	peerID := stream.Conn().RemotePeer()
-	n.peersMu.Lock()
-	if _, exists := n.peers[peerID]; !exists {
-		n.peers[peerID] = &types.NodeInfo{
-			ID: peerID.String(),
+	n.peersMu.RLock()
+	_, known := n.peers[peerID]
+	n.peersMu.RUnlock()
+	if known {
+		// Keep the dialed address rather than the inbound ephemeral port
+		n.trackPeer(peerID, nil)
+	} else {
+		n.trackPeer(peerID, stream.Conn().RemoteMultiaddr())
+	}
+
+	if msg.Type == MsgTypeHandshake {
+		if err := n.handleHandshake(&msg, peerID); err != nil {
+			n.logger.Errorf("Rejected handshake from peer %s: %v", peerID, err)
 		}
+		return
+	}
+
+	// Nothing else is handled until the peer has shown it is on our chain
+	if !n.handshakeComplete(peerID) {
+		n.logger.Debugf("Ignoring %s message from peer %s before handshake", msg.Type, peerID)
+		return
 	}
-	n.peers[peerID].LastSeen = time.Now()
-	n.peersMu.Unlock()
 
 	// Handle message
 	n.handlersMu.RLock()
@@ -262,7 +379,7 @@ func (n *Network) handleStream(stream network.Stream) {
 	n.handlersMu.RUnlock()
 
 	if exists {
-		if err := handler(&msg, peerID); err != nil {
+		if err := handler(&msg, peerID); err != nil && err != ErrSkipRelay {
 			n.logger.Errorf("Handler error for message type %s: %v", msg.Type, err)
 		}
 	} else {
@@ -275,9 +392,14 @@ func (n *Network) GetPeers() []*types.NodeInfo {
 	n.peersMu.RLock()
 	defer n.peersMu.RUnlock()
 
+	// Copy the entries; they keep being updated as peers are seen
 	peers := make([]*types.NodeInfo, 0, len(n.peers))
-	for _, peer := range n.peers {
-		peers = append(peers, peer)
+	for pid, peer := range n.peers {
+		peerCopy := *peer
+		if hs, ok := n.handshakes[pid]; ok {
+			peerCopy.Version = hs.Version
+		}
+		peers = append(peers, &peerCopy)
 	}
 	return peers
 }
@@ -289,6 +411,41 @@ func (n *Network) GetPeerCount() int {
 	return len(n.peers)
 }
 
+// SetPeerHeight records the chain height a connected peer reported
+func (n *Network) SetPeerHeight(pid peer.ID, height int64) {
+	n.peersMu.Lock()
+	defer n.peersMu.Unlock()
+
+	if info, exists := n.peers[pid]; exists {
+		info.Height = height
+	}
+}
+
+// PeerHeight returns the last height a connected peer reported, or zero
+func (n *Network) PeerHeight(pid peer.ID) int64 {
+	n.peersMu.RLock()
+	defer n.peersMu.RUnlock()
+
+	if info, exists := n.peers[pid]; exists {
+		return info.Height
+	}
+	return 0
+}
+
+// HighestPeerHeight returns the greatest height reported by a connected peer
+func (n *Network) HighestPeerHeight() int64 {
+	n.peersMu.RLock()
+	defer n.peersMu.RUnlock()
+
+	var highest int64
+	for _, info := range n.peers {
+		if info.Height > highest {
+			highest = info.Height
+		}
+	}
+	return highest
+}
+
 // RequestHeight requests height from a peer
 func (n *Network) RequestHeight(peerID string) error {
 	return n.SendToPeer(peerID, MsgTypeGetHeight, nil)
@@ -309,6 +466,10 @@ func (n *Network) ConnectToPeerByMultiaddr(maddr multiaddr.Multiaddr) error {
 		return fmt.Errorf("failed to get peer info: %v", err)
 	}
 
+	if err := n.checkDial(info.ID); err != nil {
+		return err
+	}
+
 	// Connect to peer
 	ctx, cancel := context.WithTimeout(n.ctx, 30*time.Second)
 	defer cancel()
@@ -318,14 +479,99 @@ func (n *Network) ConnectToPeerByMultiaddr(maddr multiaddr.Multiaddr) error {
 		return fmt.Errorf("failed to connect to peer: %v", err)
 	}
 
+	n.trackPeer(info.ID, maddr)
+
 	n.logger.Infof("Connected to peer %s", info.ID)
 	return nil
 }
 
-// IsConnected checks if we're connected to a specific address
+// ConnectToAddress connects to a peer known only by address. libp2p cannot
+// dial without the remote peer ID, so this looks the address up among peers
+// the peerstore has learned about (e.g. through identify).
+func (n *Network) ConnectToAddress(maddr multiaddr.Multiaddr) error {
+	host, port, ok := splitMultiaddr(maddr)
+	if !ok {
+		return fmt.Errorf("address %s has no ip and tcp port", maddr)
+	}
+
+	for _, pid := range n.host.Peerstore().Peers() {
+		if pid == n.host.ID() {
+			continue
+		}
+		for _, known := range n.host.Peerstore().Addrs(pid) {
+			ip, knownPort, ok := splitMultiaddr(known)
+			if ok && ip == host && knownPort == port {
+				full, err := multiaddr.NewMultiaddr(fmt.Sprintf("%s/p2p/%s", known, pid))
+				if err != nil {
+					return err
+				}
+				return n.ConnectToPeerByMultiaddr(full)
+			}
+		}
+	}
+
+	return fmt.Errorf("peer ID for %s is unknown; use a /p2p/<peerID> multiaddr", maddr)
+}
+
+// IsConnected checks if we're connected to a specific address, given either
+// as "ip:port" or as a multiaddr
 func (n *Network) IsConnected(address string) bool {
-	// Simple check - in a real implementation, you'd parse the address
-	// and check against connected peers
+	var host string
+	var port int
+
+	if strings.HasPrefix(address, "/") {
+		maddr, err := multiaddr.NewMultiaddr(address)
+		if err != nil {
+			return false
+		}
+
+		// A peer ID identifies the peer regardless of the address used
+		if id, err := maddr.ValueForProtocol(multiaddr.P_P2P); err == nil {
+			pid, err := peer.Decode(id)
+			return err == nil && n.host.Network().Connectedness(pid) == network.Connected
+		}
+
+		var ok bool
+		host, port, ok = splitMultiaddr(maddr)
+		if !ok {
+			return false
+		}
+	} else {
+		h, portStr, err := net.SplitHostPort(address)
+		if err != nil {
+			return false
+		}
+		p, err := strconv.Atoi(portStr)
+		if err != nil {
+			return false
+		}
+		host, port = h, p
+	}
+
+	// Peers we dialed are tracked with the address used to reach them
+	n.peersMu.RLock()
+	var candidates []peer.ID
+	for pid, info := range n.peers {
+		if info.Address == host && info.Port == port {
+			candidates = append(candidates, pid)
+		}
+	}
+	n.peersMu.RUnlock()
+
+	for _, pid := range candidates {
+		if n.host.Network().Connectedness(pid) == network.Connected {
+			return true
+		}
+	}
+
+	// Fall back to the remote addresses of live connections
+	for _, conn := range n.host.Network().Conns() {
+		ip, connPort, ok := splitMultiaddr(conn.RemoteMultiaddr())
+		if ok && ip == host && connPort == port {
+			return true
+		}
+	}
+
 	return false
 }
 
@@ -351,6 +597,14 @@ func (n *Network) EnableBootstrapMode() {
 	}
 }
 
+// SetDNSSeedPort sets the port dialed on addresses resolved from DNS seeds;
+// it must be called before Start
+func (n *Network) SetDNSSeedPort(port int) {
+	if n.discovery != nil {
+		n.discovery.SetSeedPort(port)
+	}
+}
+
 // GetDiscoveryStats returns peer discovery statistics
 func (n *Network) GetDiscoveryStats() map[string]interface{} {
 	if n.discovery != nil {
@@ -0,0 +1,51 @@
+package network
+
+import (
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// PeerCallback is notified of a peer joining or leaving
+type PeerCallback func(pid peer.ID)
+
+// OnPeerConnected registers fn to run when a peer becomes ready to exchange
+// messages: once its handshake is accepted or, when no chain status is set,
+// as soon as it connects. Callbacks run on their own goroutine.
+func (n *Network) OnPeerConnected(fn PeerCallback) {
+	n.callbacksMu.Lock()
+	defer n.callbacksMu.Unlock()
+	n.onConnect = append(n.onConnect, fn)
+}
+
+// OnPeerDisconnected registers fn to run when the last connection to a peer
+// closes. Callbacks run on their own goroutine.
+func (n *Network) OnPeerDisconnected(fn PeerCallback) {
+	n.callbacksMu.Lock()
+	defer n.callbacksMu.Unlock()
+	n.onDisconnect = append(n.onDisconnect, fn)
+}
+
+// notifyPeer runs the callbacks registered for a peer event
+func (n *Network) notifyPeer(connected bool, pid peer.ID) {
+	n.callbacksMu.RLock()
+	callbacks := n.onDisconnect
+	if connected {
+		callbacks = n.onConnect
+	}
+	callbacks = append([]PeerCallback(nil), callbacks...)
+	n.callbacksMu.RUnlock()
+
+	for _, fn := range callbacks {
+		go fn(pid)
+	}
+}
+
+// onDisconnected forgets a peer and reports it as gone once no connection
+// to it remains; a later reconnect starts over with a new handshake
+func (n *Network) onDisconnected(net network.Network, conn network.Conn) {
+	pid := conn.RemotePeer()
+	if net.Connectedness(pid) != network.Connected {
+		n.removePeer(pid)
+		n.notifyPeer(false, pid)
+	}
+}
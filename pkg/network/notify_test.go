@@ -0,0 +1,94 @@
+package network
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"agent-chain/pkg/types"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// peerEvents records the peers reported to the connect and disconnect
+// callbacks of a network
+type peerEvents struct {
+	mu           sync.Mutex
+	connected    []peer.ID
+	disconnected []peer.ID
+}
+
+func watchPeers(n *Network) *peerEvents {
+	ev := &peerEvents{}
+	n.OnPeerConnected(func(pid peer.ID) {
+		ev.mu.Lock()
+		defer ev.mu.Unlock()
+		ev.connected = append(ev.connected, pid)
+	})
+	n.OnPeerDisconnected(func(pid peer.ID) {
+		ev.mu.Lock()
+		defer ev.mu.Unlock()
+		ev.disconnected = append(ev.disconnected, pid)
+	})
+	return ev
+}
+
+func (ev *peerEvents) counts() (int, int) {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	return len(ev.connected), len(ev.disconnected)
+}
+
+func TestPeerCallbacksFire(t *testing.T) {
+	genesis := types.NewHash([]byte("genesis"))
+
+	tests := []struct {
+		name      string
+		handshake bool
+	}{
+		{"without chain status", false},
+		{"after handshake", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := newTestNetwork(t), newTestNetwork(t)
+			if tt.handshake {
+				withChain(a, 1, genesis)
+				withChain(b, 1, genesis)
+			}
+			ev := watchPeers(a)
+
+			connect(t, b, a)
+			waitFor(t, "connect callback", func() bool {
+				n, _ := ev.counts()
+				return n > 0
+			})
+
+			// Give a duplicate notification time to show up
+			time.Sleep(200 * time.Millisecond)
+			ev.mu.Lock()
+			got := append([]peer.ID(nil), ev.connected...)
+			ev.mu.Unlock()
+			if len(got) != 1 || got[0] != b.host.ID() {
+				t.Fatalf("connect callbacks = %v, want once for %s", got, b.host.ID())
+			}
+			if tt.handshake && !a.handshakeComplete(b.host.ID()) {
+				t.Error("connect callback fired before the handshake completed")
+			}
+
+			if err := a.host.Network().ClosePeer(b.host.ID()); err != nil {
+				t.Fatalf("ClosePeer: %v", err)
+			}
+			waitFor(t, "disconnect callback", func() bool {
+				_, n := ev.counts()
+				return n > 0
+			})
+			ev.mu.Lock()
+			gone := append([]peer.ID(nil), ev.disconnected...)
+			ev.mu.Unlock()
+			if len(gone) != 1 || gone[0] != b.host.ID() {
+				t.Errorf("disconnect callbacks = %v, want once for %s", gone, b.host.ID())
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package types
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// DefaultDecimals is the number of decimal places of one token
+const DefaultDecimals = 6
+
+// maxDecimals keeps 10^decimals within int64
+const maxDecimals = 18
+
+// ParseAmount converts a decimal token amount such as "1.5" into base units.
+// The conversion is exact: no floating point is involved, and digits beyond
+// the token's precision are only accepted when they are zeros.
+func ParseAmount(s string, decimals int) (int64, error) {
+	if decimals < 0 || decimals > maxDecimals {
+		return 0, fmt.Errorf("unsupported decimals: %d", decimals)
+	}
+
+	s = strings.TrimSpace(s)
+	whole, frac, _ := strings.Cut(s, ".")
+	if (whole == "" && frac == "") || !isDigits(whole) || !isDigits(frac) {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	trimmed := strings.TrimRight(frac, "0")
+	if len(trimmed) > decimals {
+		return 0, fmt.Errorf("amount %q has more than %d decimal places", s, decimals)
+	}
+	frac = trimmed + strings.Repeat("0", decimals-len(trimmed))
+
+	units, ok := new(big.Int).SetString(whole+frac, 10)
+	if !ok || !units.IsInt64() {
+		return 0, fmt.Errorf("amount %q is out of range", s)
+	}
+	return units.Int64(), nil
+}
+
+// FormatAmount renders an amount in base units as a decimal token amount,
+// without trailing zeros after the decimal point
+func FormatAmount(amount int64, decimals int) string {
+	if decimals <= 0 {
+		return fmt.Sprintf("%d", amount)
+	}
+
+	digits := new(big.Int).Abs(big.NewInt(amount)).String()
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+
+	whole := digits[:len(digits)-decimals]
+	frac := strings.TrimRight(digits[len(digits)-decimals:], "0")
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+	}
+	if frac == "" {
+		return sign + whole
+	}
+	return sign + whole + "." + frac
+}
+
+// isDigits reports whether s consists only of ASCII digits
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
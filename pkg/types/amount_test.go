@@ -0,0 +1,79 @@
+package types
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in       string
+		decimals int
+		want     int64
+		wantErr  bool
+	}{
+		{"1.5", 6, 1_500_000, false},
+		{"1", 6, 1_000_000, false},
+		{"1.", 6, 1_000_000, false},
+		{".5", 6, 500_000, false},
+		{"0.000001", 6, 1, false},
+		{"1.500000000", 6, 1_500_000, false},
+		{" 2.25 ", 6, 2_250_000, false},
+		{"007", 2, 700, false},
+		{"42", 0, 42, false},
+		{"9223372036854.775807", 6, math.MaxInt64, false},
+		{"9223372036854.775808", 6, 0, true},
+		{"0.0000001", 6, 0, true},
+		{"1.5", 0, 0, true},
+		{"", 6, 0, true},
+		{".", 6, 0, true},
+		{"-1", 6, 0, true},
+		{"1e6", 6, 0, true},
+		{"1.2.3", 6, 0, true},
+		{"1,5", 6, 0, true},
+		{"1", 19, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.in, tt.decimals)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseAmount(%q, %d) = %d, want an error", tt.in, tt.decimals, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseAmount(%q, %d) = %d, %v; want %d", tt.in, tt.decimals, got, err, tt.want)
+		}
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		decimals int
+		want     string
+	}{
+		{1_500_000, 6, "1.5"},
+		{1_000_000, 6, "1"},
+		{1, 6, "0.000001"},
+		{0, 6, "0"},
+		{10, 1, "1"},
+		{123_456_789, 6, "123.456789"},
+		{-2_500_000, 6, "-2.5"},
+		{42, 0, "42"},
+		{math.MaxInt64, 6, "9223372036854.775807"},
+		{math.MinInt64, 6, "-9223372036854.775808"},
+	}
+	for _, tt := range tests {
+		if got := FormatAmount(tt.amount, tt.decimals); got != tt.want {
+			t.Errorf("FormatAmount(%d, %d) = %q, want %q", tt.amount, tt.decimals, got, tt.want)
+		}
+	}
+
+	// Formatting and parsing back gives the same base units
+	for _, amount := range []int64{0, 1, 10, 999_999, 1_000_000, 1_234_500, math.MaxInt64} {
+		if got, err := ParseAmount(FormatAmount(amount, 6), 6); err != nil || got != amount {
+			t.Errorf("round trip of %d gave %d, %v", amount, got, err)
+		}
+	}
+}
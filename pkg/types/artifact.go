@@ -0,0 +1,27 @@
+package types
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// SetArtifact stores binary patch content base64-encoded, so it survives
+// JSON encoding byte for byte
+func (ps *PatchSet) SetArtifact(data []byte, contentType string) {
+	ps.EncodedArtifact = base64.StdEncoding.EncodeToString(data)
+	ps.ContentType = contentType
+}
+
+// Artifact returns the decoded binary content of the patch, or nil when the
+// patch carries none
+func (ps *PatchSet) Artifact() ([]byte, error) {
+	if ps.EncodedArtifact == "" {
+		return nil, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(ps.EncodedArtifact)
+	if err != nil {
+		return nil, fmt.Errorf("invalid patch artifact: %v", err)
+	}
+	return data, nil
+}
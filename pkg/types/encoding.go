@@ -0,0 +1,159 @@
+package types
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+)
+
+// TxEncodingVersion prefixes the canonical transaction encoding. It must be
+// bumped whenever the encoded fields or their order change.
+const TxEncodingVersion = 5
+
+// CanonicalBytes returns the encoding of a transaction that its hash is
+// computed over. Unlike the JSON form it does not depend on struct layout or
+// tags: fields are written in a fixed order, integers as 8-byte big-endian,
+// strings and byte slices with a 4-byte big-endian length prefix, addresses
+// and hashes as raw bytes, optional values behind a 0/1 presence byte, lists
+// with a 4-byte count and maps sorted by key. The hash, signature, public key
+// and gas used are not part of the encoding, so it is also what the sender
+// signs.
+func (tx *Transaction) CanonicalBytes() []byte {
+	e := &canonicalEncoder{}
+	e.buf.WriteByte(TxEncodingVersion)
+
+	e.string(tx.Type)
+	e.raw(tx.From[:])
+	e.raw(tx.To[:])
+	e.int64(tx.Amount)
+	e.int64(tx.Fee)
+
+	e.present(tx.PatchSet != nil)
+	if ps := tx.PatchSet; ps != nil {
+		e.string(ps.ID)
+		e.string(ps.ProblemID)
+		e.raw(ps.Author[:])
+		e.string(ps.Code)
+		e.string(ps.Language)
+		e.stringMap(ps.Files)
+		e.int64(ps.Timestamp)
+		e.bytes(ps.Signature)
+		e.bytes(ps.PublicKey)
+		e.string(ps.CodeHash)
+		e.string(ps.EncodedArtifact)
+		e.string(ps.ContentType)
+	}
+
+	e.present(tx.Problem != nil)
+	if p := tx.Problem; p != nil {
+		e.string(p.ID)
+		e.string(p.Title)
+		e.string(p.Description)
+		e.stringMap(p.InputFormat)
+		e.stringMap(p.OutputFormat)
+		e.count(len(p.AcceptanceCriteria))
+		for _, criterion := range p.AcceptanceCriteria {
+			e.string(criterion)
+		}
+		e.int64(p.TimeLimitMs)
+		e.int64(p.MemoryLimitMb)
+		e.int64(p.Reward)
+		e.count(len(p.TestSuite))
+		for _, test := range p.TestSuite {
+			e.string(test.Input)
+			e.string(test.Expected)
+			e.int64(int64(test.Weight))
+		}
+	}
+
+	e.string(tx.ProblemID)
+	e.present(tx.PatchTx != nil)
+	if tx.PatchTx != nil {
+		e.raw(tx.PatchTx[:])
+	}
+	e.int64(tx.Timestamp)
+	e.int64(tx.Nonce)
+	e.int64(tx.ChainID)
+	e.int64(tx.GasLimit)
+	e.int64(tx.ValidUntil)
+
+	return e.buf.Bytes()
+}
+
+// patchSigningDomain keeps a patch signature from being valid for any other
+// kind of signed data
+const patchSigningDomain = "agent-chain patch set"
+
+// SigningBytes returns what the author of a patch set signs: its fields in
+// the canonical form, behind a domain prefix. The signature and public key
+// are left out, so the wallet and the node compute the same bytes before and
+// after signing.
+func (ps *PatchSet) SigningBytes() []byte {
+	e := &canonicalEncoder{}
+	e.string(patchSigningDomain)
+	e.string(ps.ID)
+	e.string(ps.ProblemID)
+	e.raw(ps.Author[:])
+	e.string(ps.Code)
+	e.string(ps.Language)
+	e.stringMap(ps.Files)
+	e.int64(ps.Timestamp)
+	e.string(ps.CodeHash)
+	e.string(ps.EncodedArtifact)
+	e.string(ps.ContentType)
+	return e.buf.Bytes()
+}
+
+// canonicalEncoder accumulates the canonical encoding of a value
+type canonicalEncoder struct {
+	buf bytes.Buffer
+}
+
+func (e *canonicalEncoder) raw(data []byte) {
+	e.buf.Write(data)
+}
+
+func (e *canonicalEncoder) int64(v int64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	e.buf.Write(b[:])
+}
+
+func (e *canonicalEncoder) count(n int) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(n))
+	e.buf.Write(b[:])
+}
+
+func (e *canonicalEncoder) bytes(data []byte) {
+	e.count(len(data))
+	e.buf.Write(data)
+}
+
+func (e *canonicalEncoder) string(s string) {
+	e.count(len(s))
+	e.buf.WriteString(s)
+}
+
+func (e *canonicalEncoder) present(ok bool) {
+	if ok {
+		e.buf.WriteByte(1)
+	} else {
+		e.buf.WriteByte(0)
+	}
+}
+
+// stringMap writes a map as a count followed by its entries sorted by key
+func (e *canonicalEncoder) stringMap(m map[string]string) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	e.count(len(keys))
+	for _, k := range keys {
+		e.string(k)
+		e.string(m[k])
+	}
+}
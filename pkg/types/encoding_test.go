@@ -0,0 +1,91 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// vectorTx is the transaction behind the fixed hash vector. Its hash was
+// checked against an independent implementation of the encoding.
+func vectorTx() *Transaction {
+	patchTx := Hash{0xaa}
+	return &Transaction{
+		Type:       TxTypeTransfer,
+		From:       Address{0x11, 0x22},
+		To:         Address{0x33},
+		Amount:     1_500_000,
+		Fee:        10,
+		ProblemID:  "p1",
+		PatchTx:    &patchTx,
+		Timestamp:  1700000000,
+		Nonce:      7,
+		ChainID:    1337,
+		ValidUntil: 12345,
+	}
+}
+
+const vectorTxHash = "a3f3a983de9379b4a4ecfd81f8f8fe7a72fdb397b5409a0f13c6d8d621821336"
+
+func TestTransactionHashVector(t *testing.T) {
+	tx := vectorTx()
+	if got := tx.CalculateHash().String(); got != vectorTxHash {
+		t.Fatalf("hash = %s, want %s; bump TxEncodingVersion if the encoding changed on purpose", got, vectorTxHash)
+	}
+
+	// Fields outside the encoding leave the hash alone
+	tx.Signature = []byte{1, 2, 3}
+	tx.PublicKey = []byte{4, 5, 6}
+	tx.GasUsed = 99
+	tx.Hash = Hash{0xff}
+	if got := tx.CalculateHash().String(); got != vectorTxHash {
+		t.Errorf("hash with signature and receipt fields set = %s, want %s", got, vectorTxHash)
+	}
+
+	// So does a trip through the wire format
+	data, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var decoded Transaction
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got := decoded.CalculateHash().String(); got != vectorTxHash {
+		t.Errorf("hash after JSON round trip = %s, want %s", got, vectorTxHash)
+	}
+}
+
+func TestTransactionHashCoversFields(t *testing.T) {
+	mutations := map[string]func(*Transaction){
+		"type":        func(tx *Transaction) { tx.Type = TxTypeStake },
+		"from":        func(tx *Transaction) { tx.From[19] = 1 },
+		"to":          func(tx *Transaction) { tx.To[19] = 1 },
+		"amount":      func(tx *Transaction) { tx.Amount++ },
+		"fee":         func(tx *Transaction) { tx.Fee++ },
+		"problem id":  func(tx *Transaction) { tx.ProblemID = "p2" },
+		"no patch tx": func(tx *Transaction) { tx.PatchTx = nil },
+		"timestamp":   func(tx *Transaction) { tx.Timestamp++ },
+		"nonce":       func(tx *Transaction) { tx.Nonce++ },
+		"chain id":    func(tx *Transaction) { tx.ChainID++ },
+		"gas limit":   func(tx *Transaction) { tx.GasLimit++ },
+		"valid until": func(tx *Transaction) { tx.ValidUntil++ },
+		"patch set":   func(tx *Transaction) { tx.PatchSet = &PatchSet{} },
+		"problem":     func(tx *Transaction) { tx.Problem = &ProblemSpec{} },
+	}
+	for name, mutate := range mutations {
+		tx := vectorTx()
+		mutate(tx)
+		if tx.CalculateHash().String() == vectorTxHash {
+			t.Errorf("changing the %s does not change the hash", name)
+		}
+	}
+
+	// Length prefixes keep adjacent strings from running into each other
+	a := &PatchSet{ID: "ab", ProblemID: "c"}
+	b := &PatchSet{ID: "a", ProblemID: "bc"}
+	txA, txB := vectorTx(), vectorTx()
+	txA.PatchSet, txB.PatchSet = a, b
+	if txA.CalculateHash() == txB.CalculateHash() {
+		t.Error("patch ids and problem ids split differently hash the same")
+	}
+}
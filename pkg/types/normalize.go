@@ -0,0 +1,260 @@
+package types
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// syntax is what normalization needs to know about a language: how its
+// comments look, which literals to leave alone and whether indentation matters
+type syntax struct {
+	lineComment   string // runs to the end of the line
+	blockComments bool   // '/* */'
+	quotes        string // open string literals with backslash escapes
+	rawQuotes     string // open string literals without escapes
+	tripleQuotes  bool   // a tripled quote opens a literal closed by the same
+	charLiterals  bool   // '\'' encloses a single, possibly escaped, character
+	indented      bool   // indentation is part of the program structure
+}
+
+var (
+	pythonSyntax = syntax{lineComment: "#", quotes: `"'`, tripleQuotes: true, indented: true}
+	hashSyntax   = syntax{lineComment: "#", quotes: `"'`}
+	shellSyntax  = syntax{lineComment: "#", quotes: "\"`", rawQuotes: "'"}
+	cSyntax      = syntax{lineComment: "//", blockComments: true, quotes: `"`, charLiterals: true}
+	jvmSyntax    = syntax{lineComment: "//", blockComments: true, quotes: `"`, tripleQuotes: true, charLiterals: true}
+	jsSyntax     = syntax{lineComment: "//", blockComments: true, quotes: "\"'`"}
+)
+
+// languageSyntax holds the known languages; patches in any other language are
+// compared ignoring whitespace alone
+var languageSyntax = map[string]syntax{
+	"python":     pythonSyntax,
+	"py":         pythonSyntax,
+	"ruby":       hashSyntax,
+	"perl":       hashSyntax,
+	"r":          hashSyntax,
+	"shell":      shellSyntax,
+	"sh":         shellSyntax,
+	"bash":       shellSyntax,
+	"go":         {lineComment: "//", blockComments: true, quotes: `"`, rawQuotes: "`", charLiterals: true},
+	"c":          cSyntax,
+	"cpp":        cSyntax,
+	"c++":        cSyntax,
+	"csharp":     cSyntax,
+	"rust":       cSyntax,
+	"java":       jvmSyntax,
+	"kotlin":     jvmSyntax,
+	"swift":      {lineComment: "//", blockComments: true, quotes: `"`, tripleQuotes: true},
+	"javascript": jsSyntax,
+	"js":         jsSyntax,
+	"typescript": jsSyntax,
+	"ts":         jsSyntax,
+}
+
+// NormalizedHash hashes the patch's code and files with comments and
+// insignificant whitespace removed, so that trivially edited copies of a
+// solution hash the same. Comments are only recognized for known languages;
+// binary and unknown patches are compared ignoring whitespace alone. File
+// names are not hashed.
+func (ps *PatchSet) NormalizedHash() Hash {
+	language := strings.ToLower(ps.Language)
+
+	parts := make([]string, 0, len(ps.Files))
+	for _, content := range ps.Files {
+		parts = append(parts, normalizeCode(content, language))
+	}
+	sort.Strings(parts)
+
+	var b strings.Builder
+	b.WriteString(normalizeCode(ps.Code, language))
+	for _, part := range parts {
+		// Separate parts so that content cannot shift between them
+		b.WriteByte(0)
+		b.WriteString(part)
+	}
+	// Artifacts are compared byte for byte
+	if artifact, err := ps.Artifact(); err == nil && len(artifact) > 0 {
+		b.WriteByte(0)
+		b.Write(artifact)
+	}
+	return NewHash([]byte(b.String()))
+}
+
+// normalizeCode strips comments and insignificant whitespace for the
+// language. String and character literals are kept as written, and so is the
+// nesting of lines in languages where indentation matters.
+func normalizeCode(code, language string) string {
+	syn, known := languageSyntax[language]
+	if !known {
+		return stripSpace(code)
+	}
+
+	n := &normalizer{syntax: syn, src: code, indents: []int{0}, lineStart: true}
+	n.run()
+	return n.out.String()
+}
+
+// stripSpace drops every whitespace character
+func stripSpace(code string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, code)
+}
+
+// maxEscapeLen bounds the escape sequence in a character literal, '\U0001F600'
+// being the longest
+const maxEscapeLen = 10
+
+// normalizer scans source code once, copying what is significant to out
+type normalizer struct {
+	syntax
+	src       string
+	pos       int
+	out       strings.Builder
+	indents   []int // widths of the open indentation levels, innermost last
+	depth     int   // open brackets, inside which indentation is insignificant
+	lineStart bool
+}
+
+// run normalizes the whole source into out
+func (n *normalizer) run() {
+	for n.pos < len(n.src) {
+		if n.lineStart {
+			n.lineStart = false
+			if n.indented && n.depth == 0 {
+				n.indent()
+				continue
+			}
+		}
+
+		rest := n.src[n.pos:]
+		c := rest[0]
+		switch {
+		case n.lineComment != "" && strings.HasPrefix(rest, n.lineComment):
+			// Leave the newline to end the line
+			if end := strings.IndexByte(rest, '\n'); end >= 0 {
+				n.pos += end
+			} else {
+				n.pos = len(n.src)
+			}
+		case n.blockComments && strings.HasPrefix(rest, "/*"):
+			// An unterminated comment runs to the end
+			if end := strings.Index(rest[2:], "*/"); end >= 0 {
+				n.pos += 2 + end + 2
+			} else {
+				n.pos = len(n.src)
+			}
+		case strings.IndexByte(n.quotes, c) >= 0:
+			n.literal(c, true)
+		case strings.IndexByte(n.rawQuotes, c) >= 0:
+			n.literal(c, false)
+		case c == '\'' && n.charLiterals && n.charLiteral():
+		case c == '\n':
+			n.pos++
+			n.lineStart = true
+		case c == '\\' && n.indented && strings.HasPrefix(rest, "\\\n"):
+			// An explicit line join continues the logical line
+			n.pos += 2
+		default:
+			r, size := utf8.DecodeRuneInString(rest)
+			n.pos += size
+			if unicode.IsSpace(r) {
+				continue
+			}
+			if n.indented {
+				switch r {
+				case '(', '[', '{':
+					n.depth++
+				case ')', ']', '}':
+					if n.depth > 0 {
+						n.depth--
+					}
+				}
+			}
+			n.out.WriteRune(r)
+		}
+	}
+}
+
+// literal copies a string literal opened by quote as written, including its
+// quotes; an unterminated one runs to the end
+func (n *normalizer) literal(quote byte, escapes bool) {
+	delim := string(quote)
+	if triple := strings.Repeat(delim, 3); n.tripleQuotes && strings.HasPrefix(n.src[n.pos:], triple) {
+		delim = triple
+	}
+
+	end := n.pos + len(delim)
+	for end < len(n.src) && !strings.HasPrefix(n.src[end:], delim) {
+		if escapes && n.src[end] == '\\' {
+			end++
+		}
+		end++
+	}
+	end = min(end+len(delim), len(n.src))
+
+	n.out.WriteString(n.src[n.pos:end])
+	n.pos = end
+}
+
+// charLiteral copies a character literal such as 'a' or '\n' as written. It
+// reports false for a quote that does not open one, like a Rust lifetime.
+func (n *normalizer) charLiteral() bool {
+	rest := n.src[n.pos+1:]
+
+	var size int
+	if strings.HasPrefix(rest, `\`) && len(rest) > 2 {
+		size = strings.IndexByte(rest[2:], '\'') + 2
+		if size < 2 || size > maxEscapeLen {
+			return false
+		}
+	} else {
+		_, size = utf8.DecodeRuneInString(rest)
+	}
+	if size == 0 || size >= len(rest) || rest[size] != '\'' {
+		return false
+	}
+
+	n.out.WriteString(n.src[n.pos : n.pos+size+2])
+	n.pos += size + 2
+	return true
+}
+
+// indent reads the indentation of a line and records it as its nesting level,
+// so that only the structure is compared and not the width of each level.
+// Blank and comment-only lines carry no indentation.
+func (n *normalizer) indent() {
+	width := 0
+scan:
+	for ; n.pos < len(n.src); n.pos++ {
+		switch n.src[n.pos] {
+		case ' ':
+			width++
+		case '\t':
+			width += 8 - width%8
+		case '\r', '\f', '\v':
+		default:
+			break scan
+		}
+	}
+
+	rest := n.src[n.pos:]
+	if rest == "" || rest[0] == '\n' || (n.lineComment != "" && strings.HasPrefix(rest, n.lineComment)) {
+		return
+	}
+
+	for width < n.indents[len(n.indents)-1] {
+		n.indents = n.indents[:len(n.indents)-1]
+	}
+	if width > n.indents[len(n.indents)-1] {
+		n.indents = append(n.indents, width)
+	}
+	n.out.WriteByte('\n')
+	n.out.WriteString(strings.Repeat("\t", len(n.indents)-1))
+}
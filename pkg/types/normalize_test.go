@@ -0,0 +1,137 @@
+package types
+
+import "testing"
+
+func TestNormalizedHashDuplicates(t *testing.T) {
+	tests := []struct {
+		name     string
+		language string
+		a, b     string
+	}{
+		{
+			name:     "exact duplicate",
+			language: "go",
+			a:        "func add(a, b int) int { return a + b }",
+			b:        "func add(a, b int) int { return a + b }",
+		},
+		{
+			name:     "go whitespace",
+			language: "go",
+			a:        "func add(a, b int) int { return a + b }",
+			b:        "func add(a, b int) int {\n\treturn a+b\n}\n",
+		},
+		{
+			name:     "go comments",
+			language: "go",
+			a:        "func add(a, b int) int { return a + b }",
+			b:        "// add sums\nfunc add(a, b int) int { /* easy */ return a + b }",
+		},
+		{
+			name:     "python trailing whitespace and blank lines",
+			language: "python",
+			a:        "def add(a, b):\n    return a + b\n",
+			b:        "def add(a,b):  \n\n    return a+b   # sum\n\n",
+		},
+		{
+			name:     "python indentation width",
+			language: "python",
+			a:        "if x:\n    y = 1\n    if z:\n        y = 2\n",
+			b:        "if x:\n  y = 1\n  if z:\n\ty = 2\n",
+		},
+		{
+			name:     "python bracket continuation",
+			language: "python",
+			a:        "x = f(1,\n      2)\n",
+			b:        "x = f(1,\n  2)\n",
+		},
+		{
+			name:     "unknown language whitespace",
+			language: "",
+			a:        "SELECT 1",
+			b:        "SELECT\n  1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &PatchSet{Language: tt.language, Code: tt.a}
+			b := &PatchSet{Language: tt.language, Code: tt.b}
+			if a.NormalizedHash() != b.NormalizedHash() {
+				t.Errorf("normalized to %q and %q, want the same", normalizeCode(tt.a, tt.language), normalizeCode(tt.b, tt.language))
+			}
+		})
+	}
+}
+
+func TestNormalizedHashDistinct(t *testing.T) {
+	tests := []struct {
+		name     string
+		language string
+		a, b     string
+	}{
+		{
+			name:     "url in go string",
+			language: "go",
+			a:        `u := "http://a"`,
+			b:        `u := "http://b"`,
+		},
+		{
+			name:     "comment marker in go raw string",
+			language: "go",
+			a:        "u := `/* a */`",
+			b:        "u := `/* b */`",
+		},
+		{
+			name:     "whitespace in go string",
+			language: "go",
+			a:        `s := "a b"`,
+			b:        `s := "ab"`,
+		},
+		{
+			name:     "go char literal",
+			language: "go",
+			a:        `c := '"'; s := "//a"`,
+			b:        `c := '"'; s := "//b"`,
+		},
+		{
+			name:     "url in js string",
+			language: "js",
+			a:        `fetch('http://a')`,
+			b:        `fetch('http://b')`,
+		},
+		{
+			name:     "hash in python string",
+			language: "python",
+			a:        `print("#x")`,
+			b:        `print("#y")`,
+		},
+		{
+			name:     "hash in python triple-quoted string",
+			language: "python",
+			a:        "s = \"\"\"say \"hi\" # x\"\"\"",
+			b:        "s = \"\"\"say \"hi\" # y\"\"\"",
+		},
+		{
+			name:     "python block membership",
+			language: "python",
+			a:        "if x:\n    y = 1\n    z = 2\n",
+			b:        "if x:\n    y = 1\nz = 2\n",
+		},
+		{
+			name:     "rust lifetime before comment",
+			language: "rust",
+			a:        "fn f<'a>(s: &'a str) -> &'a str { s } // x\nconst A: &str = \"a\";",
+			b:        "fn f<'a>(s: &'a str) -> &'a str { s } // x\nconst A: &str = \"b\";",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &PatchSet{Language: tt.language, Code: tt.a}
+			b := &PatchSet{Language: tt.language, Code: tt.b}
+			if a.NormalizedHash() == b.NormalizedHash() {
+				t.Errorf("both normalized to %q", normalizeCode(tt.a, tt.language))
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package types
+
+import "math/big"
+
+// maxTarget is the target of difficulty 1, which every hash meets
+var maxTarget = new(big.Int).Lsh(big.NewInt(1), 256)
+
+// PowTarget returns the value a block hash must stay below at the given
+// difficulty; on average difficulty hashes are tried to find one
+func PowTarget(difficulty int64) *big.Int {
+	if difficulty < 1 {
+		difficulty = 1
+	}
+	return new(big.Int).Div(maxTarget, big.NewInt(difficulty))
+}
+
+// MeetsDifficulty reports whether the header's hash, read as a big-endian
+// number, is below the target for its difficulty
+func (h *BlockHeader) MeetsDifficulty() bool {
+	return new(big.Int).SetBytes(h.Hash[:]).Cmp(PowTarget(h.Difficulty)) < 0
+}
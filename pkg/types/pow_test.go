@@ -0,0 +1,33 @@
+package types
+
+import "testing"
+
+func TestMeetsDifficulty(t *testing.T) {
+	// Hashes are a leading byte followed by 31 copies of rest
+	tests := []struct {
+		name        string
+		difficulty  int64
+		first, rest byte
+		want        bool
+	}{
+		{"difficulty 1 accepts any hash", 1, 0xff, 0xff, true},
+		{"non-positive difficulty counts as 1", 0, 0xff, 0xff, true},
+		{"just below target", 2, 0x7f, 0xff, true},
+		{"at target", 2, 0x80, 0x00, false},
+		{"above target", 256, 0x01, 0x00, false},
+		{"below a high target", 256, 0x00, 0xff, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := BlockHeader{Difficulty: tt.difficulty}
+			header.Hash[0] = tt.first
+			for i := 1; i < len(header.Hash); i++ {
+				header.Hash[i] = tt.rest
+			}
+			if got := header.MeetsDifficulty(); got != tt.want {
+				t.Errorf("MeetsDifficulty() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package types
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Domain prefixes keep a leaf from being passed off as an interior node
+const (
+	stateLeafPrefix = 0x00
+	stateNodePrefix = 0x01
+)
+
+// ProofStep is a sibling hash on the path from an account leaf to the state root
+type ProofStep struct {
+	Hash Hash `json:"hash"`
+	// Left is set when the sibling is the left child
+	Left bool `json:"left"`
+}
+
+// AccountProof is the Merkle path proving an account is part of a state root
+type AccountProof struct {
+	Steps []ProofStep `json:"steps"`
+}
+
+// StateLeaf returns the leaf hash of an account. The encoding is fixed-width
+// rather than JSON so that every node derives the same bytes.
+func (a *Account) StateLeaf() Hash {
+	var buf bytes.Buffer
+	buf.WriteByte(stateLeafPrefix)
+	buf.Write(a.Address[:])
+	binary.Write(&buf, binary.BigEndian, a.Balance)
+	binary.Write(&buf, binary.BigEndian, a.Nonce)
+	buf.Write(a.CodeHash[:])
+	return NewHash(buf.Bytes())
+}
+
+// StateRoot computes the Merkle root over accounts sorted by address. An odd
+// node at any level is carried up unchanged, as in the transaction tree.
+func StateRoot(accounts []*Account) Hash {
+	root, _ := stateTree(accounts, nil)
+	return root
+}
+
+// BuildAccountProof returns the state root over accounts and the path proving
+// the account at address is included in it
+func BuildAccountProof(accounts []*Account, address Address) (Hash, *AccountProof, error) {
+	root, proof := stateTree(accounts, &address)
+	if proof == nil {
+		return root, nil, fmt.Errorf("account not found: %s", address)
+	}
+	return root, proof, nil
+}
+
+// VerifyAccountProof checks that account is committed to by stateRoot
+func VerifyAccountProof(stateRoot Hash, account *Account, proof *AccountProof) error {
+	if proof == nil {
+		return fmt.Errorf("missing proof")
+	}
+
+	hash := account.StateLeaf()
+	for _, step := range proof.Steps {
+		if step.Left {
+			hash = stateNode(step.Hash, hash)
+		} else {
+			hash = stateNode(hash, step.Hash)
+		}
+	}
+
+	if hash != stateRoot {
+		return fmt.Errorf("account does not match state root")
+	}
+	return nil
+}
+
+// stateTree builds the tree over accounts, collecting the proof for target
+// when it is given and present
+func stateTree(accounts []*Account, target *Address) (Hash, *AccountProof) {
+	if len(accounts) == 0 {
+		return Hash{}, nil
+	}
+
+	sorted := make([]*Account, len(accounts))
+	copy(sorted, accounts)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].Address[:], sorted[j].Address[:]) < 0
+	})
+
+	level := make([]Hash, len(sorted))
+	index := -1
+	for i, account := range sorted {
+		level[i] = account.StateLeaf()
+		if target != nil && account.Address == *target {
+			index = i
+		}
+	}
+
+	var proof *AccountProof
+	if index >= 0 {
+		proof = &AccountProof{}
+	}
+
+	for len(level) > 1 {
+		next := make([]Hash, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			if proof != nil {
+				switch index {
+				case i:
+					proof.Steps = append(proof.Steps, ProofStep{Hash: level[i+1]})
+				case i + 1:
+					proof.Steps = append(proof.Steps, ProofStep{Hash: level[i], Left: true})
+				}
+			}
+			next = append(next, stateNode(level[i], level[i+1]))
+		}
+		index /= 2
+		level = next
+	}
+
+	return level[0], proof
+}
+
+// stateNode hashes two children into their parent
+func stateNode(left, right Hash) Hash {
+	data := make([]byte, 0, 1+2*len(left))
+	data = append(data, stateNodePrefix)
+	data = append(data, left[:]...)
+	data = append(data, right[:]...)
+	return NewHash(data)
+}
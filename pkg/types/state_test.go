@@ -0,0 +1,100 @@
+package types
+
+import "testing"
+
+// testAccounts returns n accounts with distinct addresses, in descending
+// address order so that the tree has to sort them
+func testAccounts(n int) []*Account {
+	accounts := make([]*Account, n)
+	for i := range accounts {
+		accounts[i] = &Account{
+			Address: Address{byte(n - i)},
+			Balance: int64(100 * (i + 1)),
+			Nonce:   int64(i),
+		}
+	}
+	return accounts
+}
+
+func TestAccountProofInclusion(t *testing.T) {
+	// Every tree shape up to a few levels, including odd nodes carried up
+	for n := 1; n <= 9; n++ {
+		accounts := testAccounts(n)
+		root := StateRoot(accounts)
+
+		for _, account := range accounts {
+			proofRoot, proof, err := BuildAccountProof(accounts, account.Address)
+			if err != nil {
+				t.Fatalf("%d accounts: BuildAccountProof: %v", n, err)
+			}
+			if proofRoot != root {
+				t.Fatalf("%d accounts: proof built against root %s, want %s", n, proofRoot, root)
+			}
+			if err := VerifyAccountProof(root, account, proof); err != nil {
+				t.Errorf("%d accounts: proof of %s rejected: %v", n, account.Address, err)
+			}
+		}
+	}
+
+	accounts := testAccounts(3)
+	if _, _, err := BuildAccountProof(accounts, Address{0xee}); err == nil {
+		t.Error("built a proof for an account not in the state")
+	}
+
+	// The root does not depend on the order accounts are given in
+	reversed := []*Account{accounts[2], accounts[1], accounts[0]}
+	if StateRoot(reversed) != StateRoot(accounts) {
+		t.Error("state root depends on account order")
+	}
+}
+
+func TestAccountProofRejectsTampering(t *testing.T) {
+	accounts := testAccounts(5)
+	target := accounts[2]
+	root, proof, err := BuildAccountProof(accounts, target.Address)
+	if err != nil {
+		t.Fatalf("BuildAccountProof: %v", err)
+	}
+
+	tampered := map[string]func() (Hash, *Account, *AccountProof){
+		"balance": func() (Hash, *Account, *AccountProof) {
+			account := *target
+			account.Balance++
+			return root, &account, proof
+		},
+		"nonce": func() (Hash, *Account, *AccountProof) {
+			account := *target
+			account.Nonce--
+			return root, &account, proof
+		},
+		"address": func() (Hash, *Account, *AccountProof) {
+			account := *target
+			account.Address[19] ^= 1
+			return root, &account, proof
+		},
+		"sibling hash": func() (Hash, *Account, *AccountProof) {
+			steps := append([]ProofStep(nil), proof.Steps...)
+			steps[0].Hash[0] ^= 1
+			return root, target, &AccountProof{Steps: steps}
+		},
+		"sibling side": func() (Hash, *Account, *AccountProof) {
+			steps := append([]ProofStep(nil), proof.Steps...)
+			steps[0].Left = !steps[0].Left
+			return root, target, &AccountProof{Steps: steps}
+		},
+		"root": func() (Hash, *Account, *AccountProof) {
+			other := root
+			other[0] ^= 1
+			return other, target, proof
+		},
+		"missing proof": func() (Hash, *Account, *AccountProof) {
+			return root, target, nil
+		},
+	}
+	for name, tamper := range tampered {
+		root, account, proof := tamper()
+		if err := VerifyAccountProof(root, account, proof); err == nil {
+			t.Errorf("tampered %s: proof accepted", name)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -47,6 +49,70 @@ type ProblemSpec struct {
 	TestSuite       []TestCase        `json:"test_suite"`
 }
 
+// Limits accepted for a problem's per-test resource budget
+const (
+	MaxProblemTimeLimitMs   = 60 * 60 * 1000
+	MaxProblemMemoryLimitMb = 16 * 1024
+)
+
+// ProblemSpecError reports the field of a problem spec that failed validation
+type ProblemSpecError struct {
+	Field  string
+	Reason string
+}
+
+func (e *ProblemSpecError) Error() string {
+	return fmt.Sprintf("invalid problem spec: %s: %s", e.Field, e.Reason)
+}
+
+// Validate checks that a problem spec is complete enough to be registered
+func (ps *ProblemSpec) Validate() error {
+	if strings.TrimSpace(ps.ID) == "" {
+		return &ProblemSpecError{"id", "must not be empty"}
+	}
+	if strings.TrimSpace(ps.Title) == "" {
+		return &ProblemSpecError{"title", "must not be empty"}
+	}
+	if ps.Reward <= 0 {
+		return &ProblemSpecError{"reward", "must be positive"}
+	}
+	if ps.TimeLimitMs <= 0 || ps.TimeLimitMs > MaxProblemTimeLimitMs {
+		return &ProblemSpecError{"time_limit_ms", fmt.Sprintf("must be between 1 and %d", MaxProblemTimeLimitMs)}
+	}
+	if ps.MemoryLimitMb <= 0 || ps.MemoryLimitMb > MaxProblemMemoryLimitMb {
+		return &ProblemSpecError{"memory_limit_mb", fmt.Sprintf("must be between 1 and %d", MaxProblemMemoryLimitMb)}
+	}
+	if len(ps.TestSuite) == 0 {
+		return &ProblemSpecError{"test_suite", "must contain at least one test case"}
+	}
+	for i, tc := range ps.TestSuite {
+		if tc.Weight < 0 {
+			return &ProblemSpecError{fmt.Sprintf("test_suite[%d].weight", i), "must not be negative"}
+		}
+	}
+	return nil
+}
+
+// Problem tracks an on-chain problem and the reward escrowed for its solver
+type Problem struct {
+	Spec     ProblemSpec `json:"spec"`
+	Creator  Address     `json:"creator"`
+	Escrow   int64       `json:"escrow"`
+	Status   string      `json:"status"`
+	SolvedBy Address     `json:"solved_by"`
+}
+
+// Stake records tokens an account has bonded, either as a validator
+// (Validator equals Address) or delegated to a validator. Unstaked tokens
+// stay in Unbonding until the block at UnbondingUntil returns them.
+type Stake struct {
+	Address        Address `json:"address"`
+	Validator      Address `json:"validator"`
+	Amount         int64   `json:"amount"`
+	Unbonding      int64   `json:"unbonding,omitempty"`
+	UnbondingUntil int64   `json:"unbonding_until,omitempty"`
+}
+
 // TestCase represents a single test case
 type TestCase struct {
 	Input    string `json:"input"`
@@ -56,14 +122,29 @@ type TestCase struct {
 
 // PatchSet represents a code submission
 type PatchSet struct {
-	ID          string            `json:"id"`
-	ProblemID   string            `json:"problem_id"`
-	Author      Address           `json:"author"`
-	Code        string            `json:"code"`
-	Language    string            `json:"language"`
-	Files       map[string]string `json:"files"`
-	Timestamp   int64             `json:"timestamp"`
-	Signature   []byte            `json:"signature"`
+	ID              string            `json:"id"`
+	ProblemID       string            `json:"problem_id"`
+	Author          Address           `json:"author"`
+	Code            string            `json:"code"`
+	Language        string            `json:"language"`
+	Files           map[string]string `json:"files"`
+	Timestamp       int64             `json:"timestamp"`
+	Signature       []byte            `json:"signature"`
+	PublicKey       []byte            `json:"public_key,omitempty"` // author's key, checked against Author
+	CodeHash        string            `json:"code_hash,omitempty"`
+	EncodedArtifact string            `json:"encoded_artifact,omitempty"` // base64 binary content
+	ContentType     string            `json:"content_type,omitempty"`
+}
+
+// ComputeCodeHash returns the hex SHA-256 of the patch's code, or of the
+// decoded artifact for a binary patch
+func (ps *PatchSet) ComputeCodeHash() string {
+	if ps.Code == "" && ps.EncodedArtifact != "" {
+		if artifact, err := ps.Artifact(); err == nil {
+			return NewHash(artifact).String()
+		}
+	}
+	return NewHash([]byte(ps.Code)).String()
 }
 
 func (ps *PatchSet) Hash() Hash {
@@ -71,26 +152,62 @@ func (ps *PatchSet) Hash() Hash {
 	return NewHash(data)
 }
 
+// Size returns the number of bytes of code the patch set submits
+func (ps *PatchSet) Size() int64 {
+	size := int64(len(ps.Code)) + int64(len(ps.EncodedArtifact))
+	for _, content := range ps.Files {
+		size += int64(len(content))
+	}
+	return size
+}
+
+// PatchGas returns the gas a patch submission uses when evaluated against
+// the given number of test cases
+func PatchGas(patch *PatchSet, tests int) int64 {
+	gas := int64(PatchGasBase)
+	if patch == nil {
+		return gas
+	}
+	return gas + patch.Size()*PatchGasPerByte + int64(tests)*PatchGasPerTest
+}
+
+// Gas charged for a patch submission
+const (
+	PatchGasBase         = 1000 // per submission
+	PatchGasPerByte      = 1    // per byte of submitted code
+	PatchGasPerTest      = 1000 // per test case the patch is evaluated against
+	DefaultPatchGasLimit = 50000
+)
+
 // Transaction represents a blockchain transaction
 type Transaction struct {
-	Type      string    `json:"type"`
-	From      Address   `json:"from"`
-	To        Address   `json:"to"`
-	Amount    int64     `json:"amount"`
-	PatchSet  *PatchSet `json:"patch_set,omitempty"`
-	Timestamp int64     `json:"timestamp"`
-	Nonce     int64     `json:"nonce"`
-	Signature []byte    `json:"signature"`
-	Hash      Hash      `json:"hash"`
+	Type      string       `json:"type"`
+	From      Address      `json:"from"`
+	To        Address      `json:"to"`
+	Amount    int64        `json:"amount"`
+	Fee       int64        `json:"fee"`
+	PatchSet  *PatchSet    `json:"patch_set,omitempty"`
+	Problem   *ProblemSpec `json:"problem,omitempty"`
+	ProblemID string       `json:"problem_id,omitempty"`
+	PatchTx   *Hash        `json:"patch_tx,omitempty"`
+	Timestamp int64        `json:"timestamp"`
+	Nonce     int64        `json:"nonce"`
+	ChainID   int64        `json:"chain_id"`
+	GasLimit  int64        `json:"gas_limit,omitempty"`
+	// ValidUntil is the last block height that may include the transaction;
+	// zero means it never expires
+	ValidUntil int64 `json:"valid_until,omitempty"`
+	// GasUsed is filled in by the chain when the transaction is applied
+	GasUsed   int64  `json:"gas_used,omitempty"`
+	Signature []byte `json:"signature"`
+	// PublicKey is the sender's key; it must hash to From
+	PublicKey []byte `json:"public_key,omitempty"`
+	Hash      Hash   `json:"hash"`
 }
 
+// CalculateHash hashes the canonical encoding of the transaction
 func (tx *Transaction) CalculateHash() Hash {
-	// Create a copy without hash and signature for calculation
-	temp := *tx
-	temp.Hash = Hash{}
-	temp.Signature = nil
-	data, _ := json.Marshal(temp)
-	return NewHash(data)
+	return NewHash(tx.CanonicalBytes())
 }
 
 // Block represents a blockchain block
@@ -104,20 +221,29 @@ type BlockHeader struct {
 	Height       int64     `json:"height"`
 	PrevHash     Hash      `json:"prev_hash"`
 	MerkleRoot   Hash      `json:"merkle_root"`
+	StateRoot    Hash      `json:"state_root"`
 	Timestamp    int64     `json:"timestamp"`
 	Difficulty   int64     `json:"difficulty"`
 	Nonce        int64     `json:"nonce"`
 	Validator    Address   `json:"validator"`
+	PublicKey    []byte    `json:"public_key,omitempty"`
 	Hash         Hash      `json:"hash"`
+	Signature    []byte    `json:"signature,omitempty"`
 }
 
 func (b *Block) CalculateHash() Hash {
 	// Calculate merkle root of transactions
 	b.Header.MerkleRoot = b.calculateMerkleRoot()
 	
-	// Create header copy without hash for calculation
-	temp := b.Header
+	return b.Header.CalculateHash()
+}
+
+// CalculateHash hashes the header fields, excluding the hash itself
+func (h *BlockHeader) CalculateHash() Hash {
+	// The signature covers the hash, so it cannot be part of it
+	temp := *h
 	temp.Hash = Hash{}
+	temp.Signature = nil
 	data, _ := json.Marshal(temp)
 	return NewHash(data)
 }
@@ -164,27 +290,82 @@ type NodeInfo struct {
 	Port      int       `json:"port"`
 	PublicKey []byte    `json:"public_key"`
 	LastSeen  time.Time `json:"last_seen"`
+	Version   string    `json:"version,omitempty"`
+	Height    int64     `json:"height,omitempty"` // last height the peer reported
 }
 
 // ChainConfig represents blockchain configuration
 type ChainConfig struct {
-	ChainID         int64         `json:"chain_id"`
-	BlockTime       time.Duration `json:"block_time"`
-	MaxBlockSize    int64         `json:"max_block_size"`
-	MaxTxPerBlock   int           `json:"max_tx_per_block"`
-	InitialReward   int64         `json:"initial_reward"`
-	RewardDecay     float64       `json:"reward_decay"`
-	GenesisAccounts []Account     `json:"genesis_accounts"`
+	ChainID           int64         `json:"chain_id"`
+	BlockTime         time.Duration `json:"block_time"`
+	MaxBlockSize      int64         `json:"max_block_size"`
+	MaxTxPerBlock     int           `json:"max_tx_per_block"`
+	InitialReward     int64         `json:"initial_reward"`
+	RewardDecay       float64       `json:"reward_decay"`
+	GenesisAccounts   []Account     `json:"genesis_accounts"`
+	GenesisTime       int64         `json:"genesis_time"` // fixed genesis timestamp; 0 uses the current time
+	MaxBlocksInMemory int           `json:"max_blocks_in_memory"`
+	SnapshotInterval  int64         `json:"snapshot_interval"`
+	SnapshotRetention int           `json:"snapshot_retention"`
+	DustThreshold     int64         `json:"dust_threshold"`
+	AuditLog          bool          `json:"audit_log"`
+	FinalityDepth     int64         `json:"finality_depth"`
+	MaxReorgDepth     int64         `json:"max_reorg_depth"`
+	PrioritizeOwnTxs  bool          `json:"prioritize_own_txs"`
+	ProduceEmptyBlocks bool         `json:"produce_empty_blocks"`
+	MinValidatorStake int64         `json:"min_validator_stake"`
+	MinDelegatorStake int64         `json:"min_delegator_stake"`
+	UnbondingPeriod   int64         `json:"unbonding_period"` // blocks before unstaked tokens are returned; 0 returns them at once
+	ValidatorCommission int64       `json:"validator_commission"` // percent of block earnings a validator keeps before sharing with delegators
+	EmptyBlockInterval time.Duration `json:"empty_block_interval"` // longest gap between blocks when empty blocks are skipped
+	GasPrice          int64         `json:"gas_price"`
+	Decimals          int           `json:"decimals"`
+	MaxClockDrift     time.Duration `json:"max_clock_drift"`
+	MaxMempoolSize    int           `json:"max_mempool_size"`
+	MaxMempoolPerSender int         `json:"max_mempool_per_sender"`
+	Consensus         string        `json:"consensus"`
+	PowDifficulty     int64         `json:"pow_difficulty"`
+	PowRetargetInterval int64       `json:"pow_retarget_interval"`
 }
 
 // Constants
 const (
-	TxTypeTransfer    = "transfer"
-	TxTypePatchSubmit = "patch_submit"
-	TxTypeStake       = "stake"
+	TxTypeTransfer      = "transfer"
+	TxTypePatchSubmit   = "patch_submit"
+	TxTypeStake         = "stake"
+	TxTypeProblemCreate = "problem_create"
+	TxTypeProblemUpdate = "problem_update"
+	TxTypeProblemClose  = "problem_close"
+	TxTypePatchReward   = "patch_reward"
+	TxTypeUnstake       = "unstake"
+
+	ProblemStatusOpen   = "open"
+	ProblemStatusSolved = "solved"
+	ProblemStatusClosed = "closed"
 	
-	DefaultBlockTime     = 10 * time.Second
-	DefaultMaxBlockSize  = 1024 * 1024 // 1MB
-	DefaultMaxTxPerBlock = 1000
-	DefaultInitialReward = 1000
+	DefaultBlockTime         = 10 * time.Second
+	MinBlockTime             = 100 * time.Millisecond
+	DefaultMaxBlockSize      = 1024 * 1024 // 1MB
+	DefaultMaxTxPerBlock     = 1000
+	DefaultInitialReward     = 1000
+	DefaultMaxBlocksInMemory = 1000
+	DefaultTxFee             = 1
+	DefaultSnapshotRetention = 3
+	DefaultMaxReorgDepth     = 100
+	DefaultFinalityDepth     = 100
+	DefaultGasPrice          = 1
+	DefaultMaxClockDrift     = 15 * time.Second
+	DefaultEmptyBlockInterval = time.Minute
+	DefaultMinValidatorStake = 1000
+	DefaultMinDelegatorStake = 100
+	DefaultValidatorCommission = 10
+	DefaultMaxMempoolSize    = 10000
+	DefaultMaxMempoolPerSender = 100
+	DefaultPowDifficulty     = 1 << 16
+	DefaultPowRetargetInterval = 10
+
+	// ConsensusInstant produces blocks on the block timer without proof of
+	// work; ConsensusPoW requires each block hash to meet a difficulty target
+	ConsensusInstant = "instant"
+	ConsensusPoW     = "pow"
 )
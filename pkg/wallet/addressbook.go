@@ -0,0 +1,130 @@
+package wallet
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"agent-chain/internal/fsutil"
+	"agent-chain/pkg/crypto"
+)
+
+// AddressBookEntry is a recipient address stored under a label
+type AddressBookEntry struct {
+	Label   string `json:"label"`
+	Address string `json:"address"`
+}
+
+// addressBookPath returns the file the address book is stored in
+func (w *Wallet) addressBookPath() string {
+	return filepath.Join(w.dataDir, "addressbook.json")
+}
+
+// loadAddressBook reads the address book, which is empty until the first
+// address is added
+func (w *Wallet) loadAddressBook() (map[string]string, error) {
+	book := make(map[string]string)
+
+	data, err := os.ReadFile(w.addressBookPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return book, nil
+		}
+		return nil, fmt.Errorf("failed to read address book: %v", err)
+	}
+
+	if err := json.Unmarshal(data, &book); err != nil {
+		return nil, fmt.Errorf("failed to parse address book: %v", err)
+	}
+	return book, nil
+}
+
+// saveAddressBook writes the address book to disk
+func (w *Wallet) saveAddressBook(book map[string]string) error {
+	if err := os.MkdirAll(w.dataDir, 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(book, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(w.addressBookPath(), data, 0600)
+}
+
+// AddAddress stores a recipient address under a label. A label that is itself
+// an address would be ambiguous and is refused, as is one already in use.
+func (w *Wallet) AddAddress(label, address string) error {
+	if label == "" {
+		return fmt.Errorf("label must not be empty")
+	}
+	if _, err := crypto.AddressFromString(label); err == nil {
+		return fmt.Errorf("label %q is an address", label)
+	}
+
+	addr, err := crypto.AddressFromString(address)
+	if err != nil {
+		return fmt.Errorf("invalid address: %v", err)
+	}
+
+	book, err := w.loadAddressBook()
+	if err != nil {
+		return err
+	}
+	if existing, exists := book[label]; exists {
+		return fmt.Errorf("label %s already refers to %s", label, existing)
+	}
+
+	book[label] = addr.String()
+	return w.saveAddressBook(book)
+}
+
+// RemoveAddress deletes a label from the address book
+func (w *Wallet) RemoveAddress(label string) error {
+	book, err := w.loadAddressBook()
+	if err != nil {
+		return err
+	}
+	if _, exists := book[label]; !exists {
+		return fmt.Errorf("no address book entry %s", label)
+	}
+
+	delete(book, label)
+	return w.saveAddressBook(book)
+}
+
+// ListAddresses returns the address book sorted by label
+func (w *Wallet) ListAddresses() ([]AddressBookEntry, error) {
+	book, err := w.loadAddressBook()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]AddressBookEntry, 0, len(book))
+	for label, address := range book {
+		entries = append(entries, AddressBookEntry{Label: label, Address: address})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Label < entries[j].Label
+	})
+	return entries, nil
+}
+
+// ResolveRecipient returns to unchanged when it is an address, and otherwise
+// the address stored under that label in the address book
+func (w *Wallet) ResolveRecipient(to string) (string, error) {
+	if _, err := crypto.AddressFromString(to); err == nil {
+		return to, nil
+	}
+
+	book, err := w.loadAddressBook()
+	if err != nil {
+		return "", err
+	}
+	if address, exists := book[to]; exists {
+		return address, nil
+	}
+	return "", fmt.Errorf("%q is neither an address nor an address book label", to)
+}
@@ -0,0 +1,81 @@
+package wallet
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAddressBookRejectsInvalidEntries(t *testing.T) {
+	bob := "0x" + strings.Repeat("b", 40)
+
+	tests := []struct {
+		name           string
+		label, address string
+	}{
+		{"empty label", "", bob},
+		{"label that is an address", "0x" + strings.Repeat("c", 40), bob},
+		{"address too short", "carol", "0x1234"},
+		{"address not hex", "carol", "0x" + strings.Repeat("z", 40)},
+		{"label already in use", "bob", "0x" + strings.Repeat("c", 40)},
+	}
+
+	w := NewWallet(t.TempDir(), "http://127.0.0.1:0")
+	if err := w.AddAddress("bob", bob); err != nil {
+		t.Fatalf("AddAddress: %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := w.AddAddress(tt.label, tt.address); err == nil {
+				t.Errorf("AddAddress(%q, %q) succeeded", tt.label, tt.address)
+			}
+		})
+	}
+
+	entries, err := w.ListAddresses()
+	if err != nil {
+		t.Fatalf("ListAddresses: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Label != "bob" || entries[0].Address != bob {
+		t.Errorf("address book = %+v, want only bob", entries)
+	}
+}
+
+func TestResolveRecipient(t *testing.T) {
+	bob, carol := "0x"+strings.Repeat("b", 40), "0x"+strings.Repeat("c", 40)
+	dataDir := t.TempDir()
+
+	w := NewWallet(dataDir, "http://127.0.0.1:0")
+	for label, address := range map[string]string{"bob": bob, "carol": carol} {
+		if err := w.AddAddress(label, address); err != nil {
+			t.Fatalf("AddAddress(%s): %v", label, err)
+		}
+	}
+	if err := w.RemoveAddress("carol"); err != nil {
+		t.Fatalf("RemoveAddress: %v", err)
+	}
+
+	// Labels survive reopening the wallet
+	w = NewWallet(dataDir, "http://127.0.0.1:0")
+	tests := []struct {
+		to   string
+		want string
+		err  bool
+	}{
+		{"bob", bob, false},
+		{carol, carol, false},
+		{"carol", "", true},
+		{"dave", "", true},
+	}
+	for _, tt := range tests {
+		got, err := w.ResolveRecipient(tt.to)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ResolveRecipient(%q) = %s, want an error", tt.to, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ResolveRecipient(%q) = %s, %v; want %s", tt.to, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package wallet
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"agent-chain/pkg/blockchain"
+	"agent-chain/pkg/types"
+)
+
+// EventFilter selects which chain events a subscription delivers
+type EventFilter struct {
+	// Types limits events to the given types; empty means all types
+	Types []string
+	// Address limits block and transaction events to those involving the
+	// address; reorgs affect everyone and always pass
+	Address *types.Address
+}
+
+// Matches reports whether an event passes the filter
+func (f *EventFilter) Matches(event *blockchain.Event) bool {
+	if f == nil {
+		return true
+	}
+
+	if len(f.Types) > 0 {
+		wanted := false
+		for _, t := range f.Types {
+			if t == event.Type {
+				wanted = true
+				break
+			}
+		}
+		if !wanted {
+			return false
+		}
+	}
+
+	if f.Address == nil {
+		return true
+	}
+
+	addr := *f.Address
+	switch event.Type {
+	case blockchain.EventTransaction:
+		return event.Transaction != nil && (event.Transaction.From == addr || event.Transaction.To == addr)
+	case blockchain.EventBlock:
+		if event.Block == nil {
+			return false
+		}
+		if event.Block.Header.Validator == addr {
+			return true
+		}
+		for _, tx := range event.Block.Txs {
+			if tx.From == addr || tx.To == addr {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// EventsURL derives the node's WebSocket event feed URL from the first RPC URL
+func (w *Wallet) EventsURL() string {
+	var url string
+	if len(w.rpcURLs) > 0 {
+		url = strings.TrimSuffix(w.rpcURLs[0], "/")
+	}
+	switch {
+	case strings.HasPrefix(url, "https://"):
+		url = "wss://" + strings.TrimPrefix(url, "https://")
+	case strings.HasPrefix(url, "http://"):
+		url = "ws://" + strings.TrimPrefix(url, "http://")
+	}
+	return url + "/ws"
+}
+
+const (
+	// eventInitialBackoff is the first delay before redialling a dropped event feed
+	eventInitialBackoff = time.Second
+	// eventMaxBackoff caps the delay between event feed redials
+	eventMaxBackoff = 30 * time.Second
+	// eventReadTimeout drops a feed that has sent neither events nor pings
+	// for this long; the node pings idle clients every 30 seconds
+	eventReadTimeout = 90 * time.Second
+)
+
+// Reconnect configures how SubscribeEvents recovers from a dropped feed
+type Reconnect struct {
+	// MaxAttempts bounds consecutive failed redials; 0 disables reconnecting
+	// and a negative value retries forever
+	MaxAttempts int
+	// OnDisconnect is called when the feed drops, before redialling
+	OnDisconnect func(err error)
+	// OnGap is called after every successful reconnect
+	OnGap func(gap *EventGap)
+}
+
+// EventGap describes a window in which events may have been missed while the
+// event feed was disconnected
+type EventGap struct {
+	Disconnected time.Time
+	Reconnected  time.Time
+	// LastHeight is the last block delivered before the drop, -1 if none was
+	LastHeight int64
+	// Height is the chain height after reconnecting, -1 if it is unknown
+	Height int64
+}
+
+// SubscribeEvents connects to the node's event feed at wsURL and calls handle
+// for every event passing the filter, until handle returns an error or the
+// connection closes. With a reconnect policy a dropped feed is redialled with
+// backoff, and the filter is applied again to the new connection.
+func (w *Wallet) SubscribeEvents(wsURL string, filter *EventFilter, reconnect *Reconnect, handle func(*blockchain.Event) error) error {
+	conn, err := w.dialEvents(wsURL)
+	if err != nil {
+		return err
+	}
+
+	lastHeight := int64(-1)
+	for {
+		dropped, err := readEvents(conn, filter, &lastHeight, handle)
+		conn.Close()
+		if !dropped || reconnect == nil || reconnect.MaxAttempts == 0 {
+			return err
+		}
+
+		if reconnect.OnDisconnect != nil {
+			reconnect.OnDisconnect(err)
+		}
+		disconnected := time.Now()
+
+		conn, err = w.redialEvents(wsURL, reconnect.MaxAttempts)
+		if err != nil {
+			return err
+		}
+
+		if reconnect.OnGap != nil {
+			gap := &EventGap{
+				Disconnected: disconnected,
+				Reconnected:  time.Now(),
+				LastHeight:   lastHeight,
+				Height:       -1,
+			}
+			if height, err := w.GetHeight(); err == nil {
+				gap.Height = height
+			}
+			reconnect.OnGap(gap)
+		}
+	}
+}
+
+// dialEvents opens a connection to the event feed
+func (w *Wallet) dialEvents(wsURL string) (*websocket.Conn, error) {
+	dialer := *websocket.DefaultDialer
+	if transport, ok := w.client.Transport.(*http.Transport); ok {
+		dialer.TLSClientConfig = transport.TLSClientConfig
+	}
+
+	conn, _, err := dialer.Dial(wsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to event feed: %v", err)
+	}
+	return conn, nil
+}
+
+// redialEvents retries dialEvents with exponential backoff, giving up after
+// maxAttempts failures unless maxAttempts is negative
+func (w *Wallet) redialEvents(wsURL string, maxAttempts int) (*websocket.Conn, error) {
+	backoff := eventInitialBackoff
+	for attempt := 1; ; attempt++ {
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > eventMaxBackoff {
+			backoff = eventMaxBackoff
+		}
+
+		conn, err := w.dialEvents(wsURL)
+		if err == nil {
+			return conn, nil
+		}
+		if maxAttempts > 0 && attempt >= maxAttempts {
+			return nil, fmt.Errorf("%v (gave up after %d attempts)", err, attempt)
+		}
+	}
+}
+
+// readEvents delivers events from conn until it fails or handle returns an
+// error, reporting whether the connection itself failed. lastHeight
+// tracks the newest block seen, whether or not it passed the filter.
+func readEvents(conn *websocket.Conn, filter *EventFilter, lastHeight *int64, handle func(*blockchain.Event) error) (dropped bool, err error) {
+	conn.SetReadDeadline(time.Now().Add(eventReadTimeout))
+	conn.SetPingHandler(func(appData string) error {
+		conn.SetReadDeadline(time.Now().Add(eventReadTimeout))
+		return conn.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(time.Second))
+	})
+
+	for {
+		var event blockchain.Event
+		if err := conn.ReadJSON(&event); err != nil {
+			return true, fmt.Errorf("event feed closed: %v", err)
+		}
+		conn.SetReadDeadline(time.Now().Add(eventReadTimeout))
+
+		if event.Type == blockchain.EventBlock && event.Block != nil {
+			*lastHeight = event.Block.Header.Height
+		}
+		if !filter.Matches(&event) {
+			continue
+		}
+		if err := handle(&event); err != nil {
+			return false, err
+		}
+	}
+}
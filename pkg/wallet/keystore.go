@@ -0,0 +1,145 @@
+package wallet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// ErrWrongPassphrase is returned when a passphrase does not open an account's key
+var ErrWrongPassphrase = errors.New("wrong passphrase")
+
+// scrypt parameters for deriving the key that seals an account's private key
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltLen      = 16
+)
+
+// EncryptedKey is a private key sealed with AES-256-GCM under a key derived
+// from a passphrase with scrypt
+type EncryptedKey struct {
+	Salt       string `json:"salt"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// SetPassphrase sets the passphrase that encrypts the keys of accounts the
+// wallet stores and opens encrypted accounts it loads
+func (w *Wallet) SetPassphrase(passphrase string) {
+	w.passphrase = passphrase
+}
+
+// EncryptAccount encrypts the stored key of a plaintext account with the
+// wallet's passphrase
+func (w *Wallet) EncryptAccount(name string) error {
+	if w.passphrase == "" {
+		return fmt.Errorf("no passphrase set")
+	}
+
+	account, err := w.loadAccount(name)
+	if err != nil {
+		return err
+	}
+	if account.WatchOnly {
+		return fmt.Errorf("account %s is watch-only and has no private key", name)
+	}
+	if account.Crypto != nil {
+		return fmt.Errorf("account %s is already encrypted", name)
+	}
+
+	if err := w.saveAccount(account); err != nil {
+		return fmt.Errorf("failed to save account: %v", err)
+	}
+	return nil
+}
+
+// accountKey returns the private key hex of an account, decrypting it with
+// passphrase if the account is encrypted
+func accountKey(account *AccountInfo, passphrase string) (string, error) {
+	if account.Crypto == nil {
+		return account.PrivateKey, nil
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("account %s is encrypted; a passphrase is required", account.Name)
+	}
+	privateKey, err := decryptKey(account.Crypto, passphrase)
+	if err != nil {
+		return "", fmt.Errorf("failed to open account %s: %v", account.Name, err)
+	}
+	return privateKey, nil
+}
+
+// encryptKey seals a private key hex with a passphrase
+func encryptKey(privateKeyHex, passphrase string) (*EncryptedKey, error) {
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := keystoreCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return &EncryptedKey{
+		Salt:       hex.EncodeToString(salt),
+		Nonce:      hex.EncodeToString(nonce),
+		Ciphertext: hex.EncodeToString(aead.Seal(nil, nonce, []byte(privateKeyHex), nil)),
+	}, nil
+}
+
+// decryptKey opens a sealed private key, failing with ErrWrongPassphrase if
+// the passphrase does not match
+func decryptKey(enc *EncryptedKey, passphrase string) (string, error) {
+	salt, err := hex.DecodeString(enc.Salt)
+	if err != nil {
+		return "", fmt.Errorf("invalid salt: %v", err)
+	}
+	nonce, err := hex.DecodeString(enc.Nonce)
+	if err != nil {
+		return "", fmt.Errorf("invalid nonce: %v", err)
+	}
+	ciphertext, err := hex.DecodeString(enc.Ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("invalid ciphertext: %v", err)
+	}
+
+	aead, err := keystoreCipher(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return "", fmt.Errorf("invalid nonce length: %d", len(nonce))
+	}
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", ErrWrongPassphrase
+	}
+	return string(plaintext), nil
+}
+
+// keystoreCipher derives the AES-GCM cipher for a passphrase and salt
+func keystoreCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,96 @@
+package wallet
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExportPrivateKeyRequiresPassphrase(t *testing.T) {
+	w := NewWallet(t.TempDir(), "http://127.0.0.1:0")
+	w.SetPassphrase("correct horse")
+
+	account, err := w.CreateAccount("alice")
+	if err != nil {
+		t.Fatalf("CreateAccount: %v", err)
+	}
+
+	data, err := os.ReadFile(w.accountPath("alice"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if strings.Contains(string(data), account.PrivateKey) {
+		t.Fatal("account file holds the plaintext private key")
+	}
+
+	if _, err := w.ExportPrivateKey("alice", "wrong"); err == nil || !strings.Contains(err.Error(), ErrWrongPassphrase.Error()) {
+		t.Errorf("wrong passphrase: got %v", err)
+	}
+	if _, err := w.ExportPrivateKey("alice", ""); err == nil {
+		t.Error("export without a passphrase succeeded")
+	}
+
+	key, err := w.ExportPrivateKey("alice", "correct horse")
+	if err != nil {
+		t.Fatalf("ExportPrivateKey: %v", err)
+	}
+	if key != account.PrivateKey {
+		t.Errorf("exported key differs from the created one")
+	}
+}
+
+func TestLoadEncryptedAccount(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWallet(dir, "http://127.0.0.1:0")
+	w.SetPassphrase("secret")
+	account, err := w.CreateAccount("alice")
+	if err != nil {
+		t.Fatalf("CreateAccount: %v", err)
+	}
+
+	other := NewWallet(dir, "http://127.0.0.1:0")
+	if err := other.LoadAccount("alice"); err == nil {
+		t.Error("loaded an encrypted account without a passphrase")
+	}
+	other.SetPassphrase("not it")
+	if err := other.LoadAccount("alice"); err == nil {
+		t.Error("loaded an encrypted account with the wrong passphrase")
+	}
+	other.SetPassphrase("secret")
+	if err := other.LoadAccount("alice"); err != nil {
+		t.Fatalf("LoadAccount: %v", err)
+	}
+	if got := other.GetAddress().String(); got != account.Address {
+		t.Errorf("loaded address %s, want %s", got, account.Address)
+	}
+}
+
+func TestEncryptAccount(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWallet(dir, "http://127.0.0.1:0")
+	account, err := w.CreateAccount("alice")
+	if err != nil {
+		t.Fatalf("CreateAccount: %v", err)
+	}
+
+	// A plaintext account has no passphrase to check, so it cannot be exported
+	if _, err := w.ExportPrivateKey("alice", "anything"); err == nil {
+		t.Error("exported the key of an unencrypted account")
+	}
+
+	w.SetPassphrase("secret")
+	if err := w.EncryptAccount("alice"); err != nil {
+		t.Fatalf("EncryptAccount: %v", err)
+	}
+	if err := w.EncryptAccount("alice"); err == nil {
+		t.Error("encrypted an account twice")
+	}
+
+	key, err := w.ExportPrivateKey("alice", "secret")
+	if err != nil {
+		t.Fatalf("ExportPrivateKey: %v", err)
+	}
+	if key != account.PrivateKey {
+		t.Errorf("exported key differs from the created one")
+	}
+}
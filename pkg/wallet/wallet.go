@@ -1,40 +1,141 @@
 package wallet
 
 import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
+	"agent-chain/internal/fsutil"
 	"agent-chain/pkg/crypto"
 	"agent-chain/pkg/types"
 )
 
 // Wallet represents a wallet instance
 type Wallet struct {
-	keyPair *crypto.KeyPair
-	address types.Address
-	rpcURL  string
-	dataDir string
+	keyPair    *crypto.KeyPair
+	address    types.Address
+	rpcURLs    []string
+	rpcRetries int
+	dataDir    string
+	client     *http.Client
+	chainInfo  *ChainInfo
+	authToken  string
+	watchOnly  bool
+	passphrase string
 }
 
+// Defaults for RPC failover, overridable with SetRPCRetry
+const (
+	DefaultRPCRetries = 3
+	DefaultRPCTimeout = 10 * time.Second
+)
+
+// Backoff between rounds of attempts across all RPC endpoints
+const (
+	rpcInitialBackoff = 200 * time.Millisecond
+	rpcMaxBackoff     = 5 * time.Second
+)
+
 // AccountInfo represents account information
 type AccountInfo struct {
 	Name       string `json:"name"`
 	Address    string `json:"address"`
 	PrivateKey string `json:"private_key"`
+	WatchOnly  bool   `json:"watch_only,omitempty"` // tracked address without a key
+	// Crypto holds the private key instead of PrivateKey once it is encrypted
+	Crypto *EncryptedKey `json:"crypto,omitempty"`
+}
+
+// maxBatchSubmit is the most transactions sent in one submit_transactions call
+const maxBatchSubmit = types.DefaultMaxTxPerBlock
+
+// DefaultTxValidity is how many blocks past the current height a transaction
+// the wallet signs may still be mined
+const DefaultTxValidity = 100
+
+// TxSubmitResult represents the outcome of one transaction in a batch submission
+type TxSubmitResult struct {
+	Index        int    `json:"index"`
+	TxHash       string `json:"tx_hash,omitempty"`
+	Accepted     bool   `json:"accepted"`
+	ErrorCode    string `json:"error_code,omitempty"`
+	ErrorMessage string `json:"error_message,omitempty"`
 }
 
-// NewWallet creates a new wallet
+// NewWallet creates a new wallet. rpcURL may list several comma-separated
+// endpoints, which are tried in order when one is unreachable.
 func NewWallet(dataDir, rpcURL string) *Wallet {
+	var urls []string
+	for _, url := range strings.Split(rpcURL, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			urls = append(urls, url)
+		}
+	}
+
 	return &Wallet{
-		rpcURL:  rpcURL,
-		dataDir: dataDir,
+		rpcURLs:    urls,
+		rpcRetries: DefaultRPCRetries,
+		dataDir:    dataDir,
+		client:     &http.Client{Timeout: DefaultRPCTimeout},
+	}
+}
+
+// SetRPCRetry sets how many extra rounds of attempts are made across the RPC
+// endpoints and the timeout of each individual request
+func (w *Wallet) SetRPCRetry(retries int, timeout time.Duration) {
+	if retries < 0 {
+		retries = 0
+	}
+	w.rpcRetries = retries
+	w.client.Timeout = timeout
+}
+
+// SetRPCAuthToken sets the bearer token sent with every RPC request, which
+// nodes configured with an rpc_auth_token require to accept transactions
+func (w *Wallet) SetRPCAuthToken(token string) {
+	w.authToken = token
+}
+
+// SetRPCRootCA trusts the PEM certificates in caFile, in addition to the
+// system roots, when connecting to an https:// RPC endpoint. This allows
+// nodes using self-signed certificates.
+func (w *Wallet) SetRPCRootCA(caFile string) error {
+	pemData, err := os.ReadFile(caFile)
+	if err != nil {
+		return fmt.Errorf("failed to read CA certificate: %v", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pemData) {
+		return fmt.Errorf("no valid certificates found in %s", caFile)
 	}
+
+	w.client = &http.Client{
+		Timeout: w.client.Timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs:    pool,
+				MinVersion: tls.VersionTLS12,
+			},
+		},
+	}
+
+	return nil
 }
 
 // CreateAccount creates a new account
@@ -60,211 +161,1348 @@ func (w *Wallet) CreateAccount(name string) (*AccountInfo, error) {
 
 	w.keyPair = keyPair
 	w.address = address
+	w.watchOnly = false
 
 	return account, nil
 }
 
-// ImportAccount imports an account from private key
-func (w *Wallet) ImportAccount(name, privateKeyHex string) (*AccountInfo, error) {
+// DuplicateAddressError reports that an imported key resolves to an address
+// already stored under other account names
+type DuplicateAddressError struct {
+	Address       string
+	ExistingNames []string
+}
+
+func (e *DuplicateAddressError) Error() string {
+	return fmt.Sprintf("address %s already exists as account %s", e.Address, strings.Join(e.ExistingNames, ", "))
+}
+
+// ImportAccount imports an account from private key. Importing a key whose
+// address is already stored under another name fails with a
+// DuplicateAddressError unless allowDuplicate is set.
+func (w *Wallet) ImportAccount(name, privateKeyHex string, allowDuplicate bool) (*AccountInfo, error) {
 	keyPair, err := crypto.PrivateKeyFromHex(privateKeyHex)
 	if err != nil {
 		return nil, fmt.Errorf("failed to import private key: %v", err)
 	}
 
-	address := keyPair.GetAddress()
+	address := keyPair.GetAddress()
+
+	if !allowDuplicate {
+		existing, err := w.AccountNamesByAddress(address.String())
+		if err != nil {
+			return nil, err
+		}
+
+		var others []string
+		for _, existingName := range existing {
+			if existingName != name {
+				others = append(others, existingName)
+			}
+		}
+		if len(others) > 0 {
+			return nil, &DuplicateAddressError{Address: address.String(), ExistingNames: others}
+		}
+	}
+
+	account := &AccountInfo{
+		Name:       name,
+		Address:    address.String(),
+		PrivateKey: privateKeyHex,
+	}
+
+	// Save account to file
+	if err := w.saveAccount(account); err != nil {
+		return nil, fmt.Errorf("failed to save account: %v", err)
+	}
+
+	w.keyPair = keyPair
+	w.address = address
+	w.watchOnly = false
+
+	return account, nil
+}
+
+// WatchAccount stores an address without a private key, so its balance and
+// history can be followed by name but nothing can be signed for it
+func (w *Wallet) WatchAccount(name, address string) (*AccountInfo, error) {
+	if name == "" || filepath.Base(name) != name {
+		return nil, fmt.Errorf("invalid account name: %q", name)
+	}
+
+	addr, err := crypto.AddressFromString(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address: %v", err)
+	}
+
+	// Never overwrite an account that may hold a key
+	if _, err := os.Stat(w.accountPath(name)); err == nil {
+		return nil, fmt.Errorf("account %s already exists", name)
+	}
+
+	account := &AccountInfo{
+		Name:      name,
+		Address:   addr.String(),
+		WatchOnly: true,
+	}
+
+	if err := w.saveAccount(account); err != nil {
+		return nil, fmt.Errorf("failed to save account: %v", err)
+	}
+
+	return account, nil
+}
+
+// LoadAccount loads an account by name. A watch-only account sets the
+// address used for queries but leaves the wallet unable to sign.
+func (w *Wallet) LoadAccount(name string) error {
+	account, err := w.loadAccount(name)
+	if err != nil {
+		return err
+	}
+
+	if account.WatchOnly {
+		addr, err := crypto.AddressFromString(account.Address)
+		if err != nil {
+			return fmt.Errorf("invalid address in account %s: %v", name, err)
+		}
+		w.keyPair = nil
+		w.address = addr
+		w.watchOnly = true
+		return nil
+	}
+
+	privateKey, err := accountKey(account, w.passphrase)
+	if err != nil {
+		return err
+	}
+	keyPair, err := crypto.PrivateKeyFromHex(privateKey)
+	if err != nil {
+		return fmt.Errorf("failed to load private key: %v", err)
+	}
+
+	w.keyPair = keyPair
+	w.address = keyPair.GetAddress()
+	w.watchOnly = false
+
+	return nil
+}
+
+// ErrWatchOnly is returned when signing is attempted with a watch-only account
+var ErrWatchOnly = errors.New("account is watch-only and cannot sign")
+
+// requireKey fails unless an account with a private key is loaded
+func (w *Wallet) requireKey() error {
+	if w.watchOnly {
+		return ErrWatchOnly
+	}
+	if w.keyPair == nil {
+		return fmt.Errorf("no account loaded")
+	}
+	return nil
+}
+
+// RenameAccount stores an account under a new name. It fails if the account
+// does not exist or the new name is already taken.
+func (w *Wallet) RenameAccount(oldName, newName string) error {
+	if newName == "" || filepath.Base(newName) != newName {
+		return fmt.Errorf("invalid account name: %q", newName)
+	}
+	if newName == oldName {
+		return fmt.Errorf("account is already named %s", oldName)
+	}
+
+	account, err := w.loadAccount(oldName)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(w.accountPath(newName)); err == nil {
+		return fmt.Errorf("account %s already exists", newName)
+	}
+
+	account.Name = newName
+	if err := w.saveAccount(account); err != nil {
+		return fmt.Errorf("failed to save account: %v", err)
+	}
+
+	if err := os.Remove(w.accountPath(oldName)); err != nil {
+		return fmt.Errorf("failed to remove old account file: %v", err)
+	}
+	return nil
+}
+
+// ErrLastAccount is returned when deleting an account would leave the wallet empty
+var ErrLastAccount = errors.New("refusing to delete the only account in the wallet")
+
+// DeleteAccount removes a stored account. Deleting the only account left in
+// the wallet fails unless allowEmpty is set.
+func (w *Wallet) DeleteAccount(name string, allowEmpty bool) error {
+	if _, err := w.loadAccount(name); err != nil {
+		return err
+	}
+
+	if !allowEmpty {
+		accounts, err := w.ListAccounts()
+		if err != nil {
+			return err
+		}
+		if len(accounts) <= 1 {
+			return ErrLastAccount
+		}
+	}
+
+	if err := os.Remove(w.accountPath(name)); err != nil {
+		return fmt.Errorf("failed to delete account: %v", err)
+	}
+	return nil
+}
+
+// GetAddress returns the address of the loaded account
+func (w *Wallet) GetAddress() types.Address {
+	return w.address
+}
+
+// ExportPrivateKey returns the raw private key hex of a stored account. Only
+// encrypted accounts can be exported, and only with their passphrase.
+func (w *Wallet) ExportPrivateKey(name, passphrase string) (string, error) {
+	account, err := w.loadAccount(name)
+	if err != nil {
+		return "", err
+	}
+
+	// Accounts without key material (watch-only) have nothing to export
+	if account.WatchOnly {
+		return "", fmt.Errorf("account %s is watch-only and has no private key", name)
+	}
+
+	if account.Crypto == nil {
+		return "", fmt.Errorf("account %s is not encrypted; encrypt it with a passphrase before exporting its key", name)
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("exporting the key of account %s requires its passphrase", name)
+	}
+	privateKey, err := decryptKey(account.Crypto, passphrase)
+	if err != nil {
+		return "", fmt.Errorf("failed to open account %s: %v", name, err)
+	}
+
+	// Make sure the stored key is usable before handing it out
+	if _, err := crypto.PrivateKeyFromHex(privateKey); err != nil {
+		return "", fmt.Errorf("failed to load private key: %v", err)
+	}
+
+	return privateKey, nil
+}
+
+// messagePrefix separates signed messages from signed transactions
+const messagePrefix = "Agent Chain Signed Message:\n"
+
+// SignMessage signs an arbitrary message with the loaded account. The returned
+// signature is the hex of public key || r || s, so a verifier holding only the
+// address can check it.
+func (w *Wallet) SignMessage(message string) (string, error) {
+	if err := w.requireKey(); err != nil {
+		return "", err
+	}
+
+	signature, err := w.keyPair.Sign([]byte(messagePrefix + message))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign message: %v", err)
+	}
+
+	pubKey := crypto.PublicKeyToBytes(w.keyPair.PublicKey)
+	return hex.EncodeToString(append(pubKey, signature...)), nil
+}
+
+// VerifyMessage checks a signature produced by SignMessage against an address
+func VerifyMessage(address, message, signatureHex string) error {
+	addr, err := crypto.AddressFromString(address)
+	if err != nil {
+		return fmt.Errorf("invalid address: %v", err)
+	}
+
+	data, err := hex.DecodeString(strings.TrimPrefix(signatureHex, "0x"))
+	if err != nil {
+		return fmt.Errorf("invalid signature: %v", err)
+	}
+	if len(data) != 128 {
+		return fmt.Errorf("invalid signature length: %d", len(data))
+	}
+
+	pubKey, err := crypto.PublicKeyFromBytes(data[:64])
+	if err != nil {
+		return fmt.Errorf("invalid signature: %v", err)
+	}
+
+	if crypto.AddressFromPublicKey(pubKey) != addr {
+		return fmt.Errorf("signature was made by a different address")
+	}
+
+	if !crypto.VerifySignature(pubKey, []byte(messagePrefix+message), data[64:]) {
+		return fmt.Errorf("signature does not match message")
+	}
+
+	return nil
+}
+
+// GetBalance gets account balance
+func (w *Wallet) GetBalance(address string) (int64, error) {
+	if address == "" && w.address != (types.Address{}) {
+		address = w.address.String()
+	}
+
+	addr, err := crypto.AddressFromString(address)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address: %v", err)
+	}
+
+	// Make RPC call to get balance
+	resp, err := w.makeRPCCall("get_balance", map[string]interface{}{
+		"address": addr.String(),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	balance, ok := resp["balance"].(float64)
+	if !ok {
+		return 0, fmt.Errorf("invalid balance response")
+	}
+
+	return int64(balance), nil
+}
+
+// maxParallelBalances bounds concurrent balance queries in GetAllBalances
+const maxParallelBalances = 8
+
+// AccountBalance is the balance of one stored account, or the error fetching it
+type AccountBalance struct {
+	Name    string
+	Address string
+	Balance int64
+	Err     error
+}
+
+// GetAllBalances fetches the balance of every stored account in parallel.
+// A failed query is reported in that account's Err rather than failing the
+// whole listing.
+func (w *Wallet) GetAllBalances() ([]AccountBalance, error) {
+	accounts, err := w.ListAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	balances := make([]AccountBalance, len(accounts))
+	sem := make(chan struct{}, maxParallelBalances)
+	var wg sync.WaitGroup
+	for i, account := range accounts {
+		balances[i] = AccountBalance{Name: account.Name, Address: account.Address}
+
+		wg.Add(1)
+		go func(entry *AccountBalance) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			entry.Balance, entry.Err = w.GetBalance(entry.Address)
+		}(&balances[i])
+	}
+	wg.Wait()
+
+	return balances, nil
+}
+
+// SendTransaction sends a transaction
+func (w *Wallet) SendTransaction(to string, amount, fee int64) (string, error) {
+	if err := w.requireKey(); err != nil {
+		return "", err
+	}
+
+	toAddr, err := crypto.AddressFromString(to)
+	if err != nil {
+		return "", fmt.Errorf("invalid to address: %v", err)
+	}
+
+	nonce, err := w.nextNonce()
+	if err != nil {
+		return "", err
+	}
+
+	// Create transaction
+	tx := &types.Transaction{
+		Type:      types.TxTypeTransfer,
+		From:      w.address,
+		To:        toAddr,
+		Amount:    amount,
+		Fee:       fee,
+		Timestamp: time.Now().Unix(),
+		Nonce:     nonce,
+	}
+
+	if err := w.signForChain(tx); err != nil {
+		return "", err
+	}
+
+	return w.submitTransaction(tx)
+}
+
+// BuildUnsignedTransaction builds a transfer for offline signing and returns
+// it as canonical JSON. All fields, including the nonce, are fixed here so the
+// signing machine needs no RPC access.
+func (w *Wallet) BuildUnsignedTransaction(from, to string, amount, fee, nonce, chainID int64) (string, error) {
+	fromAddr, err := crypto.AddressFromString(from)
+	if err != nil {
+		return "", fmt.Errorf("invalid from address: %v", err)
+	}
+
+	toAddr, err := crypto.AddressFromString(to)
+	if err != nil {
+		return "", fmt.Errorf("invalid to address: %v", err)
+	}
+
+	if chainID == 0 {
+		if chainID, err = w.GetChainID(); err != nil {
+			return "", fmt.Errorf("failed to get chain ID: %v", err)
+		}
+	}
+
+	tx := &types.Transaction{
+		Type:      types.TxTypeTransfer,
+		From:      fromAddr,
+		To:        toAddr,
+		Amount:    amount,
+		Fee:       fee,
+		Timestamp: time.Now().Unix(),
+		Nonce:     nonce,
+		ChainID:   chainID,
+	}
+
+	data, err := json.MarshalIndent(tx, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode transaction: %v", err)
+	}
+
+	return string(data), nil
+}
+
+// SignRawTransaction signs an unsigned transaction produced by
+// BuildUnsignedTransaction with the loaded account, without contacting a node
+func (w *Wallet) SignRawTransaction(rawTx string) (string, error) {
+	if err := w.requireKey(); err != nil {
+		return "", err
+	}
+
+	var tx types.Transaction
+	if err := json.Unmarshal([]byte(rawTx), &tx); err != nil {
+		return "", fmt.Errorf("invalid raw transaction: %v", err)
+	}
+
+	if len(tx.Signature) != 0 {
+		return "", fmt.Errorf("transaction is already signed")
+	}
+
+	if tx.From != w.address {
+		return "", fmt.Errorf("transaction sender %s does not match loaded account %s", tx.From, w.address)
+	}
+
+	if err := w.signTransaction(&tx); err != nil {
+		return "", err
+	}
+
+	data, err := json.MarshalIndent(&tx, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode transaction: %v", err)
+	}
+
+	return string(data), nil
+}
+
+// BroadcastRawTransaction submits a transaction signed by SignRawTransaction
+func (w *Wallet) BroadcastRawTransaction(signedTx string) (string, error) {
+	var tx types.Transaction
+	if err := json.Unmarshal([]byte(signedTx), &tx); err != nil {
+		return "", fmt.Errorf("invalid signed transaction: %v", err)
+	}
+
+	if len(tx.Signature) == 0 {
+		return "", fmt.Errorf("transaction is not signed")
+	}
+
+	if tx.Hash != tx.CalculateHash() {
+		return "", fmt.Errorf("transaction hash does not match its contents")
+	}
+
+	return w.submitTransaction(&tx)
+}
+
+// signTransaction signs the transaction with the loaded key and sets its hash
+func (w *Wallet) signTransaction(tx *types.Transaction) error {
+	if err := w.keyPair.SignTransaction(tx); err != nil {
+		return fmt.Errorf("failed to sign transaction: %v", err)
+	}
+
+	return nil
+}
+
+// signForChain binds the transaction to the node's chain, sets its expiry
+// unless the caller already did, and signs it
+func (w *Wallet) signForChain(tx *types.Transaction) error {
+	chainID, err := w.GetChainID()
+	if err != nil {
+		return fmt.Errorf("failed to get chain ID: %v", err)
+	}
+	tx.ChainID = chainID
+
+	if tx.ValidUntil == 0 {
+		if tx.ValidUntil, err = w.expiryHeight(); err != nil {
+			return err
+		}
+	}
+	return w.signTransaction(tx)
+}
+
+// expiryHeight returns the default ValidUntil for a transaction signed now
+func (w *Wallet) expiryHeight() (int64, error) {
+	height, err := w.GetHeight()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get height: %v", err)
+	}
+	return height + DefaultTxValidity, nil
+}
+
+// submitTransaction sends a signed transaction to the node
+func (w *Wallet) submitTransaction(tx *types.Transaction) (string, error) {
+	resp, err := w.makeRPCCall("submit_transaction", map[string]interface{}{
+		"transaction": tx,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	txHash, ok := resp["tx_hash"].(string)
+	if !ok {
+		return "", fmt.Errorf("invalid transaction response")
+	}
+
+	return txHash, nil
+}
+
+// SubmitPatch submits a patch set
+func (w *Wallet) SubmitPatch(patchFile, codeHash string, gasLimit int64) (string, error) {
+	if err := w.requireKey(); err != nil {
+		return "", err
+	}
+
+	patchSet, err := ReadPatchSet(patchFile)
+	if err != nil {
+		return "", err
+	}
+	if err := StampCodeHash(patchSet, codeHash); err != nil {
+		return "", err
+	}
+
+	// Set author and timestamp
+	patchSet.Author = w.address
+	patchSet.Timestamp = time.Now().Unix()
+
+	// Sign patch set
+	if err := w.keyPair.SignPatchSet(patchSet); err != nil {
+		return "", fmt.Errorf("failed to sign patch: %v", err)
+	}
+
+	nonce, err := w.nextNonce()
+	if err != nil {
+		return "", err
+	}
+
+	// Create transaction
+	tx := &types.Transaction{
+		Type:      types.TxTypePatchSubmit,
+		From:      w.address,
+		To:        types.Address{}, // Zero address for patch submissions
+		Amount:    0,
+		PatchSet:  patchSet,
+		Timestamp: time.Now().Unix(),
+		Nonce:     nonce,
+		GasLimit:  gasLimit,
+	}
+
+	if err := w.signForChain(tx); err != nil {
+		return "", err
+	}
+
+	// Submit transaction
+	resp, err := w.makeRPCCall("submit_transaction", map[string]interface{}{
+		"transaction": tx,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	txHash, ok := resp["tx_hash"].(string)
+	if !ok {
+		return "", fmt.Errorf("invalid transaction response")
+	}
+
+	return txHash, nil
+}
+
+// ReadPatchSet loads a patch set from a JSON file. Any other file is wrapped
+// as a binary patch for the bootstrap problem: text is kept in the code, and
+// anything that is not valid UTF-8 is carried as a base64 artifact, since
+// JSON cannot hold it verbatim.
+func ReadPatchSet(patchFile string) (*types.PatchSet, error) {
+	patchData, err := os.ReadFile(patchFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read patch file: %v", err)
+	}
+
+	var patchSet types.PatchSet
+
+	// Try to parse as JSON first, if that fails, treat as binary
+	if err := json.Unmarshal(patchData, &patchSet); err != nil {
+		patchSet = types.PatchSet{
+			ID:        fmt.Sprintf("patch-%d", time.Now().Unix()),
+			ProblemID: "SYS-BOOTSTRAP-DEVNET-001",
+			Language:  "binary",
+		}
+		if utf8.Valid(patchData) {
+			patchSet.Code = string(patchData)
+			patchSet.Files = map[string]string{
+				patchFile: string(patchData),
+			}
+		} else {
+			patchSet.SetArtifact(patchData, http.DetectContentType(patchData))
+		}
+	}
+
+	return &patchSet, nil
+}
+
+// StampCodeHash records the SHA-256 of the patch's code in the patch set,
+// first checking it against the expected hash when one is given
+func StampCodeHash(patch *types.PatchSet, expected string) error {
+	actual := patch.ComputeCodeHash()
+	if expected != "" && !strings.EqualFold(strings.TrimPrefix(expected, "0x"), actual) {
+		return fmt.Errorf("code hash mismatch: expected %s, code hashes to %s", expected, actual)
+	}
+	patch.CodeHash = actual
+	return nil
+}
+
+// CreateProblem publishes a problem and escrows its reward from the loaded account
+func (w *Wallet) CreateProblem(spec *types.ProblemSpec, fee int64) (string, error) {
+	if err := spec.Validate(); err != nil {
+		return "", err
+	}
+
+	return w.sendProblemTransaction(&types.Transaction{
+		Type:    types.TxTypeProblemCreate,
+		Problem: spec,
+		Fee:     fee,
+	})
+}
+
+// AddProblemReward increases the escrowed reward of a problem the loaded account created
+func (w *Wallet) AddProblemReward(problemID string, amount, fee int64) (string, error) {
+	return w.sendProblemTransaction(&types.Transaction{
+		Type:      types.TxTypeProblemUpdate,
+		ProblemID: problemID,
+		Amount:    amount,
+		Fee:       fee,
+	})
+}
+
+// CloseProblem closes an unsolved problem and refunds its escrow to the loaded account
+func (w *Wallet) CloseProblem(problemID string, fee int64) (string, error) {
+	return w.sendProblemTransaction(&types.Transaction{
+		Type:      types.TxTypeProblemClose,
+		ProblemID: problemID,
+		Fee:       fee,
+	})
+}
+
+// GetProblem fetches the on-chain state of a problem
+func (w *Wallet) GetProblem(problemID string) (*types.Problem, error) {
+	resp, err := w.makeRPCCall("get_problem", map[string]interface{}{
+		"id": problemID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	problemData, err := json.Marshal(resp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid problem response: %v", err)
+	}
+
+	var problem types.Problem
+	if err := json.Unmarshal(problemData, &problem); err != nil {
+		return nil, fmt.Errorf("invalid problem response: %v", err)
+	}
+
+	return &problem, nil
+}
+
+// sendProblemTransaction fills in the sender, signs and submits a problem transaction
+func (w *Wallet) sendProblemTransaction(tx *types.Transaction) (string, error) {
+	if err := w.requireKey(); err != nil {
+		return "", err
+	}
+
+	nonce, err := w.nextNonce()
+	if err != nil {
+		return "", err
+	}
+
+	tx.From = w.address
+	tx.Timestamp = time.Now().Unix()
+	tx.Nonce = nonce
+
+	if err := w.signForChain(tx); err != nil {
+		return "", err
+	}
+
+	return w.submitTransaction(tx)
+}
+
+// SubmitTransactions submits signed transactions in a single batch call
+// and returns the per-transaction outcome reported by the node
+func (w *Wallet) SubmitTransactions(txs []*types.Transaction) ([]TxSubmitResult, error) {
+	resp, err := w.makeRPCCall("submit_transactions", map[string]interface{}{
+		"transactions": txs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resultsData, err := json.Marshal(resp["results"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid batch response: %v", err)
+	}
+
+	var results []TxSubmitResult
+	if err := json.Unmarshal(resultsData, &results); err != nil {
+		return nil, fmt.Errorf("invalid batch response: %v", err)
+	}
+
+	if len(results) != len(txs) {
+		return nil, fmt.Errorf("invalid batch response: expected %d results, got %d", len(txs), len(results))
+	}
+
+	return results, nil
+}
+
+// Payment is one transfer in a batch send
+type Payment struct {
+	To     string
+	Amount int64
+	Fee    int64
+}
+
+// PaymentResult reports the outcome of one payment in a batch send
+type PaymentResult struct {
+	Payment Payment
+	TxHash  string
+	Err     error
+}
+
+// GetNonce returns the nonce the address's next transaction should use: the
+// number of its transactions mined, plus those still waiting in the pool
+func (w *Wallet) GetNonce(address string) (int64, error) {
+	addr, err := crypto.AddressFromString(address)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address: %v", err)
+	}
+
+	resp, err := w.makeRPCCall("get_balance", map[string]interface{}{
+		"address": addr.String(),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Older nodes only report the mined nonce
+	nonce, ok := resp["pending_nonce"].(float64)
+	if !ok {
+		if nonce, ok = resp["nonce"].(float64); !ok {
+			return 0, fmt.Errorf("invalid nonce response")
+		}
+	}
+
+	return int64(nonce), nil
+}
+
+// nextNonce returns the nonce for the loaded account's next transaction
+func (w *Wallet) nextNonce() (int64, error) {
+	nonce, err := w.GetNonce(w.address.String())
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch nonce: %v", err)
+	}
+	return nonce, nil
+}
+
+// SendBatch signs a transfer for every payment from the loaded account, with
+// consecutive nonces starting at the account's current nonce, and submits
+// them in as few batch calls as possible. Each payment gets its own result;
+// an error is only returned if nothing could be attempted.
+func (w *Wallet) SendBatch(payments []Payment) ([]PaymentResult, error) {
+	if err := w.requireKey(); err != nil {
+		return nil, err
+	}
+
+	nonce, err := w.GetNonce(w.address.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch nonce: %v", err)
+	}
+	validUntil, err := w.expiryHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]PaymentResult, len(payments))
+	var txs []*types.Transaction
+	var txResults []int
+	now := time.Now().Unix()
+
+	for i, payment := range payments {
+		results[i].Payment = payment
+
+		toAddr, err := crypto.AddressFromString(payment.To)
+		if err != nil {
+			results[i].Err = fmt.Errorf("invalid to address: %v", err)
+			continue
+		}
+
+		tx := &types.Transaction{
+			Type:       types.TxTypeTransfer,
+			From:       w.address,
+			To:         toAddr,
+			Amount:     payment.Amount,
+			Fee:        payment.Fee,
+			Timestamp:  now,
+			Nonce:      nonce,
+			ValidUntil: validUntil,
+		}
+		if err := w.signForChain(tx); err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		nonce++
+		results[i].TxHash = "0x" + tx.Hash.String()
+		txs = append(txs, tx)
+		txResults = append(txResults, i)
+	}
+
+	for start := 0; start < len(txs); start += maxBatchSubmit {
+		end := start + maxBatchSubmit
+		if end > len(txs) {
+			end = len(txs)
+		}
+
+		submitted, err := w.SubmitTransactions(txs[start:end])
+		for j := start; j < end; j++ {
+			result := &results[txResults[j]]
+			switch {
+			case err != nil:
+				result.Err = err
+			case !submitted[j-start].Accepted:
+				result.Err = fmt.Errorf("%s: %s", submitted[j-start].ErrorCode, submitted[j-start].ErrorMessage)
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// GetHeight gets blockchain height
+func (w *Wallet) GetHeight() (int64, error) {
+	resp, err := w.makeRPCCall("get_height", nil)
+	if err != nil {
+		return 0, err
+	}
+
+	height, ok := resp["height"].(float64)
+	if !ok {
+		return 0, fmt.Errorf("invalid height response")
+	}
+
+	return int64(height), nil
+}
+
+// ChainInfo holds the chain parameters the wallet needs from the node
+type ChainInfo struct {
+	ChainID           int64 `json:"chain_id"`
+	Decimals          int   `json:"decimals"`
+	MinValidatorStake int64 `json:"min_validator_stake"`
+	MinDelegatorStake int64 `json:"min_delegator_stake"`
+	UnbondingPeriod   int64 `json:"unbonding_period"`
+}
+
+// GetChainInfo returns the chain parameters of the connected node, fetched
+// once and cached
+func (w *Wallet) GetChainInfo() (*ChainInfo, error) {
+	if w.chainInfo != nil {
+		return w.chainInfo, nil
+	}
+
+	resp, err := w.makeRPCCall("get_chain_info", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	infoData, err := json.Marshal(resp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chain info response: %v", err)
+	}
+	info := &ChainInfo{}
+	if err := json.Unmarshal(infoData, info); err != nil {
+		return nil, fmt.Errorf("invalid chain info response: %v", err)
+	}
+
+	w.chainInfo = info
+	return info, nil
+}
+
+// GetChainID returns the chain ID of the connected node
+func (w *Wallet) GetChainID() (int64, error) {
+	info, err := w.GetChainInfo()
+	if err != nil {
+		return 0, err
+	}
+	return info.ChainID, nil
+}
+
+// ParseAmount converts a decimal token amount such as "1.5" into base units
+// using the chain's decimals
+func (w *Wallet) ParseAmount(amount string) (int64, error) {
+	info, err := w.GetChainInfo()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get chain decimals: %v", err)
+	}
+	return types.ParseAmount(amount, info.Decimals)
+}
+
+// FormatAmount renders base units as a decimal token amount, falling back to
+// the raw integer when the chain's decimals cannot be fetched
+func (w *Wallet) FormatAmount(amount int64) string {
+	info, err := w.GetChainInfo()
+	if err != nil {
+		return fmt.Sprintf("%d", amount)
+	}
+	return types.FormatAmount(amount, info.Decimals)
+}
+
+// GetNextProposer gets the validator scheduled to propose the next block
+func (w *Wallet) GetNextProposer() (string, int64, error) {
+	resp, err := w.makeRPCCall("get_next_proposer", nil)
+	if err != nil {
+		return "", 0, err
+	}
+
+	proposer, ok := resp["proposer"].(string)
+	if !ok {
+		return "", 0, fmt.Errorf("invalid proposer response")
+	}
+
+	height, ok := resp["height"].(float64)
+	if !ok {
+		return "", 0, fmt.Errorf("invalid proposer response")
+	}
+
+	return proposer, int64(height), nil
+}
+
+// SyncStatus reports how far the node is from the chain tip its peers see
+type SyncStatus struct {
+	CurrentHeight     int64 `json:"current_height"`
+	HighestPeerHeight int64 `json:"highest_peer_height"`
+	Syncing           bool  `json:"syncing"`
+}
+
+// GetSyncStatus returns whether the connected node has caught up with its peers
+func (w *Wallet) GetSyncStatus() (*SyncStatus, error) {
+	resp, err := w.makeRPCCall("get_sync_status", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	statusData, err := json.Marshal(resp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sync status response: %v", err)
+	}
+
+	var status SyncStatus
+	if err := json.Unmarshal(statusData, &status); err != nil {
+		return nil, fmt.Errorf("invalid sync status response: %v", err)
+	}
+
+	return &status, nil
+}
+
+// GetBlockByHeight fetches the block at the given height
+func (w *Wallet) GetBlockByHeight(height int64) (*types.Block, error) {
+	return w.getBlock(map[string]interface{}{
+		"height": height,
+	})
+}
+
+// GetBlockByHash fetches the block with the given hash
+func (w *Wallet) GetBlockByHash(hash string) (*types.Block, error) {
+	return w.getBlock(map[string]interface{}{
+		"hash": hash,
+	})
+}
+
+// getBlock performs a get_block RPC call and decodes the result
+func (w *Wallet) getBlock(params map[string]interface{}) (*types.Block, error) {
+	resp, err := w.makeRPCCall("get_block", params)
+	if err != nil {
+		return nil, err
+	}
+
+	blockData, err := json.Marshal(resp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block response: %v", err)
+	}
+
+	var block types.Block
+	if err := json.Unmarshal(blockData, &block); err != nil {
+		return nil, fmt.Errorf("invalid block response: %v", err)
+	}
+
+	return &block, nil
+}
+
+// HistoryEntry is a mined transaction involving an account
+type HistoryEntry struct {
+	Transaction types.Transaction `json:"transaction"`
+	BlockHeight int64             `json:"block_height"`
+	BlockHash   string            `json:"block_hash"`
+	BlockTime   int64             `json:"block_time"`
+	Index       int               `json:"index"`
+}
+
+// GetHistory fetches a page of the mined transactions sent from or to the
+// address, newest first, and the total number that match. An empty txType
+// matches every type; a limit of zero fetches every page.
+func (w *Wallet) GetHistory(address, txType string, offset, limit int) ([]HistoryEntry, int, error) {
+	if address == "" && w.address != (types.Address{}) {
+		address = w.address.String()
+	}
+
+	addr, err := crypto.AddressFromString(address)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid address: %v", err)
+	}
+
+	var entries []HistoryEntry
+	for {
+		params := map[string]interface{}{
+			"address": addr.String(),
+			"offset":  offset + len(entries),
+		}
+		if txType != "" {
+			params["type"] = txType
+		}
+		if limit > 0 {
+			params["limit"] = limit - len(entries)
+		}
+
+		resp, err := w.makeRPCCall("get_transactions", params)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		total, ok := resp["total"].(float64)
+		if !ok {
+			return nil, 0, fmt.Errorf("invalid history response")
+		}
 
-	account := &AccountInfo{
-		Name:       name,
-		Address:    address.String(),
-		PrivateKey: privateKeyHex,
-	}
+		txsData, err := json.Marshal(resp["transactions"])
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid history response: %v", err)
+		}
 
-	// Save account to file
-	if err := w.saveAccount(account); err != nil {
-		return nil, fmt.Errorf("failed to save account: %v", err)
-	}
+		var page []HistoryEntry
+		if err := json.Unmarshal(txsData, &page); err != nil {
+			return nil, 0, fmt.Errorf("invalid history response: %v", err)
+		}
+		entries = append(entries, page...)
 
-	w.keyPair = keyPair
-	w.address = address
+		// The node caps page sizes, so keep going until the range is covered
+		done := offset+len(entries) >= int(total) || (limit > 0 && len(entries) >= limit)
+		if done || len(page) == 0 {
+			return entries, int(total), nil
+		}
+	}
+}
 
-	return account, nil
+// receiptPollInterval is how often WaitForTransaction polls the node
+const receiptPollInterval = time.Second
+
+// Receipt describes where a transaction was mined
+type Receipt struct {
+	TxHash      string `json:"tx_hash"`
+	Status      string `json:"status"`
+	BlockHeight int64  `json:"block_height"`
+	BlockHash   string `json:"block_hash"`
+	Index       int    `json:"index"`
+	GasUsed     int64  `json:"gas_used,omitempty"`
 }
 
-// LoadAccount loads an account by name
-func (w *Wallet) LoadAccount(name string) error {
-	account, err := w.loadAccount(name)
+// GetReceipt reports whether a transaction is pending or mined
+func (w *Wallet) GetReceipt(hash string) (*Receipt, error) {
+	resp, err := w.makeRPCCall("get_transaction", map[string]interface{}{
+		"hash": hash,
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	keyPair, err := crypto.PrivateKeyFromHex(account.PrivateKey)
+	receiptData, err := json.Marshal(resp)
 	if err != nil {
-		return fmt.Errorf("failed to load private key: %v", err)
+		return nil, fmt.Errorf("invalid transaction response: %v", err)
 	}
 
-	w.keyPair = keyPair
-	w.address = keyPair.GetAddress()
+	receipt := &Receipt{TxHash: hash}
+	if err := json.Unmarshal(receiptData, receipt); err != nil {
+		return nil, fmt.Errorf("invalid transaction response: %v", err)
+	}
 
-	return nil
+	return receipt, nil
 }
 
-// GetBalance gets account balance
-func (w *Wallet) GetBalance(address string) (int64, error) {
-	if address == "" && w.address != (types.Address{}) {
-		address = w.address.String()
-	}
+// WaitForTransaction polls the node until the transaction is mined or the
+// timeout elapses. Errors while polling, including an unreachable node or a
+// transaction the node has not seen yet, are retried until the deadline.
+func (w *Wallet) WaitForTransaction(hash string, timeout time.Duration) (*Receipt, error) {
+	deadline := time.Now().Add(timeout)
+
+	var lastErr error
+	for {
+		receipt, err := w.GetReceipt(hash)
+		if err == nil && receipt.Status == "mined" {
+			return receipt, nil
+		}
+		lastErr = err
 
-	// Make RPC call to get balance
-	resp, err := w.makeRPCCall("get_balance", map[string]interface{}{
-		"address": address,
-	})
-	if err != nil {
-		return 0, err
+		if time.Now().Add(receiptPollInterval).After(deadline) {
+			break
+		}
+		time.Sleep(receiptPollInterval)
 	}
 
-	balance, ok := resp["balance"].(float64)
-	if !ok {
-		return 0, fmt.Errorf("invalid balance response")
+	if lastErr != nil {
+		return nil, fmt.Errorf("transaction %s not mined within %s: %v", hash, timeout, lastErr)
 	}
+	return nil, fmt.Errorf("transaction %s still pending after %s", hash, timeout)
+}
 
-	return int64(balance), nil
+// headersPerRequest is the number of headers fetched per get_headers call
+const headersPerRequest = 500
+
+// Checkpoint is a block height and hash the user trusts
+type Checkpoint struct {
+	Height int64  `json:"height"`
+	Hash   string `json:"hash"`
 }
 
-// SendTransaction sends a transaction
-func (w *Wallet) SendTransaction(to string, amount int64) (string, error) {
-	if w.keyPair == nil {
-		return "", fmt.Errorf("no account loaded")
-	}
+// ChainVerification summarizes a successful header chain verification
+type ChainVerification struct {
+	FromHeight int64      `json:"from_height"`
+	TipHeight  int64      `json:"tip_height"`
+	TipHash    types.Hash `json:"tip_hash"`
+	Headers    int64      `json:"headers"`
+}
 
-	toAddr, err := crypto.AddressFromString(to)
-	if err != nil {
-		return "", fmt.Errorf("invalid to address: %v", err)
-	}
+// MempoolEntry summarizes a transaction waiting in the node's pool
+type MempoolEntry struct {
+	Hash   string `json:"hash"`
+	Type   string `json:"type"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Amount int64  `json:"amount"`
+	Fee    int64  `json:"fee"`
+	Nonce  int64  `json:"nonce"`
+}
 
-	// Create transaction
-	tx := &types.Transaction{
-		Type:      types.TxTypeTransfer,
-		From:      w.address,
-		To:        toAddr,
-		Amount:    amount,
-		Timestamp: time.Now().Unix(),
-		Nonce:     0, // Should get from account state
+// GetMempool returns a page of pending transactions, optionally only those
+// sent from or to address, along with the total number matching
+func (w *Wallet) GetMempool(address string, offset, limit int) ([]MempoolEntry, int, error) {
+	params := map[string]interface{}{
+		"offset": offset,
+		"limit":  limit,
+	}
+	if address != "" {
+		addr, err := crypto.AddressFromString(address)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid address: %v", err)
+		}
+		params["address"] = addr.String()
 	}
 
-	// Sign transaction
-	txData, _ := json.Marshal(tx)
-	signature, err := w.keyPair.Sign(txData)
+	resp, err := w.makeRPCCall("get_mempool", params)
 	if err != nil {
-		return "", fmt.Errorf("failed to sign transaction: %v", err)
+		return nil, 0, err
 	}
-	tx.Signature = signature
-	tx.Hash = tx.CalculateHash()
 
-	// Submit transaction
-	resp, err := w.makeRPCCall("submit_transaction", map[string]interface{}{
-		"transaction": tx,
-	})
+	entriesData, err := json.Marshal(resp["transactions"])
 	if err != nil {
-		return "", err
+		return nil, 0, fmt.Errorf("invalid mempool response: %v", err)
 	}
 
-	txHash, ok := resp["tx_hash"].(string)
+	var entries []MempoolEntry
+	if err := json.Unmarshal(entriesData, &entries); err != nil {
+		return nil, 0, fmt.Errorf("invalid mempool response: %v", err)
+	}
+
+	total, ok := resp["total"].(float64)
 	if !ok {
-		return "", fmt.Errorf("invalid transaction response")
+		return nil, 0, fmt.Errorf("invalid mempool response")
 	}
 
-	return txHash, nil
+	return entries, int(total), nil
 }
 
-// SubmitPatch submits a patch set
-func (w *Wallet) SubmitPatch(patchFile string) (string, error) {
-	if w.keyPair == nil {
-		return "", fmt.Errorf("no account loaded")
+// GetPeers returns the peers the node is connected to
+func (w *Wallet) GetPeers() ([]types.NodeInfo, error) {
+	resp, err := w.makeRPCCall("get_peers", nil)
+	if err != nil {
+		return nil, err
 	}
 
-	// Read patch file
-	patchData, err := os.ReadFile(patchFile)
+	peersData, err := json.Marshal(resp["peers"])
 	if err != nil {
-		return "", fmt.Errorf("failed to read patch file: %v", err)
+		return nil, fmt.Errorf("invalid peers response: %v", err)
 	}
 
-	var patchSet types.PatchSet
-
-	// Try to parse as JSON first, if that fails, treat as binary
-	if err := json.Unmarshal(patchData, &patchSet); err != nil {
-		// If JSON parsing fails, create a PatchSet for binary data
-		patchSet = types.PatchSet{
-			ID:        fmt.Sprintf("patch-%d", time.Now().Unix()),
-			ProblemID: "SYS-BOOTSTRAP-DEVNET-001",
-			Code:      string(patchData), // Store binary data as string
-			Language:  "binary",
-			Files: map[string]string{
-				patchFile: string(patchData),
-			},
-		}
+	var peers []types.NodeInfo
+	if err := json.Unmarshal(peersData, &peers); err != nil {
+		return nil, fmt.Errorf("invalid peers response: %v", err)
 	}
 
-	// Set author and timestamp
-	patchSet.Author = w.address
-	patchSet.Timestamp = time.Now().Unix()
+	return peers, nil
+}
 
-	// Sign patch set
-	patchData, _ = json.Marshal(patchSet)
-	signature, err := w.keyPair.Sign(patchData)
+// BlockSummary is the compact view of a block used for listings
+type BlockSummary struct {
+	Height    int64  `json:"height"`
+	Hash      string `json:"hash"`
+	Timestamp int64  `json:"timestamp"`
+	Validator string `json:"validator"`
+	TxCount   int    `json:"tx_count"`
+}
+
+// GetBlocks returns summaries of the blocks from height from through to
+func (w *Wallet) GetBlocks(from, to int64) ([]BlockSummary, error) {
+	resp, err := w.makeRPCCall("get_blocks", map[string]interface{}{
+		"from": from,
+		"to":   to,
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to sign patch: %v", err)
+		return nil, err
 	}
-	patchSet.Signature = signature
 
-	// Create transaction
-	tx := &types.Transaction{
-		Type:      types.TxTypePatchSubmit,
-		From:      w.address,
-		To:        types.Address{}, // Zero address for patch submissions
-		Amount:    0,
-		PatchSet:  &patchSet,
-		Timestamp: time.Now().Unix(),
-		Nonce:     0,
+	blocksData, err := json.Marshal(resp["blocks"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid blocks response: %v", err)
 	}
 
-	// Sign transaction
-	txData, _ := json.Marshal(tx)
-	txSignature, err := w.keyPair.Sign(txData)
-	if err != nil {
-		return "", fmt.Errorf("failed to sign transaction: %v", err)
+	var blocks []BlockSummary
+	if err := json.Unmarshal(blocksData, &blocks); err != nil {
+		return nil, fmt.Errorf("invalid blocks response: %v", err)
 	}
-	tx.Signature = txSignature
-	tx.Hash = tx.CalculateHash()
 
-	// Submit transaction
-	resp, err := w.makeRPCCall("submit_transaction", map[string]interface{}{
-		"transaction": tx,
+	return blocks, nil
+}
+
+// GetHeaders fetches up to count block headers starting at the given height
+func (w *Wallet) GetHeaders(from int64, count int) ([]types.BlockHeader, error) {
+	resp, err := w.makeRPCCall("get_headers", map[string]interface{}{
+		"from":  from,
+		"count": count,
 	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	txHash, ok := resp["tx_hash"].(string)
-	if !ok {
-		return "", fmt.Errorf("invalid transaction response")
+	headersData, err := json.Marshal(resp["headers"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid headers response: %v", err)
 	}
 
-	return txHash, nil
+	var headers []types.BlockHeader
+	if err := json.Unmarshal(headersData, &headers); err != nil {
+		return nil, fmt.Errorf("invalid headers response: %v", err)
+	}
+
+	return headers, nil
 }
 
-// GetHeight gets blockchain height
-func (w *Wallet) GetHeight() (int64, error) {
-	resp, err := w.makeRPCCall("get_height", nil)
+// VerifyChain fetches headers from the checkpoint to the node's tip and checks
+// that each header hashes correctly and links to its predecessor
+func (w *Wallet) VerifyChain(checkpoint *Checkpoint) (*ChainVerification, error) {
+	trusted, err := crypto.HashFromString(checkpoint.Hash)
 	if err != nil {
-		return 0, err
+		return nil, fmt.Errorf("invalid checkpoint hash: %v", err)
 	}
 
-	height, ok := resp["height"].(float64)
-	if !ok {
-		return 0, fmt.Errorf("invalid height response")
+	tip, err := w.GetHeight()
+	if err != nil {
+		return nil, err
 	}
 
-	return int64(height), nil
+	if checkpoint.Height < 0 || checkpoint.Height > tip {
+		return nil, fmt.Errorf("checkpoint height %d is beyond node tip %d", checkpoint.Height, tip)
+	}
+
+	var prev *types.BlockHeader
+	result := &ChainVerification{FromHeight: checkpoint.Height}
+
+	for next := checkpoint.Height; next <= tip; {
+		headers, err := w.GetHeaders(next, headersPerRequest)
+		if err != nil {
+			return nil, err
+		}
+		if len(headers) == 0 {
+			return nil, fmt.Errorf("node returned no headers at height %d", next)
+		}
+
+		for i := range headers {
+			header := &headers[i]
+
+			if header.Height != next {
+				return nil, fmt.Errorf("expected header at height %d, got %d", next, header.Height)
+			}
+			if header.CalculateHash() != header.Hash {
+				return nil, fmt.Errorf("invalid header hash at height %d", header.Height)
+			}
+			if header.Height > 0 {
+				if err := crypto.VerifyBlockHeader(header); err != nil {
+					return nil, fmt.Errorf("header at height %d: %v", header.Height, err)
+				}
+			}
+
+			if prev == nil {
+				if header.Hash != trusted {
+					return nil, fmt.Errorf("checkpoint mismatch at height %d: node has %s", header.Height, header.Hash)
+				}
+			} else if header.PrevHash != prev.Hash {
+				return nil, fmt.Errorf("broken link at height %d: prev hash does not match block %d", header.Height, prev.Height)
+			}
+
+			prev = header
+			next++
+			result.Headers++
+		}
+	}
+
+	result.TipHeight = prev.Height
+	result.TipHash = prev.Hash
+	return result, nil
 }
 
 // ListAccounts lists all saved accounts
@@ -298,12 +1536,41 @@ func (w *Wallet) ListAccounts() ([]AccountInfo, error) {
 
 		// Don't include private key in list
 		account.PrivateKey = ""
+		account.Crypto = nil
 		accounts = append(accounts, account)
 	}
 
 	return accounts, nil
 }
 
+// AccountNamesByAddress returns the names of all stored accounts with the given address
+func (w *Wallet) AccountNamesByAddress(address string) ([]string, error) {
+	addr, err := crypto.AddressFromString(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address: %v", err)
+	}
+
+	accounts, err := w.ListAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, account := range accounts {
+		stored, err := crypto.AddressFromString(account.Address)
+		if err == nil && stored == addr {
+			names = append(names, account.Name)
+		}
+	}
+
+	return names, nil
+}
+
+// accountPath returns the file an account is stored in
+func (w *Wallet) accountPath(name string) string {
+	return filepath.Join(w.dataDir, "accounts", name+".json")
+}
+
 // saveAccount saves account to file
 func (w *Wallet) saveAccount(account *AccountInfo) error {
 	accountsDir := filepath.Join(w.dataDir, "accounts")
@@ -311,19 +1578,29 @@ func (w *Wallet) saveAccount(account *AccountInfo) error {
 		return err
 	}
 
-	accountFile := filepath.Join(accountsDir, account.Name+".json")
-	data, err := json.MarshalIndent(account, "", "  ")
+	// With a passphrase set, the key only reaches disk encrypted
+	stored := *account
+	if w.passphrase != "" && stored.PrivateKey != "" {
+		enc, err := encryptKey(stored.PrivateKey, w.passphrase)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt private key: %v", err)
+		}
+		stored.Crypto = enc
+		stored.PrivateKey = ""
+	}
+
+	accountFile := w.accountPath(account.Name)
+	data, err := json.MarshalIndent(&stored, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(accountFile, data, 0600)
+	return fsutil.WriteFileAtomic(accountFile, data, 0600)
 }
 
 // loadAccount loads account from file
 func (w *Wallet) loadAccount(name string) (*AccountInfo, error) {
-	accountFile := filepath.Join(w.dataDir, "accounts", name+".json")
-	data, err := os.ReadFile(accountFile)
+	data, err := os.ReadFile(w.accountPath(name))
 	if err != nil {
 		return nil, fmt.Errorf("account not found: %s", name)
 	}
@@ -336,8 +1613,15 @@ func (w *Wallet) loadAccount(name string) (*AccountInfo, error) {
 	return &account, nil
 }
 
-// makeRPCCall makes an RPC call to the node
+// makeRPCCall makes an RPC call to the node. Connection failures and
+// gateway or overload responses (502, 503, 504) move on to the next endpoint,
+// and after every endpoint has failed the round is retried with exponential
+// backoff. Any other error response is the node's answer and is returned as is.
 func (w *Wallet) makeRPCCall(method string, params interface{}) (map[string]interface{}, error) {
+	if len(w.rpcURLs) == 0 {
+		return nil, fmt.Errorf("no RPC endpoint configured")
+	}
+
 	reqData := map[string]interface{}{
 		"method": method,
 		"params": params,
@@ -348,33 +1632,74 @@ func (w *Wallet) makeRPCCall(method string, params interface{}) (map[string]inte
 		return nil, fmt.Errorf("failed to marshal request: %v", err)
 	}
 
-	resp, err := http.Post(w.rpcURL, "application/json", strings.NewReader(string(reqBody)))
+	var lastErr error
+	backoff := rpcInitialBackoff
+	for attempt := 0; attempt <= w.rpcRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > rpcMaxBackoff {
+				backoff = rpcMaxBackoff
+			}
+		}
+
+		for _, url := range w.rpcURLs {
+			result, retry, err := w.postRPC(url, reqBody)
+			if err == nil {
+				return result, nil
+			}
+			if !retry {
+				return nil, err
+			}
+			lastErr = err
+		}
+	}
+
+	return nil, lastErr
+}
+
+// postRPC sends one request to one endpoint and reports whether a failure is
+// worth retrying elsewhere
+func (w *Wallet) postRPC(url string, reqBody []byte) (map[string]interface{}, bool, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create RPC request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+w.authToken)
+	}
+
+	resp, err := w.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to make RPC call: %v", err)
+		return nil, true, fmt.Errorf("failed to make RPC call: %v", err)
 	}
 	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %v", err)
+		return nil, true, fmt.Errorf("failed to read response: %v", err)
 	}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %v", err)
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return nil, true, fmt.Errorf("RPC error from %s: %s", url, strings.TrimSpace(string(respBody)))
+	default:
+		return nil, false, fmt.Errorf("RPC error: %s", string(respBody))
 	}
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("RPC error: %s", string(respBody))
+	var result map[string]interface{}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, false, fmt.Errorf("failed to parse response: %v", err)
 	}
 
-	return result, nil
+	return result, false, nil
 }
 
 // GetClaimableRewards gets the amount of claimable rewards for the current account
 func (w *Wallet) GetClaimableRewards() (int64, error) {
-	if w.keyPair == nil {
-		return 0, fmt.Errorf("no account loaded")
+	if err := w.requireKey(); err != nil {
+		return 0, err
 	}
 
 	// In a real implementation, this would query the blockchain for:
@@ -409,8 +1734,8 @@ func (w *Wallet) GetClaimableRewards() (int64, error) {
 
 // ClaimRewards claims available rewards
 func (w *Wallet) ClaimRewards(amount int64) (string, int64, error) {
-	if w.keyPair == nil {
-		return "", 0, fmt.Errorf("no account loaded")
+	if err := w.requireKey(); err != nil {
+		return "", 0, err
 	}
 
 	// Get claimable amount
@@ -439,15 +1764,10 @@ func (w *Wallet) ClaimRewards(amount int64) (string, int64, error) {
 		Timestamp: time.Now().Unix(),
 	}
 
-	// Calculate hash
-	tx.Hash = tx.CalculateHash()
-
 	// Sign transaction
-	signature, err := w.keyPair.Sign(tx.Hash[:])
-	if err != nil {
+	if err := w.keyPair.SignTransaction(&tx); err != nil {
 		return "", 0, fmt.Errorf("failed to sign transaction: %v", err)
 	}
-	tx.Signature = signature
 
 	// For demonstration, we'll simulate the transaction submission
 	// In a real implementation, this would submit to the blockchain
@@ -464,10 +1784,11 @@ func (w *Wallet) ClaimRewards(amount int64) (string, int64, error) {
 	return txHash, claimAmount, nil
 }
 
-// Stake stakes tokens for validation or delegation
-func (w *Wallet) Stake(amount int64, role string) (string, error) {
-	if w.keyPair == nil {
-		return "", fmt.Errorf("no account loaded")
+// Stake bonds tokens as a validator, or as a delegator backing the given
+// validator address
+func (w *Wallet) Stake(amount int64, role, validator string, fee int64) (string, error) {
+	if err := w.requireKey(); err != nil {
+		return "", err
 	}
 
 	if amount <= 0 {
@@ -479,120 +1800,154 @@ func (w *Wallet) Stake(amount int64, role string) (string, error) {
 		return "", fmt.Errorf("role must be 'validator' or 'delegator'")
 	}
 
-	// Check minimum stake requirements
-	minValidatorStake := int64(1000)
-	minDelegatorStake := int64(100)
+	// Check the chain's minimum stake against the stake after this one
+	info, err := w.GetChainInfo()
+	if err != nil {
+		return "", fmt.Errorf("failed to get staking parameters: %v", err)
+	}
+	total := amount
+	if existing, err := w.GetStake(w.address.String()); err == nil {
+		total += existing.Amount
+	}
+	if role == "validator" && total < info.MinValidatorStake {
+		return "", fmt.Errorf("minimum validator stake is %s tokens", types.FormatAmount(info.MinValidatorStake, info.Decimals))
+	}
+	if role == "delegator" && total < info.MinDelegatorStake {
+		return "", fmt.Errorf("minimum delegator stake is %s tokens", types.FormatAmount(info.MinDelegatorStake, info.Decimals))
+	}
 
-	if role == "validator" && amount < minValidatorStake {
-		return "", fmt.Errorf("minimum validator stake is %d tokens", minValidatorStake)
+	// Validators bond to themselves; delegators name the validator they back
+	target := w.address
+	if role == "delegator" {
+		if validator == "" {
+			return "", fmt.Errorf("delegators must specify a validator address")
+		}
+		addr, err := crypto.AddressFromString(validator)
+		if err != nil {
+			return "", fmt.Errorf("invalid validator address: %v", err)
+		}
+		target = addr
 	}
-	if role == "delegator" && amount < minDelegatorStake {
-		return "", fmt.Errorf("minimum delegator stake is %d tokens", minDelegatorStake)
+
+	nonce, err := w.nextNonce()
+	if err != nil {
+		return "", err
 	}
 
-	// Create stake transaction
-	tx := types.Transaction{
-		Type:      "stake",
-		From:      w.keyPair.GetAddress(),
-		To:        types.Address{}, // Zero address for staking
+	tx := &types.Transaction{
+		Type:      types.TxTypeStake,
+		From:      w.address,
+		To:        target,
 		Amount:    amount,
-		Nonce:     time.Now().Unix(),
+		Fee:       fee,
 		Timestamp: time.Now().Unix(),
+		Nonce:     nonce,
 	}
 
-	// Add staking metadata (in a real implementation, this would be in a separate field)
-	stakeData := map[string]interface{}{
-		"role":   role,
-		"amount": amount,
-		"validator_address": w.keyPair.GetAddress().String(),
+	if err := w.signForChain(tx); err != nil {
+		return "", err
 	}
 
-	// Calculate hash
-	tx.Hash = tx.CalculateHash()
+	return w.submitTransaction(tx)
+}
 
-	// Sign transaction
-	signature, err := w.keyPair.Sign(tx.Hash[:])
-	if err != nil {
-		return "", fmt.Errorf("failed to sign transaction: %v", err)
+// GetStake returns the on-chain stake of the given address
+func (w *Wallet) GetStake(address string) (*types.Stake, error) {
+	if _, err := crypto.AddressFromString(address); err != nil {
+		return nil, err
 	}
-	tx.Signature = signature
 
-	// For demonstration, we'll simulate the transaction submission
-	txHash := fmt.Sprintf("0x%x", tx.Hash[:8])
+	resp, err := w.makeRPCCall("get_stake", map[string]interface{}{
+		"address": address,
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	// Simulate successful staking
-	fmt.Printf("🔒 Stake transaction created successfully!\n")
-	fmt.Printf("Transaction details:\n")
-	fmt.Printf("  Type: %s\n", tx.Type)
-	fmt.Printf("  Role: %s\n", role)
-	fmt.Printf("  Amount: %d tokens\n", tx.Amount)
-	fmt.Printf("  Staker: %s\n", tx.From.String())
-	fmt.Printf("  Timestamp: %d\n", tx.Timestamp)
+	stakeData, err := json.Marshal(resp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stake response: %v", err)
+	}
 
-	// Log staking info
-	fmt.Printf("\n📊 Staking Information:\n")
-	if role == "validator" {
-		fmt.Printf("  • Minimum stake met: %d >= %d ✅\n", amount, minValidatorStake)
-		fmt.Printf("  • Validator node will join consensus\n")
-		fmt.Printf("  • Expected rewards: ~10%% APY + block rewards\n")
-	} else {
-		fmt.Printf("  • Minimum stake met: %d >= %d ✅\n", amount, minDelegatorStake)
-		fmt.Printf("  • Delegation to validator pool\n")
-		fmt.Printf("  • Expected rewards: ~8%% APY\n")
+	var stake types.Stake
+	if err := json.Unmarshal(stakeData, &stake); err != nil {
+		return nil, fmt.Errorf("invalid stake response: %v", err)
 	}
 
-	// Store staking info (in a real implementation, this would be on-chain)
-	_ = stakeData
+	return &stake, nil
+}
 
-	return txHash, nil
+// Delegations lists the stake delegated to a validator
+type Delegations struct {
+	Validator   string        `json:"validator"`
+	Commission  int64         `json:"commission"`
+	Delegated   int64         `json:"delegated"`
+	Delegations []types.Stake `json:"delegations"`
 }
 
-// Unstake unstakes all staked tokens
-func (w *Wallet) Unstake() (string, int64, error) {
-	if w.keyPair == nil {
-		return "", 0, fmt.Errorf("no account loaded")
+// GetDelegations returns the delegations backing the given validator
+func (w *Wallet) GetDelegations(validator string) (*Delegations, error) {
+	if _, err := crypto.AddressFromString(validator); err != nil {
+		return nil, err
+	}
+
+	resp, err := w.makeRPCCall("get_delegations", map[string]interface{}{
+		"validator": validator,
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// In a real implementation, this would query the blockchain for staked amount
-	// For demonstration, we'll use a mock amount
-	stakedAmount := int64(1000)
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid delegations response: %v", err)
+	}
 
-	if stakedAmount <= 0 {
-		return "", 0, fmt.Errorf("no staked tokens found")
+	var delegations Delegations
+	if err := json.Unmarshal(data, &delegations); err != nil {
+		return nil, fmt.Errorf("invalid delegations response: %v", err)
 	}
 
-	// Create unstake transaction
-	tx := types.Transaction{
-		Type:      "unstake",
-		From:      w.keyPair.GetAddress(),
-		To:        w.keyPair.GetAddress(),
-		Amount:    stakedAmount,
-		Nonce:     time.Now().Unix(),
-		Timestamp: time.Now().Unix(),
+	return &delegations, nil
+}
+
+// Unstake returns all staked tokens of the current account to its balance
+func (w *Wallet) Unstake(fee int64) (string, int64, error) {
+	if err := w.requireKey(); err != nil {
+		return "", 0, err
 	}
 
-	// Calculate hash
-	tx.Hash = tx.CalculateHash()
+	stake, err := w.GetStake(w.address.String())
+	if err != nil {
+		return "", 0, fmt.Errorf("no staked tokens found: %v", err)
+	}
+	if stake.Amount == 0 {
+		return "", 0, fmt.Errorf("no staked tokens found: %s tokens are already unbonding", w.FormatAmount(stake.Unbonding))
+	}
 
-	// Sign transaction
-	signature, err := w.keyPair.Sign(tx.Hash[:])
+	nonce, err := w.nextNonce()
 	if err != nil {
-		return "", 0, fmt.Errorf("failed to sign transaction: %v", err)
+		return "", 0, err
 	}
-	tx.Signature = signature
 
-	// For demonstration, we'll simulate the transaction submission
-	txHash := fmt.Sprintf("0x%x", tx.Hash[:8])
+	tx := &types.Transaction{
+		Type:      types.TxTypeUnstake,
+		From:      w.address,
+		To:        stake.Validator,
+		Amount:    stake.Amount,
+		Fee:       fee,
+		Timestamp: time.Now().Unix(),
+		Nonce:     nonce,
+	}
 
-	// Simulate successful unstaking
-	fmt.Printf("🔓 Unstake transaction created successfully!\n")
-	fmt.Printf("Transaction details:\n")
-	fmt.Printf("  Type: %s\n", tx.Type)
-	fmt.Printf("  Amount: %d tokens\n", tx.Amount)
-	fmt.Printf("  From: %s\n", tx.From.String())
-	fmt.Printf("  Timestamp: %d\n", tx.Timestamp)
-	fmt.Printf("\n⏰ Unbonding period: 7 days\n")
-	fmt.Printf("💰 Tokens will be available for withdrawal after unbonding\n")
+	if err := w.signForChain(tx); err != nil {
+		return "", 0, err
+	}
+
+	txHash, err := w.submitTransaction(tx)
+	if err != nil {
+		return "", 0, err
+	}
 
-	return txHash, stakedAmount, nil
+	return txHash, stake.Amount, nil
 }
@@ -0,0 +1,657 @@
+package wallet
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"agent-chain/pkg/crypto"
+	"agent-chain/pkg/types"
+)
+
+func TestGetHistoryPagesThroughTransactions(t *testing.T) {
+	const total, pageCap = 5, 2
+
+	kp, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+
+	// The fake node caps pages like the real one does
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string `json:"method"`
+			Params struct {
+				Offset int `json:"offset"`
+				Limit  int `json:"limit"`
+			} `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Method != "get_transactions" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		limit := pageCap
+		if req.Params.Limit > 0 && req.Params.Limit < limit {
+			limit = req.Params.Limit
+		}
+		txs := []map[string]interface{}{}
+		for i := req.Params.Offset; i < total && len(txs) < limit; i++ {
+			txs = append(txs, map[string]interface{}{"block_height": total - i})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"total":        total,
+			"offset":       req.Params.Offset,
+			"transactions": txs,
+		})
+	}))
+	defer node.Close()
+
+	w := NewWallet(t.TempDir(), node.URL)
+	address := kp.GetAddress().String()
+
+	tests := []struct {
+		name          string
+		offset, limit int
+		want          []int64
+	}{
+		{"everything", 0, 0, []int64{5, 4, 3, 2, 1}},
+		{"limited", 0, 3, []int64{5, 4, 3}},
+		{"offset", 3, 0, []int64{2, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, gotTotal, err := w.GetHistory(address, "", tt.offset, tt.limit)
+			if err != nil {
+				t.Fatalf("GetHistory: %v", err)
+			}
+			if gotTotal != total {
+				t.Errorf("total = %d, want %d", gotTotal, total)
+			}
+			if len(entries) != len(tt.want) {
+				t.Fatalf("got %d entries, want %d", len(entries), len(tt.want))
+			}
+			for i, entry := range entries {
+				if entry.BlockHeight != tt.want[i] {
+					t.Errorf("entry %d at height %d, want %d", i, entry.BlockHeight, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// The RFC 6979 P-256 test key, whose address is fixed
+const (
+	testKeyHex  = "c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721"
+	testAddress = "0x554cce7c070057c4e3298cb93577de687eece659"
+)
+
+func TestVerifyMessageVector(t *testing.T) {
+	// Signed by testKeyHex over "hello agent chain"
+	const signature = "60fed4ba255a9d31c961eb74c6356d68c049b8923b61fa6ce669622e60f29fb6" +
+		"7903fe1008b8bc99a41ae9e95628bc64f2f1b20c2d7e9f5177a3c294d4462299" +
+		"98c9901d431a185cadde60d86e842da963325612c02f73ca69f5210152a845dd" +
+		"1425f32195143494f47b828820ca960f105f58ac550bd0d02227fa9f71b70d39"
+
+	if err := VerifyMessage(testAddress, "hello agent chain", signature); err != nil {
+		t.Fatalf("known signature rejected: %v", err)
+	}
+	if err := VerifyMessage(testAddress, "hello agent chain!", signature); err == nil {
+		t.Error("signature verified for a different message")
+	}
+	other, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyMessage(other.GetAddress().String(), "hello agent chain", signature); err == nil {
+		t.Error("signature verified for a different address")
+	}
+	if err := VerifyMessage(testAddress, "hello agent chain", signature[:len(signature)-2]); err == nil {
+		t.Error("truncated signature verified")
+	}
+}
+
+func TestSignMessageRoundTrip(t *testing.T) {
+	w := newTestWallet(t, "http://127.0.0.1:0")
+
+	signature, err := w.SignMessage("pay bob 10")
+	if err != nil {
+		t.Fatalf("SignMessage: %v", err)
+	}
+	if err := VerifyMessage(testAddress, "pay bob 10", signature); err != nil {
+		t.Errorf("own signature rejected: %v", err)
+	}
+}
+
+// newFakeNode serves RPC calls with handle, which returns the result for a
+// method and its raw params
+func newFakeNode(t *testing.T, handle func(method string, params json.RawMessage) interface{}) *httptest.Server {
+	t.Helper()
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		result := handle(req.Method, req.Params)
+		if result == nil {
+			http.Error(w, "unexpected method "+req.Method, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(result)
+	}))
+	t.Cleanup(node.Close)
+	return node
+}
+
+// newTestWallet returns a wallet on rpcURL with the test key loaded
+func newTestWallet(t *testing.T, rpcURL string) *Wallet {
+	t.Helper()
+	w := NewWallet(t.TempDir(), rpcURL)
+	if _, err := w.ImportAccount("alice", testKeyHex, false); err != nil {
+		t.Fatalf("ImportAccount: %v", err)
+	}
+	if err := w.LoadAccount("alice"); err != nil {
+		t.Fatalf("LoadAccount: %v", err)
+	}
+	return w
+}
+
+func TestSendBatch(t *testing.T) {
+	const startNonce = 7
+	bob, carol := "0x"+strings.Repeat("b", 40), "0x"+strings.Repeat("c", 40)
+
+	var submitted []*types.Transaction
+	node := newFakeNode(t, func(method string, params json.RawMessage) interface{} {
+		switch method {
+		case "get_balance":
+			return map[string]interface{}{"balance": 1000, "nonce": startNonce, "pending_nonce": startNonce}
+		case "get_height":
+			return map[string]interface{}{"height": 10}
+		case "get_chain_info":
+			return map[string]interface{}{"chain_id": 1}
+		case "submit_transactions":
+			var req struct {
+				Transactions []*types.Transaction `json:"transactions"`
+			}
+			if err := json.Unmarshal(params, &req); err != nil {
+				return nil
+			}
+			// The node refuses anything over 100
+			results := make([]TxSubmitResult, len(req.Transactions))
+			for i, tx := range req.Transactions {
+				submitted = append(submitted, tx)
+				results[i] = TxSubmitResult{Index: i, TxHash: "0x" + tx.Hash.String(), Accepted: tx.Amount <= 100}
+				if !results[i].Accepted {
+					results[i].ErrorCode = "insufficient_balance"
+					results[i].ErrorMessage = "insufficient balance"
+				}
+			}
+			return map[string]interface{}{"results": results}
+		}
+		return nil
+	})
+	w := newTestWallet(t, node.URL)
+
+	results, err := w.SendBatch([]Payment{
+		{To: bob, Amount: 10, Fee: 1},
+		{To: "not-an-address", Amount: 10, Fee: 1},
+		{To: carol, Amount: 500, Fee: 1},
+		{To: carol, Amount: 20, Fee: 1},
+	})
+	if err != nil {
+		t.Fatalf("SendBatch: %v", err)
+	}
+
+	wantFailed := []bool{false, true, true, false}
+	for i, result := range results {
+		if failed := result.Err != nil; failed != wantFailed[i] {
+			t.Errorf("payment %d failed = %v (%v), want %v", i, failed, result.Err, wantFailed[i])
+		}
+	}
+
+	// The malformed row is never signed, so it does not use up a nonce
+	if len(submitted) != 3 {
+		t.Fatalf("submitted %d transactions, want 3", len(submitted))
+	}
+	for i, tx := range submitted {
+		if want := int64(startNonce + i); tx.Nonce != want {
+			t.Errorf("transaction %d has nonce %d, want %d", i, tx.Nonce, want)
+		}
+	}
+}
+
+func TestRPCFailover(t *testing.T) {
+	healthy := newFakeNode(t, func(method string, params json.RawMessage) interface{} {
+		return map[string]interface{}{"height": 42}
+	})
+
+	var overloadedCalls atomic.Int32
+	overloaded := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		overloadedCalls.Add(1)
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer overloaded.Close()
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	var flakyCalls atomic.Int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if flakyCalls.Add(1) == 1 {
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"height": 42})
+	}))
+	defer flaky.Close()
+
+	refusing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unknown method", http.StatusBadRequest)
+	}))
+	defer refusing.Close()
+
+	tests := []struct {
+		name    string
+		urls    []string
+		wantErr bool
+	}{
+		{"unreachable first endpoint", []string{down.URL, healthy.URL}, false},
+		{"overloaded first endpoint", []string{overloaded.URL, healthy.URL}, false},
+		{"recovers on retry", []string{flaky.URL}, false},
+		{"every endpoint down", []string{down.URL, overloaded.URL}, true},
+		{"error response is final", []string{refusing.URL, healthy.URL}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWallet(t.TempDir(), strings.Join(tt.urls, ","))
+			w.SetRPCRetry(1, time.Second)
+
+			height, err := w.GetHeight()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("GetHeight = %d, want an error", height)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetHeight: %v", err)
+			}
+			if height != 42 {
+				t.Errorf("height = %d, want 42", height)
+			}
+		})
+	}
+
+	// Once before the healthy endpoint took over, then once in each of the
+	// two rounds when every endpoint was down
+	if got := overloadedCalls.Load(); got != 3 {
+		t.Errorf("overloaded endpoint called %d times, want 3", got)
+	}
+}
+
+func TestTransactionsSignedForNodeChain(t *testing.T) {
+	const chainID = 99
+
+	var submitted types.Transaction
+	node := newFakeNode(t, func(method string, params json.RawMessage) interface{} {
+		switch method {
+		case "get_balance":
+			return map[string]interface{}{"balance": 1000, "nonce": 0}
+		case "get_height":
+			return map[string]interface{}{"height": 10}
+		case "get_chain_info":
+			return map[string]interface{}{"chain_id": chainID}
+		case "submit_transaction":
+			var req struct {
+				Transaction types.Transaction `json:"transaction"`
+			}
+			if err := json.Unmarshal(params, &req); err != nil {
+				return nil
+			}
+			submitted = req.Transaction
+			return map[string]interface{}{"tx_hash": "0x" + submitted.Hash.String()}
+		}
+		return nil
+	})
+	w := newTestWallet(t, node.URL)
+
+	if _, err := w.SendTransaction("0x"+strings.Repeat("b", 40), 10, 1); err != nil {
+		t.Fatalf("SendTransaction: %v", err)
+	}
+	if submitted.ChainID != chainID {
+		t.Errorf("transaction signed for chain %d, want %d", submitted.ChainID, chainID)
+	}
+	if err := crypto.VerifyTransaction(&submitted); err != nil {
+		t.Errorf("VerifyTransaction: %v", err)
+	}
+}
+
+func TestSubmitPatchChecksCodeHash(t *testing.T) {
+	code := []byte("func Add(a, b int) int { return a + b }\n")
+	sum := sha256.Sum256(code)
+	codeHash := hex.EncodeToString(sum[:])
+
+	patchFile := filepath.Join(t.TempDir(), "add.go")
+	if err := os.WriteFile(patchFile, code, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expected string
+		err      bool
+	}{
+		{"no expected hash", "", false},
+		{"matching hash", codeHash, false},
+		{"matching hash with prefix and upper case", "0x" + strings.ToUpper(codeHash), false},
+		{"mismatching hash", strings.Repeat("0", 64), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var submitted *types.Transaction
+			node := newFakeNode(t, func(method string, params json.RawMessage) interface{} {
+				switch method {
+				case "get_balance":
+					return map[string]interface{}{"balance": 1000, "nonce": 0}
+				case "get_height":
+					return map[string]interface{}{"height": 10}
+				case "get_chain_info":
+					return map[string]interface{}{"chain_id": 1}
+				case "submit_transaction":
+					var req struct {
+						Transaction types.Transaction `json:"transaction"`
+					}
+					if err := json.Unmarshal(params, &req); err != nil {
+						return nil
+					}
+					submitted = &req.Transaction
+					return map[string]interface{}{"tx_hash": "0x" + submitted.Hash.String()}
+				}
+				return nil
+			})
+			w := newTestWallet(t, node.URL)
+
+			_, err := w.SubmitPatch(patchFile, tt.expected, types.DefaultPatchGasLimit)
+			if tt.err {
+				if err == nil || !strings.Contains(err.Error(), "code hash mismatch") {
+					t.Fatalf("SubmitPatch error = %v, want a code hash mismatch", err)
+				}
+				if submitted != nil {
+					t.Error("patch with a mismatching hash was submitted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SubmitPatch: %v", err)
+			}
+			if submitted == nil || submitted.PatchSet == nil {
+				t.Fatal("no patch was submitted")
+			}
+			if submitted.PatchSet.CodeHash != codeHash {
+				t.Errorf("submitted code hash = %q, want %q", submitted.PatchSet.CodeHash, codeHash)
+			}
+		})
+	}
+}
+
+func TestStakeUsesChainMinimums(t *testing.T) {
+	validator := "0x" + strings.Repeat("a", 40)
+
+	tests := []struct {
+		name     string
+		amount   int64
+		role     string
+		existing int64
+		err      string
+	}{
+		{"validator below minimum", 499, "validator", 0, "minimum validator stake is 500"},
+		{"validator at minimum", 500, "validator", 0, ""},
+		{"validator top-up still short", 100, "validator", 300, "minimum validator stake is 500"},
+		{"delegator below minimum", 49, "delegator", 0, "minimum delegator stake is 50"},
+		{"delegator top-up reaches minimum", 20, "delegator", 40, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var submitted *types.Transaction
+			node := newFakeNode(t, func(method string, params json.RawMessage) interface{} {
+				switch method {
+				case "get_balance":
+					return map[string]interface{}{"balance": 1000, "nonce": 0}
+				case "get_height":
+					return map[string]interface{}{"height": 10}
+				case "get_chain_info":
+					return map[string]interface{}{"chain_id": 1, "min_validator_stake": 500, "min_delegator_stake": 50}
+				case "get_stake":
+					if tt.existing == 0 {
+						return nil
+					}
+					return &types.Stake{Amount: tt.existing}
+				case "submit_transaction":
+					var req struct {
+						Transaction types.Transaction `json:"transaction"`
+					}
+					if err := json.Unmarshal(params, &req); err != nil {
+						return nil
+					}
+					submitted = &req.Transaction
+					return map[string]interface{}{"tx_hash": "0x" + submitted.Hash.String()}
+				}
+				return nil
+			})
+			w := newTestWallet(t, node.URL)
+
+			_, err := w.Stake(tt.amount, tt.role, validator, 1)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Stake error = %v, want %q", err, tt.err)
+				}
+				if submitted != nil {
+					t.Error("stake below the minimum was submitted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Stake: %v", err)
+			}
+			if submitted == nil || submitted.Type != types.TxTypeStake || submitted.Amount != tt.amount {
+				t.Fatalf("submitted %+v, want a stake of %d", submitted, tt.amount)
+			}
+		})
+	}
+}
+
+func TestRenameAndDeleteAccounts(t *testing.T) {
+	w := NewWallet(t.TempDir(), "http://127.0.0.1:0")
+	alice, err := w.CreateAccount("alice")
+	if err != nil {
+		t.Fatalf("CreateAccount: %v", err)
+	}
+	if _, err := w.CreateAccount("bob"); err != nil {
+		t.Fatalf("CreateAccount: %v", err)
+	}
+
+	renames := []struct {
+		name     string
+		from, to string
+	}{
+		{"name taken", "alice", "bob"},
+		{"same name", "alice", "alice"},
+		{"no such account", "dave", "erin"},
+		{"path in name", "alice", "../carol"},
+	}
+	for _, tt := range renames {
+		if err := w.RenameAccount(tt.from, tt.to); err == nil {
+			t.Errorf("%s: renaming %s to %s succeeded", tt.name, tt.from, tt.to)
+		}
+	}
+
+	if err := w.RenameAccount("alice", "carol"); err != nil {
+		t.Fatalf("RenameAccount: %v", err)
+	}
+	if err := w.LoadAccount("alice"); err == nil {
+		t.Error("old name still loads")
+	}
+	if err := w.LoadAccount("carol"); err != nil {
+		t.Fatalf("LoadAccount: %v", err)
+	}
+	if w.GetAddress().String() != alice.Address {
+		t.Errorf("renamed account has address %s, want %s", w.GetAddress(), alice.Address)
+	}
+
+	if err := w.DeleteAccount("dave", false); err == nil {
+		t.Error("deleted an account that does not exist")
+	}
+	if err := w.DeleteAccount("bob", false); err != nil {
+		t.Fatalf("DeleteAccount: %v", err)
+	}
+	if err := w.DeleteAccount("carol", false); err != ErrLastAccount {
+		t.Errorf("deleting the last account: got %v, want ErrLastAccount", err)
+	}
+	if err := w.DeleteAccount("carol", true); err != nil {
+		t.Fatalf("DeleteAccount with allowEmpty: %v", err)
+	}
+	if accounts, err := w.ListAccounts(); err != nil || len(accounts) != 0 {
+		t.Errorf("ListAccounts = %v, %v; want an empty wallet", accounts, err)
+	}
+}
+
+func TestGetAllBalances(t *testing.T) {
+	failing := "0x" + strings.Repeat("f", 40)
+	balances := map[string]int64{}
+	node := newFakeNode(t, func(method string, params json.RawMessage) interface{} {
+		var req struct {
+			Address string `json:"address"`
+		}
+		if method != "get_balance" || json.Unmarshal(params, &req) != nil || req.Address == failing {
+			return nil
+		}
+		return map[string]interface{}{"balance": balances[req.Address]}
+	})
+
+	w := NewWallet(t.TempDir(), node.URL)
+	for i, name := range []string{"alice", "bob", "carol"} {
+		account, err := w.CreateAccount(name)
+		if err != nil {
+			t.Fatalf("CreateAccount: %v", err)
+		}
+		balances[account.Address] = int64(100 * (i + 1))
+	}
+	if _, err := w.WatchAccount("broken", failing); err != nil {
+		t.Fatalf("WatchAccount: %v", err)
+	}
+
+	got, err := w.GetAllBalances()
+	if err != nil {
+		t.Fatalf("GetAllBalances: %v", err)
+	}
+	if len(got) != 4 {
+		t.Fatalf("got %d rows, want 4", len(got))
+	}
+	for _, row := range got {
+		if row.Address == failing {
+			if row.Err == nil {
+				t.Errorf("%s: no error for the failing query", row.Name)
+			}
+			continue
+		}
+		if row.Err != nil {
+			t.Errorf("%s: %v", row.Name, row.Err)
+		}
+		if row.Balance != balances[row.Address] {
+			t.Errorf("%s: balance %d, want %d", row.Name, row.Balance, balances[row.Address])
+		}
+	}
+}
+
+func TestWatchOnlyAccountQueriesButCannotSign(t *testing.T) {
+	watched := "0x" + strings.Repeat("a", 40)
+
+	var queried string
+	var signed int32
+	node := newFakeNode(t, func(method string, params json.RawMessage) interface{} {
+		switch method {
+		case "get_balance":
+			var req struct {
+				Address string `json:"address"`
+			}
+			json.Unmarshal(params, &req)
+			queried = req.Address
+			return map[string]interface{}{"balance": 500, "nonce": 0}
+		case "submit_transaction", "submit_transactions":
+			atomic.AddInt32(&signed, 1)
+		}
+		return nil
+	})
+
+	w := NewWallet(t.TempDir(), node.URL)
+	if _, err := w.ImportAccount("alice", testKeyHex, false); err != nil {
+		t.Fatalf("ImportAccount: %v", err)
+	}
+	if _, err := w.WatchAccount("alice", watched); err == nil {
+		t.Error("watch account replaced an existing account")
+	}
+	if _, err := w.WatchAccount("audit", watched); err != nil {
+		t.Fatalf("WatchAccount: %v", err)
+	}
+	if err := w.LoadAccount("audit"); err != nil {
+		t.Fatalf("LoadAccount: %v", err)
+	}
+
+	if got := w.GetAddress().String(); got != watched {
+		t.Errorf("address = %s, want %s", got, watched)
+	}
+	balance, err := w.GetBalance("")
+	if err != nil {
+		t.Fatalf("GetBalance: %v", err)
+	}
+	if balance != 500 || queried != watched {
+		t.Errorf("balance %d for %s, want 500 for the watched address", balance, queried)
+	}
+
+	signers := map[string]func() error{
+		"send": func() error {
+			_, err := w.SendTransaction("0x"+strings.Repeat("b", 40), 10, 1)
+			return err
+		},
+		"stake": func() error {
+			_, err := w.Stake(100, "validator", "", 1)
+			return err
+		},
+		"claim": func() error {
+			_, _, err := w.ClaimRewards(10)
+			return err
+		},
+	}
+	for name, sign := range signers {
+		if err := sign(); !errors.Is(err, ErrWatchOnly) {
+			t.Errorf("%s: error = %v, want ErrWatchOnly", name, err)
+		}
+	}
+	if n := atomic.LoadInt32(&signed); n != 0 {
+		t.Errorf("%d submissions reached the node", n)
+	}
+
+	accounts, err := w.ListAccounts()
+	if err != nil {
+		t.Fatalf("ListAccounts: %v", err)
+	}
+	for _, account := range accounts {
+		if account.WatchOnly != (account.Name == "audit") {
+			t.Errorf("account %s listed with watch-only %v", account.Name, account.WatchOnly)
+		}
+	}
+}